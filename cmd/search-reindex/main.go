@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"shop/internal/bootstrap"
+)
+
+// search-reindex rebuilds the products search index from the database, shop
+// by shop, and swaps it in atomically. Searches keep using the old index
+// until then; interrupting the rebuild leaves the live index untouched.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := bootstrap.RunSearchReindex(ctx); err != nil {
+		log.Fatalf("search reindex failed: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"shop/internal/bootstrap"
+)
+
+// storage-migrate copies every object from storage.migration.source to the
+// provider in storage.type. Run it while the app serves through the mirror;
+// interrupting it is safe, -resume continues after the last checkpoint.
+func main() {
+	resume := flag.Uint("resume", 0, "id of the migration to resume, 0 starts a new one")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := bootstrap.RunStorageMigration(ctx, *resume); err != nil {
+		log.Fatalf("storage migration failed: %v", err)
+	}
+}
@@ -9,6 +9,7 @@ CREATE TABLE `platform_users`
     `password_hash` varchar(255) NOT NULL COMMENT '密码哈希',
     `real_name`     varchar(100) DEFAULT NULL COMMENT '真实姓名',
     `is_active`     tinyint(1) DEFAULT '1' COMMENT '是否激活',
+    `is_platform_admin` tinyint(1) DEFAULT '0' COMMENT '是否平台管理员',
     `created_at`    datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
     `updated_at`    datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
     `deleted_at`    datetime(3) DEFAULT NULL,
@@ -220,16 +221,18 @@ CREATE TABLE `blog_posts`
     `id`             bigint(20) unsigned NOT NULL AUTO_INCREMENT,
     `shop_id`        bigint(20) unsigned NOT NULL,
     `title`          varchar(255) NOT NULL,
+    `slug`           varchar(255) NOT NULL COMMENT 'URL别名(店铺内唯一)',
     `author`         varchar(100) DEFAULT NULL,
     `content_html`   longtext,
     `summary`        text COMMENT '摘要',
     `featured_image` varchar(255) DEFAULT NULL COMMENT '封面图',
-    `status`         varchar(20)  DEFAULT 'published' COMMENT 'published, draft',
+    `status`         varchar(20)  DEFAULT 'published' COMMENT 'published, scheduled, draft',
     `published_at`   datetime(3) DEFAULT NULL,
     `created_at`     datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
     `updated_at`     datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
     `deleted_at`     datetime(3) DEFAULT NULL,
     PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_shop_slug` (`shop_id`, `slug`) USING BTREE,
     KEY              `idx_shop_status` (`shop_id`, `status`) USING BTREE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='博客推文表';
 
@@ -240,6 +243,7 @@ CREATE TABLE `themes`
     `shop_id`     bigint(20) unsigned NOT NULL,
     `name`        varchar(100) DEFAULT NULL COMMENT '模板名',
     `source_path` varchar(255) DEFAULT NULL COMMENT '模板文件S3/本地路径',
+    `version`     int(11) DEFAULT '0' COMMENT '当前使用的版本号',
     `config_data` json         DEFAULT NULL COMMENT '模板颜色、布局等JSON配置',
     `is_active`   tinyint(1) DEFAULT '0' COMMENT '当前激活模板',
     `created_at`  datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
@@ -271,10 +275,11 @@ CREATE TABLE `orders`
     `total_tax`          decimal(12, 2) DEFAULT '0.00' COMMENT '税费总额',
     `total_discounts`    decimal(12, 2) DEFAULT '0.00' COMMENT '折扣总额',
     `shipping_price`     decimal(12, 2) DEFAULT '0.00' COMMENT '运费',
+    `discount_code`      varchar(50)    DEFAULT NULL COMMENT '使用的优惠码(按码统计报表)',
 
     -- 3. 状态管理
     `financial_status`   varchar(20)    DEFAULT 'pending' COMMENT 'paid, refunded, voided',
-    `fulfillment_status` varchar(20)    DEFAULT 'unfulfilled' COMMENT 'shipped, partial',
+    `fulfillment_status` varchar(20)    DEFAULT 'unfulfilled' COMMENT 'shipped, partial, on_hold',
     `cancel_reason`      varchar(50)    DEFAULT NULL COMMENT 'customer, fraud, inventory, other',
 
     -- 4. 地址快照 (核心补充：不要关联ID，直接存JSON)
@@ -380,4 +385,244 @@ CREATE TABLE `shop_currencies`
     PRIMARY KEY (`id`) USING BTREE,
     UNIQUE KEY `uk_shop_currency` (`shop_id`, `currency_code`) USING BTREE,
     KEY             `idx_shop_id` (`shop_id`) USING BTREE
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='店铺货币配置表';
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='店铺货币配置表';
+-- 22. 买家地址簿
+CREATE TABLE `customer_addresses`
+(
+    `id`          bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`     bigint(20) unsigned NOT NULL,
+    `customer_id` bigint(20) unsigned NOT NULL,
+    `first_name`  varchar(100) DEFAULT NULL,
+    `last_name`   varchar(100) DEFAULT NULL,
+    `company`     varchar(255) DEFAULT NULL,
+    `address1`    varchar(255) NOT NULL,
+    `address2`    varchar(255) DEFAULT NULL,
+    `city`        varchar(100) DEFAULT NULL,
+    `province`    varchar(100) DEFAULT NULL,
+    `country`     varchar(100) NOT NULL,
+    `zip`         varchar(20)  DEFAULT NULL,
+    `phone`       varchar(50)  DEFAULT NULL,
+    `is_default`  tinyint(1) DEFAULT '0' COMMENT '默认收货地址',
+    `created_at`  datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
+    `updated_at`  datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    KEY           `idx_customer_id` (`customer_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='买家地址簿';
+
+-- 23. 模板版本表 (每次上传生成一个不可变版本，支持回滚)
+CREATE TABLE `theme_versions`
+(
+    `id`          bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`     bigint(20) unsigned NOT NULL,
+    `theme_id`    bigint(20) unsigned NOT NULL,
+    `version`     int(11) NOT NULL COMMENT '版本号(主题内递增)',
+    `source_path` varchar(255) NOT NULL COMMENT '模板压缩包存储Key',
+    `manifest`    json DEFAULT NULL COMMENT 'manifest.json 内容(含配置项Schema)',
+    `config_data` json DEFAULT NULL COMMENT '该版本最近保存的配置值(回滚时恢复)',
+    `created_at`  datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_theme_version` (`theme_id`, `version`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='模板版本表';
+
+-- 24. 订单风控评估结果
+CREATE TABLE `order_risks`
+(
+    `id`         bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`    bigint(20) unsigned NOT NULL,
+    `order_id`   bigint(20) unsigned NOT NULL,
+    `score`      int(11) NOT NULL COMMENT '风险分(0-100)',
+    `level`      varchar(20) NOT NULL COMMENT 'low, medium, high',
+    `action`     varchar(20) NOT NULL COMMENT 'none, tagged, held',
+    `reasons`    json DEFAULT NULL COMMENT '命中规则及说明',
+    `created_at` datetime(3) DEFAULT CURRENT_TIMESTAMP (3),
+    `updated_at` datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_order` (`order_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='订单风控评估表';
+
+-- 25. 店铺风控规则配置
+CREATE TABLE `risk_settings`
+(
+    `id`         bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`    bigint(20) unsigned NOT NULL,
+    `rules`      json DEFAULT NULL COMMENT '规则开关、阈值与分值',
+    `updated_at` datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_shop` (`shop_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='店铺风控规则表';
+
+-- 26. 报表：店铺每日销售汇总 (由定时任务按 idx_created 聚合 orders)
+CREATE TABLE `report_daily_sales`
+(
+    `id`                bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`           bigint(20) unsigned NOT NULL,
+    `date`              date NOT NULL,
+    `orders`            bigint(20) NOT NULL DEFAULT '0' COMMENT '订单数(不含作废)',
+    `paid_orders`       bigint(20) NOT NULL DEFAULT '0',
+    `gross_sales`       decimal(14, 2) NOT NULL DEFAULT '0.00',
+    `discounts`         decimal(14, 2) NOT NULL DEFAULT '0.00',
+    `discounted_orders` bigint(20) NOT NULL DEFAULT '0' COMMENT '使用折扣的订单数',
+    `refunds`           decimal(14, 2) NOT NULL DEFAULT '0.00',
+    `refund_count`      bigint(20) NOT NULL DEFAULT '0',
+    `tax`               decimal(14, 2) NOT NULL DEFAULT '0.00',
+    `shipping`          decimal(14, 2) NOT NULL DEFAULT '0.00',
+    `net_sales`         decimal(14, 2) NOT NULL DEFAULT '0.00' COMMENT '销售额 - 退款',
+    `carts_created`     bigint(20) NOT NULL DEFAULT '0' COMMENT '新建购物车数(转化率分母)',
+    `updated_at`        datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_shop_date` (`shop_id`, `date`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='每日销售汇总表';
+
+-- 27. 报表：商品/规格每日销量
+CREATE TABLE `report_daily_products`
+(
+    `id`         bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`    bigint(20) unsigned NOT NULL,
+    `date`       date NOT NULL,
+    `product_id` bigint(20) unsigned DEFAULT NULL,
+    `variant_id` bigint(20) unsigned DEFAULT NULL,
+    `name`       varchar(255)   DEFAULT NULL,
+    `sku`        varchar(100)   DEFAULT NULL,
+    `quantity`   bigint(20) NOT NULL DEFAULT '0',
+    `sales`      decimal(14, 2) NOT NULL DEFAULT '0.00',
+    PRIMARY KEY (`id`) USING BTREE,
+    KEY          `idx_shop_date` (`shop_id`, `date`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='商品每日销量汇总表';
+
+-- 28. 分片上传会话 (用于断点续传、取消，定时任务清理过期会话)
+CREATE TABLE `upload_sessions`
+(
+    `id`            bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`       bigint(20) unsigned NOT NULL,
+    `upload_id`     varchar(191) NOT NULL COMMENT '存储服务返回的 uploadID',
+    `kind`          varchar(20)  NOT NULL DEFAULT 'multipart' COMMENT 'multipart 分片上传, presigned 直传待确认',
+    `uploader_id`   bigint(20) unsigned NOT NULL DEFAULT '0',
+    `key`           varchar(512) NOT NULL COMMENT '最终对象 key',
+    `filename`      varchar(255) DEFAULT NULL COMMENT '原始文件名',
+    `expected_size` bigint(20) NOT NULL DEFAULT '0' COMMENT '客户端声明的文件大小, 0 表示未声明',
+    `content_type`  varchar(100) DEFAULT NULL COMMENT '根据第一个分片内容识别',
+    `checksum`      varchar(64)  DEFAULT NULL COMMENT '合并后对象的校验值 (md5(各分片md5)-分片数)',
+    `status`        varchar(20)  NOT NULL COMMENT 'uploading, completed, aborted, expired',
+    `expires_at`    datetime(3) NOT NULL,
+    `created_at`    datetime(3) DEFAULT NULL,
+    `updated_at`    datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_upload_id` (`upload_id`) USING BTREE,
+    KEY             `idx_shop_id` (`shop_id`) USING BTREE,
+    KEY             `idx_status_expires` (`status`, `expires_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='分片上传会话表';
+
+-- 29. 文件/媒体库 (每次上传、分片合并后登记)
+CREATE TABLE `files`
+(
+    `id`           bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`      bigint(20) unsigned NOT NULL,
+    `uploader_id`  bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '上传的后台用户, 0 表示未知',
+    `customer_id`  bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '上传的买家, 0 表示后台上传',
+    `key`          varchar(255) NOT NULL COMMENT '存储对象 key',
+    `url`          varchar(512) NOT NULL COMMENT '公开访问地址, 私有文件为空',
+    `filename`     varchar(255) DEFAULT NULL COMMENT '原始文件名',
+    `folder`       varchar(255) DEFAULT NULL,
+    `size`         bigint(20) NOT NULL DEFAULT '0',
+    `content_type` varchar(100) DEFAULT NULL COMMENT '根据文件内容识别的 MIME 类型',
+    `checksum`     varchar(80)  DEFAULT NULL COMMENT 'sha256, 分片上传为 md5(各分片md5)-分片数',
+    `ref_count`    int(11) NOT NULL DEFAULT '0' COMMENT '被商品/博客等引用次数, 大于 0 不可删除',
+    `visibility`   varchar(16)  NOT NULL DEFAULT 'public' COMMENT 'public, private(存放在 private/ 下, 仅能通过鉴权下载接口访问)',
+    `status`       varchar(20)  NOT NULL DEFAULT 'active' COMMENT 'active, quarantined(病毒扫描命中, 已隔离)',
+    `scan_result`  varchar(255) DEFAULT NULL COMMENT 'clean 或命中的病毒特征名',
+    `scanned_at`   datetime(3) DEFAULT NULL,
+    `derivatives`  json         DEFAULT NULL COMMENT '图片衍生图(缩略图/中图)',
+    `created_at`   datetime(3) DEFAULT NULL,
+    `updated_at`   datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_key` (`key`) USING BTREE,
+    KEY            `idx_shop_created` (`shop_id`, `created_at`) USING BTREE,
+    KEY            `idx_shop_url` (`shop_id`, `url`(191)) USING BTREE,
+    KEY            `idx_customer` (`customer_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='文件表';
+
+-- 30. 文件引用 (引用计数, 防止删除正在使用的文件)
+CREATE TABLE `file_references`
+(
+    `id`         bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`    bigint(20) unsigned NOT NULL,
+    `file_id`    bigint(20) unsigned NOT NULL,
+    `ref_type`   varchar(50) NOT NULL COMMENT 'blog_post, product',
+    `ref_id`     bigint(20) unsigned NOT NULL,
+    `created_at` datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_file_ref` (`file_id`, `ref_type`, `ref_id`) USING BTREE,
+    KEY          `idx_ref` (`ref_type`, `ref_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='文件引用表';
+
+-- 31. 存储迁移 (在存储提供方之间迁移对象, 可断点续传)
+CREATE TABLE `storage_migrations`
+(
+    `id`           bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `source`       varchar(20)  NOT NULL COMMENT '源存储: local, s3, oss',
+    `destination`  varchar(20)  NOT NULL COMMENT '目标存储',
+    `status`       varchar(20)  NOT NULL DEFAULT 'pending' COMMENT 'pending, running, completed, failed',
+    `last_key`     varchar(255) DEFAULT NULL COMMENT '按 key 顺序遍历, 续传从此 key 之后开始',
+    `copied`       int(11) NOT NULL DEFAULT '0',
+    `skipped`      int(11) NOT NULL DEFAULT '0' COMMENT '目标已存在且内容一致',
+    `failed`       int(11) NOT NULL DEFAULT '0',
+    `bytes`        bigint(20) NOT NULL DEFAULT '0',
+    `error`        varchar(1000) DEFAULT NULL COMMENT '最近一次错误',
+    `locked_until` datetime(3) DEFAULT NULL COMMENT '执行中的任务租约, 过期后可被接管',
+    `started_at`   datetime(3) DEFAULT NULL,
+    `finished_at`  datetime(3) DEFAULT NULL,
+    `created_at`   datetime(3) DEFAULT NULL,
+    `updated_at`   datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='存储迁移表';
+
+-- 32. 搜索热词 (按店铺统计有结果的搜索词, 用于搜索建议加权)
+CREATE TABLE `search_query_stats`
+(
+    `id`               bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`          bigint(20) unsigned NOT NULL,
+    `query`            varchar(100) NOT NULL COMMENT '归一化后的搜索词 (小写, 去首尾空白)',
+    `searches`         bigint(20) NOT NULL DEFAULT '0' COMMENT '有结果的搜索次数',
+    `last_searched_at` datetime(3) DEFAULT NULL,
+    `created_at`       datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_shop_query` (`shop_id`, `query`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='搜索热词表';
+
+-- 33. 搜索日志 (异步写入, 仅记录文本搜索的第一页; 用于热门/无结果搜索报表, 超出最长报表区间的日志每日清理)
+CREATE TABLE `search_logs`
+(
+    `id`                 bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`            bigint(20) unsigned NOT NULL,
+    `search_id`          varchar(32)         NOT NULL COMMENT '返回给前台的搜索ID, 点击时回传',
+    `query`              varchar(100)        NOT NULL COMMENT '归一化后的搜索词',
+    `results`            bigint(20)          NOT NULL DEFAULT '0' COMMENT '结果总数',
+    `clicked_product_id` bigint(20) unsigned DEFAULT NULL COMMENT '首个点击的商品',
+    `clicked_at`         datetime(3)         DEFAULT NULL,
+    `created_at`         datetime(3)         DEFAULT NULL,
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_search_id` (`search_id`),
+    KEY `idx_shop_created` (`shop_id`, `created_at`),
+    KEY `idx_created` (`created_at`) COMMENT '按时间清理过期日志'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='搜索日志表';
+
+-- 34. 店铺搜索规则 (同义词组、置顶商品)
+CREATE TABLE `search_settings`
+(
+    `id`         bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+    `shop_id`    bigint(20) unsigned NOT NULL,
+    `rules`      json DEFAULT NULL COMMENT '同义词组与按搜索词置顶的商品',
+    `updated_at` datetime(3) DEFAULT CURRENT_TIMESTAMP (3) ON UPDATE CURRENT_TIMESTAMP (3),
+    PRIMARY KEY (`id`) USING BTREE,
+    UNIQUE KEY `uk_shop` (`shop_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='店铺搜索规则表';
+
+-- 35. 搜索索引重建标记 (重建期间各进程同时写入新索引, 租约过期视为重建已结束)
+CREATE TABLE `search_rebuilds`
+(
+    `index_name` varchar(100) NOT NULL COMMENT '线上索引名',
+    `target`     varchar(150) NOT NULL COMMENT '正在填充的新索引',
+    `expires_at` datetime(3)  NOT NULL COMMENT '重建进程定期续期',
+    `updated_at` datetime(3) DEFAULT NULL,
+    PRIMARY KEY (`index_name`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci COMMENT='搜索索引重建标记表';
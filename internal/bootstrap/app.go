@@ -2,13 +2,21 @@ package bootstrap
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"shop/internal/config"
+	"shop/internal/consumer"
 	"shop/internal/cron"
 	"shop/internal/database"
 	"shop/internal/handler"
 	"shop/internal/infra/asynq"
+	"shop/internal/infra/redis"
+	"shop/internal/infra/scanner"
+	"shop/internal/infra/storage"
 	"shop/internal/infra/storage/local"
+	"shop/internal/infra/storage/mirror"
+	"shop/internal/infra/storage/s3"
 	"shop/internal/middleware"
 	"shop/internal/repository"
 	"shop/internal/router"
@@ -19,10 +27,13 @@ import (
 	"shop/pkg/logger"
 	"shop/pkg/queue"
 	"shop/pkg/search"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 func NewApp() *fx.App {
@@ -36,47 +47,215 @@ func NewApp() *fx.App {
 			// Interfaces
 			ProvideSearchEngine,
 			ProvideQueue,
+			ProvideRedis,
 
-			// Storage provider based on config (currently simplified to always provide local)
-			// In a real app, use a factory function to choose provider based on config
-			local.NewLocalStorage,
+			// Storage provider based on config
+			ProvideStorage,
+			ProvideScanner,
 			idgen.NewIDGenerator,
 			server.NewServer,
 			middleware.NewMiddleware,
 			repository.NewUserRepository,
+			repository.NewCustomerRepository,
+			repository.NewShopRepository,
+			repository.NewPlatformUserRepository,
+			repository.NewOrderRepository,
+			repository.NewBlogRepository,
+			repository.NewThemeRepository,
+			repository.NewProductRepository,
+			repository.NewRiskRepository,
+			repository.NewReportRepository,
+			repository.NewUploadSessionRepository,
+			repository.NewFileRepository,
+			repository.NewStorageMigrationRepository,
+			repository.NewSearchQueryRepository,
+			repository.NewSearchLogRepository,
+			repository.NewSearchSettingsRepository,
+			repository.NewSearchRebuildRepository,
 			service.NewUserService,
 			service.NewFileService,
+			service.NewImageService,
+			service.NewStorageMigrationService,
+			service.NewCustomerService,
+			service.NewStaffService,
+			service.NewOrderService,
+			service.NewBlogService,
+			service.NewThemeService,
+			service.NewRiskService,
+			service.NewReportService,
+			service.NewProductSearchService,
+			service.NewSearchSettingsService,
 			handler.NewUserHandler,
 			handler.NewFileHandler,
+			handler.NewImageHandler,
+			handler.NewStorageMigrationHandler,
+			handler.NewCustomerHandler,
+			handler.NewStaffHandler,
+			handler.NewOrderHandler,
+			handler.NewBlogHandler,
+			handler.NewThemeHandler,
+			handler.NewRiskHandler,
+			handler.NewReportHandler,
+			handler.NewProductSearchHandler,
+			handler.NewSearchSettingsHandler,
 			cron.NewCronManager,
 			websocket.NewHub,
 		),
 		fx.Invoke(
 			router.RegisterRoutes,
+			consumer.RegisterConsumers,
 			cron.StartCron,
 			asynq.StartAsynqServer,
+			EnsureSearchIndexes,
+			WatchProductChanges,
 			StartWebSocket,
 			StartServer,
 		),
 	)
 }
 
+// ProvideSearchEngine builds the engine named by search.engine, or else the
+// first configured service; the in-memory engine is the fallback, so an
+// Engine is always available
 func ProvideSearchEngine(cfg *config.Config, logger *zap.Logger) (search.Engine, error) {
-	// Simple switch based on config presence or a specific flag
-	// For example, if Meilisearch host is set, use it, else if ES addresses set, use ES
-	if cfg.Meilisearch.Host != "" {
+	engine := cfg.Search.Engine
+	if engine == "" {
+		switch {
+		case cfg.Meilisearch.Host != "":
+			engine = "meilisearch"
+		case len(cfg.Elasticsearch.Addresses) > 0:
+			engine = "elasticsearch"
+		default:
+			engine = "memory"
+		}
+	}
+
+	switch engine {
+	case "meilisearch":
 		logger.Info("Using Meilisearch as search engine")
 		return search.NewMeiliAdapter(cfg, logger)
-	}
-	if len(cfg.Elasticsearch.Addresses) > 0 {
+	case "elasticsearch":
 		logger.Info("Using Elasticsearch as search engine")
 		return search.NewESAdapter(cfg, logger)
+	case "memory":
+		logger.Warn("Using the in-memory search engine, the index is rebuilt from the database at every start")
+		return search.NewMemoryEngine(), nil
+	default:
+		return nil, fmt.Errorf("unsupported search engine %q", engine)
+	}
+}
+
+// EnsureSearchIndexes applies the index definitions in the background once
+// the app starts; search being down must not keep the shop from starting.
+// The in-memory engine starts empty and is filled from the database.
+func EnsureSearchIndexes(lc fx.Lifecycle, engine search.Engine, productSearch service.ProductSearchService, logger *zap.Logger) {
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+				for _, def := range service.SearchIndexes() {
+					err := engine.EnsureIndex(ctx, def)
+					switch {
+					case errors.Is(err, search.ErrReindexRequired):
+						logger.Warn("Search index definition needs a rebuild", zap.String("index", def.Name), zap.Error(err))
+					case err != nil:
+						logger.Error("Failed to ensure search index", zap.String("index", def.Name), zap.Error(err))
+					}
+				}
+
+				if _, ok := engine.(*search.MemoryEngine); ok {
+					indexed, err := productSearch.Rebuild(context.Background())
+					if err != nil {
+						logger.Error("Failed to fill the in-memory search index", zap.Error(err))
+						return
+					}
+					logger.Info("Filled the in-memory search index", zap.Int("products", indexed))
+				}
+			}()
+			return nil
+		},
+	})
+}
+
+// WatchProductChanges feeds committed catalog writes to the search index and
+// writes the pending batch on shutdown
+func WatchProductChanges(lc fx.Lifecycle, db *gorm.DB, productSearch service.ProductSearchService) error {
+	if err := repository.WatchProductChanges(db, productSearch.Notify); err != nil {
+		return err
 	}
-	// Default or Error
-	return nil, nil // Or return a NoOp engine
+	lc.Append(fx.Hook{
+		OnStop: productSearch.Flush,
+	})
+	return nil
 }
 
-func ProvideQueue(cfg *config.Config, logger *zap.Logger) (queue.Queue, error) {
+// ProvideStorage builds the configured provider. While a migration is
+// configured it is mirrored with the migration source, and the pair is
+// exposed as a storage.Cutover (nil otherwise) for the migration job.
+func ProvideStorage(cfg *config.Config, logger *zap.Logger) (storage.Provider, *storage.Cutover, error) {
+	destination := storageType(cfg.Storage.Type)
+	primary, err := newStorage(cfg, destination, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Storage.Migration.Source == "" {
+		return primary, nil, nil
+	}
+
+	source := storageType(cfg.Storage.Migration.Source)
+	if source == destination {
+		return nil, nil, fmt.Errorf("storage migration source %q is the current storage type", source)
+	}
+	fallback, err := newStorage(cfg, source, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Storage migration configured, falling back to the source for missing objects",
+		zap.String("source", source), zap.String("destination", destination),
+		zap.Bool("dual_write", cfg.Storage.Migration.DualWrite))
+
+	cutover := &storage.Cutover{Source: fallback, Destination: primary, SourceName: source, DestinationName: destination}
+	return mirror.NewMirrorStorage(primary, fallback, cfg.Storage.Migration.DualWrite, logger), cutover, nil
+}
+
+func newStorage(cfg *config.Config, typ string, logger *zap.Logger) (storage.Provider, error) {
+	switch typ {
+	case "local":
+		logger.Info("Using local disk as storage")
+		return local.NewLocalStorage(cfg, logger), nil
+	case "s3":
+		logger.Info("Using S3 compatible storage", zap.String("endpoint", cfg.Storage.S3.Endpoint))
+		return s3.NewS3Storage(cfg.Storage.S3, logger)
+	case "oss":
+		logger.Info("Using Aliyun OSS storage", zap.String("endpoint", cfg.Storage.OSS.Endpoint))
+		return s3.NewS3Storage(cfg.Storage.OSS, logger)
+	default:
+		return nil, fmt.Errorf("unsupported storage type %q", typ)
+	}
+}
+
+func storageType(typ string) string {
+	if typ == "" {
+		return "local"
+	}
+	return typ
+}
+
+// ProvideScanner returns nil when malware scanning is disabled
+func ProvideScanner(cfg *config.Config, logger *zap.Logger) (scanner.Scanner, error) {
+	switch cfg.Storage.Scanner.Type {
+	case "", "none":
+		return nil, nil
+	case "clamav":
+		logger.Info("Scanning uploads with ClamAV", zap.String("address", cfg.Storage.Scanner.Address))
+		return scanner.NewClamAV(cfg.Storage.Scanner.Address, time.Duration(cfg.Storage.Scanner.Timeout)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unsupported scanner type %q", cfg.Storage.Scanner.Type)
+	}
+}
+
+func ProvideQueue(cfg *config.Config, logger *zap.Logger, asynqServer *asynq.AsynqServer) (queue.Queue, error) {
 	// Similar logic for Queue
 	if cfg.RabbitMQ.URL != "" {
 		logger.Info("Using RabbitMQ as message queue")
@@ -84,11 +263,30 @@ func ProvideQueue(cfg *config.Config, logger *zap.Logger) (queue.Queue, error) {
 	}
 	if cfg.Asynq.Addr != "" {
 		logger.Info("Using Asynq as message queue")
-		return queue.NewAsynqAdapter(cfg, logger)
+		return queue.NewAsynqAdapter(cfg, logger, asynqServer.Mux)
 	}
 	return nil, nil
 }
 
+// ProvideRedis returns nil when Redis is not configured or unreachable; it
+// only backs caches, which are skipped without it
+func ProvideRedis(lc fx.Lifecycle, cfg *config.Config, logger *zap.Logger) *goredis.Client {
+	if cfg.Redis.Addr == "" {
+		return nil
+	}
+	client, err := redis.NewRedis(cfg, logger)
+	if err != nil {
+		logger.Warn("Redis unavailable, caching is disabled", zap.Error(err))
+		return nil
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return client.Close()
+		},
+	})
+	return client
+}
+
 func StartWebSocket(lc fx.Lifecycle, hub *websocket.Hub) {
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -0,0 +1,50 @@
+package bootstrap
+
+import (
+	"context"
+	"shop/internal/config"
+	"shop/internal/database"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/internal/service"
+	"shop/pkg/logger"
+	"shop/pkg/queue"
+
+	"go.uber.org/fx"
+)
+
+// RunStorageMigration runs a storage migration in the foreground without
+// starting the HTTP server or queue consumers. resumeID continues an existing
+// migration; 0 starts a new one.
+func RunStorageMigration(ctx context.Context, resumeID uint) error {
+	var migrations service.StorageMigrationService
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			config.NewConfig,
+			logger.NewLogger,
+			database.NewDatabase,
+			ProvideStorage,
+			repository.NewStorageMigrationRepository,
+			service.NewStorageMigrationService,
+			// The migration runs right here, not as a queued job
+			func() queue.Queue { return nil },
+		),
+		fx.Populate(&migrations),
+	)
+	if err := app.Err(); err != nil {
+		return err
+	}
+
+	var migration *model.StorageMigration
+	var err error
+	if resumeID == 0 {
+		migration, err = migrations.Create(ctx)
+	} else {
+		migration, err = migrations.Reopen(ctx, resumeID)
+	}
+	if err != nil {
+		return err
+	}
+	return migrations.Run(ctx, migration.ID)
+}
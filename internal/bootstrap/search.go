@@ -0,0 +1,59 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"shop/internal/config"
+	"shop/internal/database"
+	"shop/internal/repository"
+	"shop/internal/service"
+	"shop/pkg/idgen"
+	"shop/pkg/logger"
+	"shop/pkg/queue"
+	"shop/pkg/search"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// RunSearchReindex rebuilds the products index from the database without
+// starting the HTTP server or queue consumers. The running app sees the
+// rebuild in search_rebuilds and writes its changes to the new index too.
+func RunSearchReindex(ctx context.Context) error {
+	var productSearch service.ProductSearchService
+	var engine search.Engine
+	var log *zap.Logger
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			config.NewConfig,
+			logger.NewLogger,
+			database.NewDatabase,
+			ProvideSearchEngine,
+			repository.NewProductRepository,
+			repository.NewSearchQueryRepository,
+			repository.NewSearchLogRepository,
+			repository.NewSearchSettingsRepository,
+			repository.NewSearchRebuildRepository,
+			idgen.NewIDGenerator,
+			service.NewProductSearchService,
+			func() queue.Queue { return nil },
+			func() *goredis.Client { return nil },
+		),
+		fx.Populate(&productSearch, &engine, &log),
+	)
+	if err := app.Err(); err != nil {
+		return err
+	}
+	if _, ok := engine.(*search.MemoryEngine); ok {
+		return errors.New("the in-memory search engine lives in the app process and is filled when it starts")
+	}
+
+	indexed, err := productSearch.Rebuild(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("Search index rebuilt", zap.String("index", service.ProductSearchIndex.Name), zap.Int("products", indexed))
+	return nil
+}
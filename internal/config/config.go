@@ -9,17 +9,27 @@ type Config struct {
 	Database      DatabaseConfig      `mapstructure:"database"`
 	Redis         RedisConfig         `mapstructure:"redis"`
 	RabbitMQ      RabbitMQConfig      `mapstructure:"rabbitmq"`
+	Search        SearchConfig        `mapstructure:"search"`
 	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
 	Meilisearch   MeilisearchConfig   `mapstructure:"meilisearch"`
 	Asynq         AsynqConfig         `mapstructure:"asynq"`
 	Storage       StorageConfig       `mapstructure:"storage"`
+	Image         ImageConfig         `mapstructure:"image"`
 	Logger        LoggerConfig        `mapstructure:"logger"`
+	JWT           JWTConfig           `mapstructure:"jwt"`
 }
 
 type ServerConfig struct {
-	Port   string `mapstructure:"port"`
-	Mode   string `mapstructure:"mode"`
-	NodeID int64  `mapstructure:"node_id"`
+	Port      string `mapstructure:"port"`
+	Mode      string `mapstructure:"mode"`
+	NodeID    int64  `mapstructure:"node_id"`
+	SecretKey string `mapstructure:"secret_key"` // HMAC key for signed URLs
+	// BaseURL is the storefront origin (scheme://host) used in links, such as
+	// blog feeds, of shops without a primary domain
+	BaseURL string `mapstructure:"base_url"`
+	// TrustedProxies are the load balancer/CDN addresses (IPs or CIDRs) whose
+	// X-Forwarded-For is believed; empty trusts none and uses the peer address
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -34,6 +44,15 @@ type RedisConfig struct {
 
 type RabbitMQConfig struct {
 	URL string `mapstructure:"url"`
+	// Prefetch is how many deliveries of one subscription are handled
+	// concurrently before they are acknowledged (default 32)
+	Prefetch int `mapstructure:"prefetch"`
+}
+
+type SearchConfig struct {
+	// Engine is meilisearch, elasticsearch or memory; empty picks the first
+	// configured service, falling back to memory
+	Engine string `mapstructure:"engine"`
 }
 
 type ElasticsearchConfig struct {
@@ -55,19 +74,85 @@ type AsynqConfig struct {
 }
 
 type StorageConfig struct {
-	Type  string      `mapstructure:"type"`
-	Local LocalConfig `mapstructure:"local"`
+	Type          string          `mapstructure:"type"`
+	PresignExpire int             `mapstructure:"presign_expire"`  // seconds
+	MaxUploadSize int64           `mapstructure:"max_upload_size"` // bytes, default for policies without max_size
+	UploadExpire  int             `mapstructure:"upload_expire"`   // seconds before an unfinished multipart upload is expired
+	Policies      []UploadPolicy  `mapstructure:"policies"`
+	Scanner       ScannerConfig   `mapstructure:"scanner"`
+	Migration     MigrationConfig `mapstructure:"migration"`
+	Local         LocalConfig     `mapstructure:"local"`
+	S3            S3Config        `mapstructure:"s3"`
+	OSS           S3Config        `mapstructure:"oss"` // Aliyun OSS through its S3 compatible API
+}
+
+// UploadPolicy restricts uploads into Folder and its subfolders; the policy
+// with the longest matching folder wins and "" matches every folder
+type UploadPolicy struct {
+	Folder       string   `mapstructure:"folder"`
+	AllowedTypes []string `mapstructure:"allowed_types"` // sniffed MIME types, "image/*" wildcards allowed, empty = any
+	MaxSize      int64    `mapstructure:"max_size"`      // bytes, 0 = max_upload_size
+	MaxParts     int      `mapstructure:"max_parts"`     // multipart uploads, 0 = 10000
+}
+
+type ScannerConfig struct {
+	Type    string `mapstructure:"type"`    // none, clamav
+	Address string `mapstructure:"address"` // clamd TCP address
+	Timeout int    `mapstructure:"timeout"` // seconds
+}
+
+type ImageConfig struct {
+	URL          string             `mapstructure:"url"`           // base of the on-demand resize endpoint
+	MaxDimension int                `mapstructure:"max_dimension"` // largest width/height the endpoint renders
+	MaxPixels    int                `mapstructure:"max_pixels"`    // sources above this are refused (decompression bombs)
+	Quality      int                `mapstructure:"quality"`       // JPEG quality
+	Derivatives  []DerivativeConfig `mapstructure:"derivatives"`
+}
+
+// DerivativeConfig is a variant generated for every uploaded image
+type DerivativeConfig struct {
+	Name   string `mapstructure:"name"`
+	Width  int    `mapstructure:"width"`
+	Height int    `mapstructure:"height"`
+	Format string `mapstructure:"format"` // jpeg, png
+	Crop   bool   `mapstructure:"crop"`   // fill width x height instead of fitting inside it
+}
+
+// MigrationConfig describes a cutover from Source to the provider in Type.
+// While Source is set, reads of objects not migrated yet fall back to it and,
+// with DualWrite, new objects are written to both so the cutover can be rolled back.
+type MigrationConfig struct {
+	Source    string `mapstructure:"source"` // local, s3, oss; empty when no migration is running
+	DualWrite bool   `mapstructure:"dual_write"`
+	BatchSize int    `mapstructure:"batch_size"` // objects per progress checkpoint
 }
 
 type LocalConfig struct {
-	Path string `mapstructure:"path"`
-	URL  string `mapstructure:"url"`
+	Path      string `mapstructure:"path"`
+	URL       string `mapstructure:"url"`
+	SignedURL string `mapstructure:"signed_url"` // API endpoint that serves presigned URLs
+}
+
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"` // host[:port], e.g. s3.amazonaws.com or 127.0.0.1:9000
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	PathStyle bool   `mapstructure:"path_style"` // required by MinIO and most self-hosted gateways
+	PublicURL string `mapstructure:"public_url"` // optional CDN/base URL used by GetURL
 }
 
 type LoggerConfig struct {
 	Level string `mapstructure:"level"`
 }
 
+type JWTConfig struct {
+	Secret      string `mapstructure:"secret"`
+	ExpireHours int    `mapstructure:"expire_hours"`
+}
+
 func NewConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -0,0 +1,93 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+
+	"shop/internal/service"
+	"shop/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// RegisterConsumers subscribes the background handlers to their queue topics
+func RegisterConsumers(q queue.Queue, riskService service.RiskService, fileService service.FileService, imageService service.ImageService, migrationService service.StorageMigrationService, productSearch service.ProductSearchService, logger *zap.Logger) error {
+	if q == nil {
+		logger.Warn("No message queue configured, background consumers are disabled")
+		return nil
+	}
+
+	if err := q.Subscribe(service.TopicOrderCreated, func(ctx context.Context, payload []byte) error {
+		var event service.OrderEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		_, err := riskService.Evaluate(ctx, event.ShopID, event.OrderID)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := q.Subscribe(service.TopicFileUploaded, func(ctx context.Context, payload []byte) error {
+		var event service.FileEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return fileService.ScanFile(ctx, event.ShopID, event.FileID)
+	}); err != nil {
+		return err
+	}
+
+	if err := q.Subscribe(service.TopicImageUploaded, func(ctx context.Context, payload []byte) error {
+		var event service.FileEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return imageService.GenerateDerivatives(ctx, event.ShopID, event.FileID)
+	}); err != nil {
+		return err
+	}
+
+	if err := q.Subscribe(service.TopicStorageMigrate, func(ctx context.Context, payload []byte) error {
+		var event service.StorageMigrationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return migrationService.Run(ctx, event.MigrationID)
+	}); err != nil {
+		return err
+	}
+
+	if err := q.Subscribe(service.TopicProductChanged, func(ctx context.Context, payload []byte) error {
+		var event service.ProductEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return productSearch.Index(ctx, event)
+	}); err != nil {
+		return err
+	}
+
+	if err := q.Subscribe(service.TopicSearchLogged, func(ctx context.Context, payload []byte) error {
+		var event service.SearchLogEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return productSearch.Record(ctx, event)
+	}); err != nil {
+		return err
+	}
+
+	return q.Subscribe(service.TopicSearchRulesChanged, func(ctx context.Context, payload []byte) error {
+		var event service.SearchRulesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		count, err := productSearch.SyncShop(ctx, event.ShopID)
+		if err != nil {
+			return err
+		}
+		logger.Info("Reindexed shop products for new search rules", zap.Uint("shop_id", event.ShopID), zap.Int("products", count))
+		return nil
+	})
+}
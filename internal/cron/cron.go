@@ -2,6 +2,9 @@ package cron
 
 import (
 	"context"
+	"time"
+
+	"shop/internal/service"
 
 	"github.com/robfig/cron/v3"
 	"go.uber.org/fx"
@@ -10,16 +13,22 @@ import (
 
 // CronManager handles background tasks
 type CronManager struct {
-	scheduler *cron.Cron
-	logger    *zap.Logger
+	scheduler     *cron.Cron
+	logger        *zap.Logger
+	blogService   service.BlogService
+	reportService service.ReportService
+	fileService   service.FileService
 }
 
-func NewCronManager(logger *zap.Logger) *CronManager {
+func NewCronManager(logger *zap.Logger, blogService service.BlogService, reportService service.ReportService, fileService service.FileService) *CronManager {
 	// Create a new cron scheduler with second-level precision
 	c := cron.New(cron.WithSeconds())
 	return &CronManager{
-		scheduler: c,
-		logger:    logger,
+		scheduler:     c,
+		logger:        logger,
+		blogService:   blogService,
+		reportService: reportService,
+		fileService:   fileService,
 	}
 }
 
@@ -33,6 +42,61 @@ func (m *CronManager) RegisterJobs() {
 	if err != nil {
 		m.logger.Error("Failed to register example job", zap.Error(err))
 	}
+
+	// Publish scheduled blog posts every minute
+	_, err = m.scheduler.AddFunc("0 * * * * *", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := m.blogService.PublishScheduled(ctx); err != nil {
+			m.logger.Error("Failed to publish scheduled blog posts", zap.Error(err))
+		}
+	})
+
+	if err != nil {
+		m.logger.Error("Failed to register blog publish job", zap.Error(err))
+	}
+
+	// Refresh today's and yesterday's report aggregates every 15 minutes
+	_, err = m.scheduler.AddFunc("0 */15 * * * *", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := m.reportService.AggregateRecent(ctx); err != nil {
+			m.logger.Error("Failed to aggregate reports", zap.Error(err))
+		}
+	})
+
+	if err != nil {
+		m.logger.Error("Failed to register report aggregation job", zap.Error(err))
+	}
+
+	// Abort multipart uploads nobody completed before their expiry
+	_, err = m.scheduler.AddFunc("0 */10 * * * *", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if _, err := m.fileService.ExpireStaleUploads(ctx); err != nil {
+			m.logger.Error("Failed to expire stale uploads", zap.Error(err))
+		}
+	})
+
+	if err != nil {
+		m.logger.Error("Failed to register upload janitor job", zap.Error(err))
+	}
+
+	// Purge search logs older than the longest report range every night
+	_, err = m.scheduler.AddFunc("0 30 3 * * *", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+		purged, err := m.reportService.PurgeSearchLogs(ctx)
+		if err != nil {
+			m.logger.Error("Failed to purge search logs", zap.Error(err))
+			return
+		}
+		m.logger.Info("Purged search logs", zap.Int64("deleted", purged))
+	})
+
+	if err != nil {
+		m.logger.Error("Failed to register search log purge job", zap.Error(err))
+	}
 }
 
 // StartCron starts the cron scheduler using Fx Lifecycle
@@ -16,7 +16,37 @@ func NewDatabase(cfg *config.Config, logger *zap.Logger) (*gorm.DB, error) {
 	}
 
 	// Auto Migrate
-	if err := db.AutoMigrate(&model.User{}); err != nil {
+	if err := db.AutoMigrate(
+		&model.User{},
+		&model.Customer{},
+		&model.CustomerAddress{},
+		&model.Order{},
+		&model.OrderItem{},
+		&model.BlogPost{},
+		&model.Theme{},
+		&model.ThemeVersion{},
+		&model.Product{},
+		&model.ProductVariant{},
+		&model.OrderRisk{},
+		&model.RiskSettings{},
+		&model.Shop{},
+		&model.ShopDomain{},
+		&model.PlatformUser{},
+		&model.OrganizationMember{},
+		&model.Cart{},
+		&model.PaymentTransaction{},
+		&model.DiscountCode{},
+		&model.DailySalesReport{},
+		&model.DailyProductReport{},
+		&model.UploadSession{},
+		&model.File{},
+		&model.FileReference{},
+		&model.StorageMigration{},
+		&model.SearchQueryStat{},
+		&model.SearchLog{},
+		&model.SearchSettings{},
+		&model.SearchRebuild{},
+	); err != nil {
 		logger.Error("failed to auto migrate", zap.Error(err))
 		return nil, err
 	}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"shop/internal/middleware"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/feeds"
+	"gorm.io/gorm"
+)
+
+// feedSize is the number of latest posts included in RSS/Atom feeds
+const feedSize = 20
+
+type BlogHandler struct {
+	service service.BlogService
+}
+
+func NewBlogHandler(service service.BlogService) *BlogHandler {
+	return &BlogHandler{service: service}
+}
+
+type blogPostRequest struct {
+	Title       string     `json:"title" binding:"required"`
+	Slug        string     `json:"slug"`
+	Author      string     `json:"author"`
+	ContentHTML string     `json:"content_html"`
+	Summary     string     `json:"summary"`
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+func (r blogPostRequest) input() service.BlogPostInput {
+	return service.BlogPostInput{
+		Title:       r.Title,
+		Slug:        r.Slug,
+		Author:      r.Author,
+		ContentHTML: r.ContentHTML,
+		Summary:     r.Summary,
+		Status:      r.Status,
+		PublishedAt: r.PublishedAt,
+	}
+}
+
+func (h *BlogHandler) CreatePost(c *gin.Context) {
+	var req blogPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := h.service.CreatePost(c.Request.Context(), middleware.ShopID(c), req.input())
+	if err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, post)
+}
+
+func (h *BlogHandler) UpdatePost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req blogPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := h.service.UpdatePost(c.Request.Context(), middleware.ShopID(c), uint(id), req.input())
+	if err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+func (h *BlogHandler) DeletePost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.service.DeletePost(c.Request.Context(), middleware.ShopID(c), uint(id)); err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *BlogHandler) GetPost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	post, err := h.service.GetPost(c.Request.Context(), middleware.ShopID(c), uint(id))
+	if err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+func (h *BlogHandler) ListPosts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	posts, total, err := h.service.ListPosts(c.Request.Context(), middleware.ShopID(c), c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts, "total": total})
+}
+
+// UploadFeaturedImage stores the cover image through FileService
+func (h *BlogHandler) UploadFeaturedImage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	post, err := h.service.UploadFeaturedImage(c.Request.Context(), middleware.ShopID(c), middleware.UserID(c), uint(id), file)
+	if err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// ListPublished is the storefront listing of published posts
+func (h *BlogHandler) ListPublished(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	posts, total, err := h.service.ListPublished(c.Request.Context(), middleware.ShopID(c), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": posts, "total": total})
+}
+
+func (h *BlogHandler) GetPublished(c *gin.Context) {
+	post, err := h.service.GetPublishedBySlug(c.Request.Context(), middleware.ShopID(c), c.Param("slug"))
+	if err != nil {
+		writeBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+func (h *BlogHandler) RSS(c *gin.Context) {
+	h.writeFeed(c, "application/rss+xml; charset=utf-8", (*feeds.Feed).ToRss)
+}
+
+func (h *BlogHandler) Atom(c *gin.Context) {
+	h.writeFeed(c, "application/atom+xml; charset=utf-8", (*feeds.Feed).ToAtom)
+}
+
+func (h *BlogHandler) writeFeed(c *gin.Context, contentType string, render func(*feeds.Feed) (string, error)) {
+	feed, err := h.service.Feed(c.Request.Context(), middleware.ShopID(c), feedSize)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shop not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	out, err := render(buildFeed(feed))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, []byte(out))
+}
+
+func buildFeed(in *service.BlogFeed) *feeds.Feed {
+	origin := in.Origin
+	feed := &feeds.Feed{
+		Title: in.Title,
+		Link:  &feeds.Link{Href: origin + "/blog"},
+	}
+	for _, p := range in.Posts {
+		item := &feeds.Item{
+			Id:          fmt.Sprintf("%s/blog/%s", origin, p.Slug),
+			Title:       p.Title,
+			Link:        &feeds.Link{Href: fmt.Sprintf("%s/blog/%s", origin, p.Slug)},
+			Description: p.Summary,
+			Content:     p.ContentHTML,
+			Updated:     p.UpdatedAt,
+		}
+		if p.Author != "" {
+			item.Author = &feeds.Author{Name: p.Author}
+		}
+		if p.PublishedAt != nil {
+			item.Created = *p.PublishedAt
+		}
+		if imageType := mime.TypeByExtension(path.Ext(p.FeaturedImage)); imageType != "" {
+			item.Enclosure = &feeds.Enclosure{Url: p.FeaturedImage, Type: imageType, Length: "0"}
+		}
+		if feed.Updated.Before(item.Updated) {
+			feed.Updated = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+func writeBlogError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+	case errors.Is(err, service.ErrInvalidBlogStatus), errors.Is(err, service.ErrMissingPublishTime):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shop/internal/middleware"
+	"shop/internal/model"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CustomerHandler struct {
+	service service.CustomerService
+}
+
+func NewCustomerHandler(service service.CustomerService) *CustomerHandler {
+	return &CustomerHandler{service: service}
+}
+
+func (h *CustomerHandler) Register(c *gin.Context) {
+	var req struct {
+		Email            string `json:"email" binding:"required,email"`
+		Password         string `json:"password" binding:"required,min=8"`
+		FirstName        string `json:"first_name"`
+		LastName         string `json:"last_name"`
+		AcceptsMarketing bool   `json:"accepts_marketing"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, token, err := h.service.Register(c.Request.Context(), middleware.ShopID(c), service.RegisterCustomerInput{
+		Email:            req.Email,
+		Password:         req.Password,
+		FirstName:        req.FirstName,
+		LastName:         req.LastName,
+		AcceptsMarketing: req.AcceptsMarketing,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"customer": customer, "token": token})
+}
+
+func (h *CustomerHandler) Login(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, token, err := h.service.Login(c.Request.Context(), middleware.ShopID(c), req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer": customer, "token": token})
+}
+
+func (h *CustomerHandler) Profile(c *gin.Context) {
+	customer, err := h.service.GetProfile(c.Request.Context(), middleware.ShopID(c), middleware.CustomerID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) ListAddresses(c *gin.Context) {
+	addresses, err := h.service.ListAddresses(c.Request.Context(), middleware.ShopID(c), middleware.CustomerID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+type addressRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Company   string `json:"company"`
+	Address1  string `json:"address1" binding:"required"`
+	Address2  string `json:"address2"`
+	City      string `json:"city"`
+	Province  string `json:"province"`
+	Country   string `json:"country" binding:"required"`
+	Zip       string `json:"zip"`
+	Phone     string `json:"phone"`
+	IsDefault bool   `json:"is_default"`
+}
+
+func (h *CustomerHandler) CreateAddress(c *gin.Context) {
+	h.saveAddress(c, 0)
+}
+
+func (h *CustomerHandler) UpdateAddress(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	h.saveAddress(c, uint(id))
+}
+
+func (h *CustomerHandler) saveAddress(c *gin.Context, id uint) {
+	var req addressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address := &model.CustomerAddress{
+		ID:         id,
+		ShopID:     middleware.ShopID(c),
+		CustomerID: middleware.CustomerID(c),
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		Company:    req.Company,
+		Address1:   req.Address1,
+		Address2:   req.Address2,
+		City:       req.City,
+		Province:   req.Province,
+		Country:    req.Country,
+		Zip:        req.Zip,
+		Phone:      req.Phone,
+		IsDefault:  req.IsDefault,
+	}
+	if err := h.service.SaveAddress(c.Request.Context(), address); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+func (h *CustomerHandler) DeleteAddress(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.service.DeleteAddress(c.Request.Context(), middleware.ShopID(c), middleware.CustomerID(c), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *CustomerHandler) ListOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	orders, total, err := h.service.ListOrders(c.Request.Context(), middleware.ShopID(c), middleware.CustomerID(c), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders, "total": total})
+}
+
+// ClaimOrders attaches past guest orders to the logged-in account
+func (h *CustomerHandler) ClaimOrders(c *gin.Context) {
+	var req struct {
+		OrderNumber string `json:"order_number" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claimed, err := h.service.ClaimGuestOrders(c.Request.Context(), middleware.ShopID(c), middleware.CustomerID(c), req.OrderNumber)
+	if err != nil {
+		if errors.Is(err, service.ErrOrderNotClaimable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"claimed": claimed})
+}
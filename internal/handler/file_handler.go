@@ -1,11 +1,22 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"shop/internal/infra/storage"
+	"shop/internal/middleware"
+	"shop/internal/model"
+	"shop/internal/repository"
 	"shop/internal/service"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type FileHandler struct {
@@ -24,21 +35,26 @@ func (h *FileHandler) UploadSimple(c *gin.Context) {
 		return
 	}
 
-	folder := c.DefaultPostForm("folder", "default")
-	url, err := h.service.UploadFile(c.Request.Context(), file, folder)
+	uploaded, err := h.service.UploadFile(c.Request.Context(), middleware.ShopID(c), file, service.UploadInput{
+		UploaderID: middleware.UserID(c),
+		Folder:     c.DefaultPostForm("folder", "default"),
+		Visibility: c.PostForm("visibility"),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeFileError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"url": url})
+	c.JSON(http.StatusOK, gin.H{"url": uploaded.URL, "file": uploaded})
 }
 
 // InitiateMultipart starts a multipart upload
 func (h *FileHandler) InitiateMultipart(c *gin.Context) {
 	var req struct {
-		Filename string `json:"filename" binding:"required"`
-		Folder   string `json:"folder"`
+		Filename   string `json:"filename" binding:"required"`
+		Folder     string `json:"folder"`
+		Visibility string `json:"visibility"` // public (default) or private
+		Size       int64  `json:"size"`       // optional, verified on complete
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -49,15 +65,16 @@ func (h *FileHandler) InitiateMultipart(c *gin.Context) {
 		req.Folder = "default"
 	}
 
-	key, uploadID, err := h.service.InitiateMultipart(c.Request.Context(), req.Filename, req.Folder)
+	session, err := h.service.InitiateMultipart(c.Request.Context(), middleware.ShopID(c), middleware.UserID(c), req.Filename, req.Folder, req.Visibility, req.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeFileError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"key":       key,
-		"upload_id": uploadID,
+		"key":        session.Key,
+		"upload_id":  session.UploadID,
+		"expires_at": session.ExpiresAt,
 	})
 }
 
@@ -87,13 +104,19 @@ func (h *FileHandler) UploadPart(c *gin.Context) {
 	}
 	defer src.Close()
 
-	etag, err := h.service.UploadPart(c.Request.Context(), req.Key, req.UploadID, req.PartNumber, src, file.Size)
+	// Optional hex digests of the chunk, verified before the part is stored
+	checksum := storage.PartChecksum{
+		MD5:    c.GetHeader("X-Checksum-MD5"),
+		SHA256: c.GetHeader("X-Checksum-SHA256"),
+	}
+
+	part, err := h.service.UploadPart(c.Request.Context(), middleware.ShopID(c), req.Key, req.UploadID, req.PartNumber, src, file.Size, checksum)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeFileError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"etag": etag})
+	c.JSON(http.StatusOK, gin.H{"etag": part.ETag, "sha256": part.SHA256})
 }
 
 // CompleteMultipart finishes the upload
@@ -108,11 +131,407 @@ func (h *FileHandler) CompleteMultipart(c *gin.Context) {
 		return
 	}
 
-	url, err := h.service.CompleteMultipart(c.Request.Context(), req.Key, req.UploadID, req.Parts)
+	uploaded, err := h.service.CompleteMultipart(c.Request.Context(), middleware.ShopID(c), req.Key, req.UploadID, req.Parts)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": uploaded.URL, "checksum": uploaded.Checksum, "file": uploaded})
+}
+
+// ListParts reports the parts already received so a client can resume
+func (h *FileHandler) ListParts(c *gin.Context) {
+	uploadID := c.Query("upload_id")
+	if uploadID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload_id is required"})
+		return
+	}
+
+	session, parts, err := h.service.ListParts(c.Request.Context(), middleware.ShopID(c), uploadID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":           session.Key,
+		"upload_id":     session.UploadID,
+		"expected_size": session.ExpectedSize,
+		"expires_at":    session.ExpiresAt,
+		"parts":         parts,
+	})
+}
+
+// AbortMultipart cancels an upload and discards the stored parts
+func (h *FileHandler) AbortMultipart(c *gin.Context) {
+	var req struct {
+		UploadID string `json:"upload_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.AbortMultipart(c.Request.Context(), middleware.ShopID(c), req.UploadID); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PresignUpload returns a URL the browser can PUT the file to directly; the
+// upload must then be confirmed with its upload_id
+func (h *FileHandler) PresignUpload(c *gin.Context) {
+	var req struct {
+		Filename    string `json:"filename" binding:"required"`
+		Folder      string `json:"folder"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Folder == "" {
+		req.Folder = "default"
+	}
+
+	upload, err := h.service.PresignUpload(c.Request.Context(), middleware.ShopID(c), service.PresignUploadInput{
+		UploaderID:  middleware.UserID(c),
+		Filename:    req.Filename,
+		Folder:      req.Folder,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	})
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// ConfirmPresignedUpload registers a file PUT through a presigned URL once
+// its content passed the upload checks
+func (h *FileHandler) ConfirmPresignedUpload(c *gin.Context) {
+	var req struct {
+		UploadID string `json:"upload_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uploaded, err := h.service.ConfirmPresignedUpload(c.Request.Context(), middleware.ShopID(c), req.UploadID)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": uploaded.URL, "file": uploaded})
+}
+
+// PresignDownload returns a short-lived URL for reading an object directly
+func (h *FileHandler) PresignDownload(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
+	}
+
+	req, err := h.service.PresignDownload(c.Request.Context(), key)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// PutSigned receives the body of a presigned PUT issued by local storage
+func (h *FileHandler) PutSigned(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	url, err := h.service.PutSigned(c.Request.Context(), key, c.Request.URL.Query(),
+		c.ContentType(), c.Request.Body, c.Request.ContentLength)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "url": url})
+}
+
+// GetSigned streams an object for a presigned GET issued by local storage
+func (h *FileHandler) GetSigned(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	file, err := h.service.OpenSigned(c.Request.Context(), key, c.Request.URL.Query())
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, filepath.Base(key), info.ModTime(), file)
+}
+
+// ListFiles lists the shop's media library with optional filename search
+func (h *FileHandler) ListFiles(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	files, total, err := h.service.ListFiles(c.Request.Context(), repository.FileFilter{
+		ShopID:      middleware.ShopID(c),
+		Query:       c.Query("q"),
+		ContentType: c.Query("content_type"),
+		Folder:      c.Query("folder"),
+	}, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files, "total": total})
+}
+
+func (h *FileHandler) GetFile(c *gin.Context) {
+	id, ok := fileID(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.service.GetFile(c.Request.Context(), middleware.ShopID(c), id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteFile removes a file unless products or posts still use it
+func (h *FileHandler) DeleteFile(c *gin.Context) {
+	id, ok := fileID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteFile(c.Request.Context(), middleware.ShopID(c), id); err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Usage reports the storage consumed by the shop
+func (h *FileHandler) Usage(c *gin.Context) {
+	usage, err := h.service.StorageUsage(c.Request.Context(), middleware.ShopID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"url": url})
+	c.JSON(http.StatusOK, usage)
+}
+
+// Download streams any file of the shop to staff, private ones included
+func (h *FileHandler) Download(c *gin.Context) {
+	h.download(c, service.Downloader{UserID: middleware.UserID(c)})
+}
+
+// CustomerDownload streams a file the signed-in buyer uploaded
+func (h *FileHandler) CustomerDownload(c *gin.Context) {
+	h.download(c, service.Downloader{CustomerID: middleware.CustomerID(c)})
+}
+
+// CustomerUpload stores a private file for the signed-in buyer, e.g. artwork
+// for a personalized product
+func (h *FileHandler) CustomerUpload(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	uploaded, err := h.service.UploadFile(c.Request.Context(), middleware.ShopID(c), file, service.UploadInput{
+		CustomerID: middleware.CustomerID(c),
+		Folder:     "customer",
+		Visibility: model.FileVisibilityPrivate,
+	})
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, uploaded)
+}
+
+// download serves the file with conditional (If-None-Match) and single-range
+// (Range, If-Range) support, streaming from the provider
+func (h *FileHandler) download(c *gin.Context, by service.Downloader) {
+	id, ok := fileID(c)
+	if !ok {
+		return
+	}
+	file, err := h.service.AuthorizeDownload(c.Request.Context(), middleware.ShopID(c), id, by)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+
+	etag := ""
+	if file.Checksum != "" {
+		etag = `"` + file.Checksum + `"`
+		c.Header("ETag", etag)
+	}
+	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	if etag != "" && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	offset, length := int64(0), file.Size
+	status := http.StatusOK
+	rangeHeader := c.GetHeader("Range")
+	if ifRange := c.GetHeader("If-Range"); ifRange != "" && (etag == "" || ifRange != etag) {
+		rangeHeader = "" // the client's copy is stale, send the whole file
+	}
+	if rangeHeader != "" {
+		start, n, ok, satisfiable := parseRange(rangeHeader, file.Size)
+		if !satisfiable {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			c.Status(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			offset, length, status = start, n, http.StatusPartialContent
+			c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+n-1, file.Size))
+		}
+	}
+
+	body, err := h.service.ReadFile(c.Request.Context(), file, offset, length)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+	defer body.Close()
+
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(status, length, contentType, body, nil)
+}
+
+// parseRange interprets a single "bytes=" range against size. ok is false
+// for headers that should be ignored (other units, multiple ranges, syntax
+// errors); satisfiable is false when the range lies beyond the end.
+func parseRange(header string, size int64) (offset, length int64, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, true
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, true
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, true
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	return start, end - start + 1, true, true
+}
+
+// etagMatches evaluates If-None-Match, which uses weak comparison
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func fileID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeFileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidSignature), errors.Is(err, service.ErrFileNotPublic),
+		errors.Is(err, service.ErrFileQuarantined):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDownloadForbidden):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, storage.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+	case errors.Is(err, service.ErrFileInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrFileTypeNotAllowed):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUploadMismatch), errors.Is(err, storage.ErrInvalidKey),
+		errors.Is(err, service.ErrInvalidPartNumber), errors.Is(err, service.ErrInvalidPartList),
+		errors.Is(err, service.ErrInvalidFolder), errors.Is(err, service.ErrTooManyParts),
+		errors.Is(err, storage.ErrInvalidPart), errors.Is(err, service.ErrInvalidVisibility):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChecksumMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUploadSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUploadSessionClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSignedURLUnsupported):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
@@ -0,0 +1,38 @@
+package handler
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header         string
+		size           int64
+		offset, length int64
+		ok, satisfied  bool
+	}{
+		{"bytes=0-99", 1000, 0, 100, true, true},
+		{"bytes=500-", 1000, 500, 500, true, true},
+		{"bytes=900-1999", 1000, 900, 100, true, true}, // end clamped to the size
+		{"bytes=-100", 1000, 900, 100, true, true},
+		{"bytes=-5000", 1000, 0, 1000, true, true}, // suffix longer than the file
+		{"bytes= 10-19 ", 1000, 10, 10, true, true},
+		{"bytes=1000-", 1000, 0, 0, false, false},
+		{"bytes=-0", 1000, 0, 0, false, false},
+		{"bytes=-10", 0, 0, 0, false, false},
+		{"bytes=0-", 0, 0, 0, false, false},
+		// Ignored: the whole file is served
+		{"items=0-9", 1000, 0, 0, false, true},
+		{"bytes=0-9,20-29", 1000, 0, 0, false, true},
+		{"bytes=9-0", 1000, 0, 0, false, true},
+		{"bytes=abc", 1000, 0, 0, false, true},
+		{"bytes=a-9", 1000, 0, 0, false, true},
+		{"bytes=-1-9", 1000, 0, 0, false, true},
+		{"", 1000, 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		offset, length, ok, satisfiable := parseRange(tt.header, tt.size)
+		if offset != tt.offset || length != tt.length || ok != tt.ok || satisfiable != tt.satisfied {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v, %v; want %d, %d, %v, %v", tt.header, tt.size,
+				offset, length, ok, satisfiable, tt.offset, tt.length, tt.ok, tt.satisfied)
+		}
+	}
+}
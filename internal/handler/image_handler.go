@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shop/internal/middleware"
+	"shop/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImageHandler struct {
+	service service.ImageService
+	files   service.FileService
+}
+
+func NewImageHandler(service service.ImageService, files service.FileService) *ImageHandler {
+	return &ImageHandler{service: service, files: files}
+}
+
+// Serve renders /img/<key>?w=&h=&fmt=&sig=; only URLs issued by SignURL are
+// accepted so clients cannot request arbitrary sizes
+func (h *ImageHandler) Serve(c *gin.Context) {
+	opts, ok := imageOptions(c)
+	if !ok {
+		return
+	}
+	key := c.Param("key")
+	if !h.service.Verify(key, opts, c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid signature"})
+		return
+	}
+
+	img, err := h.service.Render(c.Request.Context(), key, opts)
+	if err != nil {
+		writeImageError(c, err)
+		return
+	}
+
+	// The signed URL fully determines the output, so it never changes
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, img.ContentType, img.Data)
+}
+
+// SignURL issues a resize URL for a media library image
+func (h *ImageHandler) SignURL(c *gin.Context) {
+	id, ok := fileID(c)
+	if !ok {
+		return
+	}
+	opts, ok := imageOptions(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.files.GetFile(c.Request.Context(), middleware.ShopID(c), id)
+	if err != nil {
+		writeFileError(c, err)
+		return
+	}
+	url, err := h.service.SignedURL(file.Key, opts)
+	if err != nil {
+		writeImageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func imageOptions(c *gin.Context) (service.ImageOptions, bool) {
+	var opts service.ImageOptions
+	var err error
+	if w := c.Query("w"); w != "" {
+		if opts.Width, err = strconv.Atoi(w); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid width"})
+			return opts, false
+		}
+	}
+	if h := c.Query("h"); h != "" {
+		if opts.Height, err = strconv.Atoi(h); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid height"})
+			return opts, false
+		}
+	}
+	opts.Format = c.Query("fmt")
+	return opts, true
+}
+
+func writeImageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidImageOptions):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotAnImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		writeFileError(c, err)
+	}
+}
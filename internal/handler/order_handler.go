@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shop/internal/middleware"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OrderHandler struct {
+	service service.OrderService
+}
+
+func NewOrderHandler(service service.OrderService) *OrderHandler {
+	return &OrderHandler{service: service}
+}
+
+// Checkout places a storefront order for a guest or the logged-in customer
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"omitempty,email"`
+		Phone    string `json:"phone"`
+		Currency string `json:"currency" binding:"required"`
+		Items    []struct {
+			VariantID  uint            `json:"variant_id" binding:"required"`
+			Quantity   int             `json:"quantity" binding:"required,min=1"`
+			Properties json.RawMessage `json:"properties"`
+		} `json:"items" binding:"required,min=1,dive"`
+		ShippingAddress json.RawMessage `json:"shipping_address"`
+		BillingAddress  json.RawMessage `json:"billing_address"`
+		Note            string          `json:"note"`
+		LandingSite     string          `json:"landing_site"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerID := middleware.CustomerID(c)
+	if customerID == 0 && req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required for guest checkout"})
+		return
+	}
+
+	in := service.CheckoutInput{
+		ShopID:          middleware.ShopID(c),
+		CustomerID:      customerID,
+		Email:           req.Email,
+		Phone:           req.Phone,
+		Currency:        req.Currency,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		Note:            req.Note,
+		ClientIP:        c.ClientIP(),
+		UserAgent:       c.Request.UserAgent(),
+		LandingSite:     req.LandingSite,
+	}
+	for _, item := range req.Items {
+		in.Items = append(in.Items, service.CheckoutItem{
+			VariantID:  item.VariantID,
+			Quantity:   item.Quantity,
+			Properties: item.Properties,
+		})
+	}
+
+	order, err := h.service.CreateOrder(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, service.ErrEmptyCart) || errors.Is(err, service.ErrVariantUnavailable) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	order, err := h.service.GetOrder(c.Request.Context(), middleware.ShopID(c), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// MarkPaid records a manual payment for an order
+func (h *OrderHandler) MarkPaid(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	order, err := h.service.MarkPaid(c.Request.Context(), middleware.ShopID(c), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
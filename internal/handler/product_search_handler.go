@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"shop/internal/middleware"
+	"shop/internal/service"
+	"shop/pkg/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSearchPageSize caps page_size of storefront searches
+const maxSearchPageSize = 100
+
+type ProductSearchHandler struct {
+	service service.ProductSearchService
+}
+
+func NewProductSearchHandler(service service.ProductSearchService) *ProductSearchHandler {
+	return &ProductSearchHandler{service: service}
+}
+
+// Search is the storefront product search. Besides q, page and page_size it
+// takes sort ("price_min:asc"), price_min/price_max, in_stock, option[name]
+// (comma-separated values match any), facets (option names, counted per
+// value) and price_ranges (ascending bucket boundaries). Instead of page,
+// cursor takes the next_cursor of the previous page, which reaches past the
+// engine's offset limits. Text queries highlight matches in title and body.
+// First pages of text queries return a search_id, which clients send back
+// with Click.
+func (h *ProductSearchHandler) Search(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > maxSearchPageSize {
+		pageSize = 20
+	}
+
+	opts, err := productSearchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts.Limit = pageSize
+	opts.Offset = (page - 1) * pageSize
+	if opts.Cursor = c.Query("cursor"); opts.Cursor != "" {
+		opts.Offset = 0
+	}
+	query := c.Query("q")
+	if strings.TrimSpace(query) != "" {
+		opts.Highlight = []string{"title", "body"}
+	}
+
+	result, err := h.service.Search(c.Request.Context(), middleware.ShopID(c), query, opts)
+	if err != nil {
+		writeProductSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products":    result.Products,
+		"total":       result.Total,
+		"facets":      result.Facets,
+		"next_cursor": result.NextCursor,
+		"search_id":   result.SearchID,
+	})
+}
+
+type searchClickRequest struct {
+	SearchID  string `json:"search_id" binding:"required"`
+	ProductID uint   `json:"product_id" binding:"required"`
+}
+
+// Click logs the product a shopper opened from search results, with the
+// search_id of the results' first page
+func (h *ProductSearchHandler) Click(c *gin.Context) {
+	var req searchClickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.Click(c.Request.Context(), middleware.ShopID(c), req.SearchID, req.ProductID); err != nil {
+		writeProductSearchError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Suggest completes the search box as the shopper types q; limit defaults to 5
+func (h *ProductSearchHandler) Suggest(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(service.DefaultSuggestLimit)))
+
+	suggestions, err := h.service.Suggest(c.Request.Context(), middleware.ShopID(c), c.Query("q"), limit)
+	if err != nil {
+		writeProductSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+func productSearchOptions(c *gin.Context) (*search.SearchOptions, error) {
+	opts := &search.SearchOptions{}
+
+	sortFields, err := search.ParseSort(c.Query("sort"))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sortFields {
+		if !contains(service.ProductSearchIndex.Sortable, s.Field) {
+			return nil, fmt.Errorf("cannot sort by %q", s.Field)
+		}
+	}
+	opts.Sort = sortFields
+
+	var filters []search.Filter
+	for _, bound := range []struct {
+		param string
+		op    func(string, interface{}) search.Filter
+	}{{"price_min", search.Gte}, {"price_max", search.Lte}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", bound.param)
+		}
+		// A product matches when its cheapest variant is in range
+		filters = append(filters, bound.op("price_min", price))
+	}
+	if raw := c.Query("in_stock"); raw != "" {
+		inStock, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("invalid in_stock")
+		}
+		filters = append(filters, search.Eq("in_stock", inStock))
+	}
+	for name, raw := range c.QueryMap("option") {
+		var values []interface{}
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			filters = append(filters, search.In("options."+name, values...))
+		}
+	}
+	opts.Filter = search.And(filters...)
+
+	for _, name := range strings.Split(c.Query("facets"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Facets = append(opts.Facets, search.TermsFacet("options."+name, 0))
+		}
+	}
+	if raw := c.Query("price_ranges"); raw != "" {
+		var boundaries []float64
+		for _, v := range strings.Split(raw, ",") {
+			boundary, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || len(boundaries) > 0 && boundary <= boundaries[len(boundaries)-1] {
+				return nil, errors.New("price_ranges must be ascending numbers")
+			}
+			boundaries = append(boundaries, boundary)
+		}
+		opts.Facets = append(opts.Facets, search.RangeFacet("price_min", boundaries...))
+	}
+	return opts, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeProductSearchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, search.ErrInvalidFilter), errors.Is(err, search.ErrInvalidSort), errors.Is(err, search.ErrInvalidCursor),
+		errors.Is(err, service.ErrSearchShopMissing), errors.Is(err, service.ErrInvalidSearchClick):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, search.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "search is temporarily unavailable"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
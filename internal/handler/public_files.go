@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// hiddenPrefixes are never served by PublicFiles: private objects, quarantined
+// uploads and unfinished multipart parts
+var hiddenPrefixes = []string{"private", "quarantine", "temp"}
+
+// PublicFiles exposes a local storage root without its non-public prefixes
+// and without directory listings. Meant for development only; release
+// deployments serve public objects from the web server or CDN.
+func PublicFiles(root string) http.FileSystem {
+	return publicFS{http.Dir(root)}
+}
+
+type publicFS struct {
+	fs http.FileSystem
+}
+
+func (p publicFS) Open(name string) (http.File, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	top := strings.SplitN(cleaned, "/", 2)[0]
+	for _, prefix := range hiddenPrefixes {
+		if top == prefix {
+			return nil, os.ErrNotExist
+		}
+	}
+
+	f, err := p.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shop/internal/middleware"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	service service.ReportService
+}
+
+func NewReportHandler(service service.ReportService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// Sales returns the daily sales series with totals (orders, AOV, conversion, refunds)
+func (h *ReportHandler) Sales(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.service.Sales(c.Request.Context(), middleware.ShopID(c), from, to)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// TopProducts ranks products, or variants with by=variant, by sales
+func (h *ReportHandler) TopProducts(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	products, err := h.service.TopProducts(c.Request.Context(), middleware.ShopID(c), from, to, c.Query("by") == "variant", limit)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"products": products})
+}
+
+// SearchQueries ranks the storefront's most searched queries and the ones
+// that found no products
+func (h *ReportHandler) SearchQueries(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	report, err := h.service.SearchQueries(c.Request.Context(), middleware.ShopID(c), from, to, limit)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *ReportHandler) Discounts(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.service.Discounts(c.Request.Context(), middleware.ShopID(c), from, to)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Rebuild re-aggregates the shop's summary tables for a date range
+func (h *ReportHandler) Rebuild(c *gin.Context) {
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Rebuild(c.Request.Context(), middleware.ShopID(c), from, to); err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "reports rebuilt"})
+}
+
+// Export writes a report as CSV to a private file and returns its download URL
+func (h *ReportHandler) Export(c *gin.Context) {
+	var req struct {
+		Report string `json:"report" binding:"required"`
+		From   string `json:"from"`
+		To     string `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := service.ParseReportRange(req.From, req.To)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	file, err := h.service.Export(c.Request.Context(), middleware.ShopID(c), middleware.UserID(c), req.Report, from, to)
+	if err != nil {
+		writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file": file, "url": fmt.Sprintf("/api/admin/files/%d/download", file.ID)})
+}
+
+func reportRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, to, err := service.ParseReportRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func writeReportError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidReportRange) || errors.Is(err, service.ErrUnknownReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
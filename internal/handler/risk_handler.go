@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"shop/internal/middleware"
+	"shop/internal/model"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RiskHandler struct {
+	service service.RiskService
+}
+
+func NewRiskHandler(service service.RiskService) *RiskHandler {
+	return &RiskHandler{service: service}
+}
+
+// GetOrderRisk returns the stored risk assessment of an order
+func (h *RiskHandler) GetOrderRisk(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	risk, err := h.service.GetRisk(c.Request.Context(), middleware.ShopID(c), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "risk not evaluated yet"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, risk)
+}
+
+// EvaluateOrder re-runs the risk engine synchronously, e.g. after rules changed
+func (h *RiskHandler) EvaluateOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	risk, err := h.service.Evaluate(c.Request.Context(), middleware.ShopID(c), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, risk)
+}
+
+func (h *RiskHandler) GetRules(c *gin.Context) {
+	rules, err := h.service.GetRules(c.Request.Context(), middleware.ShopID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *RiskHandler) UpdateRules(c *gin.Context) {
+	var rules model.RiskRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.UpdateRules(c.Request.Context(), middleware.ShopID(c), rules); err != nil {
+		if errors.Is(err, service.ErrInvalidRiskRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"shop/internal/middleware"
+	"shop/internal/model"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchSettingsHandler struct {
+	service service.SearchSettingsService
+}
+
+func NewSearchSettingsHandler(service service.SearchSettingsService) *SearchSettingsHandler {
+	return &SearchSettingsHandler{service: service}
+}
+
+// GetRules returns the shop's synonym groups and pinned results
+func (h *SearchSettingsHandler) GetRules(c *gin.Context) {
+	rules, err := h.service.GetRules(c.Request.Context(), middleware.ShopID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// UpdateRules replaces the rules; products are reindexed in the background
+// when the synonyms changed
+func (h *SearchSettingsHandler) UpdateRules(c *gin.Context) {
+	var rules model.SearchRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.UpdateRules(c.Request.Context(), middleware.ShopID(c), rules)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearchRules) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"shop/internal/middleware"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StaffHandler struct {
+	service service.StaffService
+}
+
+func NewStaffHandler(service service.StaffService) *StaffHandler {
+	return &StaffHandler{service: service}
+}
+
+// Login signs a platform user in to the admin of the shop in X-Shop-ID
+func (h *StaffHandler) Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, token, err := h.service.Login(c.Request.Context(), middleware.ShopID(c), req.Email, req.Password)
+	if err != nil {
+		writeStaffError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "token": token})
+}
+
+// PlatformLogin signs a platform administrator in to the SaaS management API
+func (h *StaffHandler) PlatformLogin(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, token, err := h.service.PlatformLogin(c.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		writeStaffError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "token": token})
+}
+
+type loginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+func writeStaffError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotShopMember), errors.Is(err, service.ErrNotPlatformAdmin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
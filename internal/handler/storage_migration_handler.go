@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shop/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StorageMigrationHandler struct {
+	service service.StorageMigrationService
+}
+
+func NewStorageMigrationHandler(service service.StorageMigrationService) *StorageMigrationHandler {
+	return &StorageMigrationHandler{service: service}
+}
+
+// Start begins copying every object to the new storage provider
+func (h *StorageMigrationHandler) Start(c *gin.Context) {
+	migration, err := h.service.Start(c.Request.Context())
+	if err != nil {
+		writeStorageMigrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, migration)
+}
+
+// Resume continues an interrupted migration or re-verifies a finished one
+func (h *StorageMigrationHandler) Resume(c *gin.Context) {
+	id, ok := migrationID(c)
+	if !ok {
+		return
+	}
+
+	migration, err := h.service.Resume(c.Request.Context(), id)
+	if err != nil {
+		writeStorageMigrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, migration)
+}
+
+// Get reports a migration's progress
+func (h *StorageMigrationHandler) Get(c *gin.Context) {
+	id, ok := migrationID(c)
+	if !ok {
+		return
+	}
+
+	migration, err := h.service.Get(c.Request.Context(), id)
+	if err != nil {
+		writeStorageMigrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+// List returns the most recent migrations
+func (h *StorageMigrationHandler) List(c *gin.Context) {
+	migrations, err := h.service.List(c.Request.Context())
+	if err != nil {
+		writeStorageMigrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrations": migrations})
+}
+
+func migrationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid migration id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeStorageMigrationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "migration not found"})
+	case errors.Is(err, service.ErrNoStorageMigration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStorageMigrationBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
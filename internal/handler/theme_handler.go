@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"shop/internal/infra/storage"
+	"shop/internal/middleware"
+	"shop/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ThemeHandler struct {
+	service service.ThemeService
+}
+
+func NewThemeHandler(service service.ThemeService) *ThemeHandler {
+	return &ThemeHandler{service: service}
+}
+
+func (h *ThemeHandler) List(c *gin.Context) {
+	themes, err := h.service.List(c.Request.Context(), middleware.ShopID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"themes": themes})
+}
+
+// Upload installs a new theme from a zip package
+func (h *ThemeHandler) Upload(c *gin.Context) {
+	h.upload(c, 0)
+}
+
+// UploadVersion adds a new package version to an existing theme
+func (h *ThemeHandler) UploadVersion(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+	h.upload(c, id)
+}
+
+func (h *ThemeHandler) upload(c *gin.Context, id uint) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	theme, err := h.service.Upload(c.Request.Context(), middleware.ShopID(c), id, file)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, theme)
+}
+
+func (h *ThemeHandler) Get(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	theme, err := h.service.Get(c.Request.Context(), middleware.ShopID(c), id)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, theme)
+}
+
+func (h *ThemeHandler) Delete(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), middleware.ShopID(c), id); err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ThemeHandler) ListVersions(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.service.ListVersions(c.Request.Context(), middleware.ShopID(c), id)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// DownloadPackage streams the zip package of a theme version
+func (h *ThemeHandler) DownloadPackage(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+
+	v, body, err := h.service.OpenPackage(c.Request.Context(), middleware.ShopID(c), id, version)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+	defer body.Close()
+
+	filename := fmt.Sprintf("theme-%d-v%d.zip", id, v.Version)
+	c.DataFromReader(http.StatusOK, -1, "application/zip", body, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+		"Cache-Control":       "private, no-cache",
+	})
+}
+
+func (h *ThemeHandler) Rollback(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Version int `json:"version" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	theme, err := h.service.Rollback(c.Request.Context(), middleware.ShopID(c), id, req.Version)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, theme)
+}
+
+// Publish switches the shop's active theme
+func (h *ThemeHandler) Publish(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Publish(c.Request.Context(), middleware.ShopID(c), id); err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "theme published"})
+}
+
+func (h *ThemeHandler) UpdateSettings(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	var values map[string]interface{}
+	if err := c.ShouldBindJSON(&values); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	theme, err := h.service.UpdateSettings(c.Request.Context(), middleware.ShopID(c), id, values)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, theme)
+}
+
+// Preview returns a signed token to render an unpublished theme on the storefront
+func (h *ThemeHandler) Preview(c *gin.Context) {
+	id, ok := themeID(c)
+	if !ok {
+		return
+	}
+
+	token, expires, err := h.service.PreviewToken(c.Request.Context(), middleware.ShopID(c), id)
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preview_theme": token, "expires_at": expires})
+}
+
+// Settings returns the merged settings of the active (or previewed) theme to the storefront
+func (h *ThemeHandler) Settings(c *gin.Context) {
+	theme, settings, err := h.service.StorefrontSettings(c.Request.Context(), middleware.ShopID(c), c.Query("preview_theme"))
+	if err != nil {
+		writeThemeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"theme_id":    theme.ID,
+		"name":        theme.Name,
+		"version":     theme.Version,
+		"source_path": theme.SourcePath,
+		"settings":    settings,
+	})
+}
+
+func themeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeThemeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "theme not found"})
+	case errors.Is(err, service.ErrInvalidThemePackage), errors.Is(err, service.ErrInvalidThemeSettings):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrActiveThemeDelete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidPreviewToken):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
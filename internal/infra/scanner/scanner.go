@@ -0,0 +1,18 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result is the verdict of a scan
+type Result struct {
+	Clean     bool   `json:"clean"`
+	Signature string `json:"signature,omitempty"` // name of the detected threat
+}
+
+// Scanner inspects uploaded content for malware
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
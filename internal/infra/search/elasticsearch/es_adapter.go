@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
 	"shop/internal/config"
 	"shop/internal/infra/search"
 
+	engines "shop/pkg/search"
+
 	"github.com/elastic/go-elasticsearch/v8"
 	"go.uber.org/zap"
 )
@@ -21,6 +25,9 @@ func NewESAdapter(cfg *config.Config, logger *zap.Logger) (search.Engine, error)
 		Addresses: cfg.Elasticsearch.Addresses,
 		Username:  cfg.Elasticsearch.Username,
 		Password:  cfg.Elasticsearch.Password,
+		// Retried with backoff on 429 and 5xx, as by shop/pkg/search
+		Transport:    &engines.RetryTransport{},
+		DisableRetry: true,
 	}
 
 	client, err := elasticsearch.NewClient(esCfg)
@@ -43,15 +50,18 @@ func (e *ESAdapter) Index(ctx context.Context, indexName string, docID string, d
 		e.client.Index.WithDocumentID(docID),
 		e.client.Index.WithContext(ctx),
 	)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	return engines.ESDecode(res, err, nil)
+}
 
-	if res.IsError() {
-		return res.String()
-	}
-	return nil
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source interface{} `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
 }
 
 func (e *ESAdapter) Search(ctx context.Context, indexName string, query string, opts ...search.SearchOption) (*search.Result, error) {
@@ -81,37 +91,32 @@ func (e *ESAdapter) Search(ctx context.Context, indexName string, query string,
 		e.client.Search.WithIndex(indexName),
 		e.client.Search.WithBody(&buf),
 	)
-	if err != nil {
+	var r searchResponse
+	if err := engines.ESDecode(res, err, &r); err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return nil, err
-	}
-
-	hits := r["hits"].(map[string]interface{})
-	total := hits["total"].(map[string]interface{})["value"].(float64)
-	hitsList := hits["hits"].([]interface{})
 
 	// Extract source from hits
-	var results []interface{}
-	for _, hit := range hitsList {
-		results = append(results, hit.(map[string]interface{})["_source"])
+	results := make([]interface{}, len(r.Hits.Hits))
+	for i, hit := range r.Hits.Hits {
+		results[i] = hit.Source
 	}
 
 	return &search.Result{
 		Hits:  results,
-		Total: int64(total),
+		Total: r.Hits.Total.Value,
 	}, nil
 }
 
 func (e *ESAdapter) Delete(ctx context.Context, indexName string, docID string) error {
 	res, err := e.client.Delete(indexName, docID, e.client.Delete.WithContext(ctx))
-	if err != nil {
-		return err
+	if err == nil && res.StatusCode == http.StatusNotFound {
+		// Already gone, unless the index is
+		err = engines.ESDecode(res, nil, nil)
+		if errors.Is(err, search.ErrIndexNotFound) {
+			return err
+		}
+		return nil
 	}
-	defer res.Body.Close()
-	return nil
+	return engines.ESDecode(res, err, nil)
 }
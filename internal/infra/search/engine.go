@@ -1,6 +1,18 @@
 package search
 
-import "context"
+import (
+	"context"
+
+	engines "shop/pkg/search"
+)
+
+// Errors the adapters return as *engines.EngineError, the same as the
+// engines of shop/pkg/search
+var (
+	ErrIndexNotFound   = engines.ErrIndexNotFound
+	ErrVersionConflict = engines.ErrVersionConflict
+	ErrUnavailable     = engines.ErrUnavailable
+)
 
 // Engine defines the common interface for search engines
 type Engine interface {
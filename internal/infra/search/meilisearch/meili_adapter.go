@@ -0,0 +1,117 @@
+package meilisearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shop/internal/config"
+	"shop/internal/infra/search"
+
+	engines "shop/pkg/search"
+
+	meilisearchgo "github.com/meilisearch/meilisearch-go"
+	"go.uber.org/zap"
+)
+
+type MeiliAdapter struct {
+	client meilisearchgo.ServiceManager
+	logger *zap.Logger
+}
+
+func NewMeiliAdapter(cfg *config.Config, logger *zap.Logger) (search.Engine, error) {
+	client := meilisearchgo.New(
+		cfg.Meilisearch.Host,
+		meilisearchgo.WithAPIKey(cfg.Meilisearch.APIKey),
+		// Retried with backoff on 429 and 5xx, as by shop/pkg/search
+		meilisearchgo.WithCustomClient(&http.Client{Transport: &engines.RetryTransport{}}),
+		meilisearchgo.DisableRetries(),
+	)
+
+	// Optional: Health check
+	if _, err := client.Health(); err != nil {
+		logger.Warn("Failed to connect to Meilisearch", zap.Error(err))
+	} else {
+		logger.Info("Connected to Meilisearch", zap.String("host", cfg.Meilisearch.Host))
+	}
+
+	return &MeiliAdapter{client: client, logger: logger}, nil
+}
+
+func (m *MeiliAdapter) Index(ctx context.Context, indexName string, docID string, doc interface{}) error {
+	index := m.client.Index(indexName)
+	// Meilisearch expects a list of documents or a single document map
+	// If doc is struct, we might need to wrap it in array for AddDocuments
+	task, err := index.AddDocumentsWithContext(ctx, []interface{}{doc}, nil)
+	if err != nil {
+		return classify(err)
+	}
+	m.logger.Debug("Indexed document", zap.Int64("taskUID", task.TaskUID))
+	return nil
+}
+
+func (m *MeiliAdapter) Search(ctx context.Context, indexName string, query string, opts ...search.SearchOption) (*search.Result, error) {
+	options := &search.SearchOptions{Limit: 20}
+	for _, o := range opts {
+		o(options)
+	}
+
+	req := &meilisearchgo.SearchRequest{
+		Limit:  int64(options.Limit),
+		Offset: int64(options.Offset),
+	}
+	if options.Filter != "" {
+		req.Filter = options.Filter
+	}
+
+	resp, err := m.client.Index(indexName).SearchWithContext(ctx, query, req)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	hits := make([]interface{}, len(resp.Hits))
+	for i, hit := range resp.Hits {
+		var doc map[string]interface{}
+		data, err := json.Marshal(hit)
+		if err == nil {
+			err = json.Unmarshal(data, &doc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		hits[i] = doc
+	}
+
+	return &search.Result{
+		Hits:  hits,
+		Total: resp.EstimatedTotalHits,
+	}, nil
+}
+
+func (m *MeiliAdapter) Delete(ctx context.Context, indexName string, docID string) error {
+	_, err := m.client.Index(indexName).DeleteDocumentWithContext(ctx, docID, nil)
+	return classify(err)
+}
+
+// classify turns the client's errors for responses and unreachable servers
+// into *engines.EngineError
+func classify(err error) error {
+	var apiErr *meilisearchgo.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrCode {
+	case meilisearchgo.MeilisearchApiError, meilisearchgo.MeilisearchApiErrorWithoutMessage:
+		e := engines.NewEngineError("meilisearch", apiErr.StatusCode, apiErr.MeilisearchApiError.Code, apiErr.MeilisearchApiError.Message)
+		e.Err = err
+		return e
+	case meilisearchgo.MeilisearchTimeoutError:
+		return apiErr.OriginError
+	case meilisearchgo.MeilisearchCommunicationError:
+		if errors.Is(apiErr.OriginError, context.Canceled) {
+			return apiErr.OriginError
+		}
+		return &engines.EngineError{Engine: "meilisearch", Message: apiErr.OriginError.Error(), Kind: engines.ErrUnavailable, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+	"shop/internal/infra/storage/storagetest"
+	"shop/pkg/utils"
+
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T) *LocalStorage {
+	cfg := &config.Config{}
+	cfg.Server.SecretKey = "test-secret"
+	cfg.Storage.Local.Path = t.TempDir()
+	cfg.Storage.Local.URL = "http://localhost:8080/uploads"
+	return NewLocalStorage(cfg, zap.NewNop()).(*LocalStorage)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Provider {
+		return newTestStorage(t)
+	})
+}
+
+func TestPresignedURLs(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	put, err := s.PresignPut(ctx, "products/a.jpg", storage.PresignOptions{
+		Expires: time.Minute, ContentType: "image/jpeg", ContentLength: 42,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if put.Method != http.MethodPut || put.Headers["Content-Type"] != "image/jpeg" {
+		t.Errorf("presigned PUT = %+v", put)
+	}
+	signed, err := url.Parse(put.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := s.VerifySignedURL(http.MethodPut, "products/a.jpg", signed.Query())
+	if err != nil {
+		t.Fatalf("VerifySignedURL = %v", err)
+	}
+	if opts.ContentType != "image/jpeg" || opts.ContentLength != 42 || opts.Expires <= 0 || opts.Expires > time.Minute {
+		t.Errorf("verified constraints = %+v", opts)
+	}
+
+	tampered := map[string]func(q url.Values){
+		"content type":   func(q url.Values) { q.Set("content_type", "text/html") },
+		"content length": func(q url.Values) { q.Set("content_length", "4200") },
+		"no length":      func(q url.Values) { q.Del("content_length") },
+		"expiry":         func(q url.Values) { q.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)) },
+		"signature":      func(q url.Values) { q.Set("signature", strings.Repeat("0", 64)) },
+	}
+	for name, tamper := range tampered {
+		query := signed.Query()
+		tamper(query)
+		if _, err := s.VerifySignedURL(http.MethodPut, "products/a.jpg", query); !errors.Is(err, storage.ErrInvalidSignature) {
+			t.Errorf("tampered %s: got %v, want ErrInvalidSignature", name, err)
+		}
+	}
+	if _, err := s.VerifySignedURL(http.MethodGet, "products/a.jpg", signed.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+		t.Errorf("PUT URL used for GET: got %v, want ErrInvalidSignature", err)
+	}
+	if _, err := s.VerifySignedURL(http.MethodPut, "products/b.jpg", signed.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+		t.Errorf("URL used for another key: got %v, want ErrInvalidSignature", err)
+	}
+
+	other := newTestStorage(t)
+	other.secret = "other-secret"
+	if _, err := other.VerifySignedURL(http.MethodPut, "products/a.jpg", signed.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+		t.Errorf("URL checked with another secret: got %v, want ErrInvalidSignature", err)
+	}
+
+	expired, err := s.PresignGet(ctx, "products/a.jpg", storage.PresignOptions{Expires: -time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err = url.Parse(expired.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.VerifySignedURL(http.MethodGet, "products/a.jpg", signed.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+		t.Errorf("expired URL: got %v, want ErrInvalidSignature", err)
+	}
+
+	if _, err := s.PresignPut(ctx, "../a.jpg", storage.PresignOptions{Expires: time.Minute}); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("presign outside the root: got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestMultipartUploadIDs(t *testing.T) {
+	p := newTestStorage(t)
+	ctx := context.Background()
+
+	// A sibling of temp/ that a crafted upload ID could otherwise reach
+	keep := filepath.Join(p.baseDir, "keep")
+	if err := os.MkdirAll(keep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uploadID := range []string{"", "..", "../keep", "a/b", "{" + utils.GenerateUUID() + "}"} {
+		if _, err := p.UploadPart(ctx, "x", uploadID, 1, strings.NewReader("x"), 1, storage.PartChecksum{}); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("UploadPart(%q) error = %v, want ErrInvalidKey", uploadID, err)
+		}
+		if _, err := p.ListParts(ctx, "x", uploadID); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("ListParts(%q) error = %v, want ErrInvalidKey", uploadID, err)
+		}
+		if _, err := p.CompleteMultipartUpload(ctx, "x", uploadID, nil); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("CompleteMultipartUpload(%q) error = %v, want ErrInvalidKey", uploadID, err)
+		}
+		if err := p.AbortMultipartUpload(ctx, "x", uploadID); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("AbortMultipartUpload(%q) error = %v, want ErrInvalidKey", uploadID, err)
+		}
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("abort removed a directory outside temp/: %v", err)
+	}
+
+	uploadID, err := p.InitiateMultipartUpload(ctx, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CompleteMultipartUpload(ctx, "../outside", uploadID, nil); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("CompleteMultipartUpload(../outside) error = %v, want ErrInvalidKey", err)
+	}
+}
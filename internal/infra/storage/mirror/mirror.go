@@ -0,0 +1,239 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+
+	"shop/internal/infra/storage"
+
+	"go.uber.org/zap"
+)
+
+// MirrorStorage serves a storage migration: the destination is primary, reads
+// of objects it does not hold yet fall back to the source, and with dual
+// writes every new object also lands on the source so the cutover can be
+// rolled back. Writes to the source are best effort and only logged.
+type MirrorStorage struct {
+	primary   storage.Provider
+	fallback  storage.Provider
+	dualWrite bool
+	logger    *zap.Logger
+}
+
+func NewMirrorStorage(primary, fallback storage.Provider, dualWrite bool, logger *zap.Logger) storage.Provider {
+	return &MirrorStorage{primary: primary, fallback: fallback, dualWrite: dualWrite, logger: logger}
+}
+
+// PutObject streams data to both providers at once through a pipe
+func (m *MirrorStorage) PutObject(ctx context.Context, key string, data io.Reader, size int64) (string, error) {
+	if !m.dualWrite {
+		return m.primary.PutObject(ctx, key, data, size)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := m.fallback.PutObject(ctx, key, pr, size); err != nil {
+			m.logger.Warn("Mirror write to source storage failed", zap.String("key", key), zap.Error(err))
+		}
+		// Keep draining so a failed mirror never stalls the primary write
+		io.Copy(io.Discard, pr)
+	}()
+
+	url, err := m.primary.PutObject(ctx, key, io.TeeReader(data, pw), size)
+	if err != nil {
+		pw.CloseWithError(err)
+	} else {
+		pw.Close()
+	}
+	<-done
+	return url, err
+}
+
+func (m *MirrorStorage) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := m.primary.GetObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return m.fallback.GetObject(ctx, key)
+	}
+	return body, err
+}
+
+func (m *MirrorStorage) GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	body, err := m.primary.GetObjectRange(ctx, key, offset, length)
+	if errors.Is(err, storage.ErrNotFound) {
+		return m.fallback.GetObjectRange(ctx, key, offset, length)
+	}
+	return body, err
+}
+
+func (m *MirrorStorage) StatObject(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	info, err := m.primary.StatObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return m.fallback.StatObject(ctx, key)
+	}
+	return info, err
+}
+
+// ListObjects merges both listings. A truncated listing only covers keys up
+// to its last one, so the merged page stops there to keep paging gap-free.
+func (m *MirrorStorage) ListObjects(ctx context.Context, opts storage.ListOptions) (*storage.ListResult, error) {
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = storage.DefaultMaxKeys
+	}
+	opts.MaxKeys = maxKeys
+
+	var merged []storage.ObjectInfo
+	seen := map[string]bool{}
+	bound, truncated := "", false
+	for _, p := range []storage.Provider{m.primary, m.fallback} {
+		page, err := p.ListObjects(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Objects {
+			if !seen[obj.Key] {
+				seen[obj.Key] = true
+				merged = append(merged, obj)
+			}
+		}
+		if page.IsTruncated {
+			last := page.Objects[len(page.Objects)-1].Key
+			if !truncated || last < bound {
+				bound = last
+			}
+			truncated = true
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Key < merged[j].Key })
+
+	result := &storage.ListResult{IsTruncated: truncated}
+	for _, obj := range merged {
+		if (truncated && obj.Key > bound) || len(result.Objects) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.Objects = append(result.Objects, obj)
+	}
+	return result, nil
+}
+
+// CopyObject copies within the primary, pulling the source object over from
+// the fallback when it has not been migrated yet
+func (m *MirrorStorage) CopyObject(ctx context.Context, src, dst string) error {
+	err := m.primary.CopyObject(ctx, src, dst)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = m.transfer(ctx, m.fallback, m.primary, src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if m.dualWrite {
+		if err := m.fallback.CopyObject(ctx, src, dst); err != nil {
+			m.logger.Warn("Mirror copy on source storage failed", zap.String("key", dst), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// DeleteObject removes the object from both providers, otherwise the
+// fallback would resurrect it
+func (m *MirrorStorage) DeleteObject(ctx context.Context, key string) error {
+	if err := m.primary.DeleteObject(ctx, key); err != nil {
+		return err
+	}
+	return m.fallback.DeleteObject(ctx, key)
+}
+
+// Multipart uploads go to the primary; the assembled object is mirrored
+func (m *MirrorStorage) InitiateMultipartUpload(ctx context.Context, key string) (string, error) {
+	return m.primary.InitiateMultipartUpload(ctx, key)
+}
+
+func (m *MirrorStorage) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64, checksum storage.PartChecksum) (string, error) {
+	return m.primary.UploadPart(ctx, key, uploadID, partNumber, data, size, checksum)
+}
+
+func (m *MirrorStorage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []storage.Part) (string, error) {
+	url, err := m.primary.CompleteMultipartUpload(ctx, key, uploadID, parts)
+	if err != nil {
+		return "", err
+	}
+	if m.dualWrite {
+		if err := m.transfer(ctx, m.primary, m.fallback, key, key); err != nil {
+			m.logger.Warn("Mirror write to source storage failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+	return url, nil
+}
+
+func (m *MirrorStorage) ListParts(ctx context.Context, key string, uploadID string) ([]storage.Part, error) {
+	return m.primary.ListParts(ctx, key, uploadID)
+}
+
+func (m *MirrorStorage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return m.primary.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+// PresignPut targets the primary only: the upload bypasses us, so it is not
+// mirrored to the source
+func (m *MirrorStorage) PresignPut(ctx context.Context, key string, opts storage.PresignOptions) (*storage.PresignedRequest, error) {
+	return m.primary.PresignPut(ctx, key, opts)
+}
+
+func (m *MirrorStorage) PresignGet(ctx context.Context, key string, opts storage.PresignOptions) (*storage.PresignedRequest, error) {
+	if _, err := m.primary.StatObject(ctx, key); errors.Is(err, storage.ErrNotFound) {
+		return m.fallback.PresignGet(ctx, key, opts)
+	}
+	return m.primary.PresignGet(ctx, key, opts)
+}
+
+func (m *MirrorStorage) GetURL(key string) string {
+	return m.primary.GetURL(key)
+}
+
+// VerifySignedURL and Open serve the presigned URLs of whichever side is
+// local disk
+func (m *MirrorStorage) VerifySignedURL(method, key string, query url.Values) (storage.PresignOptions, error) {
+	server, ok := m.signedURLServer()
+	if !ok {
+		return storage.PresignOptions{}, storage.ErrInvalidSignature
+	}
+	return server.VerifySignedURL(method, key, query)
+}
+
+func (m *MirrorStorage) Open(key string) (*os.File, error) {
+	server, ok := m.signedURLServer()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return server.Open(key)
+}
+
+func (m *MirrorStorage) signedURLServer() (storage.SignedURLServer, bool) {
+	if server, ok := m.primary.(storage.SignedURLServer); ok {
+		return server, true
+	}
+	server, ok := m.fallback.(storage.SignedURLServer)
+	return server, ok
+}
+
+// transfer streams an object from one provider to another
+func (m *MirrorStorage) transfer(ctx context.Context, from, to storage.Provider, src, dst string) error {
+	info, err := from.StatObject(ctx, src)
+	if err != nil {
+		return err
+	}
+	body, err := from.GetObject(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = to.PutObject(ctx, dst, body, info.Size)
+	return err
+}
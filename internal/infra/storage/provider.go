@@ -2,25 +2,137 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned when a presigned URL is forged, tampered with or expired
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+	// ErrInvalidKey is returned for keys that escape the storage root
+	ErrInvalidKey = errors.New("invalid object key")
+	// ErrNotFound is returned when reading, stating or copying a missing object
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidRange is returned for range reads starting beyond the end of the object
+	ErrInvalidRange = errors.New("invalid object range")
+	// ErrInvalidPart is returned when a multipart part is missing, truncated or has a different ETag
+	ErrInvalidPart = errors.New("invalid upload part")
+	// ErrChecksumMismatch is returned when a part does not match its declared checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
 )
 
 // Part represents a part of a multipart upload
 type Part struct {
 	PartNumber int    `json:"part_number"`
-	ETag       string `json:"etag"`
+	ETag       string `json:"etag"`             // hex MD5 of the part on every provider
+	Size       int64  `json:"size,omitempty"`   // filled by ListParts
+	SHA256     string `json:"sha256,omitempty"` // filled when the part passed through our API
+}
+
+// PartChecksum holds optional hex digests of a part. Providers refuse to store
+// a part that does not match them, keeping any earlier upload of the part.
+type PartChecksum struct {
+	MD5    string
+	SHA256 string
+}
+
+// NormalizeETag strips the quotes S3 puts around ETags and lowercases the hex
+func NormalizeETag(etag string) string {
+	return strings.ToLower(strings.Trim(etag, `"`))
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`   // may be empty in ListObjects results
+	ETag         string    `json:"etag,omitempty"` // provider specific, only comparable within one provider
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListOptions selects a page of objects in lexicographic key order
+type ListOptions struct {
+	Prefix     string
+	StartAfter string // exclusive; pass the last key of the previous page
+	MaxKeys    int    // 0 = 1000
+}
+
+// ListResult is a page of ListObjects
+type ListResult struct {
+	Objects     []ObjectInfo `json:"objects"`
+	IsTruncated bool         `json:"is_truncated"`
+}
+
+// DefaultMaxKeys is the page size of ListObjects when MaxKeys is unset
+const DefaultMaxKeys = 1000
+
+// PresignOptions constrains what a presigned URL may be used for
+type PresignOptions struct {
+	Expires       time.Duration
+	ContentType   string // PUT only: the Content-Type the client must send
+	ContentLength int64  // PUT only: the exact body size the client must send, 0 = unchecked
+}
+
+// PresignedRequest describes a request the client can send directly to storage
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"` // must be sent verbatim
+	ExpiresAt time.Time         `json:"expires_at"`
 }
 
 // Provider defines the interface for file storage
 type Provider interface {
 	// Simple upload
 	PutObject(ctx context.Context, key string, data io.Reader, size int64) (string, error)
+	// GetObject opens an object for reading; the caller closes it
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetObjectRange reads length bytes starting at offset; a negative length
+	// reads to the end and a range past the end is truncated to the object
+	GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// StatObject returns an object's metadata without reading it
+	StatObject(ctx context.Context, key string) (*ObjectInfo, error)
+	// ListObjects returns objects under opts.Prefix in lexicographic key order
+	ListObjects(ctx context.Context, opts ListOptions) (*ListResult, error)
+	// CopyObject copies src to dst within the provider, overwriting dst
+	CopyObject(ctx context.Context, src, dst string) error
+	// DeleteObject removes an object; deleting a missing object is not an error
+	DeleteObject(ctx context.Context, key string) error
 
 	// Multipart upload
 	InitiateMultipartUpload(ctx context.Context, key string) (string, error)
-	UploadPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64) (string, error)
+	UploadPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64, checksum PartChecksum) (string, error)
 	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error)
+	ListParts(ctx context.Context, key string, uploadID string) ([]Part, error)
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+
+	// Presigned direct access
+	PresignPut(ctx context.Context, key string, opts PresignOptions) (*PresignedRequest, error)
+	PresignGet(ctx context.Context, key string, opts PresignOptions) (*PresignedRequest, error)
 
 	// Utility
 	GetURL(key string) string
 }
+
+// SignedURLServer is implemented by providers that cannot hand out native
+// presigned URLs (local disk). Their URLs point back at our API, which
+// verifies them and performs the transfer itself.
+type SignedURLServer interface {
+	// VerifySignedURL validates the signature carried in query and returns
+	// the constraints the URL was issued with
+	VerifySignedURL(method, key string, query url.Values) (PresignOptions, error)
+	Open(key string) (*os.File, error)
+}
+
+// Cutover names the providers of a migration in progress: objects are copied
+// from Source to Destination while the app serves through a mirror of both
+type Cutover struct {
+	Source          Provider
+	Destination     Provider
+	SourceName      string
+	DestinationName string
+}
@@ -0,0 +1,320 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+// S3Storage stores objects in any S3 compatible service (AWS S3, MinIO, OSS)
+// and maps multipart uploads onto the native S3 multipart API
+type S3Storage struct {
+	core    *minio.Core
+	bucket  string
+	baseURL string
+	logger  *zap.Logger
+}
+
+func NewS3Storage(cfg config.S3Config, logger *zap.Logger) (storage.Provider, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage requires endpoint and bucket")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	core, err := minio.NewCore(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimSuffix(cfg.PublicURL, "/")
+	if baseURL == "" {
+		scheme := "http"
+		if cfg.UseSSL {
+			scheme = "https"
+		}
+		if cfg.PathStyle {
+			baseURL = fmt.Sprintf("%s://%s/%s", scheme, cfg.Endpoint, cfg.Bucket)
+		} else {
+			baseURL = fmt.Sprintf("%s://%s.%s", scheme, cfg.Bucket, cfg.Endpoint)
+		}
+	}
+
+	s := &S3Storage{core: core, bucket: cfg.Bucket, baseURL: baseURL, logger: logger}
+	if err := s.ensureBucket(cfg.Region); err != nil {
+		// Not fatal: credentials may lack ListBucket/CreateBucket permissions
+		logger.Warn("Failed to verify s3 bucket", zap.String("bucket", cfg.Bucket), zap.Error(err))
+	}
+	return s, nil
+}
+
+func (s *S3Storage) ensureBucket(region string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exists, err := s.core.BucketExists(ctx, s.bucket)
+	if err != nil || exists {
+		return err
+	}
+	s.logger.Info("Creating s3 bucket", zap.String("bucket", s.bucket))
+	return s.core.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: region})
+}
+
+func (s *S3Storage) PutObject(ctx context.Context, key string, data io.Reader, size int64) (string, error) {
+	key = objectKey(key)
+	_, err := s.core.Client.PutObject(ctx, s.bucket, key, data, size, minio.PutObjectOptions{
+		ContentType: contentType(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.GetURL(key), nil
+}
+
+func (s *S3Storage) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.core.Client.GetObject(ctx, s.bucket, objectKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing object before the first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, mapError(err, key)
+	}
+	return obj, nil
+}
+
+func (s *S3Storage) GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: negative offset", storage.ErrInvalidRange)
+	}
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length > 0:
+		opts.SetRange(offset, offset+length-1)
+	case offset > 0:
+		opts.SetRange(offset, 0)
+	}
+
+	// A plain GET: the lazy minio.Object drops the Range header when stated
+	body, _, _, err := s.core.GetObject(ctx, s.bucket, objectKey(key), opts)
+	if err != nil {
+		return nil, mapError(err, key)
+	}
+	return body, nil
+}
+
+func (s *S3Storage) StatObject(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	info, err := s.core.Client.StatObject(ctx, s.bucket, objectKey(key), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, mapError(err, key)
+	}
+	return objectInfo(info), nil
+}
+
+func (s *S3Storage) ListObjects(ctx context.Context, opts storage.ListOptions) (*storage.ListResult, error) {
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = storage.DefaultMaxKeys
+	}
+
+	// The listing channel pages on its own; one extra key tells whether the
+	// page is truncated, then cancelling stops further requests
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &storage.ListResult{}
+	for obj := range s.core.Client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:     strings.TrimPrefix(opts.Prefix, "/"),
+		StartAfter: opts.StartAfter,
+		Recursive:  true,
+		MaxKeys:    maxKeys + 1,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if len(result.Objects) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.Objects = append(result.Objects, *objectInfo(obj))
+	}
+	return result, nil
+}
+
+func (s *S3Storage) CopyObject(ctx context.Context, src, dst string) error {
+	_, err := s.core.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: objectKey(dst)},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: objectKey(src)})
+	return mapError(err, src)
+}
+
+func (s *S3Storage) DeleteObject(ctx context.Context, key string) error {
+	return s.core.Client.RemoveObject(ctx, s.bucket, objectKey(key), minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) InitiateMultipartUpload(ctx context.Context, key string) (string, error) {
+	key = objectKey(key)
+	return s.core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{
+		ContentType: contentType(key),
+	})
+}
+
+// UploadPart sends the declared checksums as Content-MD5 and
+// x-amz-content-sha256, so S3 rejects a corrupted part before storing it, and
+// returns the ETag computed by the storage service, which must be passed back
+// unchanged to CompleteMultipartUpload
+func (s *S3Storage) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, data io.Reader, size int64, checksum storage.PartChecksum) (string, error) {
+	var opts minio.PutObjectPartOptions
+	if checksum.MD5 != "" {
+		sum, err := hex.DecodeString(checksum.MD5)
+		if err != nil || len(sum) != md5.Size {
+			return "", fmt.Errorf("%w: part %d md5 is not a hex digest", storage.ErrChecksumMismatch, partNumber)
+		}
+		opts.Md5Base64 = base64.StdEncoding.EncodeToString(sum)
+	}
+	if checksum.SHA256 != "" {
+		opts.Sha256Hex = strings.ToLower(checksum.SHA256)
+	}
+	part, err := s.core.PutObjectPart(ctx, s.bucket, objectKey(key), uploadID, partNumber, data, size, opts)
+	if err != nil {
+		return "", mapError(err, key)
+	}
+	return storage.NormalizeETag(part.ETag), nil
+}
+
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []storage.Part) (string, error) {
+	key = objectKey(key)
+
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: p.PartNumber, ETag: storage.NormalizeETag(p.ETag)})
+	}
+	// S3 rejects part lists that are not in ascending order
+	sort.Slice(completed, func(i, j int) bool { return completed[i].PartNumber < completed[j].PartNumber })
+
+	if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completed, minio.PutObjectOptions{}); err != nil {
+		return "", err
+	}
+	return s.GetURL(key), nil
+}
+
+func (s *S3Storage) ListParts(ctx context.Context, key string, uploadID string) ([]storage.Part, error) {
+	var parts []storage.Part
+	marker := 0
+	for {
+		result, err := s.core.ListObjectParts(ctx, s.bucket, objectKey(key), uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range result.ObjectParts {
+			parts = append(parts, storage.Part{PartNumber: p.PartNumber, ETag: storage.NormalizeETag(p.ETag), Size: p.Size})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return s.core.AbortMultipartUpload(ctx, s.bucket, objectKey(key), uploadID)
+}
+
+// PresignPut signs Content-Type and Content-Length into the URL so the
+// storage service itself rejects bodies that do not match
+func (s *S3Storage) PresignPut(ctx context.Context, key string, opts storage.PresignOptions) (*storage.PresignedRequest, error) {
+	headers := http.Header{}
+	if opts.ContentType != "" {
+		headers.Set("Content-Type", opts.ContentType)
+	}
+	if opts.ContentLength > 0 {
+		headers.Set("Content-Length", strconv.FormatInt(opts.ContentLength, 10))
+	}
+
+	u, err := s.core.Client.PresignHeader(ctx, http.MethodPut, s.bucket, objectKey(key), opts.Expires, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &storage.PresignedRequest{Method: http.MethodPut, URL: u.String(), ExpiresAt: time.Now().Add(opts.Expires)}
+	if opts.ContentType != "" {
+		req.Headers = map[string]string{"Content-Type": opts.ContentType}
+	}
+	return req, nil
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, key string, opts storage.PresignOptions) (*storage.PresignedRequest, error) {
+	u, err := s.core.Client.PresignedGetObject(ctx, s.bucket, objectKey(key), opts.Expires, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	return &storage.PresignedRequest{Method: http.MethodGet, URL: u.String(), ExpiresAt: time.Now().Add(opts.Expires)}, nil
+}
+
+func (s *S3Storage) GetURL(key string) string {
+	return fmt.Sprintf("%s/%s", s.baseURL, objectKey(key))
+}
+
+// objectKey normalizes OS specific separators and strips the leading slash
+func objectKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(key, "\\", "/")), "/")
+}
+
+func contentType(key string) string {
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func objectInfo(info minio.ObjectInfo) *storage.ObjectInfo {
+	return &storage.ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         storage.NormalizeETag(info.ETag),
+		LastModified: info.LastModified,
+	}
+}
+
+// mapError translates S3 error codes into the provider-neutral errors
+func mapError(err error, key string) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey":
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+	case "InvalidRange":
+		return fmt.Errorf("%w: %s", storage.ErrInvalidRange, key)
+	case "BadDigest", "InvalidDigest", "XAmzContentSHA256Mismatch":
+		return fmt.Errorf("%w: %s", storage.ErrChecksumMismatch, key)
+	}
+	return err
+}
@@ -0,0 +1,472 @@
+// Package storagetest is the conformance suite every storage.Provider must
+// pass. Provider packages call it from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Provider {
+//			return local.NewLocalStorage(cfg, zap.NewNop())
+//		})
+//	}
+//
+// All objects are written under a random prefix that is removed afterwards,
+// so the suite can run against a shared bucket.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"shop/internal/infra/storage"
+	"shop/pkg/utils"
+)
+
+// minPartSize is the smallest non-final part S3 accepts
+const minPartSize = 5 << 20
+
+// Run executes the suite; newProvider is called once per subtest
+func Run(t *testing.T, newProvider func(t *testing.T) storage.Provider) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, p storage.Provider, prefix string)
+	}{
+		{"PutGet", testPutGet},
+		{"Overwrite", testOverwrite},
+		{"GetMissing", testGetMissing},
+		{"GetRange", testGetRange},
+		{"Stat", testStat},
+		{"List", testList},
+		{"ListPaging", testListPaging},
+		{"Copy", testCopy},
+		{"Delete", testDelete},
+		{"Multipart", testMultipart},
+		{"PartChecksum", testPartChecksum},
+		{"AbortMultipart", testAbortMultipart},
+		{"Presign", testPresign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProvider(t)
+			prefix := path.Join("conformance", utils.GenerateUUID())
+			t.Cleanup(func() { cleanup(t, p, prefix+"/") })
+			tt.fn(t, p, prefix)
+		})
+	}
+}
+
+func testPutGet(t *testing.T, p storage.Provider, prefix string) {
+	key := path.Join(prefix, "hello.txt")
+	url := put(t, p, key, []byte("hello world"))
+	if url != p.GetURL(key) {
+		t.Errorf("PutObject url = %q, GetURL = %q", url, p.GetURL(key))
+	}
+	if got := get(t, p, key); string(got) != "hello world" {
+		t.Errorf("GetObject = %q, want %q", got, "hello world")
+	}
+}
+
+func testOverwrite(t *testing.T, p storage.Provider, prefix string) {
+	key := path.Join(prefix, "file.txt")
+	put(t, p, key, []byte("a much longer first version"))
+	put(t, p, key, []byte("second"))
+	if got := get(t, p, key); string(got) != "second" {
+		t.Errorf("GetObject after overwrite = %q, want %q", got, "second")
+	}
+}
+
+func testGetMissing(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "missing.txt")
+	if _, err := p.GetObject(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetObject(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := p.GetObjectRange(ctx, key, 1, 2); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetObjectRange(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testGetRange(t *testing.T, p storage.Provider, prefix string) {
+	key := path.Join(prefix, "digits.txt")
+	data := []byte("0123456789")
+	put(t, p, key, data)
+
+	cases := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 0, "0123456789"},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{7, -1, "789"},
+		{9, 1, "9"},
+		{7, 100, "789"}, // truncated to the object
+	}
+	for _, c := range cases {
+		body, err := p.GetObjectRange(context.Background(), key, c.offset, c.length)
+		if err != nil {
+			t.Errorf("GetObjectRange(%d, %d) error = %v", c.offset, c.length, err)
+			continue
+		}
+		got, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Errorf("GetObjectRange(%d, %d) read error = %v", c.offset, c.length, err)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("GetObjectRange(%d, %d) = %q, want %q", c.offset, c.length, got, c.want)
+		}
+	}
+
+	if _, err := p.GetObjectRange(context.Background(), key, int64(len(data)), 1); !errors.Is(err, storage.ErrInvalidRange) {
+		t.Errorf("GetObjectRange(past end) error = %v, want ErrInvalidRange", err)
+	}
+}
+
+func testStat(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "image.png")
+	data := []byte("not really a png")
+	before := time.Now().Add(-time.Minute)
+	put(t, p, key, data)
+
+	info, err := p.StatObject(ctx, key)
+	if err != nil {
+		t.Fatalf("StatObject error = %v", err)
+	}
+	if info.Key != key {
+		t.Errorf("StatObject key = %q, want %q", info.Key, key)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("StatObject size = %d, want %d", info.Size, len(data))
+	}
+	if info.ContentType != "image/png" {
+		t.Errorf("StatObject content type = %q, want image/png", info.ContentType)
+	}
+	if info.LastModified.Before(before) {
+		t.Errorf("StatObject last modified = %v, want after %v", info.LastModified, before)
+	}
+
+	if _, err := p.StatObject(ctx, path.Join(prefix, "missing")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("StatObject(missing) error = %v, want ErrNotFound", err)
+	}
+	// A "directory" is not an object
+	put(t, p, path.Join(prefix, "dir", "file"), []byte("x"))
+	if _, err := p.StatObject(ctx, path.Join(prefix, "dir")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("StatObject(dir) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, p storage.Provider, prefix string) {
+	for _, name := range []string{"b", "a/2", "a/sub/3", "a.txt", "a/1", "ab"} {
+		put(t, p, path.Join(prefix, name), []byte(name))
+	}
+
+	cases := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"a.txt", "a/1", "a/2", "a/sub/3", "ab", "b"}},
+		{"a/", []string{"a/1", "a/2", "a/sub/3"}},
+		{"a", []string{"a.txt", "a/1", "a/2", "a/sub/3", "ab"}},
+		{"a/sub/", []string{"a/sub/3"}},
+		{"c/", nil},
+	}
+	for _, c := range cases {
+		result, err := p.ListObjects(context.Background(), storage.ListOptions{Prefix: path.Join(prefix, c.prefix) + suffix(c.prefix)})
+		if err != nil {
+			t.Errorf("ListObjects(%q) error = %v", c.prefix, err)
+			continue
+		}
+		if result.IsTruncated {
+			t.Errorf("ListObjects(%q) is truncated", c.prefix)
+		}
+		if got := relativeKeys(prefix, result.Objects); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ListObjects(%q) = %v, want %v", c.prefix, got, c.want)
+		}
+	}
+
+	result, err := p.ListObjects(context.Background(), storage.ListOptions{Prefix: path.Join(prefix, "a/1")})
+	if err != nil {
+		t.Fatalf("ListObjects error = %v", err)
+	}
+	if len(result.Objects) != 1 || result.Objects[0].Size != 3 {
+		t.Errorf("ListObjects(a/1) = %+v, want one object of 3 bytes", result.Objects)
+	}
+}
+
+func testListPaging(t *testing.T, p storage.Provider, prefix string) {
+	// Pages continue in key order across directories
+	want := []string{"a.txt", "a/1", "a/sub/3", "a/sub/4", "ab", "b"}
+	for _, name := range want {
+		put(t, p, path.Join(prefix, name), []byte(name))
+	}
+
+	var got []string
+	opts := storage.ListOptions{Prefix: prefix + "/", MaxKeys: 2}
+	for pages := 1; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("ListObjects did not terminate, got %v", got)
+		}
+		result, err := p.ListObjects(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("ListObjects error = %v", err)
+		}
+		if len(result.Objects) > opts.MaxKeys {
+			t.Fatalf("ListObjects returned %d objects, MaxKeys is %d", len(result.Objects), opts.MaxKeys)
+		}
+		got = append(got, relativeKeys(prefix, result.Objects)...)
+		if !result.IsTruncated {
+			break
+		}
+		opts.StartAfter = result.Objects[len(result.Objects)-1].Key
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged ListObjects = %v, want %v", got, want)
+	}
+}
+
+func testCopy(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	src := path.Join(prefix, "src.txt")
+	dst := path.Join(prefix, "nested", "dst.txt")
+	put(t, p, src, []byte("copied"))
+
+	if err := p.CopyObject(ctx, src, dst); err != nil {
+		t.Fatalf("CopyObject error = %v", err)
+	}
+	if got := get(t, p, dst); string(got) != "copied" {
+		t.Errorf("copy = %q, want %q", got, "copied")
+	}
+	if got := get(t, p, src); string(got) != "copied" {
+		t.Errorf("source after copy = %q, want %q", got, "copied")
+	}
+
+	// Copying over an existing object replaces it
+	put(t, p, src, []byte("v2"))
+	if err := p.CopyObject(ctx, src, dst); err != nil {
+		t.Fatalf("CopyObject(overwrite) error = %v", err)
+	}
+	if got := get(t, p, dst); string(got) != "v2" {
+		t.Errorf("overwritten copy = %q, want %q", got, "v2")
+	}
+
+	if err := p.CopyObject(ctx, path.Join(prefix, "missing"), dst); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("CopyObject(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDelete(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "doomed.txt")
+	put(t, p, key, []byte("bye"))
+
+	if err := p.DeleteObject(ctx, key); err != nil {
+		t.Fatalf("DeleteObject error = %v", err)
+	}
+	if _, err := p.StatObject(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("StatObject after delete error = %v, want ErrNotFound", err)
+	}
+	if err := p.DeleteObject(ctx, key); err != nil {
+		t.Errorf("DeleteObject(missing) error = %v, want nil", err)
+	}
+}
+
+func testMultipart(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "big.bin")
+	first := bytes.Repeat([]byte("a"), minPartSize)
+	second := []byte("tail")
+
+	uploadID, err := p.InitiateMultipartUpload(ctx, key)
+	if err != nil {
+		t.Fatalf("InitiateMultipartUpload error = %v", err)
+	}
+	var parts []storage.Part
+	for i, data := range [][]byte{first, second} {
+		etag, err := p.UploadPart(ctx, key, uploadID, i+1, bytes.NewReader(data), int64(len(data)), storage.PartChecksum{})
+		if err != nil {
+			t.Fatalf("UploadPart(%d) error = %v", i+1, err)
+		}
+		sum := md5.Sum(data)
+		if etag != hex.EncodeToString(sum[:]) {
+			t.Errorf("UploadPart(%d) etag = %q, want hex MD5 %x", i+1, etag, sum)
+		}
+		parts = append(parts, storage.Part{PartNumber: i + 1, ETag: etag})
+	}
+
+	listed, err := p.ListParts(ctx, key, uploadID)
+	if err != nil {
+		t.Fatalf("ListParts error = %v", err)
+	}
+	if len(listed) != 2 || listed[0].PartNumber != 1 || listed[1].Size != int64(len(second)) || listed[1].ETag != parts[1].ETag {
+		t.Errorf("ListParts = %+v, want parts 1 and 2 with their etags and sizes", listed)
+	}
+
+	url, err := p.CompleteMultipartUpload(ctx, key, uploadID, parts)
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload error = %v", err)
+	}
+	if url != p.GetURL(key) {
+		t.Errorf("CompleteMultipartUpload url = %q, want %q", url, p.GetURL(key))
+	}
+	info, err := p.StatObject(ctx, key)
+	if err != nil {
+		t.Fatalf("StatObject error = %v", err)
+	}
+	if info.Size != int64(len(first)+len(second)) {
+		t.Errorf("assembled size = %d, want %d", info.Size, len(first)+len(second))
+	}
+	body, err := p.GetObjectRange(ctx, key, int64(len(first))-1, 5)
+	if err != nil {
+		t.Fatalf("GetObjectRange error = %v", err)
+	}
+	defer body.Close()
+	if got, _ := io.ReadAll(body); string(got) != "atail" {
+		t.Errorf("part boundary = %q, want %q", got, "atail")
+	}
+}
+
+// testPartChecksum uploads a part, then a corrupted retry of it that must be
+// refused without replacing the first upload
+func testPartChecksum(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "checked.bin")
+	data := []byte("checked part")
+	sum := md5.Sum(data)
+
+	uploadID, err := p.InitiateMultipartUpload(ctx, key)
+	if err != nil {
+		t.Fatalf("InitiateMultipartUpload error = %v", err)
+	}
+	t.Cleanup(func() { p.AbortMultipartUpload(ctx, key, uploadID) })
+
+	checksum := storage.PartChecksum{MD5: hex.EncodeToString(sum[:])}
+	etag, err := p.UploadPart(ctx, key, uploadID, 1, bytes.NewReader(data), int64(len(data)), checksum)
+	if err != nil {
+		t.Fatalf("UploadPart error = %v", err)
+	}
+
+	corrupt := []byte("checked pArt")
+	_, err = p.UploadPart(ctx, key, uploadID, 1, bytes.NewReader(corrupt), int64(len(corrupt)), checksum)
+	if !errors.Is(err, storage.ErrChecksumMismatch) {
+		t.Fatalf("UploadPart(corrupt) error = %v, want ErrChecksumMismatch", err)
+	}
+
+	listed, err := p.ListParts(ctx, key, uploadID)
+	if err != nil {
+		t.Fatalf("ListParts error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].ETag != etag {
+		t.Errorf("ListParts = %+v, want the first upload with etag %s", listed, etag)
+	}
+}
+
+func testAbortMultipart(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "aborted.bin")
+
+	uploadID, err := p.InitiateMultipartUpload(ctx, key)
+	if err != nil {
+		t.Fatalf("InitiateMultipartUpload error = %v", err)
+	}
+	if _, err := p.UploadPart(ctx, key, uploadID, 1, bytes.NewReader([]byte("part")), 4, storage.PartChecksum{}); err != nil {
+		t.Fatalf("UploadPart error = %v", err)
+	}
+	if err := p.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		t.Fatalf("AbortMultipartUpload error = %v", err)
+	}
+	if _, err := p.StatObject(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("StatObject after abort error = %v, want ErrNotFound", err)
+	}
+}
+
+func testPresign(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	key := path.Join(prefix, "presigned.txt")
+	opts := storage.PresignOptions{Expires: 10 * time.Minute, ContentType: "text/plain", ContentLength: 5}
+
+	for method, presign := range map[string]func(context.Context, string, storage.PresignOptions) (*storage.PresignedRequest, error){
+		"PUT": p.PresignPut,
+		"GET": p.PresignGet,
+	} {
+		req, err := presign(ctx, key, opts)
+		if err != nil {
+			t.Errorf("Presign%s error = %v", method, err)
+			continue
+		}
+		if req.Method != method || req.URL == "" {
+			t.Errorf("Presign%s = %+v, want method %s and a URL", method, req, method)
+		}
+		if until := time.Until(req.ExpiresAt); until <= 0 || until > opts.Expires {
+			t.Errorf("Presign%s expires in %v, want within %v", method, until, opts.Expires)
+		}
+	}
+}
+
+func put(t *testing.T, p storage.Provider, key string, data []byte) string {
+	t.Helper()
+	url, err := p.PutObject(context.Background(), key, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("PutObject(%q) error = %v", key, err)
+	}
+	return url
+}
+
+func get(t *testing.T, p storage.Provider, key string) []byte {
+	t.Helper()
+	body, err := p.GetObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("GetObject(%q) error = %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("GetObject(%q) read error = %v", key, err)
+	}
+	return data
+}
+
+// suffix keeps the trailing slash path.Join strips from directory prefixes
+func suffix(prefix string) string {
+	if prefix != "" && prefix[len(prefix)-1] == '/' {
+		return "/"
+	}
+	return ""
+}
+
+func relativeKeys(prefix string, objects []storage.ObjectInfo) []string {
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key[len(prefix)+1:])
+	}
+	return keys
+}
+
+func cleanup(t *testing.T, p storage.Provider, prefix string) {
+	ctx := context.Background()
+	opts := storage.ListOptions{Prefix: prefix}
+	for {
+		result, err := p.ListObjects(ctx, opts)
+		if err != nil {
+			t.Logf("cleanup of %s failed: %v", prefix, err)
+			return
+		}
+		for _, obj := range result.Objects {
+			if err := p.DeleteObject(ctx, obj.Key); err != nil {
+				t.Logf("cleanup of %s failed: %v", obj.Key, err)
+			}
+		}
+		if !result.IsTruncated {
+			return
+		}
+		opts.StartAfter = result.Objects[len(result.Objects)-1].Key
+	}
+}
@@ -1,25 +1,152 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"shop/internal/config"
+	"shop/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ShopIDKey is the gin context key holding the current shop (tenant) ID
+	ShopIDKey = "shop_id"
+	// CustomerIDKey is the gin context key holding the authenticated customer ID
+	CustomerIDKey = "customer_id"
+	// UserIDKey is the gin context key holding the authenticated platform user ID
+	UserIDKey = "user_id"
+)
+
+var (
+	errMissingToken = errors.New("missing token")
+	errInvalidToken = errors.New("invalid token")
+)
 
 type Middleware struct {
-	// Add other middleware dependencies here if needed (e.g. logger, config)
+	cfg *config.Config
 }
 
-func NewMiddleware() *Middleware {
-	return &Middleware{}
+func NewMiddleware(cfg *config.Config) *Middleware {
+	return &Middleware{cfg: cfg}
 }
 
 func (m *Middleware) Cors() gin.HandlerFunc {
 	return Cors()
 }
 
-// Auth is a placeholder for authentication middleware
-func (m *Middleware) Auth() gin.HandlerFunc {
+// Shop resolves the tenant from the X-Shop-ID header (or shop_id query
+// parameter) and stores it in the context
+func (m *Middleware) Shop() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Implement auth logic here
-		// token := c.GetHeader("Authorization")
-		// ...
+		raw := c.GetHeader("X-Shop-ID")
+		if raw == "" {
+			raw = c.Query("shop_id")
+		}
+		shopID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || shopID == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "shop id is required"})
+			return
+		}
+		c.Set(ShopIDKey, uint(shopID))
+		c.Next()
+	}
+}
+
+// CustomerAuth validates the customer bearer token issued for the current shop
+func (m *Middleware) CustomerAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		customerID, err := m.customerFromToken(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(CustomerIDKey, customerID)
+		c.Next()
+	}
+}
+
+// OptionalCustomerAuth identifies the customer when a valid token is sent and
+// lets guests through otherwise
+func (m *Middleware) OptionalCustomerAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if customerID, err := m.customerFromToken(c); err == nil {
+			c.Set(CustomerIDKey, customerID)
+		}
+		c.Next()
+	}
+}
+
+// StaffAuth validates the staff bearer token issued for the current shop
+// and stores the signed-in platform user
+func (m *Middleware) StaffAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := m.subjectFromToken(c, utils.ScopeStaff)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(UserIDKey, userID)
 		c.Next()
 	}
 }
+
+// PlatformAuth validates the platform administrator bearer token of the SaaS
+// management API and stores the signed-in platform user
+func (m *Middleware) PlatformAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := m.subjectFromToken(c, utils.ScopePlatform)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(UserIDKey, userID)
+		c.Next()
+	}
+}
+
+func (m *Middleware) customerFromToken(c *gin.Context) (uint, error) {
+	return m.subjectFromToken(c, utils.ScopeCustomer)
+}
+
+// subjectFromToken returns the subject of the bearer token when it was
+// issued with scope for the current shop; platform tokens carry no shop and
+// match outside the Shop middleware
+func (m *Middleware) subjectFromToken(c *gin.Context, scope string) (uint, error) {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		return 0, errMissingToken
+	}
+
+	claims, err := utils.ParseToken(m.cfg.JWT.Secret, tokenString)
+	if err != nil || !claims.HasScope(scope) {
+		return 0, errInvalidToken
+	}
+	subject, err := claims.SubjectID()
+	if err != nil || claims.ShopID != ShopID(c) {
+		return 0, errInvalidToken
+	}
+	return subject, nil
+}
+
+// ShopID returns the shop resolved by the Shop middleware
+func ShopID(c *gin.Context) uint {
+	return c.GetUint(ShopIDKey)
+}
+
+// CustomerID returns the customer authenticated by the CustomerAuth middleware
+func CustomerID(c *gin.Context) uint {
+	return c.GetUint(CustomerIDKey)
+}
+
+// UserID returns the platform user authenticated by the StaffAuth or
+// PlatformAuth middleware
+func UserID(c *gin.Context) uint {
+	return c.GetUint(UserIDKey)
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BlogStatusDraft     = "draft"
+	BlogStatusScheduled = "scheduled"
+	BlogStatusPublished = "published"
+)
+
+// BlogPost is a shop's CMS article (table: blog_posts)
+type BlogPost struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	ShopID        uint           `gorm:"not null;index:idx_shop_status,priority:1;uniqueIndex:uk_shop_slug" json:"shop_id"`
+	Title         string         `gorm:"size:255;not null" json:"title"`
+	Slug          string         `gorm:"size:255;not null;uniqueIndex:uk_shop_slug" json:"slug"`
+	Author        string         `gorm:"size:100" json:"author"`
+	ContentHTML   string         `gorm:"column:content_html;type:longtext" json:"content_html"`
+	Summary       string         `gorm:"type:text" json:"summary"`
+	FeaturedImage string         `gorm:"size:255" json:"featured_image"`
+	Status        string         `gorm:"size:20;default:published;index:idx_shop_status,priority:2" json:"status"`
+	PublishedAt   *time.Time     `json:"published_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
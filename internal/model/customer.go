@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Customer is a shopper account scoped to a single shop (table: customers)
+type Customer struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	ShopID           uint      `gorm:"not null;uniqueIndex:uk_shop_email" json:"shop_id"`
+	Email            string    `gorm:"size:255;not null;uniqueIndex:uk_shop_email" json:"email"`
+	PasswordHash     string    `gorm:"size:255" json:"-"`
+	FirstName        string    `gorm:"size:100" json:"first_name"`
+	LastName         string    `gorm:"size:100" json:"last_name"`
+	TotalSpent       float64   `gorm:"type:decimal(12,2);default:0.00" json:"total_spent"`
+	AcceptsMarketing bool      `gorm:"default:false" json:"accepts_marketing"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// CustomerAddress is an entry in a customer's address book (table: customer_addresses)
+type CustomerAddress struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ShopID     uint      `gorm:"not null" json:"shop_id"`
+	CustomerID uint      `gorm:"not null;index" json:"customer_id"`
+	FirstName  string    `gorm:"size:100" json:"first_name"`
+	LastName   string    `gorm:"size:100" json:"last_name"`
+	Company    string    `gorm:"size:255" json:"company"`
+	Address1   string    `gorm:"size:255;not null" json:"address1"`
+	Address2   string    `gorm:"size:255" json:"address2"`
+	City       string    `gorm:"size:100" json:"city"`
+	Province   string    `gorm:"size:100" json:"province"`
+	Country    string    `gorm:"size:100;not null" json:"country"`
+	Zip        string    `gorm:"size:20" json:"zip"`
+	Phone      string    `gorm:"size:50" json:"phone"`
+	IsDefault  bool      `gorm:"default:false" json:"is_default"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
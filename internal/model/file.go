@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	FileRefBlogPost = "blog_post"
+
+	FileStatusActive = "active"
+	// FileStatusQuarantined files were flagged by the scanner and moved under quarantine/
+	FileStatusQuarantined = "quarantined"
+
+	FileVisibilityPublic = "public"
+	// FileVisibilityPrivate files are stored under private/, have no public URL
+	// and are only served by the authenticated download endpoints
+	FileVisibilityPrivate = "private"
+)
+
+// File is an object stored through FileService, the source of the media
+// library (table: files). RefCount is the number of FileReference rows and
+// files with references cannot be deleted.
+type File struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	ShopID      uint            `gorm:"not null;index:idx_shop_created,priority:1;index:idx_shop_url,priority:1" json:"shop_id"`
+	UploaderID  uint            `gorm:"default:0" json:"uploader_id"`                             // platform user, 0 when unknown
+	CustomerID  uint            `gorm:"not null;default:0;index:idx_customer" json:"customer_id"` // buyer who uploaded it, 0 for staff uploads
+	Key         string          `gorm:"size:255;not null;uniqueIndex:uk_key" json:"key"`
+	URL         string          `gorm:"size:512;not null;index:idx_shop_url,priority:2,length:191" json:"url"` // empty for private files
+	Filename    string          `gorm:"size:255" json:"filename"`
+	Folder      string          `gorm:"size:255" json:"folder"`
+	Size        int64           `gorm:"not null;default:0" json:"size"`
+	ContentType string          `gorm:"size:100" json:"content_type"` // sniffed from the content, not the client header
+	Checksum    string          `gorm:"size:80" json:"checksum"`      // sha256 hex, or the multipart ETag (md5-N)
+	RefCount    int             `gorm:"not null;default:0" json:"ref_count"`
+	Visibility  string          `gorm:"size:16;not null;default:public" json:"visibility"`
+	Status      string          `gorm:"size:20;not null;default:active" json:"status"`
+	ScanResult  string          `gorm:"size:255" json:"scan_result"` // "clean" or the detected signature
+	ScannedAt   *time.Time      `json:"scanned_at"`
+	Derivatives json.RawMessage `gorm:"type:json" json:"derivatives"` // []ImageDerivative for images
+	CreatedAt   time.Time       `gorm:"index:idx_shop_created,priority:2" json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ImageDerivative is a resized/re-encoded variant of an image file
+type ImageDerivative struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+}
+
+// FileReference records that an entity (blog post, product...) uses a file
+// (table: file_references)
+type FileReference struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ShopID    uint      `gorm:"not null" json:"shop_id"`
+	FileID    uint      `gorm:"not null;uniqueIndex:uk_file_ref,priority:1" json:"file_id"`
+	RefType   string    `gorm:"size:50;not null;uniqueIndex:uk_file_ref,priority:2;index:idx_ref,priority:1" json:"ref_type"`
+	RefID     uint      `gorm:"not null;uniqueIndex:uk_file_ref,priority:3;index:idx_ref,priority:2" json:"ref_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileUsage is the storage consumed by a shop
+type FileUsage struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FinancialStatusPending  = "pending"
+	FinancialStatusPaid     = "paid"
+	FinancialStatusRefunded = "refunded"
+	FinancialStatusVoided   = "voided"
+)
+
+// Order is a placed order with customer, address and audit snapshots (table: orders)
+type Order struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ShopID      uint   `gorm:"not null;uniqueIndex:uk_shop_order;index:idx_customer,priority:1;index:idx_created,priority:1" json:"shop_id"`
+	OrderNumber string `gorm:"size:50;not null;uniqueIndex:uk_shop_order" json:"order_number"`
+
+	CustomerID    *uint  `gorm:"index:idx_customer,priority:2" json:"customer_id"`
+	CustomerEmail string `gorm:"size:255;not null" json:"customer_email"`
+	CustomerPhone string `gorm:"size:50" json:"customer_phone"`
+
+	Currency       string  `gorm:"size:10;not null" json:"currency"`
+	TotalPrice     float64 `gorm:"type:decimal(12,2);not null" json:"total_price"`
+	SubtotalPrice  float64 `gorm:"type:decimal(12,2);not null" json:"subtotal_price"`
+	TotalTax       float64 `gorm:"type:decimal(12,2);default:0.00" json:"total_tax"`
+	TotalDiscounts float64 `gorm:"type:decimal(12,2);default:0.00" json:"total_discounts"`
+	ShippingPrice  float64 `gorm:"type:decimal(12,2);default:0.00" json:"shipping_price"`
+	DiscountCode   string  `gorm:"size:50" json:"discount_code"` // code applied at checkout, reported per code
+
+	FinancialStatus   string `gorm:"size:20;default:pending" json:"financial_status"`
+	FulfillmentStatus string `gorm:"size:20;default:unfulfilled" json:"fulfillment_status"`
+	CancelReason      string `gorm:"size:50" json:"cancel_reason"`
+
+	ShippingAddress json.RawMessage `gorm:"type:json" json:"shipping_address"`
+	BillingAddress  json.RawMessage `gorm:"type:json" json:"billing_address"`
+
+	Note        string `gorm:"type:text" json:"note"`
+	Tags        string `gorm:"size:255" json:"tags"`
+	ClientIP    string `gorm:"size:45" json:"client_ip"`
+	UserAgent   string `gorm:"type:text" json:"user_agent"`
+	LandingSite string `gorm:"size:255" json:"landing_site"`
+
+	ProcessedAt *time.Time     `json:"processed_at"`
+	CreatedAt   time.Time      `gorm:"index:idx_created,priority:2" json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Items []OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+}
+
+// OrderItem is a line item snapshot of an order (table: order_items)
+type OrderItem struct {
+	ID                  uint            `gorm:"primaryKey" json:"id"`
+	ShopID              uint            `gorm:"not null" json:"shop_id"`
+	OrderID             uint            `gorm:"not null;index:idx_order" json:"order_id"`
+	ProductID           *uint           `json:"product_id"`
+	VariantID           *uint           `json:"variant_id"`
+	Name                string          `gorm:"size:255;not null" json:"name"`
+	SKU                 string          `gorm:"column:sku;size:100" json:"sku"`
+	ImageURL            string          `gorm:"size:512" json:"image_url"`
+	Quantity            int             `gorm:"not null" json:"quantity"`
+	FulfillableQuantity int             `gorm:"not null" json:"fulfillable_quantity"`
+	Price               float64         `gorm:"type:decimal(12,2);not null" json:"price"`
+	TotalDiscount       float64         `gorm:"type:decimal(12,2);default:0.00" json:"total_discount"`
+	VariantSnapshot     json.RawMessage `gorm:"type:json" json:"variant_snapshot"`
+	Properties          json.RawMessage `gorm:"type:json" json:"properties"`
+	CreatedAt           time.Time       `json:"created_at"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TransactionTypeSale   = "sale"
+	TransactionTypeRefund = "refund"
+
+	TransactionStatusSuccess = "success"
+)
+
+// PaymentTransaction is a gateway sale or refund of an order (table: payment_transactions)
+type PaymentTransaction struct {
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	ShopID          uint            `gorm:"not null" json:"shop_id"`
+	OrderID         uint            `gorm:"not null;index:idx_order_gateway,priority:1" json:"order_id"`
+	TransactionType string          `gorm:"size:20;not null" json:"transaction_type"`
+	Gateway         string          `gorm:"size:50;not null" json:"gateway"`
+	GatewayRef      string          `gorm:"size:255;index:idx_order_gateway,priority:2" json:"gateway_ref"`
+	Amount          float64         `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Status          string          `gorm:"size:20;default:pending" json:"status"`
+	RawResponse     json.RawMessage `gorm:"type:json" json:"raw_response"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// DiscountCode is a shop coupon (table: discount_codes)
+type DiscountCode struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	ShopID         uint           `gorm:"not null;index:idx_shop_code,priority:1" json:"shop_id"`
+	Code           string         `gorm:"size:50;not null;index:idx_shop_code,priority:2" json:"code"`
+	Type           string         `gorm:"size:20;not null" json:"type"`
+	Value          float64        `gorm:"type:decimal(12,2);not null" json:"value"`
+	MinRequirement *float64       `gorm:"type:decimal(12,2)" json:"min_requirement"`
+	StartsAt       *time.Time     `json:"starts_at"`
+	EndsAt         *time.Time     `json:"ends_at"`
+	UsageLimit     *int           `json:"usage_limit"`
+	UsageCount     int            `gorm:"default:0" json:"usage_count"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
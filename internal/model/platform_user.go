@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlatformUser is a merchant account that signs in to the admin of the shops
+// its organizations own (table: platform_users)
+type PlatformUser struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Email           string         `gorm:"size:255;not null;unique" json:"email"`
+	Phone           string         `gorm:"size:20" json:"phone"`
+	PasswordHash    string         `gorm:"size:255;not null" json:"-"`
+	RealName        string         `gorm:"size:100" json:"real_name"`
+	IsActive        bool           `gorm:"default:true" json:"is_active"`
+	IsPlatformAdmin bool           `gorm:"default:false" json:"is_platform_admin"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// OrganizationMember grants a platform user access to the shops of an
+// organization (table: organization_members)
+type OrganizationMember struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"not null;uniqueIndex:uk_org_user" json:"org_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:uk_org_user" json:"user_id"`
+	Role      string    `gorm:"size:20;default:admin" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ProductStatusActive   = "active"
+	ProductStatusDraft    = "draft"
+	ProductStatusArchived = "archived"
+)
+
+// Product is a shop's catalog item (table: products)
+type Product struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	ShopID     uint            `gorm:"not null;index:idx_shop_status,priority:1" json:"shop_id"`
+	Title      string          `gorm:"size:255;not null" json:"title"`
+	BodyHTML   string          `gorm:"column:body_html;type:text" json:"body_html"`
+	Status     string          `gorm:"size:20;default:draft;index:idx_shop_status,priority:2" json:"status"`
+	Metafields json.RawMessage `gorm:"type:json" json:"metafields"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+
+	Variants []ProductVariant `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+}
+
+// ProductVariant is a purchasable SKU of a product (table: product_variants)
+type ProductVariant struct {
+	ID                uint            `gorm:"primaryKey" json:"id"`
+	ShopID            uint            `gorm:"not null;index:idx_shop_sku,priority:1" json:"shop_id"`
+	ProductID         uint            `gorm:"not null;index:idx_product_id" json:"product_id"`
+	SKU               string          `gorm:"column:sku;size:100;index:idx_shop_sku,priority:2" json:"sku"`
+	Price             float64         `gorm:"type:decimal(12,2);not null" json:"price"`
+	CompareAtPrice    *float64        `gorm:"type:decimal(12,2)" json:"compare_at_price"`
+	InventoryQuantity int             `gorm:"default:0" json:"inventory_quantity"`
+	OptionValues      json.RawMessage `gorm:"type:json" json:"option_values"`
+	CreatedAt         time.Time       `json:"created_at"`
+
+	Product *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+}
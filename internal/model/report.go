@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// DailySalesReport is the per shop, per day aggregate of orders, carts and
+// refunds maintained by the report cron job (table: report_daily_sales)
+type DailySalesReport struct {
+	ID               uint      `gorm:"primaryKey" json:"-"`
+	ShopID           uint      `gorm:"not null;uniqueIndex:uk_shop_date" json:"shop_id"`
+	Date             time.Time `gorm:"type:date;not null;uniqueIndex:uk_shop_date" json:"date"`
+	Orders           int64     `gorm:"not null;default:0" json:"orders"`
+	PaidOrders       int64     `gorm:"not null;default:0" json:"paid_orders"`
+	GrossSales       float64   `gorm:"type:decimal(14,2);not null;default:0" json:"gross_sales"`
+	Discounts        float64   `gorm:"type:decimal(14,2);not null;default:0" json:"discounts"`
+	DiscountedOrders int64     `gorm:"not null;default:0" json:"discounted_orders"`
+	Refunds          float64   `gorm:"type:decimal(14,2);not null;default:0" json:"refunds"`
+	RefundCount      int64     `gorm:"not null;default:0" json:"refund_count"`
+	Tax              float64   `gorm:"type:decimal(14,2);not null;default:0" json:"tax"`
+	Shipping         float64   `gorm:"type:decimal(14,2);not null;default:0" json:"shipping"`
+	NetSales         float64   `gorm:"type:decimal(14,2);not null;default:0" json:"net_sales"`
+	CartsCreated     int64     `gorm:"not null;default:0" json:"carts_created"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (DailySalesReport) TableName() string {
+	return "report_daily_sales"
+}
+
+// DailyProductReport is the per variant, per day sales aggregate (table: report_daily_products)
+type DailyProductReport struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	ShopID    uint      `gorm:"not null;index:idx_shop_date,priority:1" json:"shop_id"`
+	Date      time.Time `gorm:"type:date;not null;index:idx_shop_date,priority:2" json:"date"`
+	ProductID *uint     `json:"product_id"`
+	VariantID *uint     `json:"variant_id"`
+	Name      string    `gorm:"size:255" json:"name"`
+	SKU       string    `gorm:"column:sku;size:100" json:"sku"`
+	Quantity  int64     `gorm:"not null;default:0" json:"quantity"`
+	Sales     float64   `gorm:"type:decimal(14,2);not null;default:0" json:"sales"`
+}
+
+func (DailyProductReport) TableName() string {
+	return "report_daily_products"
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	RiskLevelLow    = "low"
+	RiskLevelMedium = "medium"
+	RiskLevelHigh   = "high"
+
+	RiskActionNone   = "none"
+	RiskActionTagged = "tagged"
+	RiskActionHeld   = "held"
+
+	// FraudTag is appended to orders.tags when the score reaches the tag threshold
+	FraudTag = "疑似欺诈"
+	// FulfillmentStatusOnHold blocks fulfillment of risky orders until reviewed
+	FulfillmentStatusOnHold = "on_hold"
+)
+
+// OrderRisk is the outcome of the risk engine for one order (table: order_risks)
+type OrderRisk struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ShopID    uint            `gorm:"not null" json:"shop_id"`
+	OrderID   uint            `gorm:"not null;uniqueIndex" json:"order_id"`
+	Score     int             `gorm:"not null" json:"score"`
+	Level     string          `gorm:"size:20;not null" json:"level"`
+	Action    string          `gorm:"size:20;not null" json:"action"`
+	Reasons   json.RawMessage `gorm:"type:json" json:"reasons"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// RiskReason explains the contribution of one rule to a risk score
+type RiskReason struct {
+	Rule    string `json:"rule"`
+	Score   int    `json:"score"`
+	Message string `json:"message"`
+}
+
+// RiskSettings stores the merchant's risk rules (table: risk_settings)
+type RiskSettings struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ShopID    uint            `gorm:"not null;uniqueIndex" json:"shop_id"`
+	Rules     json.RawMessage `gorm:"type:json" json:"rules"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// RiskRules is the decoded form of RiskSettings.Rules
+type RiskRules struct {
+	IPVelocity          VelocityRule  `json:"ip_velocity"`
+	EmailVelocity       VelocityRule  `json:"email_velocity"`
+	AddressMismatch     ToggleRule    `json:"address_mismatch"`
+	HighValueFirstOrder HighValueRule `json:"high_value_first_order"`
+	TagThreshold        int           `json:"tag_threshold"`  // score at which FraudTag is added
+	HoldThreshold       int           `json:"hold_threshold"` // score at which fulfillment is held
+}
+
+// VelocityRule scores orders when too many were placed from the same source
+type VelocityRule struct {
+	Enabled       bool `json:"enabled"`
+	WindowMinutes int  `json:"window_minutes"`
+	MaxOrders     int  `json:"max_orders"`
+	Score         int  `json:"score"`
+}
+
+type ToggleRule struct {
+	Enabled bool `json:"enabled"`
+	Score   int  `json:"score"`
+}
+
+// HighValueRule scores a customer's first order at or above Threshold
+type HighValueRule struct {
+	Enabled   bool    `json:"enabled"`
+	Threshold float64 `json:"threshold"`
+	Score     int     `json:"score"`
+}
+
+// DefaultRiskRules is used for shops that never configured their rules
+func DefaultRiskRules() RiskRules {
+	return RiskRules{
+		IPVelocity:          VelocityRule{Enabled: true, WindowMinutes: 60, MaxOrders: 3, Score: 40},
+		EmailVelocity:       VelocityRule{Enabled: true, WindowMinutes: 60, MaxOrders: 3, Score: 30},
+		AddressMismatch:     ToggleRule{Enabled: true, Score: 25},
+		HighValueFirstOrder: HighValueRule{Enabled: true, Threshold: 1000, Score: 35},
+		TagThreshold:        50,
+		HoldThreshold:       80,
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SearchQueryStat counts a shop's storefront searches that found products,
+// per normalized query (table: search_query_stats); popular queries are
+// offered first as suggestions
+type SearchQueryStat struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	ShopID         uint      `gorm:"not null;uniqueIndex:uk_shop_query,priority:1" json:"shop_id"`
+	Query          string    `gorm:"size:100;not null;uniqueIndex:uk_shop_query,priority:2" json:"query"`
+	Searches       int64     `gorm:"not null;default:0" json:"searches"`
+	LastSearchedAt time.Time `json:"last_searched_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SearchLog is one storefront search, written asynchronously (table:
+// search_logs). Only first pages of text queries are logged; ClickedProductID
+// is the first product the shopper opened from the results. Logs older than
+// the longest report range are purged daily.
+type SearchLog struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	ShopID           uint       `gorm:"not null;index:idx_shop_created,priority:1" json:"shop_id"`
+	SearchID         string     `gorm:"size:32;not null;uniqueIndex" json:"search_id"`
+	Query            string     `gorm:"size:100;not null" json:"query"` // normalized
+	Results          int64      `gorm:"not null;default:0" json:"results"`
+	ClickedProductID *uint      `json:"clicked_product_id"`
+	ClickedAt        *time.Time `json:"clicked_at"`
+	CreatedAt        time.Time  `gorm:"index:idx_shop_created,priority:2;index:idx_created" json:"created_at"`
+}
+
+// SearchSettings stores the merchant's search rules (table: search_settings)
+type SearchSettings struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	ShopID    uint            `gorm:"not null;uniqueIndex" json:"shop_id"`
+	Rules     json.RawMessage `gorm:"type:json" json:"rules"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// SearchRebuild marks a search index that is being rebuilt (table:
+// search_rebuilds). Until the new index replaces the live one, every process
+// writes catalog changes to Target too; a rebuild that stopped renewing
+// ExpiresAt is over.
+type SearchRebuild struct {
+	Index     string    `gorm:"column:index_name;primaryKey;size:100" json:"index"`
+	Target    string    `gorm:"size:150;not null" json:"target"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SearchRules is the decoded form of SearchSettings.Rules
+type SearchRules struct {
+	// Synonyms are groups of equivalent terms: a product mentioning one term
+	// of a group is also found by the others
+	Synonyms [][]string  `json:"synonyms"`
+	Pins     []SearchPin `json:"pins"`
+}
+
+// SearchPin shows products first, in order, when the normalized query is
+// searched in relevance order. Products that are not active or do not pass
+// the shopper's filters are left out.
+type SearchPin struct {
+	Query      string `json:"query"`
+	ProductIDs []uint `json:"product_ids"`
+}
+
+// Pinned returns the products pinned for a normalized query
+func (r *SearchRules) Pinned(query string) []uint {
+	for _, pin := range r.Pins {
+		if pin.Query == query {
+			return pin.ProductIDs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const ShopStatusActive = "active"
+
+// Shop is a tenant of the platform (table: shops)
+type Shop struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	OrgID          uint            `gorm:"not null;index:idx_org" json:"org_id"`
+	PlanID         uint            `gorm:"not null" json:"plan_id"`
+	Name           string          `gorm:"size:255;not null" json:"name"`
+	Status         string          `gorm:"size:20;default:active" json:"status"`
+	PlanExpiredAt  *time.Time      `json:"plan_expired_at"`
+	ConfigSettings json.RawMessage `gorm:"type:json" json:"config_settings"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// ShopDomain binds a hostname to a shop; one domain per shop is primary
+// (table: shop_domains)
+type ShopDomain struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ShopID    uint      `gorm:"not null;index:idx_shop" json:"shop_id"`
+	Domain    string    `gorm:"size:255;not null;unique" json:"domain"`
+	Type      string    `gorm:"size:20;default:custom" json:"type"` // subdomain, custom
+	IsPrimary bool      `gorm:"default:false" json:"is_primary"`
+	SSLStatus string    `gorm:"column:ssl_status;size:20;default:pending" json:"ssl_status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Cart is a storefront cart, also used for abandoned checkout tracking (table: carts)
+type Cart struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	ShopID      uint            `gorm:"not null" json:"shop_id"`
+	Token       string          `gorm:"size:100;not null;unique" json:"token"`
+	CustomerID  *uint           `json:"customer_id"`
+	Items       json.RawMessage `gorm:"type:json" json:"items"`
+	IsAbandoned bool            `gorm:"default:false" json:"is_abandoned"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
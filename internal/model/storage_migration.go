@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+const (
+	MigrationStatusPending   = "pending"
+	MigrationStatusRunning   = "running"
+	MigrationStatusCompleted = "completed"
+	MigrationStatusFailed    = "failed"
+)
+
+// StorageMigration records the progress of copying every object from one
+// storage provider to another (table: storage_migrations). Objects are walked
+// in key order, so LastKey is the cursor a restarted run resumes after.
+type StorageMigration struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Source      string     `gorm:"size:20;not null" json:"source"`
+	Destination string     `gorm:"size:20;not null" json:"destination"`
+	Status      string     `gorm:"size:20;not null;default:pending" json:"status"`
+	LastKey     string     `gorm:"size:255" json:"last_key"`
+	Copied      int        `gorm:"not null;default:0" json:"copied"`
+	Skipped     int        `gorm:"not null;default:0" json:"skipped"` // already present with the same content
+	Failed      int        `gorm:"not null;default:0" json:"failed"`
+	Bytes       int64      `gorm:"not null;default:0" json:"bytes"`
+	Error       string     `gorm:"size:1000" json:"error"` // last error
+	LockedUntil *time.Time `json:"locked_until"`           // lease held by the running worker
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
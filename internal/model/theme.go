@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Theme is a storefront theme installed in a shop (table: themes). SourcePath
+// and Version point at the currently selected ThemeVersion, ConfigData holds
+// the merchant's setting values for it.
+type Theme struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	ShopID     uint            `gorm:"not null;index:idx_shop_id" json:"shop_id"`
+	Name       string          `gorm:"size:100" json:"name"`
+	SourcePath string          `gorm:"size:255" json:"source_path"`
+	Version    int             `gorm:"default:0" json:"version"`
+	ConfigData json.RawMessage `gorm:"type:json" json:"config_data"`
+	IsActive   bool            `gorm:"default:false" json:"is_active"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// ThemeVersion is an immutable uploaded package of a theme (table:
+// theme_versions). ConfigData snapshots the setting values last saved while
+// the version was current, so a rollback restores them with the package.
+type ThemeVersion struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	ShopID     uint            `gorm:"not null" json:"shop_id"`
+	ThemeID    uint            `gorm:"not null;uniqueIndex:uk_theme_version" json:"theme_id"`
+	Version    int             `gorm:"not null;uniqueIndex:uk_theme_version" json:"version"`
+	SourcePath string          `gorm:"size:255;not null" json:"source_path"`
+	Manifest   json.RawMessage `gorm:"type:json" json:"manifest"`
+	ConfigData json.RawMessage `gorm:"type:json" json:"config_data"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// ThemeManifest is the manifest.json shipped at the root of a theme package
+type ThemeManifest struct {
+	Name           string         `json:"name"`
+	Version        string         `json:"version"`
+	Author         string         `json:"author"`
+	SettingsSchema []ThemeSetting `json:"settings_schema"`
+}
+
+// ThemeSetting declares one merchant configurable setting of a theme
+type ThemeSetting struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"` // text, textarea, color, number, checkbox, select, image, url
+	Label   string        `json:"label"`
+	Default interface{}   `json:"default,omitempty"`
+	Options []interface{} `json:"options,omitempty"` // select only
+}
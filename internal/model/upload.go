@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	UploadStatusUploading = "uploading"
+	UploadStatusCompleted = "completed"
+	UploadStatusAborted   = "aborted"
+	UploadStatusExpired   = "expired"
+
+	// UploadKindMultipart sessions are assembled from parts sent through us
+	UploadKindMultipart = "multipart"
+	// UploadKindPresigned sessions track a presigned PUT straight to storage
+	// until the client confirms it
+	UploadKindPresigned = "presigned"
+)
+
+// UploadSession tracks a multipart upload, or a presigned upload awaiting
+// confirmation, from initiate until it is completed, aborted by the client or
+// expired by the janitor (table: upload_sessions)
+type UploadSession struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ShopID       uint      `gorm:"not null;index:idx_shop_id" json:"shop_id"`
+	UploaderID   uint      `gorm:"default:0" json:"uploader_id"`
+	UploadID     string    `gorm:"size:191;not null;uniqueIndex:uk_upload_id" json:"upload_id"`
+	Kind         string    `gorm:"size:20;not null;default:multipart" json:"kind"`
+	Key          string    `gorm:"size:512;not null" json:"key"`
+	Filename     string    `gorm:"size:255" json:"filename"`
+	ExpectedSize int64     `gorm:"default:0" json:"expected_size"` // 0 when the client did not declare it
+	ContentType  string    `gorm:"size:100" json:"content_type"`   // sniffed from part 1
+	Checksum     string    `gorm:"size:64" json:"checksum"`        // multipart ETag of the assembled object
+	Status       string    `gorm:"size:20;not null;index:idx_status_expires" json:"status"`
+	ExpiresAt    time.Time `gorm:"not null;index:idx_status_expires" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -6,5 +6,5 @@ type User struct {
 	gorm.Model
 	Username string `gorm:"unique;not null"`
 	Email    string `gorm:"unique;not null"`
-	Password string `not null"`
+	Password string `gorm:"not null"`
 }
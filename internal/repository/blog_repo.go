@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type BlogRepository interface {
+	Create(ctx context.Context, post *model.BlogPost) error
+	Update(ctx context.Context, post *model.BlogPost) error
+	Delete(ctx context.Context, shopID, id uint) error
+	FindByID(ctx context.Context, shopID, id uint) (*model.BlogPost, error)
+	FindPublishedBySlug(ctx context.Context, shopID uint, slug string) (*model.BlogPost, error)
+	List(ctx context.Context, shopID uint, status string, offset, limit int) ([]model.BlogPost, int64, error)
+	ListPublished(ctx context.Context, shopID uint, offset, limit int) ([]model.BlogPost, int64, error)
+	SlugExists(ctx context.Context, shopID uint, slug string, excludeID uint) (bool, error)
+	PublishDue(ctx context.Context, now time.Time) (int64, error)
+}
+
+type blogRepository struct {
+	db *gorm.DB
+}
+
+func NewBlogRepository(db *gorm.DB) BlogRepository {
+	return &blogRepository{db: db}
+}
+
+func (r *blogRepository) Create(ctx context.Context, post *model.BlogPost) error {
+	return r.db.WithContext(ctx).Create(post).Error
+}
+
+func (r *blogRepository) Update(ctx context.Context, post *model.BlogPost) error {
+	return r.db.WithContext(ctx).Save(post).Error
+}
+
+func (r *blogRepository) Delete(ctx context.Context, shopID, id uint) error {
+	res := r.db.WithContext(ctx).Where("shop_id = ?", shopID).Delete(&model.BlogPost{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *blogRepository) FindByID(ctx context.Context, shopID, id uint) (*model.BlogPost, error) {
+	var post model.BlogPost
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&post, id).Error
+	return &post, err
+}
+
+func (r *blogRepository) FindPublishedBySlug(ctx context.Context, shopID uint, slug string) (*model.BlogPost, error) {
+	var post model.BlogPost
+	err := r.db.WithContext(ctx).
+		Where("shop_id = ? AND slug = ? AND status = ?", shopID, slug, model.BlogStatusPublished).
+		First(&post).Error
+	return &post, err
+}
+
+func (r *blogRepository) List(ctx context.Context, shopID uint, status string, offset, limit int) ([]model.BlogPost, int64, error) {
+	q := r.db.WithContext(ctx).Model(&model.BlogPost{}).Where("shop_id = ?", shopID)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	return r.page(q.Order("updated_at DESC"), offset, limit)
+}
+
+func (r *blogRepository) ListPublished(ctx context.Context, shopID uint, offset, limit int) ([]model.BlogPost, int64, error) {
+	q := r.db.WithContext(ctx).Model(&model.BlogPost{}).
+		Where("shop_id = ? AND status = ?", shopID, model.BlogStatusPublished).
+		Order("published_at DESC")
+	return r.page(q, offset, limit)
+}
+
+func (r *blogRepository) page(q *gorm.DB, offset, limit int) ([]model.BlogPost, int64, error) {
+	var posts []model.BlogPost
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q.Offset(offset).Limit(limit).Find(&posts).Error
+	return posts, total, err
+}
+
+// SlugExists also checks soft-deleted posts because they still hold the unique key
+func (r *blogRepository) SlugExists(ctx context.Context, shopID uint, slug string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&model.BlogPost{}).
+		Where("shop_id = ? AND slug = ? AND id <> ?", shopID, slug, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// PublishDue flips every scheduled post whose publish time has passed
+func (r *blogRepository) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Model(&model.BlogPost{}).
+		Where("status = ? AND published_at <= ?", model.BlogStatusScheduled, now).
+		Update("status", model.BlogStatusPublished)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type CustomerRepository interface {
+	Create(ctx context.Context, customer *model.Customer) error
+	Update(ctx context.Context, customer *model.Customer) error
+	FindByID(ctx context.Context, shopID, id uint) (*model.Customer, error)
+	FindByEmail(ctx context.Context, shopID uint, email string) (*model.Customer, error)
+	// ActivateGuest stores the password and profile of a customer that has no
+	// password yet and reports false when it got one in the meantime
+	ActivateGuest(ctx context.Context, customer *model.Customer) (bool, error)
+
+	ListAddresses(ctx context.Context, shopID, customerID uint) ([]model.CustomerAddress, error)
+	FindAddress(ctx context.Context, shopID, customerID, id uint) (*model.CustomerAddress, error)
+	SaveAddress(ctx context.Context, address *model.CustomerAddress) error
+	DeleteAddress(ctx context.Context, shopID, customerID, id uint) error
+}
+
+type customerRepository struct {
+	db *gorm.DB
+}
+
+func NewCustomerRepository(db *gorm.DB) CustomerRepository {
+	return &customerRepository{db: db}
+}
+
+func (r *customerRepository) Create(ctx context.Context, customer *model.Customer) error {
+	return r.db.WithContext(ctx).Create(customer).Error
+}
+
+func (r *customerRepository) Update(ctx context.Context, customer *model.Customer) error {
+	return r.db.WithContext(ctx).Save(customer).Error
+}
+
+func (r *customerRepository) FindByID(ctx context.Context, shopID, id uint) (*model.Customer, error) {
+	var customer model.Customer
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&customer, id).Error
+	return &customer, err
+}
+
+func (r *customerRepository) FindByEmail(ctx context.Context, shopID uint, email string) (*model.Customer, error) {
+	var customer model.Customer
+	err := r.db.WithContext(ctx).Where("shop_id = ? AND email = ?", shopID, email).First(&customer).Error
+	return &customer, err
+}
+
+func (r *customerRepository) ActivateGuest(ctx context.Context, customer *model.Customer) (bool, error) {
+	res := r.db.WithContext(ctx).Model(customer).
+		Where("password_hash IS NULL OR password_hash = ''").
+		Select("password_hash", "first_name", "last_name", "accepts_marketing").
+		Updates(customer)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *customerRepository) ListAddresses(ctx context.Context, shopID, customerID uint) ([]model.CustomerAddress, error) {
+	var addresses []model.CustomerAddress
+	err := r.db.WithContext(ctx).
+		Where("shop_id = ? AND customer_id = ?", shopID, customerID).
+		Order("is_default DESC, id ASC").
+		Find(&addresses).Error
+	return addresses, err
+}
+
+func (r *customerRepository) FindAddress(ctx context.Context, shopID, customerID, id uint) (*model.CustomerAddress, error) {
+	var address model.CustomerAddress
+	err := r.db.WithContext(ctx).
+		Where("shop_id = ? AND customer_id = ?", shopID, customerID).
+		First(&address, id).Error
+	return &address, err
+}
+
+// SaveAddress creates or updates an address. When the address is marked as
+// default, every other address of the customer loses its default flag.
+func (r *customerRepository) SaveAddress(ctx context.Context, address *model.CustomerAddress) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if address.IsDefault {
+			if err := tx.Model(&model.CustomerAddress{}).
+				Where("shop_id = ? AND customer_id = ? AND id <> ?", address.ShopID, address.CustomerID, address.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(address).Error
+	})
+}
+
+func (r *customerRepository) DeleteAddress(ctx context.Context, shopID, customerID, id uint) error {
+	res := r.db.WithContext(ctx).
+		Where("shop_id = ? AND customer_id = ?", shopID, customerID).
+		Delete(&model.CustomerAddress{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FileFilter narrows the media library listing
+type FileFilter struct {
+	ShopID      uint
+	Query       string // substring of the original filename
+	ContentType string // exact type or a prefix such as "image/"
+	Folder      string
+	Visibility  string
+}
+
+type FileRepository interface {
+	Create(ctx context.Context, file *model.File) error
+	FindByID(ctx context.Context, shopID, id uint) (*model.File, error)
+	List(ctx context.Context, filter FileFilter, offset, limit int) ([]model.File, int64, error)
+	// DeleteUnreferenced removes the row unless it is referenced; deleted is
+	// false (and file holds the current row) when references remain
+	DeleteUnreferenced(ctx context.Context, shopID, id uint) (file *model.File, deleted bool, err error)
+	// SyncReferences makes urls the complete set of files used by (refType, refID),
+	// adjusting ref_count of files that gained or lost the reference
+	SyncReferences(ctx context.Context, shopID uint, refType string, refID uint, urls []string) error
+	Usage(ctx context.Context, shopID uint) (*model.FileUsage, error)
+	// SaveScanResult persists the scan verdict and, for quarantined files, the moved key
+	SaveScanResult(ctx context.Context, file *model.File) error
+	SaveDerivatives(ctx context.Context, id uint, derivatives []model.ImageDerivative) error
+}
+
+type fileRepository struct {
+	db *gorm.DB
+}
+
+func NewFileRepository(db *gorm.DB) FileRepository {
+	return &fileRepository{db: db}
+}
+
+func (r *fileRepository) Create(ctx context.Context, file *model.File) error {
+	return r.db.WithContext(ctx).Create(file).Error
+}
+
+func (r *fileRepository) FindByID(ctx context.Context, shopID, id uint) (*model.File, error) {
+	var file model.File
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&file, id).Error
+	return &file, err
+}
+
+func (r *fileRepository) List(ctx context.Context, filter FileFilter, offset, limit int) ([]model.File, int64, error) {
+	q := r.db.WithContext(ctx).Model(&model.File{}).Where("shop_id = ?", filter.ShopID)
+	if filter.Query != "" {
+		q = q.Where("filename LIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.ContentType != "" {
+		if strings.HasSuffix(filter.ContentType, "/") {
+			q = q.Where("content_type LIKE ?", escapeLike(filter.ContentType)+"%")
+		} else {
+			q = q.Where("content_type = ?", filter.ContentType)
+		}
+	}
+	if filter.Folder != "" {
+		q = q.Where("folder = ?", filter.Folder)
+	}
+	if filter.Visibility != "" {
+		q = q.Where("visibility = ?", filter.Visibility)
+	}
+
+	var files []model.File
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q.Order("created_at DESC").Offset(offset).Limit(limit).Find(&files).Error
+	return files, total, err
+}
+
+func (r *fileRepository) DeleteUnreferenced(ctx context.Context, shopID, id uint) (*model.File, bool, error) {
+	var file model.File
+	deleted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The lock serializes with SyncReferences adding a reference concurrently
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("shop_id = ?", shopID).
+			First(&file, id).Error; err != nil {
+			return err
+		}
+		if file.RefCount > 0 {
+			return nil
+		}
+		deleted = true
+		return tx.Delete(&file).Error
+	})
+	return &file, deleted, err
+}
+
+func (r *fileRepository) SyncReferences(ctx context.Context, shopID uint, refType string, refID uint, urls []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		want := map[uint]bool{}
+		if len(urls) > 0 {
+			var ids []uint
+			if err := tx.Model(&model.File{}).
+				Where("shop_id = ? AND url IN ?", shopID, urls).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				want[id] = true
+			}
+		}
+
+		var existing []model.FileReference
+		if err := tx.Where("ref_type = ? AND ref_id = ? AND shop_id = ?", refType, refID, shopID).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+
+		var stale []uint
+		for _, ref := range existing {
+			if want[ref.FileID] {
+				delete(want, ref.FileID) // already referenced
+				continue
+			}
+			stale = append(stale, ref.FileID)
+		}
+
+		if len(stale) > 0 {
+			if err := tx.Where("ref_type = ? AND ref_id = ? AND file_id IN ?", refType, refID, stale).
+				Delete(&model.FileReference{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.File{}).Where("id IN ? AND ref_count > 0", stale).
+				Update("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(want) > 0 {
+			added := make([]uint, 0, len(want))
+			refs := make([]model.FileReference, 0, len(want))
+			for id := range want {
+				added = append(added, id)
+				refs = append(refs, model.FileReference{ShopID: shopID, FileID: id, RefType: refType, RefID: refID})
+			}
+			if err := tx.Create(&refs).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.File{}).Where("id IN ?", added).
+				Update("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *fileRepository) Usage(ctx context.Context, shopID uint) (*model.FileUsage, error) {
+	var usage model.FileUsage
+	err := r.db.WithContext(ctx).Model(&model.File{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes").
+		Where("shop_id = ?", shopID).
+		Scan(&usage).Error
+	return &usage, err
+}
+
+func (r *fileRepository) SaveScanResult(ctx context.Context, file *model.File) error {
+	return r.db.WithContext(ctx).Model(file).
+		Select("key", "url", "status", "scan_result", "scanned_at").
+		Updates(file).Error
+}
+
+func (r *fileRepository) SaveDerivatives(ctx context.Context, id uint, derivatives []model.ImageDerivative) error {
+	data, err := json.Marshal(derivatives)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&model.File{}).Where("id = ?", id).
+		Update("derivatives", json.RawMessage(data)).Error
+}
+
+// escapeLike escapes LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *model.Order) error
+	FindByID(ctx context.Context, shopID, id uint) (*model.Order, error)
+	FindByNumber(ctx context.Context, shopID uint, orderNumber string) (*model.Order, error)
+	ListByCustomer(ctx context.Context, shopID, customerID uint, offset, limit int) ([]model.Order, int64, error)
+	MarkPaid(ctx context.Context, shopID, id uint, processedAt time.Time) (*model.Order, error)
+	ClaimGuestOrders(ctx context.Context, shopID uint, email string, customerID uint) (int64, error)
+
+	CountRecentByIP(ctx context.Context, shopID uint, ip string, since time.Time, excludeID uint) (int64, error)
+	CountRecentByEmail(ctx context.Context, shopID uint, email string, since time.Time, excludeID uint) (int64, error)
+	CountByEmail(ctx context.Context, shopID uint, email string, excludeID uint) (int64, error)
+}
+
+type orderRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderRepository(db *gorm.DB) OrderRepository {
+	return &orderRepository{db: db}
+}
+
+// Create inserts the order together with its line items
+func (r *orderRepository) Create(ctx context.Context, order *model.Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
+}
+
+func (r *orderRepository) FindByID(ctx context.Context, shopID, id uint) (*model.Order, error) {
+	var order model.Order
+	err := r.db.WithContext(ctx).Preload("Items").Where("shop_id = ?", shopID).First(&order, id).Error
+	return &order, err
+}
+
+func (r *orderRepository) FindByNumber(ctx context.Context, shopID uint, orderNumber string) (*model.Order, error) {
+	var order model.Order
+	err := r.db.WithContext(ctx).Where("shop_id = ? AND order_number = ?", shopID, orderNumber).First(&order).Error
+	return &order, err
+}
+
+func (r *orderRepository) ListByCustomer(ctx context.Context, shopID, customerID uint, offset, limit int) ([]model.Order, int64, error) {
+	var orders []model.Order
+	var total int64
+
+	q := r.db.WithContext(ctx).Model(&model.Order{}).Where("shop_id = ? AND customer_id = ?", shopID, customerID)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := q.Preload("Items").Order("created_at DESC").Offset(offset).Limit(limit).Find(&orders).Error
+	return orders, total, err
+}
+
+// MarkPaid flags a pending order as paid and adds its total to the owning
+// customer's total_spent in the same transaction. Orders that are already
+// paid are returned unchanged so the call is idempotent.
+func (r *orderRepository) MarkPaid(ctx context.Context, shopID, id uint, processedAt time.Time) (*model.Order, error) {
+	var order model.Order
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("shop_id = ?", shopID).First(&order, id).Error; err != nil {
+			return err
+		}
+		if order.FinancialStatus == model.FinancialStatusPaid {
+			return nil
+		}
+
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"financial_status": model.FinancialStatusPaid,
+			"processed_at":     processedAt,
+		}).Error; err != nil {
+			return err
+		}
+		order.FinancialStatus = model.FinancialStatusPaid
+		order.ProcessedAt = &processedAt
+
+		if order.CustomerID == nil {
+			return nil
+		}
+		return tx.Model(&model.Customer{}).
+			Where("id = ? AND shop_id = ?", *order.CustomerID, shopID).
+			Update("total_spent", gorm.Expr("total_spent + ?", order.TotalPrice)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ClaimGuestOrders attaches every guest order placed with email to the
+// customer and credits the paid ones to its total_spent.
+func (r *orderRepository) ClaimGuestOrders(ctx context.Context, shopID uint, email string, customerID uint) (int64, error) {
+	var claimed int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []model.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "financial_status", "total_price").
+			Where("shop_id = ? AND customer_email = ? AND customer_id IS NULL", shopID, email).
+			Find(&orders).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(orders))
+		var paidTotal float64
+		for _, o := range orders {
+			ids = append(ids, o.ID)
+			if o.FinancialStatus == model.FinancialStatusPaid {
+				paidTotal += o.TotalPrice
+			}
+		}
+
+		res := tx.Model(&model.Order{}).Where("id IN ?", ids).Update("customer_id", customerID)
+		if res.Error != nil {
+			return res.Error
+		}
+		claimed = res.RowsAffected
+
+		if paidTotal == 0 {
+			return nil
+		}
+		return tx.Model(&model.Customer{}).
+			Where("id = ? AND shop_id = ?", customerID, shopID).
+			Update("total_spent", gorm.Expr("total_spent + ?", paidTotal)).Error
+	})
+	return claimed, err
+}
+
+func (r *orderRepository) CountRecentByIP(ctx context.Context, shopID uint, ip string, since time.Time, excludeID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Order{}).
+		Where("shop_id = ? AND client_ip = ? AND created_at >= ? AND id <> ?", shopID, ip, since, excludeID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *orderRepository) CountRecentByEmail(ctx context.Context, shopID uint, email string, since time.Time, excludeID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Order{}).
+		Where("shop_id = ? AND customer_email = ? AND created_at >= ? AND id <> ?", shopID, email, since, excludeID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *orderRepository) CountByEmail(ctx context.Context, shopID uint, email string, excludeID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Order{}).
+		Where("shop_id = ? AND customer_email = ? AND id <> ?", shopID, email, excludeID).
+		Count(&count).Error
+	return count, err
+}
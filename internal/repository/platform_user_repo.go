@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type PlatformUserRepository interface {
+	FindByID(ctx context.Context, id uint) (*model.PlatformUser, error)
+	FindByEmail(ctx context.Context, email string) (*model.PlatformUser, error)
+	// IsShopMember reports whether the user belongs to the organization
+	// that owns the shop
+	IsShopMember(ctx context.Context, userID, shopID uint) (bool, error)
+}
+
+type platformUserRepository struct {
+	db *gorm.DB
+}
+
+func NewPlatformUserRepository(db *gorm.DB) PlatformUserRepository {
+	return &platformUserRepository{db: db}
+}
+
+func (r *platformUserRepository) FindByID(ctx context.Context, id uint) (*model.PlatformUser, error) {
+	var user model.PlatformUser
+	err := r.db.WithContext(ctx).First(&user, id).Error
+	return &user, err
+}
+
+func (r *platformUserRepository) FindByEmail(ctx context.Context, email string) (*model.PlatformUser, error) {
+	var user model.PlatformUser
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	return &user, err
+}
+
+func (r *platformUserRepository) IsShopMember(ctx context.Context, userID, shopID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.OrganizationMember{}).
+		Joins("JOIN shops ON shops.org_id = organization_members.org_id").
+		Where("organization_members.user_id = ? AND shops.id = ?", userID, shopID).
+		Count(&count).Error
+	return count > 0, err
+}
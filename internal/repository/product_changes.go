@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// WatchProductChanges calls notify after every committed write of a product
+// or variant, so stores derived from the catalog (the search index) can
+// follow the database. The written model must carry the row's ID, ShopID and,
+// for variants, ProductID, as models loaded or created through GORM do;
+// updates and deletes by condition alone are not seen.
+func WatchProductChanges(db *gorm.DB, notify func(ctx context.Context, shopID, productID uint)) error {
+	callback := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+		var productField string
+		switch tx.Statement.Schema.Table {
+		case "products":
+			productField = "ID"
+		case "product_variants":
+			productField = "ProductID"
+		default:
+			return
+		}
+		productID := tx.Statement.Schema.LookUpField(productField)
+		shopID := tx.Statement.Schema.LookUpField("ShopID")
+		if productID == nil || shopID == nil {
+			return
+		}
+
+		ctx := tx.Statement.Context
+		visit := func(row reflect.Value) {
+			product, zero := productID.ValueOf(ctx, row)
+			if zero {
+				return
+			}
+			shop, zero := shopID.ValueOf(ctx, row)
+			if zero {
+				return
+			}
+			notify(ctx, shop.(uint), product.(uint))
+		}
+		rows := reflect.Indirect(tx.Statement.ReflectValue)
+		switch rows.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rows.Len(); i++ {
+				visit(reflect.Indirect(rows.Index(i)))
+			}
+		case reflect.Struct:
+			visit(rows)
+		}
+	}
+
+	// After the statement's own transaction commits, so consumers read the
+	// new state; writes inside an explicit transaction notify before it commits
+	const after = "gorm:commit_or_rollback_transaction"
+	if err := db.Callback().Create().After(after).Register("catalog:product_changes", callback); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After(after).Register("catalog:product_changes", callback); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After(after).Register("catalog:product_changes", callback)
+}
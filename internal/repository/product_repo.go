@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type ProductRepository interface {
+	FindVariants(ctx context.Context, shopID uint, ids []uint) ([]model.ProductVariant, error)
+	// FindProducts loads products of the shop with their variants
+	FindProducts(ctx context.Context, shopID uint, ids []uint) ([]model.Product, error)
+	// ListActive pages through a shop's active products in ID order, with variants
+	ListActive(ctx context.Context, shopID, afterID uint, limit int) ([]model.Product, error)
+	// ActiveShopIDs lists the shops that have active products
+	ActiveShopIDs(ctx context.Context) ([]uint, error)
+}
+
+type productRepository struct {
+	db *gorm.DB
+}
+
+func NewProductRepository(db *gorm.DB) ProductRepository {
+	return &productRepository{db: db}
+}
+
+// FindVariants loads the variants of the shop with their product
+func (r *productRepository) FindVariants(ctx context.Context, shopID uint, ids []uint) ([]model.ProductVariant, error) {
+	var variants []model.ProductVariant
+	err := r.db.WithContext(ctx).Preload("Product").
+		Where("shop_id = ? AND id IN ?", shopID, ids).
+		Find(&variants).Error
+	return variants, err
+}
+
+func (r *productRepository) FindProducts(ctx context.Context, shopID uint, ids []uint) ([]model.Product, error) {
+	var products []model.Product
+	err := r.db.WithContext(ctx).Preload("Variants").
+		Where("shop_id = ? AND id IN ?", shopID, ids).
+		Find(&products).Error
+	return products, err
+}
+
+func (r *productRepository) ListActive(ctx context.Context, shopID, afterID uint, limit int) ([]model.Product, error) {
+	var products []model.Product
+	err := r.db.WithContext(ctx).Preload("Variants").
+		Where("shop_id = ? AND status = ? AND id > ?", shopID, model.ProductStatusActive, afterID).
+		Order("id").Limit(limit).
+		Find(&products).Error
+	return products, err
+}
+
+func (r *productRepository) ActiveShopIDs(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&model.Product{}).
+		Where("status = ?", model.ProductStatusActive).
+		Distinct().Order("shop_id").Pluck("shop_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// paidStatuses are the orders whose money was collected; refunds of refunded
+// orders are subtracted separately
+var paidStatuses = []string{model.FinancialStatusPaid, model.FinancialStatusRefunded}
+
+// DiscountCodeUsage is a row of the discount code report
+type DiscountCodeUsage struct {
+	Code      string  `json:"code"`
+	Orders    int64   `json:"orders"`
+	Discounts float64 `json:"discounts"`
+	Sales     float64 `json:"sales"`
+}
+
+// ProductSales is a row of the top products/variants report
+type ProductSales struct {
+	ProductID *uint   `json:"product_id"`
+	VariantID *uint   `json:"variant_id,omitempty"`
+	Name      string  `json:"name"`
+	SKU       string  `json:"sku,omitempty"`
+	Quantity  int64   `json:"quantity"`
+	Sales     float64 `json:"sales"`
+}
+
+type ReportRepository interface {
+	ActiveShopIDs(ctx context.Context) ([]uint, error)
+
+	// AggregateDay recomputes the summary rows of one shop for the day
+	// starting at day, replacing any previous aggregate
+	AggregateDay(ctx context.Context, shopID uint, day time.Time) error
+
+	DailySales(ctx context.Context, shopID uint, from, to time.Time) ([]model.DailySalesReport, error)
+	TopProducts(ctx context.Context, shopID uint, from, to time.Time, byVariant bool, limit int) ([]ProductSales, error)
+	// DiscountCodes sums the paid orders of each discount code placed
+	// between the days from and to inclusive
+	DiscountCodes(ctx context.Context, shopID uint, from, to time.Time) ([]DiscountCodeUsage, error)
+}
+
+type reportRepository struct {
+	db *gorm.DB
+}
+
+func NewReportRepository(db *gorm.DB) ReportRepository {
+	return &reportRepository{db: db}
+}
+
+func (r *reportRepository) ActiveShopIDs(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&model.Shop{}).
+		Where("status = ?", model.ShopStatusActive).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *reportRepository) AggregateDay(ctx context.Context, shopID uint, day time.Time) error {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		row := model.DailySalesReport{ShopID: shopID, Date: start}
+
+		// shop_id + created_at range is served by the idx_created index
+		var orders struct {
+			Orders           int64
+			PaidOrders       int64
+			GrossSales       float64
+			Discounts        float64
+			DiscountedOrders int64
+			Tax              float64
+			Shipping         float64
+		}
+		if err := tx.Model(&model.Order{}).
+			// Money columns only count orders that were paid
+			Select(`COUNT(*) AS orders,
+				COALESCE(SUM(CASE WHEN financial_status = ? THEN 1 ELSE 0 END), 0) AS paid_orders,
+				COALESCE(SUM(CASE WHEN financial_status IN ? THEN total_price ELSE 0 END), 0) AS gross_sales,
+				COALESCE(SUM(CASE WHEN financial_status IN ? THEN total_discounts ELSE 0 END), 0) AS discounts,
+				COALESCE(SUM(CASE WHEN financial_status IN ? AND total_discounts > 0 THEN 1 ELSE 0 END), 0) AS discounted_orders,
+				COALESCE(SUM(CASE WHEN financial_status IN ? THEN total_tax ELSE 0 END), 0) AS tax,
+				COALESCE(SUM(CASE WHEN financial_status IN ? THEN shipping_price ELSE 0 END), 0) AS shipping`,
+				model.FinancialStatusPaid, paidStatuses, paidStatuses, paidStatuses, paidStatuses, paidStatuses).
+			Where("shop_id = ? AND created_at >= ? AND created_at < ? AND financial_status <> ?", shopID, start, end, model.FinancialStatusVoided).
+			Scan(&orders).Error; err != nil {
+			return err
+		}
+		row.Orders = orders.Orders
+		row.PaidOrders = orders.PaidOrders
+		row.GrossSales = orders.GrossSales
+		row.Discounts = orders.Discounts
+		row.DiscountedOrders = orders.DiscountedOrders
+		row.Tax = orders.Tax
+		row.Shipping = orders.Shipping
+
+		var refunds struct {
+			Count  int64
+			Amount float64
+		}
+		if err := tx.Model(&model.PaymentTransaction{}).
+			Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount").
+			Where("shop_id = ? AND transaction_type = ? AND status = ? AND created_at >= ? AND created_at < ?",
+				shopID, model.TransactionTypeRefund, model.TransactionStatusSuccess, start, end).
+			Scan(&refunds).Error; err != nil {
+			return err
+		}
+		row.RefundCount = refunds.Count
+		row.Refunds = refunds.Amount
+		row.NetSales = row.GrossSales - row.Refunds
+
+		if err := tx.Model(&model.Cart{}).
+			Where("shop_id = ? AND created_at >= ? AND created_at < ?", shopID, start, end).
+			Count(&row.CartsCreated).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "shop_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"orders", "paid_orders", "gross_sales", "discounts", "discounted_orders",
+				"refunds", "refund_count", "tax", "shipping", "net_sales", "carts_created", "updated_at",
+			}),
+		}).Create(&row).Error; err != nil {
+			return err
+		}
+
+		var products []model.DailyProductReport
+		if err := tx.Table("order_items AS oi").
+			Select(`oi.product_id, oi.variant_id, MAX(oi.name) AS name, MAX(oi.sku) AS sku,
+				SUM(oi.quantity) AS quantity, SUM(oi.price * oi.quantity - oi.total_discount) AS sales`).
+			Joins("JOIN orders o ON o.id = oi.order_id").
+			// Like the money columns above, product sales count paid orders only
+			Where("o.shop_id = ? AND o.created_at >= ? AND o.created_at < ? AND o.deleted_at IS NULL AND o.financial_status IN ?",
+				shopID, start, end, paidStatuses).
+			Group("oi.product_id, oi.variant_id").
+			Scan(&products).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("shop_id = ? AND date = ?", shopID, start).Delete(&model.DailyProductReport{}).Error; err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		for i := range products {
+			products[i].ShopID = shopID
+			products[i].Date = start
+		}
+		return tx.CreateInBatches(products, 500).Error
+	})
+}
+
+func (r *reportRepository) DailySales(ctx context.Context, shopID uint, from, to time.Time) ([]model.DailySalesReport, error) {
+	var rows []model.DailySalesReport
+	err := r.db.WithContext(ctx).
+		Where("shop_id = ? AND date >= ? AND date <= ?", shopID, from, to).
+		Order("date ASC").
+		Find(&rows).Error
+	return rows, err
+}
+
+func (r *reportRepository) TopProducts(ctx context.Context, shopID uint, from, to time.Time, byVariant bool, limit int) ([]ProductSales, error) {
+	var rows []ProductSales
+	q := r.db.WithContext(ctx).Model(&model.DailyProductReport{}).
+		Where("shop_id = ? AND date >= ? AND date <= ?", shopID, from, to)
+	if byVariant {
+		q = q.Select("product_id, variant_id, MAX(name) AS name, MAX(sku) AS sku, SUM(quantity) AS quantity, SUM(sales) AS sales").
+			Group("product_id, variant_id")
+	} else {
+		q = q.Select("product_id, MAX(name) AS name, SUM(quantity) AS quantity, SUM(sales) AS sales").
+			Group("product_id")
+	}
+	err := q.Order("sales DESC").Limit(limit).Scan(&rows).Error
+	return rows, err
+}
+
+func (r *reportRepository) DiscountCodes(ctx context.Context, shopID uint, from, to time.Time) ([]DiscountCodeUsage, error) {
+	var rows []DiscountCodeUsage
+	err := r.db.WithContext(ctx).Model(&model.Order{}).
+		Select(`discount_code AS code, COUNT(*) AS orders,
+			COALESCE(SUM(total_discounts), 0) AS discounts, COALESCE(SUM(total_price), 0) AS sales`).
+		Where("shop_id = ? AND created_at >= ? AND created_at < ? AND financial_status IN ? AND discount_code <> ''",
+			shopID, from, to.AddDate(0, 0, 1), paidStatuses).
+		Group("discount_code").
+		Order("orders DESC").
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RiskRepository interface {
+	// SaveAssessment upserts the order's risk and applies the resulting action to the order
+	SaveAssessment(ctx context.Context, risk *model.OrderRisk) error
+	FindByOrder(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error)
+	FindSettings(ctx context.Context, shopID uint) (*model.RiskSettings, error)
+	SaveSettings(ctx context.Context, settings *model.RiskSettings) error
+}
+
+type riskRepository struct {
+	db *gorm.DB
+}
+
+func NewRiskRepository(db *gorm.DB) RiskRepository {
+	return &riskRepository{db: db}
+}
+
+func (r *riskRepository) SaveAssessment(ctx context.Context, risk *model.OrderRisk) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "order_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"score", "level", "action", "reasons", "updated_at"}),
+		}).Create(risk).Error; err != nil {
+			return err
+		}
+		if risk.Action == model.RiskActionNone {
+			return nil
+		}
+
+		var order model.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "tags", "fulfillment_status").
+			Where("shop_id = ?", risk.ShopID).
+			First(&order, risk.OrderID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"tags": addTag(order.Tags, model.FraudTag)}
+		if risk.Action == model.RiskActionHeld && order.FulfillmentStatus == "unfulfilled" {
+			updates["fulfillment_status"] = model.FulfillmentStatusOnHold
+		}
+		return tx.Model(&order).Updates(updates).Error
+	})
+}
+
+func (r *riskRepository) FindByOrder(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error) {
+	var risk model.OrderRisk
+	err := r.db.WithContext(ctx).Where("shop_id = ? AND order_id = ?", shopID, orderID).First(&risk).Error
+	return &risk, err
+}
+
+func (r *riskRepository) FindSettings(ctx context.Context, shopID uint) (*model.RiskSettings, error) {
+	var settings model.RiskSettings
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&settings).Error
+	return &settings, err
+}
+
+func (r *riskRepository) SaveSettings(ctx context.Context, settings *model.RiskSettings) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "shop_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rules", "updated_at"}),
+	}).Create(settings).Error
+}
+
+// addTag appends tag to a comma separated tag list unless already present
+func addTag(tags, tag string) string {
+	var list []string
+	for _, t := range strings.Split(tags, ",") {
+		t = strings.TrimSpace(t)
+		if t == tag {
+			return tags
+		}
+		if t != "" {
+			list = append(list, t)
+		}
+	}
+	return strings.Join(append(list, tag), ", ")
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchQueryReport is a row of the search query reports
+type SearchQueryReport struct {
+	Query          string    `json:"query"`
+	Searches       int64     `json:"searches"`
+	Clicks         int64     `json:"clicks"` // searches followed by a product click
+	AvgResults     float64   `json:"avg_results"`
+	LastSearchedAt time.Time `json:"last_searched_at"`
+}
+
+type SearchLogRepository interface {
+	// Create logs a search once and reports whether it was new; a
+	// redelivered log is ignored
+	Create(ctx context.Context, log *model.SearchLog) (bool, error)
+	// Click records the first product opened from a logged search. It returns
+	// gorm.ErrRecordNotFound while the search is not logged yet.
+	Click(ctx context.Context, shopID uint, searchID string, productID uint, at time.Time) error
+	// QueryReport ranks the queries searched in [from, to) by searches; with
+	// zeroResults only searches that found nothing are counted
+	QueryReport(ctx context.Context, shopID uint, from, to time.Time, zeroResults bool, limit int) ([]SearchQueryReport, error)
+	// DeleteBefore deletes up to limit searches logged before the given time
+	// and returns how many it deleted
+	DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type searchLogRepository struct {
+	db *gorm.DB
+}
+
+func NewSearchLogRepository(db *gorm.DB) SearchLogRepository {
+	return &searchLogRepository{db: db}
+}
+
+func (r *searchLogRepository) Create(ctx context.Context, log *model.SearchLog) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(log)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *searchLogRepository) Click(ctx context.Context, shopID uint, searchID string, productID uint, at time.Time) error {
+	var log model.SearchLog
+	if err := r.db.WithContext(ctx).Select("id", "clicked_product_id").
+		Where("shop_id = ? AND search_id = ?", shopID, searchID).
+		First(&log).Error; err != nil {
+		return err
+	}
+	if log.ClickedProductID != nil {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&log).
+		Where("clicked_product_id IS NULL").
+		Updates(map[string]interface{}{"clicked_product_id": productID, "clicked_at": at}).Error
+}
+
+func (r *searchLogRepository) QueryReport(ctx context.Context, shopID uint, from, to time.Time, zeroResults bool, limit int) ([]SearchQueryReport, error) {
+	var rows []SearchQueryReport
+	q := r.db.WithContext(ctx).Model(&model.SearchLog{}).
+		Select("query, COUNT(*) AS searches, COUNT(clicked_product_id) AS clicks, AVG(results) AS avg_results, MAX(created_at) AS last_searched_at").
+		Where("shop_id = ? AND created_at >= ? AND created_at < ?", shopID, from, to)
+	if zeroResults {
+		q = q.Where("results = 0")
+	}
+	err := q.Group("query").Order("searches DESC").Order("query").Limit(limit).Scan(&rows).Error
+	return rows, err
+}
+
+func (r *searchLogRepository) DeleteBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	res := r.db.WithContext(ctx).Where("created_at < ?", before).Limit(limit).Delete(&model.SearchLog{})
+	return res.RowsAffected, res.Error
+}
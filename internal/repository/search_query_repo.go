@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SearchQueryRepository interface {
+	// Increment counts one search of the normalized query
+	Increment(ctx context.Context, shopID uint, query string, at time.Time) error
+	// Popular lists the shop's most searched queries starting with prefix
+	Popular(ctx context.Context, shopID uint, prefix string, limit int) ([]model.SearchQueryStat, error)
+}
+
+type searchQueryRepository struct {
+	db *gorm.DB
+}
+
+func NewSearchQueryRepository(db *gorm.DB) SearchQueryRepository {
+	return &searchQueryRepository{db: db}
+}
+
+func (r *searchQueryRepository) Increment(ctx context.Context, shopID uint, query string, at time.Time) error {
+	stat := model.SearchQueryStat{ShopID: shopID, Query: query, Searches: 1, LastSearchedAt: at}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "shop_id"}, {Name: "query"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"searches":         gorm.Expr("searches + 1"),
+			"last_searched_at": at,
+		}),
+	}).Create(&stat).Error
+}
+
+func (r *searchQueryRepository) Popular(ctx context.Context, shopID uint, prefix string, limit int) ([]model.SearchQueryStat, error) {
+	var stats []model.SearchQueryStat
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	err := r.db.WithContext(ctx).
+		Where("shop_id = ? AND query LIKE ?", shopID, escaped+"%").
+		Order("searches DESC").Order("query").
+		Limit(limit).
+		Find(&stats).Error
+	return stats, err
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SearchRebuildRepository interface {
+	// Start marks index as being rebuilt into target until the given time,
+	// replacing the mark of an earlier rebuild
+	Start(ctx context.Context, index, target string, until time.Time) error
+	// Renew extends the mark of a running rebuild
+	Renew(ctx context.Context, index, target string, until time.Time) error
+	// Finish removes the mark of a rebuild
+	Finish(ctx context.Context, index, target string) error
+	// Target returns the index a running rebuild of index fills, or ""
+	Target(ctx context.Context, index string, now time.Time) (string, error)
+}
+
+type searchRebuildRepository struct {
+	db *gorm.DB
+}
+
+func NewSearchRebuildRepository(db *gorm.DB) SearchRebuildRepository {
+	return &searchRebuildRepository{db: db}
+}
+
+func (r *searchRebuildRepository) Start(ctx context.Context, index, target string, until time.Time) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "index_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"target", "expires_at", "updated_at"}),
+	}).Create(&model.SearchRebuild{Index: index, Target: target, ExpiresAt: until}).Error
+}
+
+func (r *searchRebuildRepository) Renew(ctx context.Context, index, target string, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.SearchRebuild{}).
+		Where("index_name = ? AND target = ?", index, target).
+		Update("expires_at", until).Error
+}
+
+func (r *searchRebuildRepository) Finish(ctx context.Context, index, target string) error {
+	return r.db.WithContext(ctx).
+		Where("index_name = ? AND target = ?", index, target).
+		Delete(&model.SearchRebuild{}).Error
+}
+
+func (r *searchRebuildRepository) Target(ctx context.Context, index string, now time.Time) (string, error) {
+	var targets []string
+	err := r.db.WithContext(ctx).Model(&model.SearchRebuild{}).
+		Where("index_name = ? AND expires_at > ?", index, now).
+		Limit(1).Pluck("target", &targets).Error
+	if err != nil || len(targets) == 0 {
+		return "", err
+	}
+	return targets[0], nil
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SearchSettingsRepository interface {
+	FindSettings(ctx context.Context, shopID uint) (*model.SearchSettings, error)
+	SaveSettings(ctx context.Context, settings *model.SearchSettings) error
+}
+
+type searchSettingsRepository struct {
+	db *gorm.DB
+}
+
+func NewSearchSettingsRepository(db *gorm.DB) SearchSettingsRepository {
+	return &searchSettingsRepository{db: db}
+}
+
+func (r *searchSettingsRepository) FindSettings(ctx context.Context, shopID uint) (*model.SearchSettings, error) {
+	var settings model.SearchSettings
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&settings).Error
+	return &settings, err
+}
+
+func (r *searchSettingsRepository) SaveSettings(ctx context.Context, settings *model.SearchSettings) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "shop_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rules", "updated_at"}),
+	}).Create(settings).Error
+}
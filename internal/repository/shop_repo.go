@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type ShopRepository interface {
+	FindByID(ctx context.Context, id uint) (*model.Shop, error)
+	// PrimaryDomain returns the primary domain bound to the shop, "" when it
+	// has none
+	PrimaryDomain(ctx context.Context, shopID uint) (string, error)
+}
+
+type shopRepository struct {
+	db *gorm.DB
+}
+
+func NewShopRepository(db *gorm.DB) ShopRepository {
+	return &shopRepository{db: db}
+}
+
+func (r *shopRepository) FindByID(ctx context.Context, id uint) (*model.Shop, error) {
+	var shop model.Shop
+	err := r.db.WithContext(ctx).First(&shop, id).Error
+	return &shop, err
+}
+
+func (r *shopRepository) PrimaryDomain(ctx context.Context, shopID uint) (string, error) {
+	var domains []string
+	err := r.db.WithContext(ctx).Model(&model.ShopDomain{}).
+		Where("shop_id = ? AND is_primary = ?", shopID, true).
+		Limit(1).
+		Pluck("domain", &domains).Error
+	if err != nil || len(domains) == 0 {
+		return "", err
+	}
+	return domains[0], nil
+}
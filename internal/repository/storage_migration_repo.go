@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type StorageMigrationRepository interface {
+	Create(ctx context.Context, migration *model.StorageMigration) error
+	FindByID(ctx context.Context, id uint) (*model.StorageMigration, error)
+	List(ctx context.Context, limit int) ([]model.StorageMigration, error)
+	// Claim takes the lease of an unfinished migration until the given time and
+	// reports false when another worker holds it
+	Claim(ctx context.Context, id uint, now, until time.Time) (bool, error)
+	// Renew extends the lease of a running migration
+	Renew(ctx context.Context, id uint, until time.Time) error
+	// SaveProgress stores the cursor, counters, status and lease
+	SaveProgress(ctx context.Context, migration *model.StorageMigration) error
+}
+
+type storageMigrationRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageMigrationRepository(db *gorm.DB) StorageMigrationRepository {
+	return &storageMigrationRepository{db: db}
+}
+
+func (r *storageMigrationRepository) Create(ctx context.Context, migration *model.StorageMigration) error {
+	return r.db.WithContext(ctx).Create(migration).Error
+}
+
+func (r *storageMigrationRepository) FindByID(ctx context.Context, id uint) (*model.StorageMigration, error) {
+	var migration model.StorageMigration
+	err := r.db.WithContext(ctx).First(&migration, id).Error
+	return &migration, err
+}
+
+func (r *storageMigrationRepository) List(ctx context.Context, limit int) ([]model.StorageMigration, error) {
+	var migrations []model.StorageMigration
+	err := r.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&migrations).Error
+	return migrations, err
+}
+
+func (r *storageMigrationRepository) Claim(ctx context.Context, id uint, now, until time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.StorageMigration{}).
+		Where("id = ? AND status <> ? AND (locked_until IS NULL OR locked_until < ?)", id, model.MigrationStatusCompleted, now).
+		Updates(map[string]interface{}{"status": model.MigrationStatusRunning, "locked_until": until})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *storageMigrationRepository) Renew(ctx context.Context, id uint, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.StorageMigration{}).
+		Where("id = ? AND status = ?", id, model.MigrationStatusRunning).
+		Update("locked_until", until).Error
+}
+
+func (r *storageMigrationRepository) SaveProgress(ctx context.Context, migration *model.StorageMigration) error {
+	return r.db.WithContext(ctx).Model(migration).
+		Select("status", "last_key", "copied", "skipped", "failed", "bytes", "error", "locked_until", "started_at", "finished_at").
+		Updates(migration).Error
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ThemeRepository interface {
+	FindByID(ctx context.Context, shopID, id uint) (*model.Theme, error)
+	FindActive(ctx context.Context, shopID uint) (*model.Theme, error)
+	List(ctx context.Context, shopID uint) ([]model.Theme, error)
+	Update(ctx context.Context, theme *model.Theme) error
+	// SaveConfig stores the theme's ConfigData and snapshots it into the
+	// current version
+	SaveConfig(ctx context.Context, theme *model.Theme) error
+	Delete(ctx context.Context, shopID, id uint) error
+
+	AddVersion(ctx context.Context, theme *model.Theme, version *model.ThemeVersion) error
+	FindVersion(ctx context.Context, themeID uint, version int) (*model.ThemeVersion, error)
+	ListVersions(ctx context.Context, themeID uint) ([]model.ThemeVersion, error)
+	Activate(ctx context.Context, shopID, id uint) error
+}
+
+type themeRepository struct {
+	db *gorm.DB
+}
+
+func NewThemeRepository(db *gorm.DB) ThemeRepository {
+	return &themeRepository{db: db}
+}
+
+func (r *themeRepository) FindByID(ctx context.Context, shopID, id uint) (*model.Theme, error) {
+	var theme model.Theme
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).First(&theme, id).Error
+	return &theme, err
+}
+
+func (r *themeRepository) FindActive(ctx context.Context, shopID uint) (*model.Theme, error) {
+	var theme model.Theme
+	err := r.db.WithContext(ctx).Where("shop_id = ? AND is_active = ?", shopID, true).First(&theme).Error
+	return &theme, err
+}
+
+func (r *themeRepository) List(ctx context.Context, shopID uint) ([]model.Theme, error) {
+	var themes []model.Theme
+	err := r.db.WithContext(ctx).Where("shop_id = ?", shopID).Order("id ASC").Find(&themes).Error
+	return themes, err
+}
+
+func (r *themeRepository) Update(ctx context.Context, theme *model.Theme) error {
+	return r.db.WithContext(ctx).Save(theme).Error
+}
+
+func (r *themeRepository) SaveConfig(ctx context.Context, theme *model.Theme) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(theme).Update("config_data", theme.ConfigData).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.ThemeVersion{}).
+			Where("theme_id = ? AND version = ?", theme.ID, theme.Version).
+			Update("config_data", theme.ConfigData).Error
+	})
+}
+
+func (r *themeRepository) Delete(ctx context.Context, shopID, id uint) error {
+	res := r.db.WithContext(ctx).Where("shop_id = ?", shopID).Delete(&model.Theme{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddVersion stores a new package version and makes it the theme's current
+// one, starting from the theme's setting values. A theme without ID is
+// created in the same transaction.
+func (r *themeRepository) AddVersion(ctx context.Context, theme *model.Theme, version *model.ThemeVersion) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if theme.ID == 0 {
+			if err := tx.Create(theme).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(theme, theme.ID).Error; err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&model.ThemeVersion{}).
+			Where("theme_id = ?", theme.ID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		version.ShopID = theme.ShopID
+		version.ThemeID = theme.ID
+		version.Version = latest + 1
+		version.ConfigData = theme.ConfigData
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+
+		theme.Version = version.Version
+		theme.SourcePath = version.SourcePath
+		return tx.Model(theme).Select("version", "source_path").Updates(theme).Error
+	})
+}
+
+func (r *themeRepository) FindVersion(ctx context.Context, themeID uint, version int) (*model.ThemeVersion, error) {
+	var v model.ThemeVersion
+	err := r.db.WithContext(ctx).Where("theme_id = ? AND version = ?", themeID, version).First(&v).Error
+	return &v, err
+}
+
+func (r *themeRepository) ListVersions(ctx context.Context, themeID uint) ([]model.ThemeVersion, error) {
+	var versions []model.ThemeVersion
+	err := r.db.WithContext(ctx).Where("theme_id = ?", themeID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Activate makes id the only active theme of the shop in a single transaction
+func (r *themeRepository) Activate(ctx context.Context, shopID, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Theme{}).Where("shop_id = ? AND id = ?", shopID, id).Update("is_active", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&model.Theme{}).Where("shop_id = ? AND id = ?", shopID, id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		return tx.Model(&model.Theme{}).
+			Where("shop_id = ? AND id <> ? AND is_active = ?", shopID, id, true).
+			Update("is_active", false).Error
+	})
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type UploadSessionRepository interface {
+	Create(ctx context.Context, session *model.UploadSession) error
+	FindByUploadID(ctx context.Context, shopID uint, uploadID string) (*model.UploadSession, error)
+	// Transition moves a session between states and reports false if it was
+	// no longer in the expected state (e.g. completed and aborted concurrently)
+	Transition(ctx context.Context, id uint, from, to string) (bool, error)
+	SetChecksum(ctx context.Context, id uint, checksum string) error
+	SetContentType(ctx context.Context, id uint, contentType string) error
+	ListExpired(ctx context.Context, now time.Time, limit int) ([]model.UploadSession, error)
+}
+
+type uploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(ctx context.Context, session *model.UploadSession) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *uploadSessionRepository) FindByUploadID(ctx context.Context, shopID uint, uploadID string) (*model.UploadSession, error) {
+	var session model.UploadSession
+	err := r.db.WithContext(ctx).Where("shop_id = ? AND upload_id = ?", shopID, uploadID).First(&session).Error
+	return &session, err
+}
+
+func (r *uploadSessionRepository) Transition(ctx context.Context, id uint, from, to string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.UploadSession{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *uploadSessionRepository) SetChecksum(ctx context.Context, id uint, checksum string) error {
+	return r.db.WithContext(ctx).Model(&model.UploadSession{}).Where("id = ?", id).Update("checksum", checksum).Error
+}
+
+func (r *uploadSessionRepository) SetContentType(ctx context.Context, id uint, contentType string) error {
+	return r.db.WithContext(ctx).Model(&model.UploadSession{}).Where("id = ?", id).Update("content_type", contentType).Error
+}
+
+func (r *uploadSessionRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]model.UploadSession, error) {
+	var sessions []model.UploadSession
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", model.UploadStatusUploading, now).
+		Order("expires_at").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
@@ -6,68 +6,217 @@ import (
 	"shop/internal/websocket"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/fx"
 )
 
-func RegisterRoutes(r *gin.Engine, userHandler *handler.UserHandler, fileHandler *handler.FileHandler, mw *middleware.Middleware, wsHub *websocket.Hub) {
+// Handlers groups every HTTP handler so new ones only need a field here
+type Handlers struct {
+	fx.In
+
+	User     *handler.UserHandler
+	File     *handler.FileHandler
+	Image    *handler.ImageHandler
+	Storage  *handler.StorageMigrationHandler
+	Customer *handler.CustomerHandler
+	Staff    *handler.StaffHandler
+	Order    *handler.OrderHandler
+	Blog     *handler.BlogHandler
+	Theme    *handler.ThemeHandler
+	Risk     *handler.RiskHandler
+	Report   *handler.ReportHandler
+	Search   *handler.ProductSearchHandler
+	Settings *handler.SearchSettingsHandler
+}
+
+func RegisterRoutes(r *gin.Engine, h Handlers, mw *middleware.Middleware, wsHub *websocket.Hub) {
 	// Global middleware
 	r.Use(mw.Cors())
 
 	// WebSocket Route
 	r.GET("/ws", wsHub.HandleWebSocket)
 
-	// File Upload Routes (Example)
-	upload := r.Group("/upload")
+	// File Upload Routes (Example), scoped to the shop in X-Shop-ID and
+	// restricted to its staff; buyers upload through /api/mall/account/files
+	upload := r.Group("/upload", mw.Shop(), mw.StaffAuth())
 	{
-		upload.POST("/simple", fileHandler.UploadSimple)
-		upload.POST("/init", fileHandler.InitiateMultipart)
-		upload.POST("/part", fileHandler.UploadPart)
-		upload.POST("/complete", fileHandler.CompleteMultipart)
+		upload.POST("/simple", h.File.UploadSimple)
+		upload.POST("/init", h.File.InitiateMultipart)
+		upload.POST("/part", h.File.UploadPart)
+		upload.POST("/complete", h.File.CompleteMultipart)
+		upload.GET("/parts", h.File.ListParts)
+		upload.POST("/abort", h.File.AbortMultipart)
+
+		// Presigned direct-to-storage transfers
+		upload.POST("/presign", h.File.PresignUpload)
+		upload.POST("/presign/confirm", h.File.ConfirmPresignedUpload)
+		upload.GET("/presign", h.File.PresignDownload)
+	}
 
-		// Static file serving for local storage (DEV ONLY)
-		r.Static("/uploads", "./uploads")
+	// Public local storage objects (DEV ONLY): release deployments serve them
+	// from the web server or CDN, which must exclude private/, quarantine/ and temp/
+	if gin.Mode() != gin.ReleaseMode {
+		r.StaticFS("/uploads", handler.PublicFiles("./uploads"))
 	}
 
+	// Presigned URL endpoints for local storage (signature checked per request)
+	r.PUT("/storage/local/*key", h.File.PutSigned)
+	r.GET("/storage/local/*key", h.File.GetSigned)
+
+	// On-the-fly image resizing (parameters signed, renditions cached in storage)
+	r.GET("/img/*key", h.Image.Serve)
+
 	// Root API Group
 	api := r.Group("/api")
 
 	// 1. SaaS Management (SaaS 管理端)
 	// 面向平台管理员：管理租户、计费、系统设置等
-	registerSaaSRoutes(api, userHandler, mw)
+	registerSaaSRoutes(api, h, mw)
 
 	// 2. E-commerce Admin (电商后台)
 	// 面向商家/租户：管理商品、订单、会员、营销等
-	registerAdminRoutes(api, userHandler, mw)
+	registerAdminRoutes(api, h, mw)
 
 	// 3. E-commerce Mall (电商前台)
 	// 面向C端消费者：浏览商品、购物车、下单、个人中心等
-	registerMallRoutes(api, userHandler, mw)
+	registerMallRoutes(api, h, mw)
 }
 
-func registerSaaSRoutes(rg *gin.RouterGroup, h *handler.UserHandler, mw *middleware.Middleware) {
+func registerSaaSRoutes(rg *gin.RouterGroup, h Handlers, mw *middleware.Middleware) {
 	saas := rg.Group("/saas")
-	// saas.Use(mw.Auth("admin")) // Example: Platform Admin Auth
 	{
 		// 示例：SaaS 平台管理接口
 		saas.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "saas module ok"})
 		})
+
+		// 平台管理员登录
+		saas.POST("/login", h.Staff.PlatformLogin)
+	}
+
+	// 以下接口需平台管理员令牌
+	platform := saas.Group("", mw.PlatformAuth())
+	{
+		// 存储迁移：在存储提供方之间复制全部对象 (可断点续传)
+		platform.GET("/storage/migrations", h.Storage.List)
+		platform.POST("/storage/migrations", h.Storage.Start)
+		platform.GET("/storage/migrations/:id", h.Storage.Get)
+		platform.POST("/storage/migrations/:id/resume", h.Storage.Resume)
 	}
 }
 
-func registerAdminRoutes(rg *gin.RouterGroup, h *handler.UserHandler, mw *middleware.Middleware) {
+func registerAdminRoutes(rg *gin.RouterGroup, h Handlers, mw *middleware.Middleware) {
 	admin := rg.Group("/admin")
 	// admin.Use(mw.Auth("merchant")) // Example: Merchant Auth
 	{
 		// 示例：商家后台接口复用 UserHandler
-		admin.GET("/users/:id", h.GetUser)
+		admin.GET("/users/:id", h.User.GetUser)
+	}
+
+	// 商家员工登录：签发仅对 X-Shop-ID 店铺有效的令牌
+	admin.POST("/login", mw.Shop(), h.Staff.Login)
+
+	// 店铺维度接口：通过 X-Shop-ID 识别租户，需该店铺的员工令牌
+	shop := admin.Group("", mw.Shop(), mw.StaffAuth())
+	{
+		shop.GET("/orders/:id", h.Order.GetOrder)
+		shop.POST("/orders/:id/mark-paid", h.Order.MarkPaid)
+
+		// 订单风控
+		shop.GET("/orders/:id/risk", h.Risk.GetOrderRisk)
+		shop.POST("/orders/:id/risk/evaluate", h.Risk.EvaluateOrder)
+		shop.GET("/risk/rules", h.Risk.GetRules)
+		shop.PUT("/risk/rules", h.Risk.UpdateRules)
+
+		// 数据报表 (按天汇总表; 搜索词报表来自搜索日志)
+		shop.GET("/reports/sales", h.Report.Sales)
+		shop.GET("/reports/top-products", h.Report.TopProducts)
+		shop.GET("/reports/discounts", h.Report.Discounts)
+		shop.POST("/reports/rebuild", h.Report.Rebuild)
+		shop.POST("/reports/export", h.Report.Export)
+		shop.GET("/reports/search-queries", h.Report.SearchQueries)
+
+		// 商品搜索规则：同义词组 (写入索引)、按搜索词置顶商品
+		shop.GET("/search/rules", h.Settings.GetRules)
+		shop.PUT("/search/rules", h.Settings.UpdateRules)
+
+		// 媒体库：文件列表/搜索/删除/下载(含私有文件)，存储用量
+		shop.GET("/files", h.File.ListFiles)
+		shop.GET("/files/usage", h.File.Usage)
+		shop.GET("/files/:id", h.File.GetFile)
+		shop.GET("/files/:id/download", h.File.Download)
+		shop.DELETE("/files/:id", h.File.DeleteFile)
+		shop.GET("/files/:id/image-url", h.Image.SignURL)
+
+		// 博客/CMS
+		shop.GET("/blog/posts", h.Blog.ListPosts)
+		shop.POST("/blog/posts", h.Blog.CreatePost)
+		shop.GET("/blog/posts/:id", h.Blog.GetPost)
+		shop.PUT("/blog/posts/:id", h.Blog.UpdatePost)
+		shop.DELETE("/blog/posts/:id", h.Blog.DeletePost)
+		shop.POST("/blog/posts/:id/featured-image", h.Blog.UploadFeaturedImage)
+
+		// 模板/主题：上传、版本回滚、发布、预览
+		shop.GET("/themes", h.Theme.List)
+		shop.POST("/themes", h.Theme.Upload)
+		shop.GET("/themes/:id", h.Theme.Get)
+		shop.DELETE("/themes/:id", h.Theme.Delete)
+		shop.GET("/themes/:id/versions", h.Theme.ListVersions)
+		shop.GET("/themes/:id/versions/:version/package", h.Theme.DownloadPackage)
+		shop.POST("/themes/:id/versions", h.Theme.UploadVersion)
+		shop.POST("/themes/:id/rollback", h.Theme.Rollback)
+		shop.POST("/themes/:id/publish", h.Theme.Publish)
+		shop.PUT("/themes/:id/settings", h.Theme.UpdateSettings)
+		shop.POST("/themes/:id/preview", h.Theme.Preview)
 	}
 }
 
-func registerMallRoutes(rg *gin.RouterGroup, h *handler.UserHandler, mw *middleware.Middleware) {
+func registerMallRoutes(rg *gin.RouterGroup, h Handlers, mw *middleware.Middleware) {
 	mall := rg.Group("/mall")
 	// mall.Use(mw.Auth("user")) // Example: Customer Auth
 	{
 		// 示例：前台用户注册
-		mall.POST("/register", h.Register)
+		mall.POST("/register", h.User.Register)
+	}
+
+	// 买家账户：注册/登录，地址簿，历史订单
+	account := mall.Group("/account", mw.Shop())
+	{
+		account.POST("/register", h.Customer.Register)
+		account.POST("/login", h.Customer.Login)
+
+		authed := account.Group("", mw.CustomerAuth())
+		authed.GET("", h.Customer.Profile)
+		authed.GET("/addresses", h.Customer.ListAddresses)
+		authed.POST("/addresses", h.Customer.CreateAddress)
+		authed.PUT("/addresses/:id", h.Customer.UpdateAddress)
+		authed.DELETE("/addresses/:id", h.Customer.DeleteAddress)
+		authed.GET("/orders", h.Customer.ListOrders)
+		authed.POST("/orders/claim", h.Customer.ClaimOrders)
+
+		// 买家私有文件 (如定制商品的图案)：仅上传者本人可下载
+		authed.POST("/files", h.File.CustomerUpload)
+		authed.GET("/files/:id/download", h.File.CustomerDownload)
+	}
+
+	// 下单：游客或已登录买家
+	mall.POST("/orders", mw.Shop(), mw.OptionalCustomerAuth(), h.Order.Checkout)
+
+	// 博客：已发布文章列表、详情与订阅源
+	blog := mall.Group("/blog", mw.Shop())
+	{
+		blog.GET("/posts", h.Blog.ListPublished)
+		blog.GET("/posts/:slug", h.Blog.GetPublished)
+		blog.GET("/rss", h.Blog.RSS)
+		blog.GET("/atom", h.Blog.Atom)
 	}
+
+	// 商品搜索：仅返回当前店铺的在售商品，支持筛选、排序与分面统计
+	mall.GET("/search", mw.Shop(), h.Search.Search)
+	// 搜索建议：输入时联想，热门搜索词优先 (Redis 缓存)
+	mall.GET("/search/suggest", mw.Shop(), h.Search.Suggest)
+	// 搜索点击：回传 search_id 与商品, 用于搜索报表
+	mall.POST("/search/click", mw.Shop(), h.Search.Click)
+
+	// 店铺装修：当前主题配置 (支持 preview_theme 签名预览)
+	mall.GET("/theme/settings", mw.Shop(), h.Theme.Settings)
 }
@@ -1,17 +1,25 @@
 package server
 
 import (
+	"fmt"
+
 	"shop/internal/config"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-func NewServer(cfg *config.Config, logger *zap.Logger) *gin.Engine {
+func NewServer(cfg *config.Config, logger *zap.Logger) (*gin.Engine, error) {
 	gin.SetMode(cfg.Server.Mode)
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(gin.Logger()) // Basic gin logger
 
-	return r
+	// ClientIP feeds the order risk checks, so forwarded addresses are only
+	// taken from the configured proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+
+	return r, nil
 }
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/utils"
+
+	"github.com/microcosm-cc/bluemonday"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidBlogStatus  = errors.New("status must be one of draft, scheduled, published")
+	ErrMissingPublishTime = errors.New("published_at is required for scheduled posts")
+)
+
+// imgSrcPattern extracts image URLs from sanitized HTML, which always quotes
+// attribute values with double quotes
+var imgSrcPattern = regexp.MustCompile(`<img[^>]+src="([^"]+)"`)
+
+// blogPolicy allows the formatting produced by rich text editors and strips
+// scripts, event handlers and other active content
+var blogPolicy = bluemonday.UGCPolicy()
+
+type BlogPostInput struct {
+	Title       string
+	Slug        string
+	Author      string
+	ContentHTML string
+	Summary     string
+	Status      string
+	PublishedAt *time.Time
+}
+
+// BlogFeed is what the RSS and Atom feeds of a shop are built from
+type BlogFeed struct {
+	Title  string // the shop name
+	Origin string // storefront scheme://host the post links point at
+	Posts  []model.BlogPost
+}
+
+type BlogService interface {
+	CreatePost(ctx context.Context, shopID uint, in BlogPostInput) (*model.BlogPost, error)
+	UpdatePost(ctx context.Context, shopID, id uint, in BlogPostInput) (*model.BlogPost, error)
+	DeletePost(ctx context.Context, shopID, id uint) error
+	GetPost(ctx context.Context, shopID, id uint) (*model.BlogPost, error)
+	ListPosts(ctx context.Context, shopID uint, status string, page, pageSize int) ([]model.BlogPost, int64, error)
+	UploadFeaturedImage(ctx context.Context, shopID, uploaderID, id uint, file *multipart.FileHeader) (*model.BlogPost, error)
+
+	// Storefront
+	ListPublished(ctx context.Context, shopID uint, page, pageSize int) ([]model.BlogPost, int64, error)
+	GetPublishedBySlug(ctx context.Context, shopID uint, slug string) (*model.BlogPost, error)
+	// Feed returns the latest size published posts with the shop name and
+	// the storefront origin: the shop's primary domain, else server.base_url
+	Feed(ctx context.Context, shopID uint, size int) (*BlogFeed, error)
+
+	// PublishScheduled publishes every scheduled post that is due, used by cron
+	PublishScheduled(ctx context.Context) (int64, error)
+}
+
+type blogService struct {
+	repo        repository.BlogRepository
+	shops       repository.ShopRepository
+	fileService FileService
+	cfg         *config.Config
+	logger      *zap.Logger
+}
+
+func NewBlogService(repo repository.BlogRepository, shops repository.ShopRepository, fileService FileService, cfg *config.Config, logger *zap.Logger) BlogService {
+	return &blogService{repo: repo, shops: shops, fileService: fileService, cfg: cfg, logger: logger}
+}
+
+func (s *blogService) CreatePost(ctx context.Context, shopID uint, in BlogPostInput) (*model.BlogPost, error) {
+	post := &model.BlogPost{ShopID: shopID}
+	if err := s.apply(ctx, post, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, post); err != nil {
+		return nil, err
+	}
+	s.syncFileReferences(ctx, post)
+	return post, nil
+}
+
+func (s *blogService) UpdatePost(ctx context.Context, shopID, id uint, in BlogPostInput) (*model.BlogPost, error) {
+	post, err := s.repo.FindByID(ctx, shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, post, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, post); err != nil {
+		return nil, err
+	}
+	s.syncFileReferences(ctx, post)
+	return post, nil
+}
+
+func (s *blogService) DeletePost(ctx context.Context, shopID, id uint) error {
+	if err := s.repo.Delete(ctx, shopID, id); err != nil {
+		return err
+	}
+	s.syncFileReferences(ctx, &model.BlogPost{ID: id, ShopID: shopID})
+	return nil
+}
+
+func (s *blogService) GetPost(ctx context.Context, shopID, id uint) (*model.BlogPost, error) {
+	return s.repo.FindByID(ctx, shopID, id)
+}
+
+func (s *blogService) ListPosts(ctx context.Context, shopID uint, status string, page, pageSize int) ([]model.BlogPost, int64, error) {
+	offset, limit := paginate(page, pageSize)
+	return s.repo.List(ctx, shopID, status, offset, limit)
+}
+
+func (s *blogService) UploadFeaturedImage(ctx context.Context, shopID, uploaderID, id uint, file *multipart.FileHeader) (*model.BlogPost, error) {
+	post, err := s.repo.FindByID(ctx, shopID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded, err := s.fileService.UploadFile(ctx, shopID, file, UploadInput{UploaderID: uploaderID, Folder: fmt.Sprintf("blog/%d", shopID)})
+	if err != nil {
+		return nil, err
+	}
+
+	post.FeaturedImage = uploaded.URL
+	if err := s.repo.Update(ctx, post); err != nil {
+		return nil, err
+	}
+	s.syncFileReferences(ctx, post)
+	return post, nil
+}
+
+func (s *blogService) ListPublished(ctx context.Context, shopID uint, page, pageSize int) ([]model.BlogPost, int64, error) {
+	offset, limit := paginate(page, pageSize)
+	return s.repo.ListPublished(ctx, shopID, offset, limit)
+}
+
+func (s *blogService) GetPublishedBySlug(ctx context.Context, shopID uint, slug string) (*model.BlogPost, error) {
+	return s.repo.FindPublishedBySlug(ctx, shopID, slug)
+}
+
+func (s *blogService) Feed(ctx context.Context, shopID uint, size int) (*BlogFeed, error) {
+	shop, err := s.shops.FindByID(ctx, shopID)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := s.shops.PrimaryDomain(ctx, shopID)
+	if err != nil {
+		return nil, err
+	}
+	origin := strings.TrimSuffix(s.cfg.Server.BaseURL, "/")
+	if domain != "" {
+		origin = "https://" + domain
+	}
+
+	posts, _, err := s.repo.ListPublished(ctx, shopID, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return &BlogFeed{Title: shop.Name, Origin: origin, Posts: posts}, nil
+}
+
+func (s *blogService) PublishScheduled(ctx context.Context) (int64, error) {
+	n, err := s.repo.PublishDue(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		s.logger.Info("Published scheduled blog posts", zap.Int64("count", n))
+	}
+	return n, nil
+}
+
+// apply copies the input onto post, sanitizing HTML, resolving a unique slug
+// and normalizing the publishing state
+func (s *blogService) apply(ctx context.Context, post *model.BlogPost, in BlogPostInput) error {
+	status := in.Status
+	if status == "" {
+		status = model.BlogStatusDraft
+	}
+
+	now := time.Now()
+	publishedAt := in.PublishedAt
+	switch status {
+	case model.BlogStatusDraft:
+	case model.BlogStatusPublished, model.BlogStatusScheduled:
+		if publishedAt == nil {
+			if status == model.BlogStatusScheduled {
+				return ErrMissingPublishTime
+			}
+			if post.PublishedAt != nil && post.Status == model.BlogStatusPublished {
+				publishedAt = post.PublishedAt
+			} else {
+				publishedAt = &now
+			}
+		}
+		// A publish time in the future always means scheduled, and a
+		// scheduled time in the past means published right away
+		if publishedAt.After(now) {
+			status = model.BlogStatusScheduled
+		} else {
+			status = model.BlogStatusPublished
+		}
+	default:
+		return ErrInvalidBlogStatus
+	}
+
+	slugSource := in.Slug
+	if slugSource == "" {
+		if post.Slug != "" {
+			slugSource = post.Slug
+		} else {
+			slugSource = in.Title
+		}
+	}
+	slug, err := s.uniqueSlug(ctx, post.ShopID, utils.Slugify(slugSource), post.ID)
+	if err != nil {
+		return err
+	}
+
+	post.Title = in.Title
+	post.Slug = slug
+	post.Author = in.Author
+	post.ContentHTML = blogPolicy.Sanitize(in.ContentHTML)
+	post.Summary = blogPolicy.Sanitize(in.Summary)
+	post.Status = status
+	post.PublishedAt = publishedAt
+	return nil
+}
+
+// syncFileReferences pins the featured image and inline images of the post in
+// the media library so they cannot be deleted while in use
+func (s *blogService) syncFileReferences(ctx context.Context, post *model.BlogPost) {
+	var urls []string
+	if post.FeaturedImage != "" {
+		urls = append(urls, post.FeaturedImage)
+	}
+	for _, m := range imgSrcPattern.FindAllStringSubmatch(post.ContentHTML, -1) {
+		urls = append(urls, html.UnescapeString(m[1]))
+	}
+
+	if err := s.fileService.SyncReferences(ctx, post.ShopID, model.FileRefBlogPost, post.ID, urls); err != nil {
+		s.logger.Error("Failed to sync blog post file references", zap.Uint("post_id", post.ID), zap.Error(err))
+	}
+}
+
+func (s *blogService) uniqueSlug(ctx context.Context, shopID uint, base string, postID uint) (string, error) {
+	if base == "" {
+		base = "post"
+	}
+	slug := base
+	for i := 2; ; i++ {
+		exists, err := s.repo.SlugExists(ctx, shopID, slug, postID)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// paginate converts a 1-based page into offset/limit with a sane page size
+func paginate(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return (page - 1) * pageSize, pageSize
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrOrderNotClaimable  = errors.New("order cannot be claimed by this account")
+)
+
+type RegisterCustomerInput struct {
+	Email            string
+	Password         string
+	FirstName        string
+	LastName         string
+	AcceptsMarketing bool
+}
+
+type CustomerService interface {
+	Register(ctx context.Context, shopID uint, in RegisterCustomerInput) (*model.Customer, string, error)
+	Login(ctx context.Context, shopID uint, email, password string) (*model.Customer, string, error)
+	GetProfile(ctx context.Context, shopID, customerID uint) (*model.Customer, error)
+
+	ListAddresses(ctx context.Context, shopID, customerID uint) ([]model.CustomerAddress, error)
+	SaveAddress(ctx context.Context, address *model.CustomerAddress) error
+	DeleteAddress(ctx context.Context, shopID, customerID, addressID uint) error
+
+	ListOrders(ctx context.Context, shopID, customerID uint, page, pageSize int) ([]model.Order, int64, error)
+	ClaimGuestOrders(ctx context.Context, shopID, customerID uint, orderNumber string) (int64, error)
+}
+
+type customerService struct {
+	repo      repository.CustomerRepository
+	orderRepo repository.OrderRepository
+	cfg       *config.Config
+}
+
+func NewCustomerService(repo repository.CustomerRepository, orderRepo repository.OrderRepository, cfg *config.Config) CustomerService {
+	return &customerService{repo: repo, orderRepo: orderRepo, cfg: cfg}
+}
+
+func (s *customerService) Register(ctx context.Context, shopID uint, in RegisterCustomerInput) (*model.Customer, string, error) {
+	email := normalizeEmail(in.Email)
+	existing, err := s.repo.FindByEmail(ctx, shopID, email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+	guest := err == nil
+	if guest && existing.PasswordHash != "" {
+		return nil, "", ErrEmailTaken
+	}
+
+	hash, err := utils.HashPassword(in.Password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A guest checkout already created the customer: it becomes an account
+	if guest {
+		existing.PasswordHash = hash
+		if in.FirstName != "" || in.LastName != "" {
+			existing.FirstName, existing.LastName = in.FirstName, in.LastName
+		}
+		existing.AcceptsMarketing = existing.AcceptsMarketing || in.AcceptsMarketing
+		activated, err := s.repo.ActivateGuest(ctx, existing)
+		if err != nil {
+			return nil, "", err
+		}
+		if !activated {
+			return nil, "", ErrEmailTaken
+		}
+		token, err := s.issueToken(existing)
+		return existing, token, err
+	}
+
+	customer := &model.Customer{
+		ShopID:           shopID,
+		Email:            email,
+		PasswordHash:     hash,
+		FirstName:        in.FirstName,
+		LastName:         in.LastName,
+		AcceptsMarketing: in.AcceptsMarketing,
+	}
+	if err := s.repo.Create(ctx, customer); err != nil {
+		return nil, "", err
+	}
+
+	token, err := s.issueToken(customer)
+	return customer, token, err
+}
+
+func (s *customerService) Login(ctx context.Context, shopID uint, email, password string) (*model.Customer, string, error) {
+	customer, err := s.repo.FindByEmail(ctx, shopID, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrInvalidCredentials
+		}
+		return nil, "", err
+	}
+	// Customers created from guest checkout have no password yet
+	if customer.PasswordHash == "" || !utils.CheckPasswordHash(password, customer.PasswordHash) {
+		return nil, "", ErrInvalidCredentials
+	}
+
+	token, err := s.issueToken(customer)
+	return customer, token, err
+}
+
+func (s *customerService) GetProfile(ctx context.Context, shopID, customerID uint) (*model.Customer, error) {
+	return s.repo.FindByID(ctx, shopID, customerID)
+}
+
+func (s *customerService) ListAddresses(ctx context.Context, shopID, customerID uint) ([]model.CustomerAddress, error) {
+	return s.repo.ListAddresses(ctx, shopID, customerID)
+}
+
+func (s *customerService) SaveAddress(ctx context.Context, address *model.CustomerAddress) error {
+	if address.ID != 0 {
+		existing, err := s.repo.FindAddress(ctx, address.ShopID, address.CustomerID, address.ID)
+		if err != nil {
+			return err
+		}
+		address.CreatedAt = existing.CreatedAt
+	}
+	return s.repo.SaveAddress(ctx, address)
+}
+
+func (s *customerService) DeleteAddress(ctx context.Context, shopID, customerID, addressID uint) error {
+	return s.repo.DeleteAddress(ctx, shopID, customerID, addressID)
+}
+
+func (s *customerService) ListOrders(ctx context.Context, shopID, customerID uint, page, pageSize int) ([]model.Order, int64, error) {
+	offset, limit := paginate(page, pageSize)
+	return s.orderRepo.ListByCustomer(ctx, shopID, customerID, offset, limit)
+}
+
+// ClaimGuestOrders attaches the guest orders placed with the customer's email.
+// The caller must present the number of one of those orders as proof that it
+// received the order confirmation, since account emails are not verified.
+func (s *customerService) ClaimGuestOrders(ctx context.Context, shopID, customerID uint, orderNumber string) (int64, error) {
+	customer, err := s.repo.FindByID(ctx, shopID, customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	order, err := s.orderRepo.FindByNumber(ctx, shopID, orderNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrOrderNotClaimable
+		}
+		return 0, err
+	}
+	if order.CustomerID != nil || normalizeEmail(order.CustomerEmail) != customer.Email {
+		return 0, ErrOrderNotClaimable
+	}
+
+	return s.orderRepo.ClaimGuestOrders(ctx, shopID, customer.Email, customer.ID)
+}
+
+func (s *customerService) issueToken(customer *model.Customer) (string, error) {
+	ttl := time.Duration(s.cfg.JWT.ExpireHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 72 * time.Hour
+	}
+	return utils.GenerateToken(s.cfg.JWT.Secret, utils.ScopeCustomer, customer.ShopID, customer.ID, ttl)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
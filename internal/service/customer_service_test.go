@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"shop/internal/config"
+	"shop/internal/model"
+	"shop/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// customerStore keeps a shop's customers in memory
+type customerStore struct {
+	repository.CustomerRepository
+	customers []*model.Customer
+}
+
+func (r *customerStore) Create(ctx context.Context, customer *model.Customer) error {
+	customer.ID = uint(len(r.customers) + 1)
+	r.customers = append(r.customers, customer)
+	return nil
+}
+
+func (r *customerStore) FindByID(ctx context.Context, shopID, id uint) (*model.Customer, error) {
+	for _, c := range r.customers {
+		if c.ShopID == shopID && c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *customerStore) FindByEmail(ctx context.Context, shopID uint, email string) (*model.Customer, error) {
+	for _, c := range r.customers {
+		if c.ShopID == shopID && c.Email == email {
+			return c, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *customerStore) ActivateGuest(ctx context.Context, customer *model.Customer) (bool, error) {
+	return true, nil
+}
+
+// guestOrders keeps orders in memory and claims them like the repository
+type guestOrders struct {
+	repository.OrderRepository
+	orders []*model.Order
+}
+
+func (r *guestOrders) FindByNumber(ctx context.Context, shopID uint, orderNumber string) (*model.Order, error) {
+	for _, o := range r.orders {
+		if o.ShopID == shopID && o.OrderNumber == orderNumber {
+			return o, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *guestOrders) ClaimGuestOrders(ctx context.Context, shopID uint, email string, customerID uint) (int64, error) {
+	var claimed int64
+	for _, o := range r.orders {
+		if o.ShopID == shopID && o.CustomerEmail == email && o.CustomerID == nil {
+			o.CustomerID = &customerID
+			claimed++
+		}
+	}
+	return claimed, nil
+}
+
+func TestClaimGuestOrders(t *testing.T) {
+	other := uint(7)
+	orders := &guestOrders{orders: []*model.Order{
+		{ShopID: 1, OrderNumber: "#1001", CustomerEmail: "buyer@example.com"},
+		{ShopID: 1, OrderNumber: "#1002", CustomerEmail: "buyer@example.com"},
+		{ShopID: 1, OrderNumber: "#1003", CustomerEmail: "someone@example.com"},
+		{ShopID: 1, OrderNumber: "#1004", CustomerEmail: "buyer@example.com", CustomerID: &other},
+		{ShopID: 2, OrderNumber: "#1005", CustomerEmail: "buyer@example.com"},
+	}}
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test"
+	s := NewCustomerService(&customerStore{}, orders, cfg)
+	ctx := context.Background()
+
+	customer, token, err := s.Register(ctx, 1, RegisterCustomerInput{Email: " Buyer@Example.com", Password: "secret123"})
+	if err != nil || token == "" {
+		t.Fatalf("register: %v", err)
+	}
+
+	// The email alone proves nothing: an order number must be presented
+	for _, number := range []string{"#9999", "#1003", "#1004", "#1005"} {
+		if _, err := s.ClaimGuestOrders(ctx, 1, customer.ID, number); !errors.Is(err, ErrOrderNotClaimable) {
+			t.Errorf("claim with %s: got %v, want ErrOrderNotClaimable", number, err)
+		}
+	}
+
+	claimed, err := s.ClaimGuestOrders(ctx, 1, customer.ID, "#1002")
+	if err != nil || claimed != 2 {
+		t.Fatalf("claim = %d, %v; want 2 orders", claimed, err)
+	}
+	for _, o := range orders.orders {
+		mine := o.CustomerID != nil && *o.CustomerID == customer.ID
+		if want := o.ShopID == 1 && o.CustomerEmail == "buyer@example.com" && o.OrderNumber != "#1004"; mine != want {
+			t.Errorf("order %s (shop %d) claimed = %v, want %v", o.OrderNumber, o.ShopID, mine, want)
+		}
+	}
+
+	// A claimed order cannot be presented again
+	if _, err := s.ClaimGuestOrders(ctx, 1, customer.ID, "#1001"); !errors.Is(err, ErrOrderNotClaimable) {
+		t.Errorf("second claim: got %v, want ErrOrderNotClaimable", err)
+	}
+}
+
+func TestRegisterGuestCustomer(t *testing.T) {
+	repo := &customerStore{}
+	guest := &model.Customer{ShopID: 1, Email: "buyer@example.com", FirstName: "Ann"}
+	repo.Create(context.Background(), guest)
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test"
+	s := NewCustomerService(repo, &guestOrders{}, cfg)
+	ctx := context.Background()
+
+	customer, _, err := s.Register(ctx, 1, RegisterCustomerInput{Email: "buyer@example.com", Password: "secret123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer.ID != guest.ID || customer.PasswordHash == "" || customer.FirstName != "Ann" {
+		t.Errorf("registering over a guest = %+v, want the guest activated", customer)
+	}
+	if _, _, err := s.Register(ctx, 1, RegisterCustomerInput{Email: "buyer@example.com", Password: "other123"}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("registering twice: got %v, want ErrEmailTaken", err)
+	}
+	if _, _, err := s.Login(ctx, 1, "BUYER@example.com", "secret123"); err != nil {
+		t.Errorf("login: %v", err)
+	}
+}
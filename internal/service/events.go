@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"shop/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// Topics published on queue.Queue
+const (
+	TopicOrderCreated = "order.created"
+	TopicFileUploaded = "file.uploaded"
+	// TopicImageUploaded follows TopicFileUploaded once an image passed scanning
+	TopicImageUploaded = "image.uploaded"
+	// TopicStorageMigrate runs a storage migration in the background
+	TopicStorageMigrate = "storage.migrate"
+	// TopicProductChanged follows every committed product or variant write
+	TopicProductChanged = "product.changed"
+	// TopicSearchLogged carries storefront searches and clicks on their
+	// results; they share the topic so a click follows its search
+	TopicSearchLogged = "search.logged"
+	// TopicSearchRulesChanged reindexes a shop's products after its synonyms changed
+	TopicSearchRulesChanged = "search.rules_changed"
+)
+
+// OrderEvent is the payload of order topics
+type OrderEvent struct {
+	ShopID  uint `json:"shop_id"`
+	OrderID uint `json:"order_id"`
+}
+
+// FileEvent is the payload of file topics
+type FileEvent struct {
+	ShopID uint `json:"shop_id"`
+	FileID uint `json:"file_id"`
+}
+
+// ProductEvent is the payload of TopicProductChanged
+type ProductEvent struct {
+	ShopID    uint `json:"shop_id"`
+	ProductID uint `json:"product_id"`
+}
+
+// SearchLogEvent is the payload of TopicSearchLogged: a search, or a click on
+// one of its results when ClickedProductID is set
+type SearchLogEvent struct {
+	ShopID           uint      `json:"shop_id"`
+	SearchID         string    `json:"search_id"`
+	Query            string    `json:"query,omitempty"`
+	Results          int64     `json:"results"`
+	ClickedProductID uint      `json:"clicked_product_id,omitempty"`
+	At               time.Time `json:"at"`
+}
+
+// SearchRulesEvent is the payload of TopicSearchRulesChanged
+type SearchRulesEvent struct {
+	ShopID uint `json:"shop_id"`
+}
+
+// StorageMigrationEvent is the payload of TopicStorageMigrate
+type StorageMigrationEvent struct {
+	MigrationID uint `json:"migration_id"`
+}
+
+// publishEvent marshals payload onto topic. Publishing is best effort: the
+// queue is optional in development, so a missing queue or a publish failure
+// is logged instead of failing the request that produced the event.
+func publishEvent(ctx context.Context, q queue.Queue, logger *zap.Logger, topic string, payload interface{}) {
+	if q == nil {
+		logger.Warn("No message queue configured, dropping event", zap.String("topic", topic))
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Failed to encode event", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+	if err := q.Publish(ctx, topic, data, nil); err != nil {
+		logger.Error("Failed to publish event", zap.String("topic", topic), zap.Error(err))
+	}
+}
@@ -1,61 +1,986 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"shop/internal/config"
+	"shop/internal/infra/scanner"
 	"shop/internal/infra/storage"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/queue"
 	"shop/pkg/utils"
+	"strings"
 	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxPartNumber is the S3 limit, applied to every provider for consistency
+const maxPartNumber = 10000
+
+// privatePrefix holds every private object, so web servers and bucket
+// policies can keep the whole prefix out of public access
+const privatePrefix = "private"
+
+var (
+	ErrUploadTooLarge        = errors.New("file exceeds the maximum upload size")
+	ErrUploadMismatch        = errors.New("upload does not match the declared constraints")
+	ErrSignedURLUnsupported  = errors.New("storage provider serves its own presigned URLs")
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadSessionClosed   = errors.New("upload session is no longer active")
+	ErrInvalidPartNumber     = errors.New("part number must be between 1 and 10000")
+	ErrInvalidPartList       = errors.New("invalid part list")
+	ErrChecksumMismatch      = storage.ErrChecksumMismatch
+	ErrFileInUse             = errors.New("file is still referenced")
+	ErrInvalidVisibility     = errors.New("visibility must be public or private")
+	ErrFileNotPublic         = errors.New("private files are only served by the download endpoint")
+	ErrFileQuarantined       = errors.New("file was quarantined by the malware scanner")
+	ErrDownloadForbidden     = errors.New("downloading files requires a staff or customer sign-in")
 )
 
+// UploadInput describes who uploads a file and how it is stored
+type UploadInput struct {
+	UploaderID uint // platform user, 0 when unknown
+	CustomerID uint // buyer, for storefront uploads
+	Folder     string
+	Visibility string // public (default) or private
+}
+
+// Downloader identifies who asks for a file: a platform user signed in to
+// the shop's admin, or a buyer
+type Downloader struct {
+	UserID     uint
+	CustomerID uint
+}
+
+// PresignUploadInput describes the file the client is about to upload directly
+type PresignUploadInput struct {
+	UploaderID  uint // platform user, 0 when unknown
+	Filename    string
+	Folder      string
+	ContentType string
+	Size        int64
+}
+
+// PresignedUpload is a presigned PUT plus the key the object will be stored
+// under once the upload is confirmed with UploadID
+type PresignedUpload struct {
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	storage.PresignedRequest
+}
+
 type FileService interface {
-	UploadFile(ctx context.Context, file *multipart.FileHeader, folder string) (string, error)
-	InitiateMultipart(ctx context.Context, filename string, folder string) (string, string, error)
-	UploadPart(ctx context.Context, key string, uploadID string, partNumber int, file io.Reader, size int64) (string, error)
-	CompleteMultipart(ctx context.Context, key string, uploadID string, parts []storage.Part) (string, error)
+	// UploadFile stores the file and registers it in the shop's media library
+	UploadFile(ctx context.Context, shopID uint, file *multipart.FileHeader, input UploadInput) (*model.File, error)
+	// SaveGenerated registers content the platform produced for the shop,
+	// such as a report export, as a private file. It is trusted, so upload
+	// policies and the malware scan do not apply.
+	SaveGenerated(ctx context.Context, shopID, uploaderID uint, folder, filename string, body io.Reader, size int64) (*model.File, error)
+
+	// Multipart uploads are tracked as sessions owned by a shop
+	InitiateMultipart(ctx context.Context, shopID, uploaderID uint, filename string, folder string, visibility string, size int64) (*model.UploadSession, error)
+	UploadPart(ctx context.Context, shopID uint, key string, uploadID string, partNumber int, file io.Reader, size int64, checksum storage.PartChecksum) (*storage.Part, error)
+	CompleteMultipart(ctx context.Context, shopID uint, key string, uploadID string, parts []storage.Part) (*model.File, error)
+	ListParts(ctx context.Context, shopID uint, uploadID string) (*model.UploadSession, []storage.Part, error)
+	AbortMultipart(ctx context.Context, shopID uint, uploadID string) error
+	// ExpireStaleUploads aborts sessions past their expiry on the provider,
+	// deleting unconfirmed presigned uploads
+	ExpireStaleUploads(ctx context.Context) (int, error)
+
+	// Presigned direct-to-storage transfers, public objects only. A presigned
+	// upload lands in a pending area and becomes a file once confirmed;
+	// unconfirmed uploads are deleted by ExpireStaleUploads.
+	PresignUpload(ctx context.Context, shopID uint, input PresignUploadInput) (*PresignedUpload, error)
+	ConfirmPresignedUpload(ctx context.Context, shopID uint, uploadID string) (*model.File, error)
+	PresignDownload(ctx context.Context, key string) (*storage.PresignedRequest, error)
+
+	// AuthorizeDownload loads a file for the download endpoints: staff may
+	// read any file of the shop, buyers only their own
+	AuthorizeDownload(ctx context.Context, shopID, id uint, by Downloader) (*model.File, error)
+	// ReadFile streams a byte range of an authorized file, see
+	// storage.Provider.GetObjectRange
+	ReadFile(ctx context.Context, file *model.File, offset, length int64) (io.ReadCloser, error)
+
+	// Media library
+	ListFiles(ctx context.Context, filter repository.FileFilter, page, pageSize int) ([]model.File, int64, error)
+	GetFile(ctx context.Context, shopID, id uint) (*model.File, error)
+	DeleteFile(ctx context.Context, shopID, id uint) error
+	StorageUsage(ctx context.Context, shopID uint) (*model.FileUsage, error)
+	// SyncReferences records that (refType, refID) uses exactly the files at urls;
+	// URLs that are not in the media library are ignored
+	SyncReferences(ctx context.Context, shopID uint, refType string, refID uint, urls []string) error
+
+	// ScanFile runs the malware scanner on a stored file and quarantines it
+	// when flagged; invoked asynchronously from TopicFileUploaded. Clean images
+	// are handed on to TopicImageUploaded for derivative generation.
+	ScanFile(ctx context.Context, shopID, id uint) error
+
+	// Endpoints backing presigned URLs of providers without native support
+	PutSigned(ctx context.Context, key string, query url.Values, contentType string, body io.Reader, size int64) (string, error)
+	OpenSigned(ctx context.Context, key string, query url.Values) (*os.File, error)
 }
 
 type fileService struct {
-	provider storage.Provider
+	provider      storage.Provider
+	sessions      repository.UploadSessionRepository
+	files         repository.FileRepository
+	scanner       scanner.Scanner // nil when scanning is disabled
+	queue         queue.Queue
+	logger        *zap.Logger
+	policies      []config.UploadPolicy
+	presignExpire time.Duration
+	uploadExpire  time.Duration
+	maxUploadSize int64
 }
 
-func NewFileService(provider storage.Provider) FileService {
-	return &fileService{provider: provider}
+func NewFileService(provider storage.Provider, sessions repository.UploadSessionRepository, files repository.FileRepository, fileScanner scanner.Scanner, q queue.Queue, cfg *config.Config, logger *zap.Logger) FileService {
+	presignExpire := time.Duration(cfg.Storage.PresignExpire) * time.Second
+	if presignExpire <= 0 {
+		presignExpire = 15 * time.Minute
+	}
+	uploadExpire := time.Duration(cfg.Storage.UploadExpire) * time.Second
+	if uploadExpire <= 0 {
+		uploadExpire = 24 * time.Hour
+	}
+	maxSize := cfg.Storage.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	return &fileService{
+		provider:      provider,
+		sessions:      sessions,
+		files:         files,
+		scanner:       fileScanner,
+		queue:         q,
+		logger:        logger,
+		policies:      cfg.Storage.Policies,
+		presignExpire: presignExpire,
+		uploadExpire:  uploadExpire,
+		maxUploadSize: maxSize,
+	}
 }
 
-func (s *fileService) UploadFile(ctx context.Context, file *multipart.FileHeader, folder string) (string, error) {
+func (s *fileService) UploadFile(ctx context.Context, shopID uint, file *multipart.FileHeader, input UploadInput) (*model.File, error) {
+	folder, err := cleanFolder(input.Folder)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err := cleanVisibility(input.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	policy := resolvePolicy(s.policies, folder, s.maxUploadSize)
+	if file.Size > policy.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+
 	src, err := file.Open()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer src.Close()
 
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := utils.GenerateUUID() + ext
-	key := filepath.Join(folder, time.Now().Format("20060102"), filename)
+	contentType, body, err := sniff(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.check(file.Filename, contentType, file.Size); err != nil {
+		return nil, err
+	}
 
-	return s.provider.PutObject(ctx, key, src, file.Size)
+	record := &model.File{
+		ShopID:      shopID,
+		UploaderID:  input.UploaderID,
+		CustomerID:  input.CustomerID,
+		Filename:    file.Filename,
+		Folder:      folder,
+		Size:        file.Size,
+		ContentType: contentType,
+		Visibility:  visibility,
+	}
+	if err := s.store(ctx, record, body); err != nil {
+		return nil, err
+	}
+	s.publishUploaded(ctx, record)
+	return record, nil
 }
 
-func (s *fileService) InitiateMultipart(ctx context.Context, filename string, folder string) (string, string, error) {
-	ext := filepath.Ext(filename)
-	newFilename := utils.GenerateUUID() + ext
-	key := filepath.Join(folder, time.Now().Format("20060102"), newFilename)
+func (s *fileService) SaveGenerated(ctx context.Context, shopID, uploaderID uint, folder, filename string, body io.Reader, size int64) (*model.File, error) {
+	folder, err := cleanFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	contentType, body, err := sniff(body)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &model.File{
+		ShopID:      shopID,
+		UploaderID:  uploaderID,
+		Filename:    filename,
+		Folder:      folder,
+		Size:        size,
+		ContentType: contentType,
+		Visibility:  model.FileVisibilityPrivate,
+	}
+	if err := s.store(ctx, record, body); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// store writes body under the record's key, or a new one when it has none,
+// and registers the record, filling in its key, URL and checksum
+func (s *fileService) store(ctx context.Context, record *model.File, body io.Reader) error {
+	key := record.Key
+	if key == "" {
+		key = newObjectKey(record.Folder, record.Filename, record.Visibility)
+	}
+	hash := sha256.New()
+	url, err := s.provider.PutObject(ctx, key, io.TeeReader(body, hash), record.Size)
+	if err != nil {
+		return err
+	}
+
+	record.Key = key
+	record.URL = publicURL(url, record.Visibility)
+	record.Checksum = hex.EncodeToString(hash.Sum(nil))
+	if err := s.files.Create(ctx, record); err != nil {
+		// An unregistered object would be invisible to the library and quotas
+		if delErr := s.provider.DeleteObject(ctx, key); delErr != nil {
+			s.logger.Warn("Failed to delete unregistered upload", zap.String("key", key), zap.Error(delErr))
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *fileService) InitiateMultipart(ctx context.Context, shopID, uploaderID uint, filename string, folder string, visibility string, size int64) (*model.UploadSession, error) {
+	if size < 0 {
+		return nil, ErrUploadMismatch
+	}
+	folder, err := cleanFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err = cleanVisibility(visibility)
+	if err != nil {
+		return nil, err
+	}
+	if size > resolvePolicy(s.policies, folder, s.maxUploadSize).maxSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	// The visibility is carried by the key until the file is registered
+	key := newObjectKey(folder, filename, visibility)
 
 	uploadID, err := s.provider.InitiateMultipartUpload(ctx, key)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	session := &model.UploadSession{
+		ShopID:       shopID,
+		UploaderID:   uploaderID,
+		UploadID:     uploadID,
+		Key:          key,
+		Filename:     filename,
+		ExpectedSize: size,
+		Status:       model.UploadStatusUploading,
+		ExpiresAt:    time.Now().Add(s.uploadExpire),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		// Without a session nobody could resume or clean it up
+		if abortErr := s.provider.AbortMultipartUpload(ctx, key, uploadID); abortErr != nil {
+			s.logger.Warn("Failed to abort untracked multipart upload", zap.String("upload_id", uploadID), zap.Error(abortErr))
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// UploadPart streams the part to the provider with the client's declared
+// digests, which the provider checks before storing it, and hashes it on the
+// way to record its SHA-256 and compare the provider's ETag
+func (s *fileService) UploadPart(ctx context.Context, shopID uint, key string, uploadID string, partNumber int, file io.Reader, size int64, checksum storage.PartChecksum) (*storage.Part, error) {
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return nil, ErrInvalidPartNumber
+	}
+	session, err := s.openSession(ctx, model.UploadKindMultipart, shopID, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session.ExpectedSize > 0 && size > session.ExpectedSize {
+		return nil, ErrUploadTooLarge
+	}
+	policy := resolvePolicy(s.policies, keyFolder(session.Key), s.maxUploadSize)
+	if partNumber > policy.maxParts {
+		return nil, ErrTooManyParts
+	}
+
+	// The first part decides the content type of the whole file
+	if partNumber == 1 {
+		contentType, body, err := sniff(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.check(session.Filename, contentType, session.ExpectedSize); err != nil {
+			return nil, err
+		}
+		if err := s.sessions.SetContentType(ctx, session.ID, contentType); err != nil {
+			return nil, err
+		}
+		file = body
+	}
+
+	md5Hash, shaHash := md5.New(), sha256.New()
+	etag, err := s.provider.UploadPart(ctx, session.Key, uploadID, partNumber,
+		io.TeeReader(file, io.MultiWriter(md5Hash, shaHash)), size, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	part := &storage.Part{
+		PartNumber: partNumber,
+		ETag:       storage.NormalizeETag(etag),
+		Size:       size,
+		SHA256:     hex.EncodeToString(shaHash.Sum(nil)),
+	}
+	sumMD5 := hex.EncodeToString(md5Hash.Sum(nil))
+
+	switch {
+	case checksum.MD5 != "" && !strings.EqualFold(checksum.MD5, sumMD5):
+		return nil, fmt.Errorf("%w: part %d md5", ErrChecksumMismatch, partNumber)
+	case checksum.SHA256 != "" && !strings.EqualFold(checksum.SHA256, part.SHA256):
+		return nil, fmt.Errorf("%w: part %d sha256", ErrChecksumMismatch, partNumber)
+	case isMD5(part.ETag) && part.ETag != sumMD5:
+		// The provider stored different bytes than we sent (SSE-KMS ETags are not MD5s and skip this)
+		return nil, fmt.Errorf("%w: part %d etag", ErrChecksumMismatch, partNumber)
+	}
+	return part, nil
+}
+
+func (s *fileService) CompleteMultipart(ctx context.Context, shopID uint, key string, uploadID string, parts []storage.Part) (*model.File, error) {
+	session, err := s.openSession(ctx, model.UploadKindMultipart, shopID, key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := resolvePolicy(s.policies, keyFolder(session.Key), s.maxUploadSize)
+	if len(parts) > policy.maxParts {
+		return nil, ErrTooManyParts
+	}
+	stored, err := s.validateParts(ctx, session, parts)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, p := range stored {
+		size += p.Size
+	}
+	if size > policy.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	// Claim the session first so the janitor cannot abort it mid-assembly
+	ok, err := s.sessions.Transition(ctx, session.ID, model.UploadStatusUploading, model.UploadStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadSessionClosed
+	}
+
+	url, err := s.provider.CompleteMultipartUpload(ctx, session.Key, uploadID, stored)
+	if err != nil {
+		if _, rollbackErr := s.sessions.Transition(ctx, session.ID, model.UploadStatusCompleted, model.UploadStatusUploading); rollbackErr != nil {
+			s.logger.Error("Failed to reopen upload session", zap.Uint("session_id", session.ID), zap.Error(rollbackErr))
+		}
+		return nil, err
+	}
+
+	checksum := multipartChecksum(stored)
+	if err := s.sessions.SetChecksum(ctx, session.ID, checksum); err != nil {
+		s.logger.Error("Failed to record upload checksum", zap.Uint("session_id", session.ID), zap.Error(err))
+	}
+
+	visibility := keyVisibility(session.Key)
+	record := &model.File{
+		ShopID:      session.ShopID,
+		UploaderID:  session.UploaderID,
+		Key:         session.Key,
+		URL:         publicURL(url, visibility),
+		Filename:    session.Filename,
+		Folder:      keyFolder(session.Key),
+		Size:        size,
+		ContentType: session.ContentType,
+		Checksum:    checksum,
+		Visibility:  visibility,
+	}
+	if err := s.files.Create(ctx, record); err != nil {
+		s.logger.Error("Failed to register multipart upload", zap.String("key", session.Key), zap.Error(err))
+		return nil, err
+	}
+	s.publishUploaded(ctx, record)
+	return record, nil
+}
+
+// ListParts lets a client resume after a dropped connection by reporting the
+// parts the provider already holds
+func (s *fileService) ListParts(ctx context.Context, shopID uint, uploadID string) (*model.UploadSession, []storage.Part, error) {
+	session, err := s.openSession(ctx, model.UploadKindMultipart, shopID, "", uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts, err := s.provider.ListParts(ctx, session.Key, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, parts, nil
+}
+
+func (s *fileService) AbortMultipart(ctx context.Context, shopID uint, uploadID string) error {
+	session, err := s.openSession(ctx, model.UploadKindMultipart, shopID, "", uploadID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.sessions.Transition(ctx, session.ID, model.UploadStatusUploading, model.UploadStatusAborted)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUploadSessionClosed
+	}
+	return s.provider.AbortMultipartUpload(ctx, session.Key, uploadID)
+}
+
+func (s *fileService) ExpireStaleUploads(ctx context.Context) (int, error) {
+	const batchSize = 100
+
+	expired := 0
+	for {
+		sessions, err := s.sessions.ListExpired(ctx, time.Now(), batchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, session := range sessions {
+			ok, err := s.sessions.Transition(ctx, session.ID, model.UploadStatusUploading, model.UploadStatusExpired)
+			if err != nil {
+				return expired, err
+			}
+			if !ok {
+				continue
+			}
+			if session.Kind == model.UploadKindPresigned {
+				if err := s.provider.DeleteObject(ctx, pendingKey(session.Key)); err != nil {
+					s.logger.Warn("Failed to delete unconfirmed presigned upload",
+						zap.String("upload_id", session.UploadID), zap.Error(err))
+				}
+			} else if err := s.provider.AbortMultipartUpload(ctx, session.Key, session.UploadID); err != nil {
+				s.logger.Warn("Failed to abort expired multipart upload",
+					zap.String("upload_id", session.UploadID), zap.Error(err))
+			}
+			expired++
+		}
+
+		if len(sessions) < batchSize {
+			break
+		}
+	}
+
+	if expired > 0 {
+		s.logger.Info("Expired stale uploads", zap.Int("count", expired))
+	}
+	return expired, nil
+}
+
+func (s *fileService) ListFiles(ctx context.Context, filter repository.FileFilter, page, pageSize int) ([]model.File, int64, error) {
+	offset, limit := paginate(page, pageSize)
+	return s.files.List(ctx, filter, offset, limit)
+}
+
+func (s *fileService) GetFile(ctx context.Context, shopID, id uint) (*model.File, error) {
+	return s.files.FindByID(ctx, shopID, id)
+}
+
+// DeleteFile removes an unreferenced file from the library and the provider
+func (s *fileService) DeleteFile(ctx context.Context, shopID, id uint) error {
+	file, deleted, err := s.files.DeleteUnreferenced(ctx, shopID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrFileInUse
+	}
+	// The row is gone already; failures below only leave orphaned storage
+	if err := s.provider.DeleteObject(ctx, file.Key); err != nil {
+		s.logger.Error("Failed to delete file object", zap.String("key", file.Key), zap.Error(err))
+	}
+	if err := s.deletePrefix(ctx, path.Join(derivativePrefix, file.Key)+"/"); err != nil {
+		s.logger.Error("Failed to delete image derivatives", zap.String("key", file.Key), zap.Error(err))
+	}
+	return nil
+}
+
+// deletePrefix removes every object under prefix, e.g. the configured and
+// on-demand renditions of an image
+func (s *fileService) deletePrefix(ctx context.Context, prefix string) error {
+	opts := storage.ListOptions{Prefix: prefix}
+	for {
+		page, err := s.provider.ListObjects(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Objects {
+			if err := s.provider.DeleteObject(ctx, obj.Key); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			return nil
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+}
+
+func (s *fileService) StorageUsage(ctx context.Context, shopID uint) (*model.FileUsage, error) {
+	return s.files.Usage(ctx, shopID)
+}
+
+func (s *fileService) SyncReferences(ctx context.Context, shopID uint, refType string, refID uint, urls []string) error {
+	return s.files.SyncReferences(ctx, shopID, refType, refID, urls)
+}
+
+func (s *fileService) ScanFile(ctx context.Context, shopID, id uint) error {
+	file, err := s.files.FindByID(ctx, shopID, id)
+	if err != nil {
+		return err
+	}
+	if file.Status == model.FileStatusQuarantined {
+		return nil
+	}
+	if s.scanner == nil {
+		s.publishImageUploaded(ctx, file)
+		return nil
+	}
+
+	result, err := s.scanObject(ctx, file.Key)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	file.ScannedAt = &now
+	if result.Clean {
+		file.ScanResult = "clean"
+		if err := s.files.SaveScanResult(ctx, file); err != nil {
+			return err
+		}
+		s.publishImageUploaded(ctx, file)
+		return nil
 	}
-	return key, uploadID, nil
+
+	s.logger.Warn("Malware detected in upload, quarantining",
+		zap.Uint("shop_id", shopID), zap.Uint("file_id", id),
+		zap.String("key", file.Key), zap.String("signature", result.Signature))
+
+	quarantineKey := path.Join("quarantine", file.Key)
+	if err := s.moveObject(ctx, file.Key, quarantineKey); err != nil {
+		return err
+	}
+	// Renditions served before the scan finished must not outlive the original
+	if err := s.deletePrefix(ctx, path.Join(derivativePrefix, file.Key)+"/"); err != nil {
+		s.logger.Error("Failed to delete image derivatives", zap.String("key", file.Key), zap.Error(err))
+	}
+	file.Key = quarantineKey
+	file.URL = ""
+	file.Status = model.FileStatusQuarantined
+	file.ScanResult = result.Signature
+	return s.files.SaveScanResult(ctx, file)
 }
 
-func (s *fileService) UploadPart(ctx context.Context, key string, uploadID string, partNumber int, file io.Reader, size int64) (string, error) {
-	return s.provider.UploadPart(ctx, key, uploadID, partNumber, file, size)
+func (s *fileService) scanObject(ctx context.Context, key string) (*scanner.Result, error) {
+	obj, err := s.provider.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return s.scanner.Scan(ctx, obj)
 }
 
-func (s *fileService) CompleteMultipart(ctx context.Context, key string, uploadID string, parts []storage.Part) (string, error) {
-	return s.provider.CompleteMultipartUpload(ctx, key, uploadID, parts)
+// moveObject copies an object to a new key and removes the original
+func (s *fileService) moveObject(ctx context.Context, from, to string) error {
+	if err := s.provider.CopyObject(ctx, from, to); err != nil {
+		return err
+	}
+	return s.provider.DeleteObject(ctx, from)
+}
+
+func (s *fileService) publishUploaded(ctx context.Context, file *model.File) {
+	publishEvent(ctx, s.queue, s.logger, TopicFileUploaded, FileEvent{ShopID: file.ShopID, FileID: file.ID})
+}
+
+// publishImageUploaded hands public images on to derivative generation;
+// derivatives are public objects, so private images get none
+func (s *fileService) publishImageUploaded(ctx context.Context, file *model.File) {
+	if strings.HasPrefix(file.ContentType, "image/") && file.Visibility != model.FileVisibilityPrivate {
+		publishEvent(ctx, s.queue, s.logger, TopicImageUploaded, FileEvent{ShopID: file.ShopID, FileID: file.ID})
+	}
+}
+
+// openSession loads a session that is still accepting parts; key is optional
+func (s *fileService) openSession(ctx context.Context, kind string, shopID uint, key string, uploadID string) (*model.UploadSession, error) {
+	session, err := s.sessions.FindByUploadID(ctx, shopID, uploadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Kind != kind || key != "" && key != session.Key {
+		return nil, ErrUploadSessionNotFound
+	}
+	if session.Status != model.UploadStatusUploading || time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadSessionClosed
+	}
+	return session, nil
+}
+
+// validateParts checks the client's part list against what the provider holds:
+// parts must be numbered 1..n in order, exist, and carry the stored ETag. The
+// stored parts are returned in the client's order.
+func (s *fileService) validateParts(ctx context.Context, session *model.UploadSession, parts []storage.Part) ([]storage.Part, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no parts", ErrInvalidPartList)
+	}
+	for i, p := range parts {
+		if p.PartNumber != i+1 {
+			return nil, fmt.Errorf("%w: expected part %d at position %d, got %d", ErrInvalidPartList, i+1, i+1, p.PartNumber)
+		}
+		if p.ETag == "" {
+			return nil, fmt.Errorf("%w: part %d has no etag", ErrInvalidPartList, p.PartNumber)
+		}
+	}
+
+	listed, err := s.provider.ListParts(ctx, session.Key, session.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int]storage.Part, len(listed))
+	for _, p := range listed {
+		byNumber[p.PartNumber] = p
+	}
+
+	stored := make([]storage.Part, 0, len(parts))
+	var total int64
+	for _, p := range parts {
+		st, ok := byNumber[p.PartNumber]
+		if !ok {
+			return nil, fmt.Errorf("%w: part %d was not uploaded", ErrInvalidPartList, p.PartNumber)
+		}
+		if storage.NormalizeETag(p.ETag) != st.ETag {
+			return nil, fmt.Errorf("%w: part %d etag mismatch", ErrInvalidPartList, p.PartNumber)
+		}
+		stored = append(stored, st)
+		total += st.Size
+	}
+
+	if session.ExpectedSize > 0 && total != session.ExpectedSize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrUploadMismatch, session.ExpectedSize, total)
+	}
+	return stored, nil
+}
+
+// multipartChecksum is the S3 multipart ETag: md5 of the concatenated binary
+// part MD5s, suffixed with the part count. It is identical on every provider.
+func multipartChecksum(parts []storage.Part) string {
+	hash := md5.New()
+	for _, p := range parts {
+		sum, err := hex.DecodeString(p.ETag)
+		if err != nil {
+			return ""
+		}
+		hash.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(hash.Sum(nil)), len(parts))
+}
+
+// newObjectKey generates a unique key: [private/]folder/date/uuid.ext
+func newObjectKey(folder, filename, visibility string) string {
+	key := path.Join(folder, time.Now().Format("20060102"), utils.GenerateUUID()+filepath.Ext(filename))
+	if visibility == model.FileVisibilityPrivate {
+		key = path.Join(privatePrefix, key)
+	}
+	return key
+}
+
+// keyFolder strips the visibility prefix, date directory and object name from
+// a generated key
+func keyFolder(key string) string {
+	return path.Dir(path.Dir(strings.TrimPrefix(key, privatePrefix+"/")))
+}
+
+func keyVisibility(key string) string {
+	if strings.HasPrefix(key, privatePrefix+"/") {
+		return model.FileVisibilityPrivate
+	}
+	return model.FileVisibilityPublic
+}
+
+func cleanVisibility(visibility string) (string, error) {
+	switch visibility {
+	case "", model.FileVisibilityPublic:
+		return model.FileVisibilityPublic, nil
+	case model.FileVisibilityPrivate:
+		return visibility, nil
+	}
+	return "", ErrInvalidVisibility
+}
+
+// publicURL drops the provider URL of private files, which must not leak
+func publicURL(url, visibility string) string {
+	if visibility == model.FileVisibilityPrivate {
+		return ""
+	}
+	return url
+}
+
+// sniff detects the content type from the first 512 bytes without consuming them
+func sniff(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+	return http.DetectContentType(head), br, nil
+}
+
+func isMD5(etag string) bool {
+	if len(etag) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(etag)
+	return err == nil
+}
+
+// PresignUpload reserves a key and signs a PUT of the pending object, bound
+// to the declared type and size. Nothing is trusted until the upload is
+// confirmed: the content never passes through us.
+func (s *fileService) PresignUpload(ctx context.Context, shopID uint, input PresignUploadInput) (*PresignedUpload, error) {
+	folder, err := cleanFolder(input.Folder)
+	if err != nil {
+		return nil, err
+	}
+	if input.Size <= 0 {
+		return nil, ErrUploadMismatch
+	}
+	if input.ContentType == "" {
+		input.ContentType = "application/octet-stream"
+	}
+	// Reject early what confirmation would reject anyway
+	policy := resolvePolicy(s.policies, folder, s.maxUploadSize)
+	if err := policy.check(input.Filename, input.ContentType, input.Size); err != nil {
+		return nil, err
+	}
+
+	key := newObjectKey(folder, input.Filename, model.FileVisibilityPublic)
+	req, err := s.provider.PresignPut(ctx, pendingKey(key), storage.PresignOptions{
+		Expires:       s.presignExpire,
+		ContentType:   input.ContentType,
+		ContentLength: input.Size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.UploadSession{
+		ShopID:       shopID,
+		UploaderID:   input.UploaderID,
+		UploadID:     "presign-" + utils.GenerateUUID(),
+		Kind:         model.UploadKindPresigned,
+		Key:          key,
+		Filename:     input.Filename,
+		ExpectedSize: input.Size,
+		ContentType:  input.ContentType,
+		Status:       model.UploadStatusUploading,
+		ExpiresAt:    time.Now().Add(s.presignExpire + s.uploadExpire),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return &PresignedUpload{Key: key, UploadID: session.UploadID, PresignedRequest: *req}, nil
+}
+
+// ConfirmPresignedUpload checks the pending object like UploadFile checks an
+// upload (size, sniffed type, folder policy), moves it to its key, registers
+// it and hands it to the scanner. A rejected object is deleted.
+func (s *fileService) ConfirmPresignedUpload(ctx context.Context, shopID uint, uploadID string) (*model.File, error) {
+	session, err := s.openSession(ctx, model.UploadKindPresigned, shopID, "", uploadID)
+	if err != nil {
+		return nil, err
+	}
+	pending := pendingKey(session.Key)
+
+	info, err := s.provider.StatObject(ctx, pending)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: nothing was uploaded", ErrUploadMismatch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the session so that concurrent confirmations register it once
+	ok, err := s.sessions.Transition(ctx, session.ID, model.UploadStatusUploading, model.UploadStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadSessionClosed
+	}
+
+	record, err := s.registerPending(ctx, session, pending, info.Size)
+	if err != nil {
+		// A rejected upload is over, the client has to start again
+		if _, trErr := s.sessions.Transition(ctx, session.ID, model.UploadStatusCompleted, model.UploadStatusAborted); trErr != nil {
+			s.logger.Warn("Failed to abort rejected presigned upload", zap.String("upload_id", uploadID), zap.Error(trErr))
+		}
+		if delErr := s.provider.DeleteObject(ctx, pending); delErr != nil {
+			s.logger.Warn("Failed to delete rejected presigned upload", zap.String("key", pending), zap.Error(delErr))
+		}
+		return nil, err
+	}
+	if err := s.provider.DeleteObject(ctx, pending); err != nil {
+		s.logger.Warn("Failed to delete confirmed presigned upload", zap.String("key", pending), zap.Error(err))
+	}
+	s.publishUploaded(ctx, record)
+	return record, nil
+}
+
+// registerPending validates the pending object of session and stores it as
+// a file under the session key
+func (s *fileService) registerPending(ctx context.Context, session *model.UploadSession, pending string, size int64) (*model.File, error) {
+	if size != session.ExpectedSize {
+		return nil, fmt.Errorf("%w: size", ErrUploadMismatch)
+	}
+	body, err := s.provider.GetObject(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	contentType, content, err := sniff(body)
+	if err != nil {
+		return nil, err
+	}
+	policy := resolvePolicy(s.policies, keyFolder(session.Key), s.maxUploadSize)
+	if err := policy.check(session.Filename, contentType, size); err != nil {
+		return nil, err
+	}
+
+	record := &model.File{
+		ShopID:      session.ShopID,
+		UploaderID:  session.UploaderID,
+		Key:         session.Key,
+		Filename:    session.Filename,
+		Folder:      keyFolder(session.Key),
+		Size:        size,
+		ContentType: contentType,
+		Visibility:  keyVisibility(session.Key),
+	}
+	if err := s.store(ctx, record, content); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// pendingKey is where a presigned upload of key waits for confirmation; it
+// is private, so nothing serves it in the meantime
+func pendingKey(key string) string {
+	return path.Join(privatePrefix, "pending", key)
+}
+
+func (s *fileService) PresignDownload(ctx context.Context, key string) (*storage.PresignedRequest, error) {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if keyVisibility(key) == model.FileVisibilityPrivate || strings.HasPrefix(key, "quarantine/") {
+		return nil, ErrFileNotPublic
+	}
+	return s.provider.PresignGet(ctx, key, storage.PresignOptions{Expires: s.presignExpire})
+}
+
+func (s *fileService) AuthorizeDownload(ctx context.Context, shopID, id uint, by Downloader) (*model.File, error) {
+	if by.UserID == 0 && by.CustomerID == 0 {
+		return nil, ErrDownloadForbidden
+	}
+	file, err := s.files.FindByID(ctx, shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	// Other buyers' files are reported as missing rather than forbidden
+	if by.UserID == 0 && file.CustomerID != by.CustomerID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if file.Status == model.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
+	return file, nil
+}
+
+func (s *fileService) ReadFile(ctx context.Context, file *model.File, offset, length int64) (io.ReadCloser, error) {
+	return s.provider.GetObjectRange(ctx, file.Key, offset, length)
+}
+
+func (s *fileService) PutSigned(ctx context.Context, key string, query url.Values, contentType string, body io.Reader, size int64) (string, error) {
+	server, ok := s.provider.(storage.SignedURLServer)
+	if !ok {
+		return "", ErrSignedURLUnsupported
+	}
+	opts, err := server.VerifySignedURL(http.MethodPut, key, query)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.ContentType != "" && opts.ContentType != contentType {
+		return "", fmt.Errorf("%w: content type", ErrUploadMismatch)
+	}
+	// Chunked requests report -1 and are only accepted for unconstrained URLs
+	if opts.ContentLength > 0 && size != opts.ContentLength {
+		return "", fmt.Errorf("%w: content length", ErrUploadMismatch)
+	}
+	if size > s.maxUploadSize {
+		return "", ErrUploadTooLarge
+	}
+
+	limit := s.maxUploadSize
+	if size > 0 {
+		limit = size
+	}
+	return s.provider.PutObject(ctx, key, io.LimitReader(body, limit), size)
+}
+
+func (s *fileService) OpenSigned(ctx context.Context, key string, query url.Values) (*os.File, error) {
+	server, ok := s.provider.(storage.SignedURLServer)
+	if !ok {
+		return nil, ErrSignedURLUnsupported
+	}
+	if _, err := server.VerifySignedURL(http.MethodGet, key, query); err != nil {
+		return nil, err
+	}
+	return server.Open(key)
 }
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+	"shop/internal/infra/storage/local"
+	"shop/internal/model"
+
+	"go.uber.org/zap"
+)
+
+func TestValidateParts(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Local.Path = t.TempDir()
+	provider := local.NewLocalStorage(cfg, zap.NewNop())
+	s := &fileService{provider: provider}
+	ctx := context.Background()
+
+	session := &model.UploadSession{Key: "products/a.bin"}
+	uploadID, err := provider.InitiateMultipartUpload(ctx, session.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.UploadID = uploadID
+
+	var etags []string
+	for i, data := range []string{"first part", "second"} {
+		etag, err := provider.UploadPart(ctx, session.Key, uploadID, i+1, strings.NewReader(data), int64(len(data)), storage.PartChecksum{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		etags = append(etags, etag)
+	}
+
+	stored, err := s.validateParts(ctx, session, []storage.Part{
+		{PartNumber: 1, ETag: `"` + strings.ToUpper(etags[0]) + `"`}, // as S3 clients echo it
+		{PartNumber: 2, ETag: etags[1]},
+	})
+	if err != nil {
+		t.Fatalf("valid part list: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Size != 10 || stored[1].ETag != etags[1] {
+		t.Errorf("stored parts = %+v", stored)
+	}
+
+	tests := []struct {
+		name     string
+		parts    []storage.Part
+		expected int64
+		err      error
+	}{
+		{"no parts", nil, 0, ErrInvalidPartList},
+		{"out of order", []storage.Part{{PartNumber: 2, ETag: etags[1]}, {PartNumber: 1, ETag: etags[0]}}, 0, ErrInvalidPartList},
+		{"gap", []storage.Part{{PartNumber: 1, ETag: etags[0]}, {PartNumber: 3, ETag: etags[1]}}, 0, ErrInvalidPartList},
+		{"missing etag", []storage.Part{{PartNumber: 1}}, 0, ErrInvalidPartList},
+		{"etag mismatch", []storage.Part{{PartNumber: 1, ETag: etags[1]}}, 0, ErrInvalidPartList},
+		{"not uploaded", []storage.Part{{PartNumber: 1, ETag: etags[0]}, {PartNumber: 2, ETag: etags[1]}, {PartNumber: 3, ETag: etags[1]}}, 0, ErrInvalidPartList},
+		{"size differs", []storage.Part{{PartNumber: 1, ETag: etags[0]}}, 16, ErrUploadMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := *session
+			session.ExpectedSize = tt.expected
+			if _, err := s.validateParts(ctx, &session, tt.parts); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMultipartChecksum(t *testing.T) {
+	a, b := md5.Sum([]byte("a")), md5.Sum([]byte("b"))
+	parts := []storage.Part{{ETag: hex.EncodeToString(a[:])}, {ETag: hex.EncodeToString(b[:])}}
+	whole := md5.Sum(append(a[:], b[:]...))
+	if got, want := multipartChecksum(parts), hex.EncodeToString(whole[:])+"-2"; got != want {
+		t.Errorf("multipartChecksum = %s, want %s", got, want)
+	}
+	if got := multipartChecksum([]storage.Part{{ETag: "part-1"}}); got != "" {
+		t.Errorf("checksum of a non-MD5 ETag = %q, want none", got)
+	}
+}
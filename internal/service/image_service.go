@@ -0,0 +1,372 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"path"
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/utils"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	// WebP uploads are decoded; renditions are encoded as JPEG or PNG since
+	// no lossy WebP encoder is available in pure Go
+	_ "golang.org/x/image/webp"
+)
+
+// derivativePrefix holds every generated variant, keyed by the original's key
+const derivativePrefix = "derivatives"
+
+var (
+	ErrInvalidImageOptions = errors.New("invalid image options")
+	ErrImageTooLarge       = errors.New("image exceeds the maximum pixel count")
+	ErrNotAnImage          = errors.New("file is not a supported image")
+)
+
+// ImageOptions selects an on-demand rendition; zero width or height keeps
+// the aspect ratio, an empty format keeps the source format
+type ImageOptions struct {
+	Width  int
+	Height int
+	Format string
+}
+
+// RenderedImage is an encoded derivative
+type RenderedImage struct {
+	Data        []byte
+	ContentType string
+}
+
+type ImageService interface {
+	// GenerateDerivatives renders the configured variants of an uploaded
+	// image; invoked asynchronously from TopicImageUploaded
+	GenerateDerivatives(ctx context.Context, shopID, fileID uint) error
+	// Render returns a resized copy of the image at key, cached in storage
+	Render(ctx context.Context, key string, opts ImageOptions) (*RenderedImage, error)
+	// SignedURL builds an on-demand resize URL; Verify checks its signature
+	SignedURL(key string, opts ImageOptions) (string, error)
+	Verify(key string, opts ImageOptions, signature string) bool
+}
+
+type imageService struct {
+	provider      storage.Provider
+	files         repository.FileRepository
+	logger        *zap.Logger
+	derivatives   []config.DerivativeConfig
+	baseURL       string
+	secret        string
+	maxDimension  int
+	maxPixels     int
+	maxSourceSize int64
+	quality       int
+	renders       singleflight.Group
+}
+
+func NewImageService(provider storage.Provider, files repository.FileRepository, cfg *config.Config, logger *zap.Logger) (ImageService, error) {
+	if cfg.Server.SecretKey == "" {
+		return nil, fmt.Errorf("server.secret_key is required to sign image URLs")
+	}
+	for _, d := range cfg.Image.Derivatives {
+		if !isOutputFormat(d.Format) {
+			return nil, fmt.Errorf("image.derivatives %s: format must be jpeg or png", d.Name)
+		}
+	}
+	maxDimension := cfg.Image.MaxDimension
+	if maxDimension <= 0 {
+		maxDimension = 2000
+	}
+	maxPixels := cfg.Image.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = 40_000_000
+	}
+	quality := cfg.Image.Quality
+	if quality <= 0 || quality > 100 {
+		quality = 82
+	}
+	maxSourceSize := cfg.Storage.MaxUploadSize
+	if maxSourceSize <= 0 {
+		maxSourceSize = 100 << 20
+	}
+	return &imageService{
+		provider:      provider,
+		files:         files,
+		logger:        logger,
+		derivatives:   cfg.Image.Derivatives,
+		baseURL:       strings.TrimSuffix(cfg.Image.URL, "/"),
+		secret:        cfg.Server.SecretKey,
+		maxDimension:  maxDimension,
+		maxPixels:     maxPixels,
+		maxSourceSize: maxSourceSize,
+		quality:       quality,
+	}, nil
+}
+
+func (s *imageService) GenerateDerivatives(ctx context.Context, shopID, fileID uint) error {
+	file, err := s.files.FindByID(ctx, shopID, fileID)
+	if err != nil {
+		return err
+	}
+	if file.Status != model.FileStatusActive || file.Visibility == model.FileVisibilityPrivate ||
+		!strings.HasPrefix(file.ContentType, "image/") || len(s.derivatives) == 0 {
+		return nil
+	}
+
+	src, err := s.load(ctx, file.Key)
+	if errors.Is(err, ErrNotAnImage) || errors.Is(err, ErrImageTooLarge) {
+		// Nothing to derive (e.g. SVG); the original stays usable
+		s.logger.Info("Skipping image derivatives", zap.Uint("file_id", fileID), zap.Error(err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	derivatives := make([]model.ImageDerivative, 0, len(s.derivatives))
+	for _, d := range s.derivatives {
+		format := normalizeFormat(d.Format, src.format)
+		var img image.Image
+		if d.Crop && d.Width > 0 && d.Height > 0 {
+			img = fill(src.img, d.Width, d.Height)
+		} else {
+			img = fit(src.img, d.Width, d.Height)
+		}
+		data, contentType, err := s.encode(img, format)
+		if err != nil {
+			return err
+		}
+
+		key := path.Join(derivativePrefix, file.Key, d.Name+"."+format)
+		if _, err := s.provider.PutObject(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+			return err
+		}
+		bounds := img.Bounds()
+		derivatives = append(derivatives, model.ImageDerivative{
+			Name:   d.Name,
+			Key:    key,
+			URL:    s.provider.GetURL(key),
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			Format: strings.TrimPrefix(contentType, "image/"),
+			Size:   int64(len(data)),
+		})
+	}
+	return s.files.SaveDerivatives(ctx, file.ID, derivatives)
+}
+
+func (s *imageService) Render(ctx context.Context, key string, opts ImageOptions) (*RenderedImage, error) {
+	key = strings.TrimPrefix(key, "/")
+	if err := s.checkOptions(key, opts); err != nil {
+		return nil, err
+	}
+
+	// Concurrent requests for the same rendition share one decode/encode
+	cacheKey := s.cacheKey(key, opts)
+	result, err, _ := s.renders.Do(cacheKey, func() (interface{}, error) {
+		if cached, err := s.cached(ctx, cacheKey); err == nil {
+			return cached, nil
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+
+		src, err := s.load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		format := normalizeFormat(opts.Format, src.format)
+		data, contentType, err := s.encode(fit(src.img, opts.Width, opts.Height), format)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.provider.PutObject(ctx, cacheKey, bytes.NewReader(data), int64(len(data))); err != nil {
+			// Serving the rendition matters more than caching it
+			s.logger.Error("Failed to cache image derivative", zap.String("key", cacheKey), zap.Error(err))
+		}
+		return &RenderedImage{Data: data, ContentType: contentType}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*RenderedImage), nil
+}
+
+func (s *imageService) SignedURL(key string, opts ImageOptions) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if err := s.checkOptions(key, opts); err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	if opts.Width > 0 {
+		query.Set("w", strconv.Itoa(opts.Width))
+	}
+	if opts.Height > 0 {
+		query.Set("h", strconv.Itoa(opts.Height))
+	}
+	if opts.Format != "" {
+		query.Set("fmt", opts.Format)
+	}
+	query.Set("sig", utils.HMACSign(s.secret, signaturePayload(key, opts)))
+	return s.baseURL + "/" + key + "?" + query.Encode(), nil
+}
+
+func (s *imageService) Verify(key string, opts ImageOptions, signature string) bool {
+	return utils.HMACVerify(s.secret, signaturePayload(strings.TrimPrefix(key, "/"), opts), signature)
+}
+
+func (s *imageService) checkOptions(key string, opts ImageOptions) error {
+	if key == "" || reservedFolders[strings.SplitN(key, "/", 2)[0]] {
+		return fmt.Errorf("%w: key", ErrInvalidImageOptions)
+	}
+	if opts.Width < 0 || opts.Height < 0 || opts.Width > s.maxDimension || opts.Height > s.maxDimension {
+		return fmt.Errorf("%w: dimensions must be between 1 and %d", ErrInvalidImageOptions, s.maxDimension)
+	}
+	if opts.Width == 0 && opts.Height == 0 {
+		return fmt.Errorf("%w: width or height is required", ErrInvalidImageOptions)
+	}
+	if !isOutputFormat(opts.Format) {
+		return fmt.Errorf("%w: format must be jpeg or png", ErrInvalidImageOptions)
+	}
+	return nil
+}
+
+// isOutputFormat reports whether renditions can be encoded as format; empty
+// picks one from the source
+func isOutputFormat(format string) bool {
+	switch format {
+	case "", "jpeg", "png":
+		return true
+	}
+	return false
+}
+
+// cacheKey names the stored rendition; an empty format maps to the source's
+func (s *imageService) cacheKey(key string, opts ImageOptions) string {
+	format := opts.Format
+	if format == "" {
+		format = "orig"
+	}
+	return path.Join(derivativePrefix, key, fmt.Sprintf("w%d_h%d.%s", opts.Width, opts.Height, format))
+}
+
+func (s *imageService) cached(ctx context.Context, key string) (*RenderedImage, error) {
+	body, err := s.provider.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderedImage{Data: data, ContentType: detectImageType(data)}, nil
+}
+
+type sourceImage struct {
+	img    image.Image
+	format string
+}
+
+// load reads and decodes an original, refusing decompression bombs before
+// any pixels are allocated
+func (s *imageService) load(ctx context.Context, key string) (*sourceImage, error) {
+	body, err := s.provider.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, s.maxSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSourceSize {
+		return nil, ErrImageTooLarge
+	}
+
+	dims, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+	if dims.Width*dims.Height > s.maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+	return &sourceImage{img: img, format: format}, nil
+}
+
+func (s *imageService) encode(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		format = "jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.quality})
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/" + format, nil
+}
+
+// fit scales img to fit inside width x height without upscaling; a zero
+// bound keeps the aspect ratio
+func fit(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if (width == 0 || bounds.Dx() <= width) && (height == 0 || bounds.Dy() <= height) {
+		return img
+	}
+	if width == 0 || height == 0 {
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+	return imaging.Fit(img, width, height, imaging.Lanczos)
+}
+
+// fill crops img to the width:height ratio and scales it down to that size
+func fill(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() < width || bounds.Dy() < height {
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+	return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+}
+
+// normalizeFormat resolves the output format; sources other than PNG (JPEG,
+// GIF, WebP, ...) are re-encoded as JPEG
+func normalizeFormat(format, source string) string {
+	if format != "" {
+		return format
+	}
+	if source == "png" {
+		return source
+	}
+	return "jpeg"
+}
+
+func detectImageType(data []byte) string {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return "image/" + format
+}
+
+func signaturePayload(key string, opts ImageOptions) string {
+	return fmt.Sprintf("%s|%d|%d|%s", key, opts.Width, opts.Height, opts.Format)
+}
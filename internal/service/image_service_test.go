@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage/local"
+
+	"go.uber.org/zap"
+)
+
+func newTestImageService(t *testing.T) *imageService {
+	cfg := &config.Config{}
+	cfg.Server.SecretKey = "test-secret"
+	cfg.Storage.Local.Path = t.TempDir()
+	cfg.Image.URL = "http://localhost:8080/images/"
+	cfg.Image.MaxDimension = 500
+	s, err := NewImageService(local.NewLocalStorage(cfg, zap.NewNop()), nil, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*imageService)
+}
+
+func putTestImage(t *testing.T, s *imageService, key string, width, height int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x*height/width, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.provider.PutObject(context.Background(), key, &buf, int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageRender(t *testing.T) {
+	s := newTestImageService(t)
+	putTestImage(t, s, "products/photo.png", 400, 200)
+	ctx := context.Background()
+
+	tests := []struct {
+		opts          ImageOptions
+		width, height int
+		contentType   string
+	}{
+		{ImageOptions{Width: 100}, 100, 50, "image/png"},
+		{ImageOptions{Height: 100, Format: "jpeg"}, 200, 100, "image/jpeg"},
+		{ImageOptions{Width: 100, Height: 100}, 100, 50, "image/png"}, // fits inside the box
+		// Renditions are never upscaled
+		{ImageOptions{Width: 500}, 400, 200, "image/png"},
+	}
+	for _, tt := range tests {
+		for _, pass := range []string{"rendered", "cached"} {
+			img, err := s.Render(ctx, "products/photo.png", tt.opts)
+			if err != nil {
+				t.Fatalf("%+v (%s): %v", tt.opts, pass, err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height || img.ContentType != tt.contentType || "image/"+format != tt.contentType {
+				t.Errorf("%+v (%s) = %dx%d %s, want %dx%d %s", tt.opts, pass, cfg.Width, cfg.Height, img.ContentType, tt.width, tt.height, tt.contentType)
+			}
+		}
+	}
+
+	invalid := []struct {
+		key  string
+		opts ImageOptions
+	}{
+		{"products/photo.png", ImageOptions{}},
+		{"products/photo.png", ImageOptions{Width: 501}},
+		{"products/photo.png", ImageOptions{Width: -1, Height: 10}},
+		{"products/photo.png", ImageOptions{Width: 10, Format: "webp"}},
+		{"private/exports/a.png", ImageOptions{Width: 10}},
+		{"derivatives/products/photo.png", ImageOptions{Width: 10}},
+	}
+	for _, tt := range invalid {
+		if _, err := s.Render(ctx, tt.key, tt.opts); !errors.Is(err, ErrInvalidImageOptions) {
+			t.Errorf("Render(%q, %+v): got %v, want ErrInvalidImageOptions", tt.key, tt.opts, err)
+		}
+	}
+}
+
+func TestImageSignedURL(t *testing.T) {
+	s := newTestImageService(t)
+	opts := ImageOptions{Width: 100, Format: "jpeg"}
+
+	signed, err := s.SignedURL("products/photo.png", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil || !strings.HasPrefix(signed, "http://localhost:8080/images/products/photo.png?") {
+		t.Fatalf("signed URL = %s", signed)
+	}
+	sig := u.Query().Get("sig")
+	if !s.Verify("/products/photo.png", opts, sig) {
+		t.Error("signature of a signed URL rejected")
+	}
+	if s.Verify("products/photo.png", ImageOptions{Width: 2000, Format: "jpeg"}, sig) {
+		t.Error("signature accepted for other dimensions")
+	}
+	if s.Verify("products/other.png", opts, sig) {
+		t.Error("signature accepted for another key")
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/idgen"
+	"shop/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmptyCart          = errors.New("order has no items")
+	ErrVariantUnavailable = errors.New("variant is not available")
+)
+
+type CheckoutItem struct {
+	VariantID  uint
+	Quantity   int
+	Properties json.RawMessage
+}
+
+// CheckoutInput carries a storefront order. Prices are always taken from the
+// catalog, never from the client.
+type CheckoutInput struct {
+	ShopID          uint
+	CustomerID      uint // 0 for guest checkout
+	Email           string
+	Phone           string
+	Currency        string
+	Items           []CheckoutItem
+	ShippingAddress json.RawMessage
+	BillingAddress  json.RawMessage
+	Note            string
+	ClientIP        string
+	UserAgent       string
+	LandingSite     string
+}
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, in CheckoutInput) (*model.Order, error)
+	GetOrder(ctx context.Context, shopID, id uint) (*model.Order, error)
+	MarkPaid(ctx context.Context, shopID, id uint) (*model.Order, error)
+}
+
+type orderService struct {
+	repo         repository.OrderRepository
+	productRepo  repository.ProductRepository
+	customerRepo repository.CustomerRepository
+	queue        queue.Queue
+	idGen        idgen.IDGenerator
+	logger       *zap.Logger
+}
+
+func NewOrderService(
+	repo repository.OrderRepository,
+	productRepo repository.ProductRepository,
+	customerRepo repository.CustomerRepository,
+	q queue.Queue,
+	idGen idgen.IDGenerator,
+	logger *zap.Logger,
+) OrderService {
+	return &orderService{
+		repo:         repo,
+		productRepo:  productRepo,
+		customerRepo: customerRepo,
+		queue:        q,
+		idGen:        idGen,
+		logger:       logger,
+	}
+}
+
+// CreateOrder prices the items from the catalog, stores the order and
+// publishes TopicOrderCreated for asynchronous processing (risk scoring)
+func (s *orderService) CreateOrder(ctx context.Context, in CheckoutInput) (*model.Order, error) {
+	if len(in.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	order := &model.Order{
+		ShopID:          in.ShopID,
+		OrderNumber:     s.idGen.GenerateStringID(),
+		CustomerEmail:   normalizeEmail(in.Email),
+		CustomerPhone:   in.Phone,
+		Currency:        in.Currency,
+		FinancialStatus: model.FinancialStatusPending,
+		ShippingAddress: in.ShippingAddress,
+		BillingAddress:  in.BillingAddress,
+		Note:            in.Note,
+		ClientIP:        in.ClientIP,
+		UserAgent:       in.UserAgent,
+		LandingSite:     in.LandingSite,
+	}
+	if in.CustomerID != 0 {
+		customer, err := s.customerRepo.FindByID(ctx, in.ShopID, in.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+		order.CustomerID = &customer.ID
+		order.CustomerEmail = customer.Email
+	}
+
+	ids := make([]uint, 0, len(in.Items))
+	for _, item := range in.Items {
+		ids = append(ids, item.VariantID)
+	}
+	variants, err := s.productRepo.FindVariants(ctx, in.ShopID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]model.ProductVariant, len(variants))
+	for _, v := range variants {
+		byID[v.ID] = v
+	}
+
+	var subtotal float64
+	for _, item := range in.Items {
+		v, ok := byID[item.VariantID]
+		if !ok || v.Product == nil || v.Product.Status != model.ProductStatusActive || item.Quantity < 1 {
+			return nil, fmt.Errorf("%w: %d", ErrVariantUnavailable, item.VariantID)
+		}
+		snapshot, err := json.Marshal(map[string]interface{}{
+			"options":          v.OptionValues,
+			"compare_at_price": v.CompareAtPrice,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		productID, variantID := v.ProductID, v.ID
+		order.Items = append(order.Items, model.OrderItem{
+			ShopID:              in.ShopID,
+			ProductID:           &productID,
+			VariantID:           &variantID,
+			Name:                v.Product.Title,
+			SKU:                 v.SKU,
+			Quantity:            item.Quantity,
+			FulfillableQuantity: item.Quantity,
+			Price:               v.Price,
+			VariantSnapshot:     snapshot,
+			Properties:          item.Properties,
+		})
+		subtotal += v.Price * float64(item.Quantity)
+	}
+	order.SubtotalPrice = roundMoney(subtotal)
+	order.TotalPrice = order.SubtotalPrice
+
+	if err := s.repo.Create(ctx, order); err != nil {
+		return nil, err
+	}
+
+	publishEvent(ctx, s.queue, s.logger, TopicOrderCreated, OrderEvent{ShopID: order.ShopID, OrderID: order.ID})
+	return order, nil
+}
+
+func (s *orderService) GetOrder(ctx context.Context, shopID, id uint) (*model.Order, error) {
+	return s.repo.FindByID(ctx, shopID, id)
+}
+
+// MarkPaid records a successful payment and credits the customer's total_spent
+func (s *orderService) MarkPaid(ctx context.Context, shopID, id uint) (*model.Order, error) {
+	return s.repo.MarkPaid(ctx, shopID, id, time.Now())
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
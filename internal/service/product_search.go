@@ -0,0 +1,50 @@
+package service
+
+import "shop/pkg/search"
+
+// ProductDocument is a product as stored in the search index
+type ProductDocument struct {
+	ID        uint                `json:"id"`
+	ShopID    uint                `json:"shop_id"`
+	Title     string              `json:"title"`
+	Body      string              `json:"body"` // BodyHTML without markup
+	Status    string              `json:"status"`
+	SKUs      []string            `json:"skus"`
+	Keywords  []string            `json:"keywords"` // synonyms of terms the product mentions, per shop
+	Options   map[string][]string `json:"options"`  // option name -> values across variants
+	PriceMin  float64             `json:"price_min"`
+	PriceMax  float64             `json:"price_max"`
+	InStock   bool                `json:"in_stock"`
+	CreatedAt int64               `json:"created_at"` // unix seconds, sortable on every engine
+	UpdatedAt int64               `json:"updated_at"`
+}
+
+// ProductSearchIndex declares the products index. Changes are applied at
+// startup, or need a rebuild when EnsureIndex reports ErrReindexRequired.
+var ProductSearchIndex = search.IndexDefinition{
+	Name: "products",
+	Fields: map[string]search.FieldType{
+		"id":         search.FieldLong,
+		"shop_id":    search.FieldLong,
+		"title":      search.FieldText,
+		"body":       search.FieldText,
+		"status":     search.FieldKeyword,
+		"skus":       search.FieldKeyword,
+		"keywords":   search.FieldText,
+		"price_min":  search.FieldDouble,
+		"price_max":  search.FieldDouble,
+		"in_stock":   search.FieldBoolean,
+		"created_at": search.FieldLong,
+		"updated_at": search.FieldLong,
+	},
+	// Synonyms are shop rules, so they are indexed per product as keywords
+	// rather than set on the index, which every shop shares
+	Searchable: []string{"title", "skus", "keywords", "body"},
+	Filterable: []string{"id", "shop_id", "status", "options", "price_min", "price_max", "in_stock"},
+	Sortable:   []string{"price_min", "created_at", "updated_at"},
+}
+
+// SearchIndexes lists every index the application maintains
+func SearchIndexes() []search.IndexDefinition {
+	return []search.IndexDefinition{ProductSearchIndex}
+}
@@ -0,0 +1,711 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/idgen"
+	"shop/pkg/queue"
+	"shop/pkg/search"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// searchBatchWindow is how long product changes are collected before
+	// they are written to the search engine together
+	searchBatchWindow = 500 * time.Millisecond
+	// searchBatchSize flushes a batch early once it holds this many products
+	searchBatchSize = 100
+	// searchSyncTimeout bounds one batch write
+	searchSyncTimeout = 30 * time.Second
+	// rebuildPageSize is how many products a rebuild loads and writes at once
+	rebuildPageSize = 500
+	// searchLogTimeout bounds writing a search log without a queue
+	searchLogTimeout = 5 * time.Second
+)
+
+// rebuildLease is how long other processes keep writing to the target of a
+// rebuild that stopped renewing its mark; a running rebuild renews it every
+// rebuildHeartbeat.
+const (
+	rebuildLease     = 2 * time.Minute
+	rebuildHeartbeat = rebuildLease / 4
+)
+
+var (
+	ErrSearchShopMissing  = errors.New("search requires a shop")
+	ErrInvalidSearchClick = errors.New("a click needs a search_id and a product_id")
+)
+
+var searchTextPolicy = bluemonday.StrictPolicy()
+
+// ProductSearchService keeps the products index in line with the catalog and
+// searches it. Every search is scoped to one shop.
+type ProductSearchService interface {
+	// Notify publishes TopicProductChanged for a committed product or variant
+	// write; it is hooked into the database by repository.WatchProductChanges
+	Notify(ctx context.Context, shopID, productID uint)
+	// Enqueue adds a changed product to the current batch without waiting,
+	// for changes made without a queue. Failed batches are logged, a rebuild
+	// repairs them.
+	Enqueue(ctx context.Context, event ProductEvent)
+	// Index adds a changed product to the current batch and returns once the
+	// batch is written, with its error; invoked from TopicProductChanged, so
+	// a failed batch is delivered again
+	Index(ctx context.Context, event ProductEvent) error
+	// Flush writes the pending batch, on shutdown
+	Flush(ctx context.Context) error
+	// Sync indexes the products of a shop as they are now: active ones are
+	// written, deleted or inactive ones removed
+	Sync(ctx context.Context, shopID uint, productIDs []uint) error
+	// Rebuild streams every active product, shop by shop, into a fresh index
+	// that then replaces the live one; it returns the number indexed
+	Rebuild(ctx context.Context) (int, error)
+	// SyncShop reindexes every active product of a shop, after its synonyms
+	// changed; it returns the number indexed
+	SyncShop(ctx context.Context, shopID uint) (int, error)
+	// Search finds active products of the shop; filters in opts are combined
+	// with the shop filter and cannot widen it. In relevance order, products
+	// pinned for the query come first. First pages of text queries are
+	// logged on TopicSearchLogged. Pages continue from opts.Offset, or from
+	// opts.Cursor set to the NextCursor of the previous page.
+	Search(ctx context.Context, shopID uint, query string, opts *search.SearchOptions) (*ProductSearchResult, error)
+	// Click logs the product a shopper opened from the results of a search
+	Click(ctx context.Context, shopID uint, searchID string, productID uint) error
+	// Record writes a search or click from TopicSearchLogged; searches that
+	// found products are counted for suggestions
+	Record(ctx context.Context, event SearchLogEvent) error
+	// Suggest completes a partly typed query with the shop's popular queries,
+	// then with titles of its active products
+	Suggest(ctx context.Context, shopID uint, prefix string, limit int) ([]SearchSuggestion, error)
+}
+
+// ProductSearchResult is a page of products. SearchID identifies the logged
+// search for click tracking; it is set on first pages of text queries.
+type ProductSearchResult struct {
+	Products   []ProductHit                   `json:"products"`
+	Total      int64                          `json:"total"`
+	Facets     map[string][]search.FacetValue `json:"facets,omitempty"`
+	NextCursor string                         `json:"next_cursor,omitempty"`
+	SearchID   string                         `json:"search_id,omitempty"`
+}
+
+// ProductHit is a found product with its relevance score and the snippets
+// of the highlighted fields that matched
+type ProductHit struct {
+	ProductDocument
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+type productSearchService struct {
+	engine   search.Engine
+	products repository.ProductRepository
+	queries  repository.SearchQueryRepository
+	logs     repository.SearchLogRepository
+	settings repository.SearchSettingsRepository
+	rebuilds repository.SearchRebuildRepository
+	cache    *redis.Client // nil disables suggestion caching
+	queue    queue.Queue
+	ids      idgen.IDGenerator
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	pending *searchBatch
+	timer   *time.Timer
+	writing bool // a drain is writing batches
+}
+
+// searchBatch collects changed products until they are written together
+type searchBatch struct {
+	products map[uint]map[uint]bool // shop ID -> product IDs
+	size     int
+	done     chan struct{} // closed once written
+	err      error
+}
+
+func NewProductSearchService(
+	engine search.Engine,
+	products repository.ProductRepository,
+	queries repository.SearchQueryRepository,
+	logs repository.SearchLogRepository,
+	settings repository.SearchSettingsRepository,
+	rebuilds repository.SearchRebuildRepository,
+	cache *redis.Client,
+	q queue.Queue,
+	ids idgen.IDGenerator,
+	logger *zap.Logger,
+) ProductSearchService {
+	return &productSearchService{
+		engine:   engine,
+		products: products,
+		queries:  queries,
+		logs:     logs,
+		settings: settings,
+		rebuilds: rebuilds,
+		cache:    cache,
+		queue:    q,
+		ids:      ids,
+		logger:   logger,
+	}
+}
+
+func (s *productSearchService) Notify(ctx context.Context, shopID, productID uint) {
+	event := ProductEvent{ShopID: shopID, ProductID: productID}
+	if s.queue == nil {
+		// Without a queue the batch is filled in process
+		s.Enqueue(ctx, event)
+		return
+	}
+	publishEvent(ctx, s.queue, s.logger, TopicProductChanged, event)
+}
+
+func (s *productSearchService) Enqueue(ctx context.Context, event ProductEvent) {
+	if event.ShopID == 0 || event.ProductID == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batch := s.addLocked(event); batch.size >= searchBatchSize {
+		s.takeLocked()
+		go s.writeLogged(batch)
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(searchBatchWindow, func() {
+			s.mu.Lock()
+			batch := s.takeLocked()
+			s.mu.Unlock()
+			s.writeLogged(batch)
+		})
+	}
+}
+
+// Index writes batches as soon as no other write is in flight: changes
+// delivered while a batch is written join the next one, so concurrent
+// deliveries share bulk writes and a single one is not held up by a window.
+func (s *productSearchService) Index(ctx context.Context, event ProductEvent) error {
+	if event.ShopID == 0 || event.ProductID == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	batch := s.addLocked(event)
+	if !s.writing {
+		s.writing = true
+		go s.drain()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-batch.done:
+		return batch.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *productSearchService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.takeLocked()
+	s.mu.Unlock()
+	return s.write(ctx, batch)
+}
+
+// addLocked adds a changed product to the pending batch and returns the
+// batch; s.mu must be held
+func (s *productSearchService) addLocked(event ProductEvent) *searchBatch {
+	if s.pending == nil {
+		s.pending = &searchBatch{products: map[uint]map[uint]bool{}, done: make(chan struct{})}
+	}
+	batch := s.pending
+	if batch.products[event.ShopID] == nil {
+		batch.products[event.ShopID] = map[uint]bool{}
+	}
+	if !batch.products[event.ShopID][event.ProductID] {
+		batch.products[event.ShopID][event.ProductID] = true
+		batch.size++
+	}
+	return batch
+}
+
+// takeLocked detaches the pending batch, nil when there is none; s.mu must
+// be held
+func (s *productSearchService) takeLocked() *searchBatch {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	batch := s.pending
+	s.pending = nil
+	return batch
+}
+
+// drain writes the pending batches one after another until none is left
+func (s *productSearchService) drain() {
+	for {
+		s.mu.Lock()
+		batch := s.takeLocked()
+		if batch == nil {
+			s.writing = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), searchSyncTimeout)
+		s.write(ctx, batch)
+		cancel()
+	}
+}
+
+// write syncs a batch and reports the result to the changes waiting on it
+func (s *productSearchService) write(ctx context.Context, batch *searchBatch) error {
+	if batch == nil {
+		return nil
+	}
+	batch.err = s.sync(ctx, batch.products)
+	close(batch.done)
+	return batch.err
+}
+
+func (s *productSearchService) writeLogged(batch *searchBatch) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchSyncTimeout)
+	defer cancel()
+	if err := s.write(ctx, batch); err != nil {
+		s.logger.Error("Failed to sync products to search", zap.Error(err))
+	}
+}
+
+func (s *productSearchService) sync(ctx context.Context, batch map[uint]map[uint]bool) error {
+	var errs []error
+	for shopID, products := range batch {
+		ids := make([]uint, 0, len(products))
+		for id := range products {
+			ids = append(ids, id)
+		}
+		if err := s.Sync(ctx, shopID, ids); err != nil {
+			errs = append(errs, fmt.Errorf("shop %d: %w", shopID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *productSearchService) Sync(ctx context.Context, shopID uint, productIDs []uint) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	products, err := s.products.FindProducts(ctx, shopID, productIDs)
+	if err != nil {
+		return err
+	}
+	rules, err := findSearchRules(ctx, s.settings, shopID)
+	if err != nil {
+		return err
+	}
+	found := make(map[uint]bool, len(products))
+	docs := make([]search.Document, 0, len(products))
+	for i := range products {
+		p := &products[i]
+		if p.Status != model.ProductStatusActive {
+			continue
+		}
+		found[p.ID] = true
+		docs = append(docs, productSearchDocument(p, rules))
+	}
+	var gone []string
+	for _, id := range productIDs {
+		if !found[id] {
+			gone = append(gone, productDocID(id))
+		}
+	}
+
+	indexes, err := s.writeIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, index := range indexes {
+		if len(docs) > 0 {
+			errs = append(errs, s.engine.IndexBatch(ctx, index, docs, nil))
+		}
+		if len(gone) > 0 {
+			errs = append(errs, s.engine.DeleteBatch(ctx, index, gone, nil))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeIndexes returns the products index and, while a rebuild in any
+// process fills a new one, the rebuild's target
+func (s *productSearchService) writeIndexes(ctx context.Context) ([]string, error) {
+	target, err := s.rebuilds.Target(ctx, ProductSearchIndex.Name, time.Now())
+	if err != nil || target == "" {
+		return []string{ProductSearchIndex.Name}, err
+	}
+	return []string{ProductSearchIndex.Name, target}, nil
+}
+
+func (s *productSearchService) Rebuild(ctx context.Context) (int, error) {
+	// The in-memory engine is private to this process, which already writes
+	// to its target; other engines are shared, so the rebuild is marked for
+	// the processes writing to them
+	_, private := s.engine.(*search.MemoryEngine)
+	beatCtx, stopBeat := context.WithCancel(ctx)
+	defer stopBeat()
+	beating := make(chan struct{})
+	var marked string
+
+	indexed := 0
+	err := s.engine.Reindex(ctx, ProductSearchIndex, func(ctx context.Context, target string) error {
+		if !private {
+			if err := s.rebuilds.Start(ctx, ProductSearchIndex.Name, target, time.Now().Add(rebuildLease)); err != nil {
+				return err
+			}
+			marked = target
+			go func() {
+				defer close(beating)
+				s.heartbeat(beatCtx, target)
+			}()
+		}
+		shops, err := s.products.ActiveShopIDs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, shopID := range shops {
+			count, err := s.indexShop(ctx, target, shopID)
+			if err != nil {
+				return err
+			}
+			indexed += count
+			s.logger.Info("Indexed shop products", zap.Uint("shop_id", shopID), zap.Int("products", count))
+		}
+		return nil
+	})
+	if marked == "" {
+		return indexed, err
+	}
+	// The mark outlives the swap, so no write misses the new index
+	stopBeat()
+	<-beating
+	// The caller's context may be what stopped the rebuild
+	if finishErr := s.rebuilds.Finish(context.Background(), ProductSearchIndex.Name, marked); finishErr != nil {
+		err = errors.Join(err, finishErr)
+	}
+	return indexed, err
+}
+
+// heartbeat renews the rebuild mark of target until ctx ends
+func (s *productSearchService) heartbeat(ctx context.Context, target string) {
+	ticker := time.NewTicker(rebuildHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.rebuilds.Renew(ctx, ProductSearchIndex.Name, target, time.Now().Add(rebuildLease)); err != nil && ctx.Err() == nil {
+				s.logger.Warn("Failed to renew search rebuild mark", zap.String("target", target), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *productSearchService) SyncShop(ctx context.Context, shopID uint) (int, error) {
+	indexes, err := s.writeIndexes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, index := range indexes {
+		if count, err = s.indexShop(ctx, index, shopID); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// indexShop writes every active product of a shop to index, page by page
+func (s *productSearchService) indexShop(ctx context.Context, index string, shopID uint) (int, error) {
+	rules, err := findSearchRules(ctx, s.settings, shopID)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	var after uint
+	for {
+		products, err := s.products.ListActive(ctx, shopID, after, rebuildPageSize)
+		if err != nil {
+			return count, err
+		}
+		docs := make([]search.Document, len(products))
+		for i := range products {
+			docs[i] = productSearchDocument(&products[i], rules)
+		}
+		if err := s.engine.IndexBatch(ctx, index, docs, nil); err != nil {
+			return count, err
+		}
+		count += len(products)
+		if len(products) < rebuildPageSize {
+			return count, nil
+		}
+		after = products[len(products)-1].ID
+	}
+}
+
+func (s *productSearchService) Search(ctx context.Context, shopID uint, query string, opts *search.SearchOptions) (*ProductSearchResult, error) {
+	if shopID == 0 {
+		return nil, ErrSearchShopMissing
+	}
+	var scoped search.SearchOptions
+	if opts != nil {
+		scoped = *opts
+	}
+	scoped.Filter = search.And(shopProducts(shopID), scoped.Filter)
+
+	normalized := normalizeSearchQuery(query)
+	var pinned []uint
+	if normalized != "" && len(scoped.Sort) == 0 {
+		rules, err := findSearchRules(ctx, s.settings, shopID)
+		if err != nil {
+			return nil, err
+		}
+		pinned = rules.Pinned(normalized)
+	}
+	var result *search.SearchResult
+	var err error
+	if len(pinned) > 0 {
+		result, err = s.searchPinned(ctx, query, scoped, pinned)
+	} else {
+		result, err = s.engine.Search(ctx, ProductSearchIndex.Name, query, &scoped)
+	}
+	if err != nil {
+		return nil, err
+	}
+	typed, err := search.DecodeResult[ProductDocument](result)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ProductSearchResult{
+		Products:   make([]ProductHit, len(typed.Hits)),
+		Total:      typed.Total,
+		Facets:     typed.Facets,
+		NextCursor: typed.NextCursor,
+	}
+	for i, hit := range typed.Hits {
+		out.Products[i] = ProductHit{ProductDocument: hit.Document, Score: hit.Score, Highlights: hit.Highlights}
+	}
+	if scoped.Offset == 0 && scoped.Cursor == "" && normalized != "" {
+		out.SearchID = s.ids.GenerateStringID()
+		s.logSearch(ctx, SearchLogEvent{
+			ShopID:   shopID,
+			SearchID: out.SearchID,
+			Query:    normalized,
+			Results:  result.Total,
+			At:       time.Now(),
+		})
+	}
+	return out, nil
+}
+
+// searchPinned shows the pinned products that pass opts first, in pin order,
+// whether or not they match the query text, and pages the other matches
+// after them. Cursors page through the pins by offset and past them with
+// the engine's cursors.
+func (s *productSearchService) searchPinned(ctx context.Context, query string, opts search.SearchOptions, ids []uint) (*search.SearchResult, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	pinFilter := search.In("id", values...)
+
+	pinned, err := s.engine.Search(ctx, ProductSearchIndex.Name, "", &search.SearchOptions{
+		Filter: search.And(opts.Filter, pinFilter),
+		Limit:  len(ids),
+		Facets: opts.Facets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]search.Hit, len(pinned.Hits))
+	for _, hit := range pinned.Hits {
+		byID[hit.ID] = hit
+	}
+	var hits []search.Hit
+	for _, id := range ids {
+		if hit, ok := byID[productDocID(id)]; ok {
+			hits = append(hits, hit)
+		}
+	}
+
+	organic := opts
+	organic.Filter = search.And(opts.Filter, search.Not(pinFilter))
+	if opts.Cursor != "" {
+		if offset, err := search.CursorOffset(query, &opts); err == nil {
+			opts.Offset, opts.Cursor, organic.Cursor = offset, "", ""
+		}
+	}
+	var shown []search.Hit
+	if opts.Cursor == "" {
+		shown = hits[min(opts.Offset, len(hits)):min(opts.Offset+limit, len(hits))]
+		organic.Offset = max(opts.Offset-len(hits), 0)
+	}
+	room := limit - len(shown)
+	// With no room the other matches are still searched for the total and
+	// facets; the hit is dropped
+	organic.Limit = max(room, 1)
+	result, err := s.engine.Search(ctx, ProductSearchIndex.Name, query, &organic)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.Cursor != "":
+	case opts.Offset+limit < len(hits):
+		next := opts
+		next.Offset += limit
+		result.NextCursor = search.NewCursor(query, &next)
+	case room == 0:
+		result.NextCursor = ""
+		if len(result.Hits) > 0 {
+			result.NextCursor = search.NewCursor(query, &organic)
+		}
+	}
+	result.Hits = append(append([]search.Hit{}, shown...), result.Hits[:min(room, len(result.Hits))]...)
+	result.Total += int64(len(hits))
+	result.Facets = search.MergeFacets(opts.Facets, pinned.Facets, result.Facets)
+	return result, nil
+}
+
+func (s *productSearchService) Click(ctx context.Context, shopID uint, searchID string, productID uint) error {
+	if shopID == 0 {
+		return ErrSearchShopMissing
+	}
+	if searchID == "" || len(searchID) > 32 || productID == 0 {
+		return ErrInvalidSearchClick
+	}
+	s.logSearch(ctx, SearchLogEvent{ShopID: shopID, SearchID: searchID, ClickedProductID: productID, At: time.Now()})
+	return nil
+}
+
+func (s *productSearchService) Record(ctx context.Context, event SearchLogEvent) error {
+	if event.ClickedProductID != 0 {
+		return s.logs.Click(ctx, event.ShopID, event.SearchID, event.ClickedProductID, event.At)
+	}
+	created, err := s.logs.Create(ctx, &model.SearchLog{
+		ShopID:    event.ShopID,
+		SearchID:  event.SearchID,
+		Query:     event.Query,
+		Results:   event.Results,
+		CreatedAt: event.At,
+	})
+	if err != nil || !created || event.Results == 0 {
+		return err
+	}
+	return s.queries.Increment(ctx, event.ShopID, event.Query, event.At)
+}
+
+// logSearch hands a search or click to Record without holding up the request
+func (s *productSearchService) logSearch(ctx context.Context, event SearchLogEvent) {
+	if s.queue == nil {
+		// Without a queue the log is written in process
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), searchLogTimeout)
+			defer cancel()
+			if err := s.Record(ctx, event); err != nil {
+				s.logger.Warn("Failed to log search", zap.Uint("shop_id", event.ShopID), zap.Error(err))
+			}
+		}()
+		return
+	}
+	publishEvent(ctx, s.queue, s.logger, TopicSearchLogged, event)
+}
+
+// shopProducts is the filter every storefront search and suggestion is
+// scoped with
+func shopProducts(shopID uint) search.Filter {
+	return search.And(search.Eq("shop_id", shopID), search.Eq("status", model.ProductStatusActive))
+}
+
+func productDocID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// productSearchDocument is the document of p with the shop's synonyms
+func productSearchDocument(p *model.Product, rules *model.SearchRules) search.Document {
+	doc := NewProductDocument(p)
+	doc.Keywords = synonymKeywords(&doc, rules.Synonyms)
+	return search.Document{ID: productDocID(p.ID), Doc: doc}
+}
+
+// NewProductDocument flattens a product and its variants into its search
+// document
+func NewProductDocument(p *model.Product) ProductDocument {
+	doc := ProductDocument{
+		ID:        p.ID,
+		ShopID:    p.ShopID,
+		Title:     p.Title,
+		Body:      strings.Join(strings.Fields(html.UnescapeString(searchTextPolicy.Sanitize(p.BodyHTML))), " "),
+		Status:    p.Status,
+		SKUs:      []string{},
+		Keywords:  []string{},
+		Options:   map[string][]string{},
+		CreatedAt: p.CreatedAt.Unix(),
+		UpdatedAt: p.UpdatedAt.Unix(),
+	}
+	options := map[string]map[string]bool{}
+	for i, v := range p.Variants {
+		if v.SKU != "" {
+			doc.SKUs = append(doc.SKUs, v.SKU)
+		}
+		if i == 0 || v.Price < doc.PriceMin {
+			doc.PriceMin = v.Price
+		}
+		if v.Price > doc.PriceMax {
+			doc.PriceMax = v.Price
+		}
+		if v.InventoryQuantity > 0 {
+			doc.InStock = true
+		}
+
+		// {"color": "Red", "size": "XL"}; malformed values are left out
+		var values map[string]string
+		if len(v.OptionValues) == 0 || json.Unmarshal(v.OptionValues, &values) != nil {
+			continue
+		}
+		for name, value := range values {
+			if name == "" || value == "" {
+				continue
+			}
+			if options[name] == nil {
+				options[name] = map[string]bool{}
+			}
+			options[name][value] = true
+		}
+	}
+	for name, values := range options {
+		list := make([]string, 0, len(values))
+		for value := range values {
+			list = append(list, value)
+		}
+		sort.Strings(list)
+		doc.Options[name] = list
+	}
+	return doc
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"shop/internal/model"
+	"shop/pkg/search"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSuggestLimit and MaxSuggestLimit bound the suggestions returned
+	DefaultSuggestLimit = 5
+	MaxSuggestLimit     = 10
+	// suggestCacheTTL is how long suggestions for a prefix are cached; new
+	// products and popular queries show up after at most this long
+	suggestCacheTTL = time.Minute
+	// maxQueryLength is the longest query counted for suggestions, in runes
+	maxQueryLength = 100
+)
+
+// SearchSuggestion completes the search box: a popular query of the shop or
+// the title of one of its products
+type SearchSuggestion struct {
+	Type        string `json:"type"` // query or product
+	Text        string `json:"text"`
+	Highlighted string `json:"highlighted"` // HTML-escaped, matches wrapped in <em>
+	ProductID   uint   `json:"product_id,omitempty"`
+}
+
+const (
+	SuggestionQuery   = "query"
+	SuggestionProduct = "product"
+)
+
+// Suggest boosts the shop's popular queries: they come first, taking at most
+// half the slots while products also match, so shoppers are led to searches
+// that found something. An empty prefix lists the most popular queries.
+func (s *productSearchService) Suggest(ctx context.Context, shopID uint, prefix string, limit int) ([]SearchSuggestion, error) {
+	if shopID == 0 {
+		return nil, ErrSearchShopMissing
+	}
+	if limit <= 0 || limit > MaxSuggestLimit {
+		limit = DefaultSuggestLimit
+	}
+	normalized := normalizeSearchQuery(prefix)
+	key := fmt.Sprintf("search:suggest:%d:%d:%s", shopID, limit, normalized)
+	if cached, ok := s.cachedSuggestions(ctx, key); ok {
+		return cached, nil
+	}
+
+	popular, err := s.queries.Popular(ctx, shopID, normalized, limit)
+	if err != nil {
+		return nil, err
+	}
+	var products []search.Suggestion
+	if normalized != "" {
+		products, err = s.engine.Suggest(ctx, ProductSearchIndex.Name, prefix, &search.SuggestOptions{
+			Field:  "title",
+			Limit:  limit,
+			Filter: shopProducts(shopID),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	queries := len(popular)
+	if room := limit - len(products); queries > room && queries > (limit+1)/2 {
+		queries = max(room, (limit+1)/2)
+	}
+	suggestions := make([]SearchSuggestion, 0, limit)
+	seen := map[string]bool{}
+	addQueries := func(popular []model.SearchQueryStat) {
+		for _, q := range popular {
+			if len(suggestions) >= limit {
+				return
+			}
+			if seen[q.Query] {
+				continue
+			}
+			seen[q.Query] = true
+			suggestions = append(suggestions, SearchSuggestion{
+				Type:        SuggestionQuery,
+				Text:        q.Query,
+				Highlighted: highlightPrefix(q.Query, normalized),
+			})
+		}
+	}
+	addQueries(popular[:queries])
+	for _, p := range products {
+		if len(suggestions) >= limit {
+			break
+		}
+		text := normalizeSearchQuery(p.Text)
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+		id, _ := strconv.ParseUint(p.ID, 10, 64)
+		suggestions = append(suggestions, SearchSuggestion{
+			Type:        SuggestionProduct,
+			Text:        p.Text,
+			Highlighted: p.Highlighted,
+			ProductID:   uint(id),
+		})
+	}
+
+	// Products repeating a popular query leave room for more queries
+	addQueries(popular[queries:])
+
+	s.cacheSuggestions(ctx, key, suggestions)
+	return suggestions, nil
+}
+
+func (s *productSearchService) cachedSuggestions(ctx context.Context, key string) ([]SearchSuggestion, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	data, err := s.cache.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var suggestions []SearchSuggestion
+	if err := json.Unmarshal(data, &suggestions); err != nil {
+		return nil, false
+	}
+	return suggestions, true
+}
+
+// cacheSuggestions is best effort: a cache failure only costs the next
+// request a lookup
+func (s *productSearchService) cacheSuggestions(ctx context.Context, key string, suggestions []SearchSuggestion) {
+	if s.cache == nil {
+		return
+	}
+	data, err := json.Marshal(suggestions)
+	if err != nil {
+		return
+	}
+	if err := s.cache.Set(ctx, key, data, suggestCacheTTL).Err(); err != nil {
+		s.logger.Warn("Failed to cache search suggestions", zap.Error(err))
+	}
+}
+
+// normalizeSearchQuery lowercases a query and collapses its whitespace, so
+// spellings of one query are counted together
+func normalizeSearchQuery(query string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(query), " "))
+	if utf8.RuneCountInString(normalized) > maxQueryLength {
+		normalized = strings.TrimSpace(string([]rune(normalized)[:maxQueryLength]))
+	}
+	return normalized
+}
+
+// highlightPrefix marks the typed prefix of a popular query the way engine
+// suggestions are marked
+func highlightPrefix(query, prefix string) string {
+	if prefix == "" || !strings.HasPrefix(query, prefix) {
+		return html.EscapeString(query)
+	}
+	return search.HighlightPreTag + html.EscapeString(prefix) + search.HighlightPostTag + html.EscapeString(query[len(prefix):])
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+const (
+	reportDateLayout = "2006-01-02"
+	maxReportDays    = 366
+	// searchLogPurgeBatch is how many search logs one delete removes, so
+	// the purge never holds long locks
+	searchLogPurgeBatch = 5000
+)
+
+var (
+	ErrInvalidReportRange = errors.New("invalid report date range")
+	ErrUnknownReport      = errors.New("unknown report")
+)
+
+// ReportTotals summarizes a date range of daily aggregates
+type ReportTotals struct {
+	Orders             int64   `json:"orders"`
+	PaidOrders         int64   `json:"paid_orders"`
+	GrossSales         float64 `json:"gross_sales"`
+	NetSales           float64 `json:"net_sales"`
+	Discounts          float64 `json:"discounts"`
+	DiscountedOrders   int64   `json:"discounted_orders"`
+	Refunds            float64 `json:"refunds"`
+	RefundCount        int64   `json:"refund_count"`
+	AverageOrderValue  float64 `json:"average_order_value"`
+	CartsCreated       int64   `json:"carts_created"`
+	CartConversionRate float64 `json:"cart_conversion_rate"` // orders / carts created
+}
+
+type SalesReport struct {
+	Days   []model.DailySalesReport `json:"days"`
+	Totals ReportTotals             `json:"totals"`
+}
+
+type DiscountReport struct {
+	Days   []model.DailySalesReport       `json:"days"`
+	Totals ReportTotals                   `json:"totals"`
+	Codes  []repository.DiscountCodeUsage `json:"codes"`
+}
+
+// SearchQueriesReport ranks the storefront search queries of a date range
+type SearchQueriesReport struct {
+	Top         []repository.SearchQueryReport `json:"top"`
+	ZeroResults []repository.SearchQueryReport `json:"zero_results"` // demand the catalog does not meet
+}
+
+type ReportService interface {
+	// AggregateRecent refreshes today's and yesterday's aggregates of every
+	// active shop, used by cron
+	AggregateRecent(ctx context.Context) error
+	Rebuild(ctx context.Context, shopID uint, from, to time.Time) error
+
+	Sales(ctx context.Context, shopID uint, from, to time.Time) (*SalesReport, error)
+	TopProducts(ctx context.Context, shopID uint, from, to time.Time, byVariant bool, limit int) ([]repository.ProductSales, error)
+	Discounts(ctx context.Context, shopID uint, from, to time.Time) (*DiscountReport, error)
+	// SearchQueries ranks the most searched queries, and those that most
+	// often found nothing, from the search logs
+	SearchQueries(ctx context.Context, shopID uint, from, to time.Time, limit int) (*SearchQueriesReport, error)
+	// PurgeSearchLogs deletes search logs older than the longest report
+	// range, used by cron; it returns the number deleted
+	PurgeSearchLogs(ctx context.Context) (int64, error)
+
+	// Export renders a report as CSV into a private file of the shop, served
+	// by the authenticated file download endpoint
+	Export(ctx context.Context, shopID, userID uint, report string, from, to time.Time) (*model.File, error)
+}
+
+type reportService struct {
+	repo       repository.ReportRepository
+	searchLogs repository.SearchLogRepository
+	files      FileService
+	logger     *zap.Logger
+}
+
+func NewReportService(repo repository.ReportRepository, searchLogs repository.SearchLogRepository, files FileService, logger *zap.Logger) ReportService {
+	return &reportService{repo: repo, searchLogs: searchLogs, files: files, logger: logger}
+}
+
+func (s *reportService) AggregateRecent(ctx context.Context) error {
+	shopIDs, err := s.repo.ActiveShopIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	for _, shopID := range shopIDs {
+		for _, day := range []time.Time{yesterday, today} {
+			if err := s.repo.AggregateDay(ctx, shopID, day); err != nil {
+				// Keep going so one broken shop does not block the others
+				s.logger.Error("Failed to aggregate daily report",
+					zap.Uint("shop_id", shopID),
+					zap.String("date", day.Format(reportDateLayout)),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *reportService) Rebuild(ctx context.Context, shopID uint, from, to time.Time) error {
+	if err := checkReportRange(from, to); err != nil {
+		return err
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := s.repo.AggregateDay(ctx, shopID, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *reportService) Sales(ctx context.Context, shopID uint, from, to time.Time) (*SalesReport, error) {
+	if err := checkReportRange(from, to); err != nil {
+		return nil, err
+	}
+	days, err := s.repo.DailySales(ctx, shopID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &SalesReport{Days: days, Totals: sumReport(days)}, nil
+}
+
+func (s *reportService) TopProducts(ctx context.Context, shopID uint, from, to time.Time, byVariant bool, limit int) ([]repository.ProductSales, error) {
+	if err := checkReportRange(from, to); err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return s.repo.TopProducts(ctx, shopID, from, to, byVariant, limit)
+}
+
+func (s *reportService) SearchQueries(ctx context.Context, shopID uint, from, to time.Time, limit int) (*SearchQueriesReport, error) {
+	if err := checkReportRange(from, to); err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	// to is a whole day
+	end := to.AddDate(0, 0, 1)
+	top, err := s.searchLogs.QueryReport(ctx, shopID, from, end, false, limit)
+	if err != nil {
+		return nil, err
+	}
+	zero, err := s.searchLogs.QueryReport(ctx, shopID, from, end, true, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchQueriesReport{Top: top, ZeroResults: zero}, nil
+}
+
+func (s *reportService) PurgeSearchLogs(ctx context.Context) (int64, error) {
+	now := time.Now()
+	before := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -maxReportDays)
+	var purged int64
+	for {
+		n, err := s.searchLogs.DeleteBefore(ctx, before, searchLogPurgeBatch)
+		purged += n
+		if err != nil || n < searchLogPurgeBatch {
+			return purged, err
+		}
+	}
+}
+
+func (s *reportService) Discounts(ctx context.Context, shopID uint, from, to time.Time) (*DiscountReport, error) {
+	sales, err := s.Sales(ctx, shopID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.repo.DiscountCodes(ctx, shopID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscountReport{Days: sales.Days, Totals: sales.Totals, Codes: codes}, nil
+}
+
+func (s *reportService) Export(ctx context.Context, shopID, userID uint, report string, from, to time.Time) (*model.File, error) {
+	var rows [][]string
+	switch report {
+	case "sales":
+		sales, err := s.Sales(ctx, shopID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, []string{"date", "orders", "paid_orders", "gross_sales", "discounts", "refunds", "net_sales", "tax", "shipping", "carts_created"})
+		for _, d := range sales.Days {
+			rows = append(rows, []string{
+				d.Date.Format(reportDateLayout),
+				strconv.FormatInt(d.Orders, 10),
+				strconv.FormatInt(d.PaidOrders, 10),
+				formatMoney(d.GrossSales),
+				formatMoney(d.Discounts),
+				formatMoney(d.Refunds),
+				formatMoney(d.NetSales),
+				formatMoney(d.Tax),
+				formatMoney(d.Shipping),
+				strconv.FormatInt(d.CartsCreated, 10),
+			})
+		}
+	case "top-products", "top-variants":
+		products, err := s.TopProducts(ctx, shopID, from, to, report == "top-variants", 100)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, []string{"product_id", "variant_id", "name", "sku", "quantity", "sales"})
+		for _, p := range products {
+			rows = append(rows, []string{
+				formatOptionalID(p.ProductID),
+				formatOptionalID(p.VariantID),
+				p.Name,
+				p.SKU,
+				strconv.FormatInt(p.Quantity, 10),
+				formatMoney(p.Sales),
+			})
+		}
+	default:
+		return nil, ErrUnknownReport
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("%s_%s_%s.csv", report, from.Format("20060102"), to.Format("20060102"))
+	return s.files.SaveGenerated(ctx, shopID, userID, "reports", filename, &buf, int64(buf.Len()))
+}
+
+// ParseReportRange parses from/to query values (YYYY-MM-DD), defaulting to the last 30 days
+func ParseReportRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	today := time.Now()
+	to := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	from := to.AddDate(0, 0, -29)
+
+	var err error
+	if toStr != "" {
+		if to, err = time.ParseInLocation(reportDateLayout, toStr, time.Local); err != nil {
+			return from, to, ErrInvalidReportRange
+		}
+	}
+	if fromStr != "" {
+		if from, err = time.ParseInLocation(reportDateLayout, fromStr, time.Local); err != nil {
+			return from, to, ErrInvalidReportRange
+		}
+	} else if toStr != "" {
+		from = to.AddDate(0, 0, -29)
+	}
+	return from, to, checkReportRange(from, to)
+}
+
+func checkReportRange(from, to time.Time) error {
+	if to.Before(from) || to.Sub(from) > maxReportDays*24*time.Hour {
+		return ErrInvalidReportRange
+	}
+	return nil
+}
+
+func sumReport(days []model.DailySalesReport) ReportTotals {
+	var t ReportTotals
+	for _, d := range days {
+		t.Orders += d.Orders
+		t.PaidOrders += d.PaidOrders
+		t.GrossSales += d.GrossSales
+		t.NetSales += d.NetSales
+		t.Discounts += d.Discounts
+		t.DiscountedOrders += d.DiscountedOrders
+		t.Refunds += d.Refunds
+		t.RefundCount += d.RefundCount
+		t.CartsCreated += d.CartsCreated
+	}
+	t.GrossSales = roundMoney(t.GrossSales)
+	t.NetSales = roundMoney(t.NetSales)
+	t.Discounts = roundMoney(t.Discounts)
+	t.Refunds = roundMoney(t.Refunds)
+	if t.Orders > 0 {
+		t.AverageOrderValue = roundMoney(t.GrossSales / float64(t.Orders))
+	}
+	if t.CartsCreated > 0 {
+		t.CartConversionRate = float64(t.Orders) / float64(t.CartsCreated)
+	}
+	return t
+}
+
+func formatMoney(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"shop/internal/model"
+)
+
+func TestParseReportRange(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(reportDateLayout, s, time.Local)
+		return d
+	}
+	tests := []struct {
+		from, to         string
+		wantFrom, wantTo time.Time
+		err              error
+	}{
+		{"2026-01-01", "2026-01-31", day("2026-01-01"), day("2026-01-31"), nil},
+		{"", "2026-01-31", day("2026-01-02"), day("2026-01-31"), nil},
+		{"2025-01-01", "2026-01-01", day("2025-01-01"), day("2026-01-01"), nil},
+		{"2024-01-01", "2026-01-01", time.Time{}, time.Time{}, ErrInvalidReportRange},
+		{"2026-02-01", "2026-01-31", time.Time{}, time.Time{}, ErrInvalidReportRange},
+		{"01/02/2026", "", time.Time{}, time.Time{}, ErrInvalidReportRange},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseReportRange(tt.from, tt.to)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("ParseReportRange(%q, %q) error = %v, want %v", tt.from, tt.to, err, tt.err)
+			continue
+		}
+		if err == nil && (!from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo)) {
+			t.Errorf("ParseReportRange(%q, %q) = %s, %s", tt.from, tt.to, from, to)
+		}
+	}
+
+	from, to, err := ParseReportRange("", "")
+	if err != nil || !from.Equal(to.AddDate(0, 0, -29)) {
+		t.Errorf("default range = %s, %s, %v; want the last 30 days", from, to, err)
+	}
+}
+
+func TestSumReport(t *testing.T) {
+	totals := sumReport([]model.DailySalesReport{
+		{Orders: 2, PaidOrders: 2, GrossSales: 100.10, NetSales: 90.05, Discounts: 10.05, DiscountedOrders: 1, CartsCreated: 8},
+		{Orders: 1, PaidOrders: 0, GrossSales: 50.20, NetSales: 40.10, Refunds: 10.10, RefundCount: 1, CartsCreated: 2},
+	})
+	want := ReportTotals{
+		Orders: 3, PaidOrders: 2, GrossSales: 150.30, NetSales: 130.15, Discounts: 10.05, DiscountedOrders: 1,
+		Refunds: 10.10, RefundCount: 1, AverageOrderValue: 50.10, CartsCreated: 10, CartConversionRate: 0.3,
+	}
+	if totals != want {
+		t.Errorf("sumReport = %+v, want %+v", totals, want)
+	}
+	if empty := sumReport(nil); empty != (ReportTotals{}) {
+		t.Errorf("sumReport(nil) = %+v, want zero totals", empty)
+	}
+}
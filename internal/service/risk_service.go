@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidRiskRules = errors.New("invalid risk rules")
+
+type RiskService interface {
+	// Evaluate scores an order with the shop's rules, stores the result and
+	// tags or holds the order when the score reaches the thresholds
+	Evaluate(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error)
+	GetRisk(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error)
+	GetRules(ctx context.Context, shopID uint) (*model.RiskRules, error)
+	UpdateRules(ctx context.Context, shopID uint, rules model.RiskRules) error
+}
+
+type riskService struct {
+	repo      repository.RiskRepository
+	orderRepo repository.OrderRepository
+	logger    *zap.Logger
+}
+
+func NewRiskService(repo repository.RiskRepository, orderRepo repository.OrderRepository, logger *zap.Logger) RiskService {
+	return &riskService{repo: repo, orderRepo: orderRepo, logger: logger}
+}
+
+// riskRule inspects an order and returns a reason when it matches
+type riskRule func(ctx context.Context, s *riskService, rules *model.RiskRules, order *model.Order) (*model.RiskReason, error)
+
+var riskRules = []riskRule{
+	ipVelocityRule,
+	emailVelocityRule,
+	addressMismatchRule,
+	highValueFirstOrderRule,
+}
+
+func (s *riskService) Evaluate(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error) {
+	order, err := s.orderRepo.FindByID(ctx, shopID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.GetRules(ctx, shopID)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons := []model.RiskReason{}
+	score := 0
+	for _, rule := range riskRules {
+		reason, err := rule(ctx, s, rules, order)
+		if err != nil {
+			return nil, err
+		}
+		if reason != nil {
+			reasons = append(reasons, *reason)
+			score += reason.Score
+		}
+	}
+	if score > 100 {
+		score = 100
+	}
+
+	data, err := json.Marshal(reasons)
+	if err != nil {
+		return nil, err
+	}
+	risk := &model.OrderRisk{
+		ShopID:  shopID,
+		OrderID: orderID,
+		Score:   score,
+		Level:   riskLevel(score, rules),
+		Action:  model.RiskActionNone,
+		Reasons: data,
+	}
+	switch {
+	case rules.HoldThreshold > 0 && score >= rules.HoldThreshold:
+		risk.Action = model.RiskActionHeld
+	case rules.TagThreshold > 0 && score >= rules.TagThreshold:
+		risk.Action = model.RiskActionTagged
+	}
+
+	if err := s.repo.SaveAssessment(ctx, risk); err != nil {
+		return nil, err
+	}
+	if risk.Action != model.RiskActionNone {
+		s.logger.Info("Order flagged by risk engine",
+			zap.Uint("shop_id", shopID),
+			zap.Uint("order_id", orderID),
+			zap.Int("score", score),
+			zap.String("action", risk.Action),
+		)
+	}
+	return risk, nil
+}
+
+func (s *riskService) GetRisk(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error) {
+	return s.repo.FindByOrder(ctx, shopID, orderID)
+}
+
+// GetRules returns the shop's rules, or the defaults when none are configured
+func (s *riskService) GetRules(ctx context.Context, shopID uint) (*model.RiskRules, error) {
+	rules := model.DefaultRiskRules()
+	settings, err := s.repo.FindSettings(ctx, shopID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &rules, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(settings.Rules, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func (s *riskService) UpdateRules(ctx context.Context, shopID uint, rules model.RiskRules) error {
+	if err := validateRiskRules(&rules); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRiskRules, err)
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return s.repo.SaveSettings(ctx, &model.RiskSettings{ShopID: shopID, Rules: data})
+}
+
+func validateRiskRules(rules *model.RiskRules) error {
+	for name, v := range map[string]model.VelocityRule{"ip_velocity": rules.IPVelocity, "email_velocity": rules.EmailVelocity} {
+		if v.Enabled && (v.WindowMinutes < 1 || v.MaxOrders < 1) {
+			return fmt.Errorf("%s needs a positive window_minutes and max_orders", name)
+		}
+	}
+	if rules.HighValueFirstOrder.Enabled && rules.HighValueFirstOrder.Threshold <= 0 {
+		return errors.New("high_value_first_order needs a positive threshold")
+	}
+	if rules.TagThreshold < 0 || rules.TagThreshold > 100 || rules.HoldThreshold < 0 || rules.HoldThreshold > 100 {
+		return errors.New("thresholds must be between 0 and 100")
+	}
+	return nil
+}
+
+func riskLevel(score int, rules *model.RiskRules) string {
+	switch {
+	case rules.HoldThreshold > 0 && score >= rules.HoldThreshold:
+		return model.RiskLevelHigh
+	case rules.TagThreshold > 0 && score >= rules.TagThreshold:
+		return model.RiskLevelMedium
+	default:
+		return model.RiskLevelLow
+	}
+}
+
+func ipVelocityRule(ctx context.Context, s *riskService, rules *model.RiskRules, order *model.Order) (*model.RiskReason, error) {
+	r := rules.IPVelocity
+	if !r.Enabled || order.ClientIP == "" {
+		return nil, nil
+	}
+	since := order.CreatedAt.Add(-time.Duration(r.WindowMinutes) * time.Minute)
+	count, err := s.orderRepo.CountRecentByIP(ctx, order.ShopID, order.ClientIP, since, order.ID)
+	if err != nil || count < int64(r.MaxOrders) {
+		return nil, err
+	}
+	return &model.RiskReason{
+		Rule:    "ip_velocity",
+		Score:   r.Score,
+		Message: fmt.Sprintf("%d other orders from IP %s in the last %d minutes", count, order.ClientIP, r.WindowMinutes),
+	}, nil
+}
+
+func emailVelocityRule(ctx context.Context, s *riskService, rules *model.RiskRules, order *model.Order) (*model.RiskReason, error) {
+	r := rules.EmailVelocity
+	if !r.Enabled || order.CustomerEmail == "" {
+		return nil, nil
+	}
+	since := order.CreatedAt.Add(-time.Duration(r.WindowMinutes) * time.Minute)
+	count, err := s.orderRepo.CountRecentByEmail(ctx, order.ShopID, order.CustomerEmail, since, order.ID)
+	if err != nil || count < int64(r.MaxOrders) {
+		return nil, err
+	}
+	return &model.RiskReason{
+		Rule:    "email_velocity",
+		Score:   r.Score,
+		Message: fmt.Sprintf("%d other orders from %s in the last %d minutes", count, order.CustomerEmail, r.WindowMinutes),
+	}, nil
+}
+
+func addressMismatchRule(ctx context.Context, s *riskService, rules *model.RiskRules, order *model.Order) (*model.RiskReason, error) {
+	r := rules.AddressMismatch
+	if !r.Enabled || isEmptyJSON(order.ShippingAddress) || isEmptyJSON(order.BillingAddress) {
+		return nil, nil
+	}
+
+	var shipping, billing map[string]interface{}
+	if json.Unmarshal(order.ShippingAddress, &shipping) != nil || json.Unmarshal(order.BillingAddress, &billing) != nil {
+		return nil, nil
+	}
+	for _, field := range []string{"country", "zip"} {
+		a, b := addressField(shipping, field), addressField(billing, field)
+		if a != "" && b != "" && a != b {
+			return &model.RiskReason{
+				Rule:    "address_mismatch",
+				Score:   r.Score,
+				Message: fmt.Sprintf("billing %s %q differs from shipping %s %q", field, b, field, a),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func highValueFirstOrderRule(ctx context.Context, s *riskService, rules *model.RiskRules, order *model.Order) (*model.RiskReason, error) {
+	r := rules.HighValueFirstOrder
+	if !r.Enabled || order.CustomerEmail == "" || order.TotalPrice < r.Threshold {
+		return nil, nil
+	}
+	previous, err := s.orderRepo.CountByEmail(ctx, order.ShopID, order.CustomerEmail, order.ID)
+	if err != nil || previous > 0 {
+		return nil, err
+	}
+	return &model.RiskReason{
+		Rule:    "high_value_first_order",
+		Score:   r.Score,
+		Message: fmt.Sprintf("first order of %s totals %.2f %s", order.CustomerEmail, order.TotalPrice, order.Currency),
+	}, nil
+}
+
+func addressField(address map[string]interface{}, field string) string {
+	v, _ := address[field].(string)
+	return strings.ToUpper(strings.TrimSpace(v))
+}
+
+func isEmptyJSON(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
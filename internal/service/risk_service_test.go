@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// riskOrders answers the order counts the risk rules query
+type riskOrders struct {
+	repository.OrderRepository
+	order        *model.Order
+	recentByIP   int64
+	recentByMail int64
+	byMail       int64
+	queried      []string
+}
+
+func (r *riskOrders) FindByID(ctx context.Context, shopID, id uint) (*model.Order, error) {
+	if r.order.ShopID != shopID || r.order.ID != id {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.order, nil
+}
+
+func (r *riskOrders) CountRecentByIP(ctx context.Context, shopID uint, ip string, since time.Time, excludeID uint) (int64, error) {
+	r.queried = append(r.queried, "ip")
+	return r.recentByIP, nil
+}
+
+func (r *riskOrders) CountRecentByEmail(ctx context.Context, shopID uint, email string, since time.Time, excludeID uint) (int64, error) {
+	r.queried = append(r.queried, "email")
+	return r.recentByMail, nil
+}
+
+func (r *riskOrders) CountByEmail(ctx context.Context, shopID uint, email string, excludeID uint) (int64, error) {
+	r.queried = append(r.queried, "first order")
+	return r.byMail, nil
+}
+
+// riskStore keeps the rules and the last assessment in memory
+type riskStore struct {
+	settings *model.RiskSettings
+	saved    *model.OrderRisk
+}
+
+func (r *riskStore) SaveAssessment(ctx context.Context, risk *model.OrderRisk) error {
+	r.saved = risk
+	return nil
+}
+
+func (r *riskStore) FindByOrder(ctx context.Context, shopID, orderID uint) (*model.OrderRisk, error) {
+	if r.saved == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.saved, nil
+}
+
+func (r *riskStore) FindSettings(ctx context.Context, shopID uint) (*model.RiskSettings, error) {
+	if r.settings == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.settings, nil
+}
+
+func (r *riskStore) SaveSettings(ctx context.Context, settings *model.RiskSettings) error {
+	r.settings = settings
+	return nil
+}
+
+func riskOrder() *model.Order {
+	return &model.Order{
+		ID:              9,
+		ShopID:          1,
+		CustomerEmail:   "buyer@example.com",
+		ClientIP:        "203.0.113.7",
+		TotalPrice:      50,
+		Currency:        "USD",
+		ShippingAddress: json.RawMessage(`{"country": "US", "zip": "10001"}`),
+		BillingAddress:  json.RawMessage(`{"country": "us", "zip": " 10001 "}`),
+		CreatedAt:       time.Now(),
+	}
+}
+
+func TestRiskEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		orders riskOrders
+		edit   func(o *model.Order)
+		rules  []string
+		score  int
+		action string
+	}{
+		{"clean order", riskOrders{byMail: 2}, nil, nil, 0, model.RiskActionNone},
+		{"ip velocity", riskOrders{recentByIP: 3, byMail: 2}, nil, []string{"ip_velocity"}, 40, model.RiskActionNone},
+		{"ip and email velocity", riskOrders{recentByIP: 5, recentByMail: 3, byMail: 2}, nil,
+			[]string{"ip_velocity", "email_velocity"}, 70, model.RiskActionTagged},
+		{"address mismatch", riskOrders{byMail: 2}, func(o *model.Order) { o.BillingAddress = json.RawMessage(`{"country": "CA"}`) },
+			[]string{"address_mismatch"}, 25, model.RiskActionNone},
+		{"high value first order", riskOrders{}, func(o *model.Order) { o.TotalPrice = 1500 },
+			[]string{"high_value_first_order"}, 35, model.RiskActionNone},
+		{"everything", riskOrders{recentByIP: 9, recentByMail: 9}, func(o *model.Order) {
+			o.TotalPrice = 1500
+			o.BillingAddress = json.RawMessage(`{"zip": "94105"}`)
+		}, []string{"ip_velocity", "email_velocity", "address_mismatch", "high_value_first_order"}, 100, model.RiskActionHeld},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := tt.orders
+			orders.order = riskOrder()
+			if tt.edit != nil {
+				tt.edit(orders.order)
+			}
+			store := &riskStore{}
+			s := NewRiskService(store, &orders, zap.NewNop())
+
+			risk, err := s.Evaluate(context.Background(), 1, 9)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reasons []model.RiskReason
+			if err := json.Unmarshal(risk.Reasons, &reasons); err != nil {
+				t.Fatal(err)
+			}
+			var rules []string
+			for _, r := range reasons {
+				rules = append(rules, r.Rule)
+			}
+			if len(rules) != len(tt.rules) {
+				t.Fatalf("rules = %v, want %v", rules, tt.rules)
+			}
+			for i := range rules {
+				if rules[i] != tt.rules[i] {
+					t.Fatalf("rules = %v, want %v", rules, tt.rules)
+				}
+			}
+			if risk.Score != tt.score || risk.Action != tt.action || store.saved != risk {
+				t.Errorf("score %d, action %s, saved %v; want %d, %s", risk.Score, risk.Action, store.saved != nil, tt.score, tt.action)
+			}
+		})
+	}
+}
+
+func TestRiskRulesWithoutEmail(t *testing.T) {
+	// Guests checking out without an email share the empty address, which
+	// must not count as velocity or make every order a first order
+	orders := &riskOrders{recentByMail: 50, order: riskOrder()}
+	orders.order.CustomerEmail = ""
+	orders.order.TotalPrice = 5000
+	s := NewRiskService(&riskStore{}, orders, zap.NewNop())
+
+	risk, err := s.Evaluate(context.Background(), 1, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if risk.Score != 0 {
+		t.Errorf("score = %d, want 0: %s", risk.Score, risk.Reasons)
+	}
+	for _, q := range orders.queried {
+		if q != "ip" {
+			t.Errorf("queried orders by %s without an email", q)
+		}
+	}
+}
+
+func TestRiskRulesSettings(t *testing.T) {
+	store := &riskStore{}
+	s := NewRiskService(store, &riskOrders{}, zap.NewNop())
+	ctx := context.Background()
+
+	rules, err := s.GetRules(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *rules != model.DefaultRiskRules() {
+		t.Errorf("rules without settings = %+v, want the defaults", rules)
+	}
+
+	rules.IPVelocity.Enabled = false
+	rules.HoldThreshold = 90
+	if err := s.UpdateRules(ctx, 1, *rules); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := s.GetRules(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *saved != *rules {
+		t.Errorf("saved rules = %+v, want %+v", saved, rules)
+	}
+
+	invalid := []func(r *model.RiskRules){
+		func(r *model.RiskRules) { r.EmailVelocity.WindowMinutes = 0 },
+		func(r *model.RiskRules) { r.HighValueFirstOrder.Threshold = 0 },
+		func(r *model.RiskRules) { r.TagThreshold = 101 },
+		func(r *model.RiskRules) { r.HoldThreshold = -1 },
+	}
+	for i, edit := range invalid {
+		r := model.DefaultRiskRules()
+		edit(&r)
+		if err := s.UpdateRules(ctx, 1, r); !errors.Is(err, ErrInvalidRiskRules) {
+			t.Errorf("invalid rules %d: got %v, want ErrInvalidRiskRules", i, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/queue"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	maxSynonymGroups  = 500
+	maxSynonymTerms   = 20
+	maxSearchPins     = 200
+	maxPinnedProducts = 10
+	// searchResyncTimeout bounds reindexing a shop after its synonyms changed
+	searchResyncTimeout = 10 * time.Minute
+)
+
+var ErrInvalidSearchRules = errors.New("invalid search rules")
+
+// SearchSettingsService manages the merchant's search rules: synonym groups,
+// applied when products are indexed, and pinned results, applied per search
+type SearchSettingsService interface {
+	GetRules(ctx context.Context, shopID uint) (*model.SearchRules, error)
+	// UpdateRules replaces the rules and returns them normalized. Changed
+	// synonyms reindex the shop's products in the background.
+	UpdateRules(ctx context.Context, shopID uint, rules model.SearchRules) (*model.SearchRules, error)
+}
+
+type searchSettingsService struct {
+	repo          repository.SearchSettingsRepository
+	productSearch ProductSearchService
+	queue         queue.Queue
+	logger        *zap.Logger
+}
+
+func NewSearchSettingsService(repo repository.SearchSettingsRepository, productSearch ProductSearchService, q queue.Queue, logger *zap.Logger) SearchSettingsService {
+	return &searchSettingsService{repo: repo, productSearch: productSearch, queue: q, logger: logger}
+}
+
+func (s *searchSettingsService) GetRules(ctx context.Context, shopID uint) (*model.SearchRules, error) {
+	return findSearchRules(ctx, s.repo, shopID)
+}
+
+func (s *searchSettingsService) UpdateRules(ctx context.Context, shopID uint, rules model.SearchRules) (*model.SearchRules, error) {
+	if err := normalizeSearchRules(&rules); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearchRules, err)
+	}
+	current, err := findSearchRules(ctx, s.repo, shopID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveSettings(ctx, &model.SearchSettings{ShopID: shopID, Rules: data}); err != nil {
+		return nil, err
+	}
+
+	if !reflect.DeepEqual(current.Synonyms, rules.Synonyms) {
+		s.resync(ctx, shopID)
+	}
+	return &rules, nil
+}
+
+// resync reindexes the shop's products with their new keywords
+func (s *searchSettingsService) resync(ctx context.Context, shopID uint) {
+	if s.queue == nil {
+		// Without a queue the shop is reindexed in process
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), searchResyncTimeout)
+			defer cancel()
+			if _, err := s.productSearch.SyncShop(ctx, shopID); err != nil {
+				s.logger.Error("Failed to reindex shop products", zap.Uint("shop_id", shopID), zap.Error(err))
+			}
+		}()
+		return
+	}
+	publishEvent(ctx, s.queue, s.logger, TopicSearchRulesChanged, SearchRulesEvent{ShopID: shopID})
+}
+
+// findSearchRules returns the shop's rules; shops that never configured
+// search have none
+func findSearchRules(ctx context.Context, repo repository.SearchSettingsRepository, shopID uint) (*model.SearchRules, error) {
+	rules := model.SearchRules{Synonyms: [][]string{}, Pins: []model.SearchPin{}}
+	settings, err := repo.FindSettings(ctx, shopID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &rules, nil
+		}
+		return nil, err
+	}
+	if isEmptyJSON(settings.Rules) {
+		return &rules, nil
+	}
+	if err := json.Unmarshal(settings.Rules, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// normalizeSearchRules validates rules and normalizes their terms and queries
+// the way searches are normalized
+func normalizeSearchRules(rules *model.SearchRules) error {
+	if len(rules.Synonyms) > maxSynonymGroups {
+		return fmt.Errorf("at most %d synonym groups", maxSynonymGroups)
+	}
+	if len(rules.Pins) > maxSearchPins {
+		return fmt.Errorf("at most %d pins", maxSearchPins)
+	}
+
+	synonyms := make([][]string, 0, len(rules.Synonyms))
+	for _, group := range rules.Synonyms {
+		if len(group) > maxSynonymTerms {
+			return fmt.Errorf("at most %d terms per synonym group", maxSynonymTerms)
+		}
+		var terms []string
+		seen := map[string]bool{}
+		for _, term := range group {
+			if utf8.RuneCountInString(term) > maxQueryLength {
+				return fmt.Errorf("synonym %q is too long", term)
+			}
+			term = normalizeSearchQuery(term)
+			if term != "" && !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) < 2 {
+			return errors.New("a synonym group needs at least two different terms")
+		}
+		synonyms = append(synonyms, terms)
+	}
+	rules.Synonyms = synonyms
+
+	queries := map[string]bool{}
+	pins := make([]model.SearchPin, 0, len(rules.Pins))
+	for _, pin := range rules.Pins {
+		if utf8.RuneCountInString(pin.Query) > maxQueryLength {
+			return fmt.Errorf("pinned query %q is too long", pin.Query)
+		}
+		query := normalizeSearchQuery(pin.Query)
+		if query == "" {
+			return errors.New("a pin needs a query")
+		}
+		if queries[query] {
+			return fmt.Errorf("query %q is pinned twice", query)
+		}
+		queries[query] = true
+		if len(pin.ProductIDs) == 0 || len(pin.ProductIDs) > maxPinnedProducts {
+			return fmt.Errorf("pin %q needs 1 to %d products", query, maxPinnedProducts)
+		}
+		ids := make([]uint, 0, len(pin.ProductIDs))
+		seen := map[uint]bool{}
+		for _, id := range pin.ProductIDs {
+			if id == 0 {
+				return fmt.Errorf("pin %q has an invalid product", query)
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		pins = append(pins, model.SearchPin{Query: query, ProductIDs: ids})
+	}
+	rules.Pins = pins
+	return nil
+}
+
+// synonymKeywords returns the terms of the synonym groups doc mentions that
+// it does not mention itself, so that a search for any term of a group
+// finds it. Terms match on word boundaries; terms with Han characters,
+// which are written without spaces, match anywhere.
+func synonymKeywords(doc *ProductDocument, groups [][]string) []string {
+	keywords := []string{}
+	if len(groups) == 0 {
+		return keywords
+	}
+	parts := append([]string{doc.Title, doc.Body}, doc.SKUs...)
+	for _, values := range doc.Options {
+		parts = append(parts, values...)
+	}
+	text := " " + searchWords(strings.Join(parts, " ")) + " "
+
+	mentions := func(term string) bool {
+		for _, r := range term {
+			if unicode.Is(unicode.Han, r) {
+				return strings.Contains(text, searchWords(term))
+			}
+		}
+		return strings.Contains(text, " "+searchWords(term)+" ")
+	}
+	added := map[string]bool{}
+	for _, group := range groups {
+		var missing []string
+		matched := false
+		for _, term := range group {
+			if mentions(term) {
+				matched = true
+			} else {
+				missing = append(missing, term)
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, term := range missing {
+			if !added[term] {
+				added[term] = true
+				keywords = append(keywords, term)
+			}
+		}
+	}
+	return keywords
+}
+
+// searchWords lowercases s and keeps its letters and digits, single-space
+// separated
+func searchWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
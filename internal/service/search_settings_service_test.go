@@ -0,0 +1,59 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"shop/internal/model"
+)
+
+func TestNormalizeSearchRules(t *testing.T) {
+	rules := model.SearchRules{
+		Synonyms: [][]string{{" Sneaker ", "trainer", "SNEAKER", ""}, {"tee", "T-Shirt"}},
+		Pins:     []model.SearchPin{{Query: "  Summer   Sale ", ProductIDs: []uint{3, 1, 3}}},
+	}
+	if err := normalizeSearchRules(&rules); err != nil {
+		t.Fatal(err)
+	}
+	want := model.SearchRules{
+		Synonyms: [][]string{{"sneaker", "trainer"}, {"tee", "t-shirt"}},
+		Pins:     []model.SearchPin{{Query: "summer sale", ProductIDs: []uint{3, 1}}},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("normalized rules = %+v, want %+v", rules, want)
+	}
+
+	invalid := []model.SearchRules{
+		{Synonyms: [][]string{{"shoe", " SHOE "}}},
+		{Pins: []model.SearchPin{{Query: " ", ProductIDs: []uint{1}}}},
+		{Pins: []model.SearchPin{{Query: "sale"}}},
+		{Pins: []model.SearchPin{{Query: "sale", ProductIDs: []uint{0}}}},
+		{Pins: []model.SearchPin{{Query: "Sale", ProductIDs: []uint{1}}, {Query: "sale", ProductIDs: []uint{2}}}},
+	}
+	for _, rules := range invalid {
+		if err := normalizeSearchRules(&rules); err == nil {
+			t.Errorf("rules %+v accepted", rules)
+		}
+	}
+}
+
+func TestSynonymKeywords(t *testing.T) {
+	groups := [][]string{{"sneaker", "trainer", "running shoe"}, {"tee", "t-shirt"}, {"运动鞋", "跑鞋"}}
+	tests := []struct {
+		doc  ProductDocument
+		want []string
+	}{
+		{ProductDocument{Title: "Trainer, white"}, []string{"sneaker", "running shoe"}},
+		{ProductDocument{Body: "A light running-shoe"}, []string{"sneaker", "trainer"}},
+		{ProductDocument{Title: "Basic T-shirt", Options: map[string][]string{"Size": {"M"}}}, []string{"tee"}},
+		// Words match whole: "teen" is not "tee"
+		{ProductDocument{Title: "Teen jacket"}, []string{}},
+		{ProductDocument{Title: "男士运动鞋"}, []string{"跑鞋"}},
+		{ProductDocument{Title: "Sneaker", SKUs: []string{"TRAINER-1"}}, []string{"running shoe"}},
+	}
+	for _, tt := range tests {
+		if got := synonymKeywords(&tt.doc, groups); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("synonymKeywords(%+v) = %q, want %q", tt.doc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotShopMember    = errors.New("account has no access to this shop")
+	ErrNotPlatformAdmin = errors.New("account is not a platform administrator")
+)
+
+// StaffService signs platform users in to the admin of a shop, and platform
+// administrators in to the SaaS management API
+type StaffService interface {
+	Login(ctx context.Context, shopID uint, email, password string) (*model.PlatformUser, string, error)
+	PlatformLogin(ctx context.Context, email, password string) (*model.PlatformUser, string, error)
+}
+
+type staffService struct {
+	repo repository.PlatformUserRepository
+	cfg  *config.Config
+}
+
+func NewStaffService(repo repository.PlatformUserRepository, cfg *config.Config) StaffService {
+	return &staffService{repo: repo, cfg: cfg}
+}
+
+// Login checks the credentials and that the user's organization owns the
+// shop, and issues a staff token valid for that shop only
+func (s *staffService) Login(ctx context.Context, shopID uint, email, password string) (*model.PlatformUser, string, error) {
+	user, err := s.authenticate(ctx, email, password)
+	if err != nil {
+		return nil, "", err
+	}
+	member, err := s.repo.IsShopMember(ctx, user.ID, shopID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !member {
+		return nil, "", ErrNotShopMember
+	}
+
+	token, err := s.issueToken(utils.ScopeStaff, shopID, user.ID)
+	return user, token, err
+}
+
+// PlatformLogin issues a platform token, which is bound to no shop
+func (s *staffService) PlatformLogin(ctx context.Context, email, password string) (*model.PlatformUser, string, error) {
+	user, err := s.authenticate(ctx, email, password)
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.IsPlatformAdmin {
+		return nil, "", ErrNotPlatformAdmin
+	}
+
+	token, err := s.issueToken(utils.ScopePlatform, 0, user.ID)
+	return user, token, err
+}
+
+func (s *staffService) authenticate(ctx context.Context, email, password string) (*model.PlatformUser, error) {
+	user, err := s.repo.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !user.IsActive || !utils.CheckPasswordHash(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *staffService) issueToken(scope string, shopID, userID uint) (string, error) {
+	ttl := time.Duration(s.cfg.JWT.ExpireHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 72 * time.Hour
+	}
+	return utils.GenerateToken(s.cfg.JWT.Secret, scope, shopID, userID, ttl)
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/queue"
+
+	"go.uber.org/zap"
+)
+
+// migrationLease is how long a worker owns a migration without renewing it;
+// a crashed worker's migration can be resumed once it runs out. A running
+// worker renews it every migrationHeartbeat, however long a page takes.
+const (
+	migrationLease     = 15 * time.Minute
+	migrationHeartbeat = migrationLease / 5
+)
+
+var (
+	ErrNoStorageMigration   = errors.New("no storage migration configured, set storage.migration.source")
+	ErrStorageMigrationBusy = errors.New("storage migration is already running")
+)
+
+// StorageMigrationService copies every object of the configured cutover from
+// the source to the destination provider, verifying each copy by SHA-256
+type StorageMigrationService interface {
+	// Start records a new migration and runs it in the background
+	Start(ctx context.Context) (*model.StorageMigration, error)
+	// Resume continues an interrupted migration after its last key; a finished
+	// one (completed, or with failed objects) is walked again from the start,
+	// skipping objects that verify
+	Resume(ctx context.Context, id uint) (*model.StorageMigration, error)
+	Get(ctx context.Context, id uint) (*model.StorageMigration, error)
+	List(ctx context.Context) ([]model.StorageMigration, error)
+
+	// Create and Reopen prepare a migration without scheduling it, for the
+	// CLI; Start and Resume are them plus a background run
+	Create(ctx context.Context) (*model.StorageMigration, error)
+	Reopen(ctx context.Context, id uint) (*model.StorageMigration, error)
+	// Run executes a migration in the calling goroutine; invoked by the
+	// TopicStorageMigrate job and cmd/storage-migrate
+	Run(ctx context.Context, id uint) error
+}
+
+type storageMigrationService struct {
+	cutover    *storage.Cutover // nil when no migration is configured
+	migrations repository.StorageMigrationRepository
+	queue      queue.Queue
+	logger     *zap.Logger
+	batchSize  int
+}
+
+func NewStorageMigrationService(cutover *storage.Cutover, migrations repository.StorageMigrationRepository, q queue.Queue, cfg *config.Config, logger *zap.Logger) StorageMigrationService {
+	batchSize := cfg.Storage.Migration.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &storageMigrationService{
+		cutover:    cutover,
+		migrations: migrations,
+		queue:      q,
+		logger:     logger,
+		batchSize:  batchSize,
+	}
+}
+
+func (s *storageMigrationService) Create(ctx context.Context) (*model.StorageMigration, error) {
+	if s.cutover == nil {
+		return nil, ErrNoStorageMigration
+	}
+	migration := &model.StorageMigration{
+		Source:      s.cutover.SourceName,
+		Destination: s.cutover.DestinationName,
+		Status:      model.MigrationStatusPending,
+	}
+	if err := s.migrations.Create(ctx, migration); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+func (s *storageMigrationService) Start(ctx context.Context) (*model.StorageMigration, error) {
+	migration, err := s.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.schedule(ctx, migration.ID)
+	return migration, nil
+}
+
+func (s *storageMigrationService) Resume(ctx context.Context, id uint) (*model.StorageMigration, error) {
+	migration, err := s.Reopen(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.schedule(ctx, migration.ID)
+	return migration, nil
+}
+
+func (s *storageMigrationService) Reopen(ctx context.Context, id uint) (*model.StorageMigration, error) {
+	if s.cutover == nil {
+		return nil, ErrNoStorageMigration
+	}
+	migration, err := s.migrations.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if migration.Source != s.cutover.SourceName || migration.Destination != s.cutover.DestinationName {
+		return nil, fmt.Errorf("%w: migration %d is %s -> %s", ErrNoStorageMigration, id, migration.Source, migration.Destination)
+	}
+	if migration.LockedUntil != nil && migration.LockedUntil.After(time.Now()) {
+		return nil, ErrStorageMigrationBusy
+	}
+	if migration.FinishedAt != nil {
+		// Re-verify from the start, e.g. to retry failed objects
+		migration.Status = model.MigrationStatusPending
+		migration.LastKey = ""
+		migration.Copied, migration.Skipped, migration.Failed, migration.Bytes = 0, 0, 0, 0
+		migration.Error = ""
+		migration.FinishedAt = nil
+		if err := s.migrations.SaveProgress(ctx, migration); err != nil {
+			return nil, err
+		}
+	}
+	return migration, nil
+}
+
+func (s *storageMigrationService) Get(ctx context.Context, id uint) (*model.StorageMigration, error) {
+	return s.migrations.FindByID(ctx, id)
+}
+
+func (s *storageMigrationService) List(ctx context.Context) ([]model.StorageMigration, error) {
+	return s.migrations.List(ctx, 50)
+}
+
+// schedule hands the migration to the job queue, or to a goroutine when the
+// queue is disabled in development
+func (s *storageMigrationService) schedule(ctx context.Context, id uint) {
+	if s.queue == nil {
+		go func() {
+			if err := s.Run(context.Background(), id); err != nil {
+				s.logger.Error("Storage migration failed", zap.Uint("migration_id", id), zap.Error(err))
+			}
+		}()
+		return
+	}
+	publishEvent(ctx, s.queue, s.logger, TopicStorageMigrate, StorageMigrationEvent{MigrationID: id})
+}
+
+func (s *storageMigrationService) Run(ctx context.Context, id uint) error {
+	if s.cutover == nil {
+		return ErrNoStorageMigration
+	}
+	now := time.Now()
+	ok, err := s.migrations.Claim(ctx, id, now, now.Add(migrationLease))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Completed, or another worker holds the lease (e.g. a redelivered job)
+		s.logger.Info("Storage migration not claimable, skipping", zap.Uint("migration_id", id))
+		return nil
+	}
+	migration, err := s.migrations.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if migration.StartedAt == nil {
+		migration.StartedAt = &now
+	}
+
+	s.logger.Info("Running storage migration", zap.Uint("migration_id", id),
+		zap.String("source", migration.Source), zap.String("destination", migration.Destination),
+		zap.String("after", migration.LastKey))
+
+	beatCtx, stopBeat := context.WithCancel(ctx)
+	beating := make(chan struct{})
+	go func() {
+		defer close(beating)
+		s.heartbeat(beatCtx, id)
+	}()
+	runErr := s.walk(ctx, migration)
+	// Stop renewing before the lease is released below
+	stopBeat()
+	<-beating
+
+	finished := time.Now()
+	migration.LockedUntil = nil
+	switch {
+	case runErr != nil:
+		migration.Status = model.MigrationStatusFailed
+		migration.Error = truncate(runErr.Error(), 1000)
+	case migration.Failed > 0:
+		migration.Status = model.MigrationStatusFailed
+		migration.FinishedAt = &finished
+	default:
+		migration.Status = model.MigrationStatusCompleted
+		migration.FinishedAt = &finished
+	}
+	// The caller's context may be what stopped the walk
+	if err := s.migrations.SaveProgress(context.Background(), migration); err != nil {
+		return err
+	}
+
+	s.logger.Info("Storage migration finished", zap.Uint("migration_id", id), zap.String("status", migration.Status),
+		zap.Int("copied", migration.Copied), zap.Int("skipped", migration.Skipped), zap.Int("failed", migration.Failed))
+	return runErr
+}
+
+// heartbeat renews the lease of migration id until ctx ends
+func (s *storageMigrationService) heartbeat(ctx context.Context, id uint) {
+	ticker := time.NewTicker(migrationHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.migrations.Renew(ctx, id, time.Now().Add(migrationLease)); err != nil && ctx.Err() == nil {
+				s.logger.Warn("Failed to renew storage migration lease", zap.Uint("migration_id", id), zap.Error(err))
+			}
+		}
+	}
+}
+
+// walk pages through the source in key order and checkpoints after every page
+func (s *storageMigrationService) walk(ctx context.Context, migration *model.StorageMigration) error {
+	opts := storage.ListOptions{StartAfter: migration.LastKey, MaxKeys: s.batchSize}
+	for {
+		page, err := s.cutover.Source.ListObjects(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Objects {
+			copied, err := s.migrateObject(ctx, obj)
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err != nil:
+				s.logger.Warn("Failed to migrate object", zap.String("key", obj.Key), zap.Error(err))
+				migration.Failed++
+				migration.Error = truncate(fmt.Sprintf("%s: %v", obj.Key, err), 1000)
+			case copied:
+				migration.Copied++
+				migration.Bytes += obj.Size
+			default:
+				migration.Skipped++
+			}
+			migration.LastKey = obj.Key
+		}
+
+		until := time.Now().Add(migrationLease)
+		migration.LockedUntil = &until
+		if err := s.migrations.SaveProgress(ctx, migration); err != nil {
+			return err
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		opts.StartAfter = migration.LastKey
+	}
+}
+
+// migrateObject copies one object unless the destination already holds the
+// same content, then verifies the copy by reading it back
+func (s *storageMigrationService) migrateObject(ctx context.Context, obj storage.ObjectInfo) (bool, error) {
+	src, dst := s.cutover.Source, s.cutover.Destination
+
+	if existing, err := dst.StatObject(ctx, obj.Key); err == nil && existing.Size == obj.Size {
+		srcSum, err := objectSHA256(ctx, src, obj.Key)
+		if err != nil {
+			return false, err
+		}
+		dstSum, err := objectSHA256(ctx, dst, obj.Key)
+		if err != nil {
+			return false, err
+		}
+		if srcSum == dstSum {
+			return false, nil
+		}
+	} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+
+	body, err := src.GetObject(ctx, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.New()
+	_, err = dst.PutObject(ctx, obj.Key, io.TeeReader(body, hash), obj.Size)
+	body.Close()
+	if err != nil {
+		return false, err
+	}
+
+	dstSum, err := objectSHA256(ctx, dst, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	if srcSum := hex.EncodeToString(hash.Sum(nil)); srcSum != dstSum {
+		return false, fmt.Errorf("%w: sha256 %s on source, %s on destination", ErrChecksumMismatch, srcSum, dstSum)
+	}
+	return true, nil
+}
+
+func objectSHA256(ctx context.Context, p storage.Provider, key string) (string, error) {
+	body, err := p.GetObject(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"shop/internal/config"
+	"shop/internal/infra/storage"
+	"shop/internal/model"
+	"shop/internal/repository"
+	"shop/pkg/utils"
+)
+
+const (
+	themeManifestFile      = "manifest.json"
+	maxThemePackageSize    = 50 << 20
+	maxThemeUnpackedSize   = 200 << 20
+	maxThemePackageFiles   = 2000
+	defaultThemePreviewTTL = time.Hour
+)
+
+var (
+	ErrInvalidThemePackage  = errors.New("invalid theme package")
+	ErrInvalidThemeSettings = errors.New("invalid theme settings")
+	ErrActiveThemeDelete    = errors.New("the active theme cannot be deleted")
+	ErrInvalidPreviewToken  = errors.New("invalid or expired preview token")
+
+	settingIDPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+	colorPattern     = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+type ThemeService interface {
+	// Upload validates a zip package and stores it as a new version of
+	// themeID, or of a new theme when themeID is 0
+	Upload(ctx context.Context, shopID, themeID uint, file *multipart.FileHeader) (*model.Theme, error)
+	List(ctx context.Context, shopID uint) ([]model.Theme, error)
+	Get(ctx context.Context, shopID, id uint) (*model.Theme, error)
+	Delete(ctx context.Context, shopID, id uint) error
+	ListVersions(ctx context.Context, shopID, id uint) ([]model.ThemeVersion, error)
+	// OpenPackage streams the zip package uploaded as version of the theme
+	OpenPackage(ctx context.Context, shopID, id uint, version int) (*model.ThemeVersion, io.ReadCloser, error)
+	Rollback(ctx context.Context, shopID, id uint, version int) (*model.Theme, error)
+	Publish(ctx context.Context, shopID, id uint) error
+	UpdateSettings(ctx context.Context, shopID, id uint, values map[string]interface{}) (*model.Theme, error)
+	PreviewToken(ctx context.Context, shopID, id uint) (string, time.Time, error)
+
+	// StorefrontSettings returns the schema defaults merged with the merchant
+	// values of the active theme, or of the previewed theme when a valid
+	// preview token is supplied
+	StorefrontSettings(ctx context.Context, shopID uint, previewToken string) (*model.Theme, map[string]interface{}, error)
+}
+
+type themeService struct {
+	repo     repository.ThemeRepository
+	provider storage.Provider
+	cfg      *config.Config
+}
+
+func NewThemeService(repo repository.ThemeRepository, provider storage.Provider, cfg *config.Config) (ThemeService, error) {
+	if cfg.Server.SecretKey == "" {
+		return nil, fmt.Errorf("server.secret_key is required to sign theme preview tokens")
+	}
+	return &themeService{repo: repo, provider: provider, cfg: cfg}, nil
+}
+
+func (s *themeService) Upload(ctx context.Context, shopID, themeID uint, file *multipart.FileHeader) (*model.Theme, error) {
+	if file.Size > maxThemePackageSize {
+		return nil, fmt.Errorf("%w: package exceeds %d bytes", ErrInvalidThemePackage, maxThemePackageSize)
+	}
+
+	theme := &model.Theme{ShopID: shopID}
+	if themeID != 0 {
+		existing, err := s.repo.FindByID(ctx, shopID, themeID)
+		if err != nil {
+			return nil, err
+		}
+		theme = existing
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	manifest, rawManifest, err := readThemeManifest(src, file.Size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// Packages are only read by the platform and staff, never served publicly
+	key := path.Join(privatePrefix, "themes", strconv.FormatUint(uint64(shopID), 10), utils.GenerateUUID()+".zip")
+	if _, err := s.provider.PutObject(ctx, key, src, file.Size); err != nil {
+		return nil, err
+	}
+
+	if theme.ID == 0 {
+		theme.Name = manifest.Name
+	}
+	version := &model.ThemeVersion{SourcePath: key, Manifest: rawManifest}
+	if err := s.repo.AddVersion(ctx, theme, version); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+func (s *themeService) List(ctx context.Context, shopID uint) ([]model.Theme, error) {
+	return s.repo.List(ctx, shopID)
+}
+
+func (s *themeService) Get(ctx context.Context, shopID, id uint) (*model.Theme, error) {
+	return s.repo.FindByID(ctx, shopID, id)
+}
+
+func (s *themeService) Delete(ctx context.Context, shopID, id uint) error {
+	theme, err := s.repo.FindByID(ctx, shopID, id)
+	if err != nil {
+		return err
+	}
+	if theme.IsActive {
+		return ErrActiveThemeDelete
+	}
+	return s.repo.Delete(ctx, shopID, id)
+}
+
+func (s *themeService) ListVersions(ctx context.Context, shopID, id uint) ([]model.ThemeVersion, error) {
+	if _, err := s.repo.FindByID(ctx, shopID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListVersions(ctx, id)
+}
+
+func (s *themeService) OpenPackage(ctx context.Context, shopID, id uint, version int) (*model.ThemeVersion, io.ReadCloser, error) {
+	if _, err := s.repo.FindByID(ctx, shopID, id); err != nil {
+		return nil, nil, err
+	}
+	v, err := s.repo.FindVersion(ctx, id, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := s.provider.GetObject(ctx, v.SourcePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, body, nil
+}
+
+// Rollback points the theme at an earlier package and restores the setting
+// values saved with it.
+func (s *themeService) Rollback(ctx context.Context, shopID, id uint, version int) (*model.Theme, error) {
+	theme, err := s.repo.FindByID(ctx, shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.repo.FindVersion(ctx, theme.ID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	theme.Version = v.Version
+	theme.SourcePath = v.SourcePath
+	theme.ConfigData = v.ConfigData
+	if err := s.repo.Update(ctx, theme); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+func (s *themeService) Publish(ctx context.Context, shopID, id uint) error {
+	return s.repo.Activate(ctx, shopID, id)
+}
+
+func (s *themeService) UpdateSettings(ctx context.Context, shopID, id uint, values map[string]interface{}) (*model.Theme, error) {
+	theme, err := s.repo.FindByID(ctx, shopID, id)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := s.currentManifest(ctx, theme)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]model.ThemeSetting, len(manifest.SettingsSchema))
+	for _, setting := range manifest.SettingsSchema {
+		schema[setting.ID] = setting
+	}
+	for key, value := range values {
+		setting, ok := schema[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown setting %q", ErrInvalidThemeSettings, key)
+		}
+		if err := validateSettingValue(setting, value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidThemeSettings, key, err)
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	theme.ConfigData = data
+	if err := s.repo.SaveConfig(ctx, theme); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+func (s *themeService) PreviewToken(ctx context.Context, shopID, id uint) (string, time.Time, error) {
+	if _, err := s.repo.FindByID(ctx, shopID, id); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(defaultThemePreviewTTL)
+	sig := utils.HMACSign(s.cfg.Server.SecretKey, previewPayload(shopID, id, expires.Unix()))
+	return fmt.Sprintf("%d.%d.%s", id, expires.Unix(), sig), expires, nil
+}
+
+func (s *themeService) StorefrontSettings(ctx context.Context, shopID uint, previewToken string) (*model.Theme, map[string]interface{}, error) {
+	theme, err := s.storefrontTheme(ctx, shopID, previewToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest, err := s.currentManifest(ctx, theme)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]interface{}{}
+	if len(theme.ConfigData) > 0 {
+		if err := json.Unmarshal(theme.ConfigData, &values); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	merged := make(map[string]interface{}, len(manifest.SettingsSchema))
+	for _, setting := range manifest.SettingsSchema {
+		merged[setting.ID] = setting.Default
+		if v, ok := values[setting.ID]; ok && validateSettingValue(setting, v) == nil {
+			merged[setting.ID] = v
+		}
+	}
+	return theme, merged, nil
+}
+
+func (s *themeService) storefrontTheme(ctx context.Context, shopID uint, previewToken string) (*model.Theme, error) {
+	if previewToken == "" {
+		return s.repo.FindActive(ctx, shopID)
+	}
+	id, err := s.verifyPreviewToken(shopID, previewToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(ctx, shopID, id)
+}
+
+func (s *themeService) currentManifest(ctx context.Context, theme *model.Theme) (*model.ThemeManifest, error) {
+	v, err := s.repo.FindVersion(ctx, theme.ID, theme.Version)
+	if err != nil {
+		return nil, err
+	}
+	var manifest model.ThemeManifest
+	if err := json.Unmarshal(v.Manifest, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (s *themeService) verifyPreviewToken(shopID uint, token string) (uint, error) {
+	parts := strings.SplitN(token, ".", 3)
+	if len(parts) != 3 {
+		return 0, ErrInvalidPreviewToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidPreviewToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, ErrInvalidPreviewToken
+	}
+	if !utils.HMACVerify(s.cfg.Server.SecretKey, previewPayload(shopID, uint(id), expires), parts[2]) {
+		return 0, ErrInvalidPreviewToken
+	}
+	return uint(id), nil
+}
+
+func previewPayload(shopID, themeID uint, expires int64) string {
+	return fmt.Sprintf("theme-preview:%d:%d:%d", shopID, themeID, expires)
+}
+
+// readThemeManifest checks the archive layout and returns the validated
+// manifest together with its normalized JSON
+func readThemeManifest(r io.ReaderAt, size int64) (*model.ThemeManifest, []byte, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: not a zip archive", ErrInvalidThemePackage)
+	}
+	if len(zr.File) > maxThemePackageFiles {
+		return nil, nil, fmt.Errorf("%w: more than %d files", ErrInvalidThemePackage, maxThemePackageFiles)
+	}
+
+	var (
+		unpacked uint64
+		manifest *zip.File
+	)
+	for _, f := range zr.File {
+		name := f.Name
+		clean := path.Clean(name)
+		if strings.Contains(name, "\\") || path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, nil, fmt.Errorf("%w: illegal path %q", ErrInvalidThemePackage, name)
+		}
+		unpacked += f.UncompressedSize64
+		if unpacked > maxThemeUnpackedSize {
+			return nil, nil, fmt.Errorf("%w: unpacked size exceeds %d bytes", ErrInvalidThemePackage, maxThemeUnpackedSize)
+		}
+		if name == themeManifestFile {
+			manifest = f
+		}
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%w: %s not found at archive root", ErrInvalidThemePackage, themeManifestFile)
+	}
+
+	rc, err := manifest.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidThemePackage, err)
+	}
+	defer rc.Close()
+
+	var m model.ThemeManifest
+	if err := json.NewDecoder(io.LimitReader(rc, 1<<20)).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed %s: %v", ErrInvalidThemePackage, themeManifestFile, err)
+	}
+	if err := validateManifest(&m); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidThemePackage, err)
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &m, raw, nil
+}
+
+func validateManifest(m *model.ThemeManifest) error {
+	if strings.TrimSpace(m.Name) == "" {
+		return errors.New("manifest name is required")
+	}
+	seen := make(map[string]bool, len(m.SettingsSchema))
+	for _, setting := range m.SettingsSchema {
+		if !settingIDPattern.MatchString(setting.ID) {
+			return fmt.Errorf("setting id %q must match %s", setting.ID, settingIDPattern)
+		}
+		if seen[setting.ID] {
+			return fmt.Errorf("duplicate setting id %q", setting.ID)
+		}
+		seen[setting.ID] = true
+
+		if setting.Type == "select" && len(setting.Options) == 0 {
+			return fmt.Errorf("select setting %q has no options", setting.ID)
+		}
+		if setting.Default == nil {
+			if !isKnownSettingType(setting.Type) {
+				return fmt.Errorf("setting %q has unknown type %q", setting.ID, setting.Type)
+			}
+			continue
+		}
+		if err := validateSettingValue(setting, setting.Default); err != nil {
+			return fmt.Errorf("setting %q default: %v", setting.ID, err)
+		}
+	}
+	return nil
+}
+
+func isKnownSettingType(t string) bool {
+	switch t {
+	case "text", "textarea", "color", "number", "checkbox", "select", "image", "url":
+		return true
+	}
+	return false
+}
+
+// validateSettingValue checks a JSON decoded value against its declaration
+func validateSettingValue(setting model.ThemeSetting, value interface{}) error {
+	switch setting.Type {
+	case "text", "textarea", "image":
+		if _, ok := value.(string); !ok {
+			return errors.New("must be a string")
+		}
+	case "url":
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		if s != "" {
+			if _, err := url.Parse(s); err != nil {
+				return errors.New("must be a valid URL")
+			}
+		}
+	case "color":
+		s, ok := value.(string)
+		if !ok || !colorPattern.MatchString(s) {
+			return errors.New("must be a hex color like #1a2b3c")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return errors.New("must be a number")
+		}
+	case "checkbox":
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be a boolean")
+		}
+	case "select":
+		for _, opt := range setting.Options {
+			if fmt.Sprint(opt) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return errors.New("must be one of the declared options")
+	default:
+		return fmt.Errorf("unknown type %q", setting.Type)
+	}
+	return nil
+}
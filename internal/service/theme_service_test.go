@@ -0,0 +1,310 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shop/internal/config"
+	"shop/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func themeZip(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+const testManifest = `{"name": "Dawn", "version": "1.0.0", "settings_schema": [
+	{"id": "accent", "type": "color", "default": "#112233"},
+	{"id": "columns", "type": "number", "default": 4},
+	{"id": "layout", "type": "select", "options": ["grid", "list"], "default": "grid"},
+	{"id": "logo", "type": "image"}
+]}`
+
+func TestReadThemeManifest(t *testing.T) {
+	r := themeZip(t, map[string]string{"manifest.json": testManifest, "templates/index.html": "<h1>hi</h1>"})
+	manifest, raw, err := readThemeManifest(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Name != "Dawn" || len(manifest.SettingsSchema) != 4 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	var decoded model.ThemeManifest
+	if err := json.Unmarshal(raw, &decoded); err != nil || !reflect.DeepEqual(&decoded, manifest) {
+		t.Errorf("normalized manifest %s does not decode to the manifest: %v", raw, err)
+	}
+
+	tests := map[string]map[string]string{
+		"no manifest":        {"templates/index.html": ""},
+		"nested manifest":    {"dawn/manifest.json": testManifest},
+		"parent traversal":   {"manifest.json": testManifest, "../evil.html": ""},
+		"nested traversal":   {"manifest.json": testManifest, "templates/../../evil.html": ""},
+		"absolute path":      {"manifest.json": testManifest, "/etc/evil": ""},
+		"backslash path":     {"manifest.json": testManifest, `..\evil.html`: ""},
+		"malformed manifest": {"manifest.json": `{"name":`},
+		"unnamed theme":      {"manifest.json": `{"name": " "}`},
+		"bad setting id":     {"manifest.json": `{"name": "x", "settings_schema": [{"id": "Accent", "type": "text"}]}`},
+		"duplicate setting":  {"manifest.json": `{"name": "x", "settings_schema": [{"id": "a", "type": "text"}, {"id": "a", "type": "text"}]}`},
+		"unknown type":       {"manifest.json": `{"name": "x", "settings_schema": [{"id": "a", "type": "video"}]}`},
+		"select no options":  {"manifest.json": `{"name": "x", "settings_schema": [{"id": "a", "type": "select"}]}`},
+		"invalid default":    {"manifest.json": `{"name": "x", "settings_schema": [{"id": "a", "type": "color", "default": "red"}]}`},
+	}
+	for name, files := range tests {
+		r := themeZip(t, files)
+		if _, _, err := readThemeManifest(r, r.Size()); !errors.Is(err, ErrInvalidThemePackage) {
+			t.Errorf("%s: got %v, want ErrInvalidThemePackage", name, err)
+		}
+	}
+
+	notZip := strings.NewReader("not a zip")
+	if _, _, err := readThemeManifest(notZip, notZip.Size()); !errors.Is(err, ErrInvalidThemePackage) {
+		t.Errorf("not a zip: got %v, want ErrInvalidThemePackage", err)
+	}
+}
+
+func TestValidateSettingValue(t *testing.T) {
+	tests := []struct {
+		setting model.ThemeSetting
+		value   interface{}
+		ok      bool
+	}{
+		{model.ThemeSetting{Type: "text"}, "hello", true},
+		{model.ThemeSetting{Type: "text"}, 1.0, false},
+		{model.ThemeSetting{Type: "color"}, "#abc", true},
+		{model.ThemeSetting{Type: "color"}, "#abcd", false},
+		{model.ThemeSetting{Type: "number"}, 3.0, true},
+		{model.ThemeSetting{Type: "number"}, "3", false},
+		{model.ThemeSetting{Type: "checkbox"}, true, true},
+		{model.ThemeSetting{Type: "checkbox"}, "true", false},
+		{model.ThemeSetting{Type: "select", Options: []interface{}{"grid", "list"}}, "list", true},
+		{model.ThemeSetting{Type: "select", Options: []interface{}{"grid", "list"}}, "table", false},
+		{model.ThemeSetting{Type: "url"}, "", true},
+		{model.ThemeSetting{Type: "url"}, "https://example.com/a", true},
+		{model.ThemeSetting{Type: "url"}, "http://[::1", false},
+		{model.ThemeSetting{Type: "video"}, "x", false},
+	}
+	for _, tt := range tests {
+		if err := validateSettingValue(tt.setting, tt.value); (err == nil) != tt.ok {
+			t.Errorf("validateSettingValue(%s, %v) = %v, want ok %v", tt.setting.Type, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestThemePreviewToken(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.SecretKey = "test-secret"
+	repo := newFakeThemeRepo()
+	repo.themes[7] = &model.Theme{ID: 7, ShopID: 1}
+	svc, err := NewThemeService(repo, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := svc.(*themeService)
+
+	token, _, err := s.PreviewToken(context.Background(), 1, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.verifyPreviewToken(1, token); err != nil || id != 7 {
+		t.Errorf("verifyPreviewToken = %d, %v; want theme 7", id, err)
+	}
+	// Tokens are bound to the shop and cannot be edited
+	if _, err := s.verifyPreviewToken(2, token); !errors.Is(err, ErrInvalidPreviewToken) {
+		t.Errorf("token of another shop: got %v", err)
+	}
+	if _, err := s.verifyPreviewToken(1, "8"+strings.TrimPrefix(token, "7")); !errors.Is(err, ErrInvalidPreviewToken) {
+		t.Errorf("token for another theme: got %v", err)
+	}
+	expired := strings.Join([]string{"7", "1", strings.SplitN(token, ".", 3)[2]}, ".")
+	if _, err := s.verifyPreviewToken(1, expired); !errors.Is(err, ErrInvalidPreviewToken) {
+		t.Errorf("expired token: got %v", err)
+	}
+
+	if _, err := NewThemeService(repo, nil, &config.Config{}); err == nil {
+		t.Error("theme service constructed without server.secret_key")
+	}
+}
+
+func TestThemeSettingsFollowVersions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.SecretKey = "test-secret"
+	repo := newFakeThemeRepo()
+	svc, err := NewThemeService(repo, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	theme := &model.Theme{ShopID: 1, Name: "Dawn"}
+	if err := repo.AddVersion(ctx, theme, &model.ThemeVersion{Manifest: json.RawMessage(testManifest)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateSettings(ctx, 1, theme.ID, map[string]interface{}{"accent": "#000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateSettings(ctx, 1, theme.ID, map[string]interface{}{"accent": "red"}); !errors.Is(err, ErrInvalidThemeSettings) {
+		t.Errorf("invalid color: got %v, want ErrInvalidThemeSettings", err)
+	}
+	if _, err := svc.UpdateSettings(ctx, 1, theme.ID, map[string]interface{}{"font": "serif"}); !errors.Is(err, ErrInvalidThemeSettings) {
+		t.Errorf("unknown setting: got %v, want ErrInvalidThemeSettings", err)
+	}
+
+	// A new version starts from the current values and is configured on its own
+	if err := repo.AddVersion(ctx, theme, &model.ThemeVersion{Manifest: json.RawMessage(testManifest)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateSettings(ctx, 1, theme.ID, map[string]interface{}{"accent": "#ffffff", "layout": "list"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Publish(ctx, 1, theme.ID); err != nil {
+		t.Fatal(err)
+	}
+	settings := func() map[string]interface{} {
+		t.Helper()
+		_, merged, err := svc.StorefrontSettings(ctx, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return merged
+	}
+	want := map[string]interface{}{"accent": "#ffffff", "columns": 4.0, "layout": "list", "logo": nil}
+	if got := settings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings of version 2 = %v, want %v", got, want)
+	}
+
+	// Rolling back restores the values saved with version 1
+	if _, err := svc.Rollback(ctx, 1, theme.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{"accent": "#000000", "columns": 4.0, "layout": "grid", "logo": nil}
+	if got := settings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings after rollback = %v, want %v", got, want)
+	}
+	if _, err := svc.Rollback(ctx, 1, theme.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := settings(); got["accent"] != "#ffffff" {
+		t.Errorf("accent after rolling forward = %v, want #ffffff", got["accent"])
+	}
+}
+
+// fakeThemeRepo keeps themes and versions in memory for one shop
+type fakeThemeRepo struct {
+	themes   map[uint]*model.Theme
+	versions map[uint][]model.ThemeVersion
+}
+
+func newFakeThemeRepo() *fakeThemeRepo {
+	return &fakeThemeRepo{themes: map[uint]*model.Theme{}, versions: map[uint][]model.ThemeVersion{}}
+}
+
+func (r *fakeThemeRepo) FindByID(ctx context.Context, shopID, id uint) (*model.Theme, error) {
+	theme, ok := r.themes[id]
+	if !ok || theme.ShopID != shopID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *theme
+	return &copied, nil
+}
+
+func (r *fakeThemeRepo) FindActive(ctx context.Context, shopID uint) (*model.Theme, error) {
+	for _, theme := range r.themes {
+		if theme.ShopID == shopID && theme.IsActive {
+			return r.FindByID(ctx, shopID, theme.ID)
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeThemeRepo) List(ctx context.Context, shopID uint) ([]model.Theme, error) {
+	var themes []model.Theme
+	for _, theme := range r.themes {
+		if theme.ShopID == shopID {
+			themes = append(themes, *theme)
+		}
+	}
+	return themes, nil
+}
+
+func (r *fakeThemeRepo) Update(ctx context.Context, theme *model.Theme) error {
+	copied := *theme
+	r.themes[theme.ID] = &copied
+	return nil
+}
+
+func (r *fakeThemeRepo) SaveConfig(ctx context.Context, theme *model.Theme) error {
+	r.themes[theme.ID].ConfigData = theme.ConfigData
+	versions := r.versions[theme.ID]
+	for i := range versions {
+		if versions[i].Version == theme.Version {
+			versions[i].ConfigData = theme.ConfigData
+		}
+	}
+	return nil
+}
+
+func (r *fakeThemeRepo) Delete(ctx context.Context, shopID, id uint) error {
+	delete(r.themes, id)
+	return nil
+}
+
+func (r *fakeThemeRepo) AddVersion(ctx context.Context, theme *model.Theme, version *model.ThemeVersion) error {
+	if theme.ID == 0 {
+		theme.ID = uint(len(r.themes) + 1)
+	} else {
+		*theme = *r.themes[theme.ID]
+	}
+	version.ShopID = theme.ShopID
+	version.ThemeID = theme.ID
+	version.Version = len(r.versions[theme.ID]) + 1
+	version.ConfigData = theme.ConfigData
+	r.versions[theme.ID] = append(r.versions[theme.ID], *version)
+
+	theme.Version = version.Version
+	theme.SourcePath = version.SourcePath
+	return r.Update(ctx, theme)
+}
+
+func (r *fakeThemeRepo) FindVersion(ctx context.Context, themeID uint, version int) (*model.ThemeVersion, error) {
+	for _, v := range r.versions[themeID] {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeThemeRepo) ListVersions(ctx context.Context, themeID uint) ([]model.ThemeVersion, error) {
+	return r.versions[themeID], nil
+}
+
+func (r *fakeThemeRepo) Activate(ctx context.Context, shopID, id uint) error {
+	for _, theme := range r.themes {
+		if theme.ShopID == shopID {
+			theme.IsActive = theme.ID == id
+		}
+	}
+	return nil
+}
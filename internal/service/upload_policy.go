@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"shop/internal/config"
+)
+
+var (
+	ErrInvalidFolder      = errors.New("folder may only contain letters, digits, '-', '_' and '/' separators")
+	ErrFileTypeNotAllowed = errors.New("file type is not allowed in this folder")
+	ErrTooManyParts       = errors.New("upload exceeds the maximum number of parts")
+)
+
+var folderPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(/[A-Za-z0-9_-]+)*$`)
+
+// activeTypes are rendered or executed by browsers. A filename extension that
+// maps to one of them is only accepted when sniffing confirms the content,
+// otherwise e.g. an HTML page could be uploaded as "photo.html" with a JPEG header.
+var activeTypes = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"text/xml":               true,
+	"application/xml":        true,
+}
+
+// uploadPolicy is the effective policy for one folder
+type uploadPolicy struct {
+	allowedTypes []string
+	maxSize      int64
+	maxParts     int
+}
+
+// resolvePolicy picks the configured policy with the longest folder prefix
+func resolvePolicy(policies []config.UploadPolicy, folder string, defaultMaxSize int64) uploadPolicy {
+	var best *config.UploadPolicy
+	for i := range policies {
+		p := &policies[i]
+		prefix := strings.Trim(p.Folder, "/")
+		if prefix != "" && folder != prefix && !strings.HasPrefix(folder, prefix+"/") {
+			continue
+		}
+		if best == nil || len(prefix) > len(strings.Trim(best.Folder, "/")) {
+			best = p
+		}
+	}
+
+	policy := uploadPolicy{maxSize: defaultMaxSize, maxParts: maxPartNumber}
+	if best == nil {
+		return policy
+	}
+	policy.allowedTypes = best.AllowedTypes
+	if best.MaxSize > 0 {
+		policy.maxSize = best.MaxSize
+	}
+	if best.MaxParts > 0 && best.MaxParts < maxPartNumber {
+		policy.maxParts = best.MaxParts
+	}
+	return policy
+}
+
+// allows reports whether the media type matches an allowed type or wildcard
+func (p uploadPolicy) allows(contentType string) bool {
+	if len(p.allowedTypes) == 0 {
+		return true
+	}
+	mediaType := baseMediaType(contentType)
+	for _, allowed := range p.allowedTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*/*" || allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// check validates sniffed content against the policy and the filename extension
+func (p uploadPolicy) check(filename, contentType string, size int64) error {
+	if size > p.maxSize {
+		return ErrUploadTooLarge
+	}
+	if !p.allows(contentType) {
+		return fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, baseMediaType(contentType))
+	}
+	byExt := baseMediaType(mime.TypeByExtension(filepath.Ext(filename)))
+	if activeTypes[byExt] && byExt != baseMediaType(contentType) {
+		return fmt.Errorf("%w: extension %s does not match content", ErrFileTypeNotAllowed, filepath.Ext(filename))
+	}
+	return nil
+}
+
+// reservedFolders are top-level key prefixes managed by the services themselves
+var reservedFolders = map[string]bool{
+	privatePrefix:    true,
+	"quarantine":     true,
+	derivativePrefix: true,
+	"temp":           true,
+}
+
+// cleanFolder rejects absolute paths, traversal, unexpected characters and
+// reserved prefixes
+func cleanFolder(folder string) (string, error) {
+	folder = strings.TrimSuffix(folder, "/")
+	if len(folder) > 128 || !folderPattern.MatchString(folder) {
+		return "", ErrInvalidFolder
+	}
+	if reservedFolders[strings.SplitN(folder, "/", 2)[0]] {
+		return "", ErrInvalidFolder
+	}
+	return folder, nil
+}
+
+func baseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
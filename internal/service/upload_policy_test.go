@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"shop/internal/config"
+)
+
+func TestCleanFolder(t *testing.T) {
+	tests := []struct {
+		folder string
+		want   string
+		ok     bool
+	}{
+		{"products", "products", true},
+		{"blog/12/", "blog/12", true},
+		{"a-b_c/D9", "a-b_c/D9", true},
+		{"", "", false},
+		{"/products", "", false},
+		{"../products", "", false},
+		{"products/../private", "", false},
+		{"products//x", "", false},
+		{`products\x`, "", false},
+		{"products/x.y", "", false},
+		{"private/x", "", false},
+		{"quarantine", "", false},
+		{"derivatives/x", "", false},
+		{"temp", "", false},
+		{strings.Repeat("a", 129), "", false},
+	}
+	for _, tt := range tests {
+		got, err := cleanFolder(tt.folder)
+		if tt.ok != (err == nil) || got != tt.want {
+			t.Errorf("cleanFolder(%q) = %q, %v; want %q, ok %v", tt.folder, got, err, tt.want, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("cleanFolder(%q) error = %v, want ErrInvalidFolder", tt.folder, err)
+		}
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	policies := []config.UploadPolicy{
+		{Folder: "", AllowedTypes: []string{"image/*", "application/pdf"}, MaxSize: 100, MaxParts: 50},
+		{Folder: "blog/", AllowedTypes: []string{"image/jpeg"}, MaxSize: 10},
+		{Folder: "blog/drafts", MaxParts: 20000},
+	}
+	tests := []struct {
+		folder   string
+		types    []string
+		maxSize  int64
+		maxParts int
+	}{
+		{"products", []string{"image/*", "application/pdf"}, 100, 50},
+		{"blog", []string{"image/jpeg"}, 10, maxPartNumber},
+		{"blog/12", []string{"image/jpeg"}, 10, maxPartNumber},
+		{"blogs", []string{"image/*", "application/pdf"}, 100, 50}, // not below blog/
+		{"blog/drafts/1", nil, 1000, maxPartNumber},                // max_parts is capped
+	}
+	for _, tt := range tests {
+		got := resolvePolicy(policies, tt.folder, 1000)
+		if strings.Join(got.allowedTypes, ",") != strings.Join(tt.types, ",") || got.maxSize != tt.maxSize || got.maxParts != tt.maxParts {
+			t.Errorf("resolvePolicy(%q) = %+v, want types %v, size %d, parts %d", tt.folder, got, tt.types, tt.maxSize, tt.maxParts)
+		}
+	}
+
+	if got := resolvePolicy(nil, "products", 1000); got.allowedTypes != nil || got.maxSize != 1000 {
+		t.Errorf("without policies = %+v, want any type up to the default size", got)
+	}
+}
+
+func TestUploadPolicyCheck(t *testing.T) {
+	policy := uploadPolicy{allowedTypes: []string{"image/*", "text/plain"}, maxSize: 100, maxParts: 10}
+	tests := []struct {
+		filename    string
+		contentType string
+		size        int64
+		err         error
+	}{
+		{"photo.jpg", "image/jpeg", 100, nil},
+		{"notes.txt", "text/plain; charset=utf-8", 10, nil},
+		{"photo.jpg", "image/jpeg", 101, ErrUploadTooLarge},
+		{"doc.pdf", "application/pdf", 10, ErrFileTypeNotAllowed},
+		// The extension is not trusted: an HTML page stays HTML
+		{"photo.jpg", "text/html; charset=utf-8", 10, ErrFileTypeNotAllowed},
+		// ...and an extension browsers render must match the content
+		{"page.html", "text/plain; charset=utf-8", 10, ErrFileTypeNotAllowed},
+		{"logo.svg", "text/plain; charset=utf-8", 10, ErrFileTypeNotAllowed},
+		{"README", "text/plain; charset=utf-8", 10, nil},
+	}
+	for _, tt := range tests {
+		err := policy.check(tt.filename, tt.contentType, tt.size)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("check(%q, %q, %d) = %v, want %v", tt.filename, tt.contentType, tt.size, err, tt.err)
+		}
+	}
+
+	if !(uploadPolicy{}).allows("application/x-anything") {
+		t.Error("a policy without types rejected content")
+	}
+	if !(uploadPolicy{allowedTypes: []string{"*/*"}}).allows("video/mp4") {
+		t.Error("*/* rejected content")
+	}
+}
+
+func TestSniff(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 600)
+	tests := []struct {
+		body string
+		want string
+	}{
+		{png, "image/png"},
+		{"<!DOCTYPE html><html><body>hi</body></html>", "text/html; charset=utf-8"},
+		{"plain text", "text/plain; charset=utf-8"},
+		{"", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		contentType, r, err := sniff(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != tt.want {
+			t.Errorf("sniff(%.16q) = %q, want %q", tt.body, contentType, tt.want)
+		}
+		// Sniffing must not consume the content
+		if body, err := io.ReadAll(r); err != nil || string(body) != tt.body {
+			t.Errorf("sniff(%.16q) consumed the body: %d bytes left, %v", tt.body, len(body), err)
+		}
+	}
+}
@@ -11,16 +11,19 @@ import (
 
 type AsynqAdapter struct {
 	client *asynq.Client
+	mux    *asynq.ServeMux
 	logger *zap.Logger
 }
 
-func NewAsynqAdapter(cfg *config.Config, logger *zap.Logger) (Queue, error) {
+// NewAsynqAdapter publishes through an asynq client and subscribes by
+// registering handlers on mux, which the asynq server serves once started
+func NewAsynqAdapter(cfg *config.Config, logger *zap.Logger, mux *asynq.ServeMux) (Queue, error) {
 	client := asynq.NewClient(asynq.RedisClientOpt{
 		Addr:     cfg.Asynq.Addr,
 		Password: cfg.Asynq.Password,
 		DB:       cfg.Asynq.DB,
 	})
-	return &AsynqAdapter{client: client, logger: logger}, nil
+	return &AsynqAdapter{client: client, mux: mux, logger: logger}, nil
 }
 
 func (a *AsynqAdapter) Publish(ctx context.Context, topic string, payload []byte, options *PublishOptions) error {
@@ -34,10 +37,9 @@ func (a *AsynqAdapter) Publish(ctx context.Context, topic string, payload []byte
 }
 
 func (a *AsynqAdapter) Subscribe(topic string, handler func(ctx context.Context, payload []byte) error) error {
-	// Note: Asynq server handles subscription in a different way (Mux).
-	// This generic interface might need adjustment or the adapter needs to hold a reference to the Server Mux
-	// For simplicity, we assume this is called during setup to register handlers to a global/passed Mux
-	// Or we simply log that dynamic subscription isn't fully supported in this simplified adapter
-	a.logger.Warn("Subscribe called on AsynqAdapter - ensure handlers are registered with AsynqServer Mux")
+	// Handlers must be registered before the asynq server starts (see asynq.StartAsynqServer)
+	a.mux.HandleFunc(topic, func(ctx context.Context, t *asynq.Task) error {
+		return handler(ctx, t.Payload())
+	})
 	return nil
 }
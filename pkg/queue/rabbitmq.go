@@ -8,10 +8,14 @@ import (
 	"go.uber.org/zap"
 )
 
+// defaultPrefetch is the RabbitMQ prefetch when rabbitmq.prefetch is unset
+const defaultPrefetch = 32
+
 type RabbitMQAdapter struct {
-	conn   *amqp.Connection
-	ch     *amqp.Channel
-	logger *zap.Logger
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	prefetch int
+	logger   *zap.Logger
 }
 
 func NewRabbitMQAdapter(cfg *config.Config, logger *zap.Logger) (Queue, error) {
@@ -23,7 +27,11 @@ func NewRabbitMQAdapter(cfg *config.Config, logger *zap.Logger) (Queue, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &RabbitMQAdapter{conn: conn, ch: ch, logger: logger}, nil
+	prefetch := cfg.RabbitMQ.Prefetch
+	if prefetch <= 0 {
+		prefetch = defaultPrefetch
+	}
+	return &RabbitMQAdapter{conn: conn, ch: ch, prefetch: prefetch, logger: logger}, nil
 }
 
 func (r *RabbitMQAdapter) Publish(ctx context.Context, topic string, payload []byte, options *PublishOptions) error {
@@ -52,11 +60,26 @@ func (r *RabbitMQAdapter) Publish(ctx context.Context, topic string, payload []b
 	return err
 }
 
+// Subscribe consumes topic on a channel of its own, handling up to prefetch
+// deliveries concurrently. A delivery is acknowledged once its handler
+// succeeds; a failed one is requeued once and dropped when it fails again
 func (r *RabbitMQAdapter) Subscribe(topic string, handler func(ctx context.Context, payload []byte) error) error {
-	msgs, err := r.ch.Consume(
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Qos(r.prefetch, 0, false); err != nil {
+		return err
+	}
+	// Declare the queue as Publish does, consuming from a missing queue fails
+	if _, err := ch.QueueDeclare(topic, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	msgs, err := ch.Consume(
 		topic, // queue
 		"",    // consumer
-		true,  // auto-ack
+		false, // auto-ack
 		false, // exclusive
 		false, // no-local
 		false, // no-wait
@@ -66,10 +89,26 @@ func (r *RabbitMQAdapter) Subscribe(topic string, handler func(ctx context.Conte
 		return err
 	}
 
-	go func() {
-		for d := range msgs {
-			handler(context.Background(), d.Body)
-		}
-	}()
+	for i := 0; i < r.prefetch; i++ {
+		go func() {
+			for d := range msgs {
+				r.handle(topic, d, handler)
+			}
+		}()
+	}
 	return nil
 }
+
+func (r *RabbitMQAdapter) handle(topic string, d amqp.Delivery, handler func(ctx context.Context, payload []byte) error) {
+	if err := handler(context.Background(), d.Body); err != nil {
+		requeue := !d.Redelivered
+		r.logger.Error("Failed to handle message", zap.String("topic", topic), zap.Bool("requeue", requeue), zap.Error(err))
+		if err := d.Nack(false, requeue); err != nil {
+			r.logger.Error("Failed to nack message", zap.String("topic", topic), zap.Error(err))
+		}
+		return
+	}
+	if err := d.Ack(false); err != nil {
+		r.logger.Error("Failed to ack message", zap.String("topic", topic), zap.Error(err))
+	}
+}
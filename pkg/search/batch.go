@@ -0,0 +1,89 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxBatchSize is how many documents one request to the engine carries;
+// larger batches are split
+const MaxBatchSize = 1000
+
+// ErrEmptyFilter guards DeleteByFilter against wiping an index with a nil filter
+var ErrEmptyFilter = errors.New("delete by filter requires a filter")
+
+// Document is one item of IndexBatch
+type Document struct {
+	ID  string
+	Doc interface{}
+}
+
+// WriteOptions tune batch writes; nil means the defaults
+type WriteOptions struct {
+	// Wait returns once the writes are visible to searches: Meilisearch tasks
+	// are awaited and Elasticsearch refreshes. Without it writes are
+	// accepted but may become searchable later, or fail later on Meilisearch.
+	Wait bool
+}
+
+func (o *WriteOptions) wait() bool {
+	return o != nil && o.Wait
+}
+
+// ItemError is the failure of one document of a batch write
+type ItemError struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// BatchError lists the documents a batch write failed for; the other
+// documents were written. Retrieve it with errors.As.
+type BatchError struct {
+	Items []ItemError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Items) == 1 {
+		return fmt.Sprintf("search: document %s failed: %s", e.Items[0].ID, e.Items[0].Reason)
+	}
+	return fmt.Sprintf("search: %d documents failed, first %s: %s", len(e.Items), e.Items[0].ID, e.Items[0].Reason)
+}
+
+// itemErrors collects item failures once per document, since dual writes
+// during a rebuild may fail the same document in two indexes
+type itemErrors struct {
+	items []ItemError
+	seen  map[string]bool
+}
+
+func (e *itemErrors) add(id, reason string) {
+	if e.seen == nil {
+		e.seen = map[string]bool{}
+	}
+	if e.seen[id] {
+		return
+	}
+	e.seen[id] = true
+	e.items = append(e.items, ItemError{ID: id, Reason: reason})
+}
+
+// err returns a *BatchError, or nil when every item succeeded
+func (e *itemErrors) err() error {
+	if len(e.items) == 0 {
+		return nil
+	}
+	return &BatchError{Items: e.items}
+}
+
+// chunks splits n items into [start, end) ranges of at most MaxBatchSize
+func chunks(n int) [][2]int {
+	var ranges [][2]int
+	for start := 0; start < n; start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > n {
+			end = n
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChunks(t *testing.T) {
+	tests := []struct {
+		n    int
+		want [][2]int
+	}{
+		{0, nil},
+		{1, [][2]int{{0, 1}}},
+		{MaxBatchSize, [][2]int{{0, MaxBatchSize}}},
+		{2*MaxBatchSize + 1, [][2]int{{0, MaxBatchSize}, {MaxBatchSize, 2 * MaxBatchSize}, {2 * MaxBatchSize, 2*MaxBatchSize + 1}}},
+	}
+	for _, tt := range tests {
+		if got := chunks(tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("chunks(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestItemErrors(t *testing.T) {
+	var e itemErrors
+	if e.err() != nil {
+		t.Fatal("no failures reported an error")
+	}
+	// A document failing in both indexes during a rebuild counts once
+	e.add("1", "mapper_parsing_exception")
+	e.add("2", "version_conflict")
+	e.add("1", "mapper_parsing_exception")
+
+	var batchErr *BatchError
+	if !errors.As(e.err(), &batchErr) {
+		t.Fatalf("err() = %v, want a *BatchError", e.err())
+	}
+	want := []ItemError{{"1", "mapper_parsing_exception"}, {"2", "version_conflict"}}
+	if !reflect.DeepEqual(batchErr.Items, want) {
+		t.Errorf("items = %v, want %v", batchErr.Items, want)
+	}
+	if got := batchErr.Error(); got != "search: 2 documents failed, first 1: mapper_parsing_exception" {
+		t.Errorf("Error() = %q", got)
+	}
+}
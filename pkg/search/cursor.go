@@ -0,0 +1,121 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidCursor reports a cursor that is malformed or belongs to another
+// search
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+// cursor is the state behind SearchResult.NextCursor. Position counts the hits
+// before the next page; After holds the sort values of the last hit, which
+// engines that page by search_after or by filter continue from.
+type cursor struct {
+	Key      string            `json:"k"`
+	Position int               `json:"p"`
+	After    []json.RawMessage `json:"a,omitempty"`
+}
+
+// NewCursor returns a cursor that continues a search at opts.Offset, for
+// callers that show results of their own before the engine's
+func NewCursor(query string, options *SearchOptions) string {
+	var opts SearchOptions
+	if options != nil {
+		opts = *options
+	}
+	return cursor{Key: cursorKey(query, opts), Position: opts.Offset}.encode()
+}
+
+// CursorOffset returns the offset opts.Cursor continues query at, when it
+// is a cursor of query and opts that pages by offset, as NewCursor's do
+func CursorOffset(query string, options *SearchOptions) (int, error) {
+	var opts SearchOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.Cursor == "" {
+		return 0, ErrInvalidCursor
+	}
+	c, err := startCursor(query, opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(c.After) > 0 {
+		return 0, ErrInvalidCursor
+	}
+	return c.Position, nil
+}
+
+// cursorKey ties a cursor to the query, filter and sort it pages through
+func cursorKey(query string, opts SearchOptions) string {
+	return hashJSON(struct {
+		Query  string
+		Filter string
+		Sort   []SortField
+	}{query, fmt.Sprintf("%#v", opts.Filter), opts.Sort})
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// startCursor decodes opts.Cursor for query; a search without one starts at
+// opts.Offset
+func startCursor(query string, opts SearchOptions) (cursor, error) {
+	key := cursorKey(query, opts)
+	if opts.Cursor == "" {
+		return cursor{Key: key, Position: opts.Offset}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Key != key || c.Position < 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// next is the cursor after a page of n hits ending with the sort values
+// after, or "" when no more hits follow
+func (c cursor) next(n int, more bool, after []json.RawMessage) string {
+	if n == 0 || !more {
+		return ""
+	}
+	return cursor{Key: c.Key, Position: c.Position + n, After: after}.encode()
+}
+
+// remaining reports whether hits follow a page of n hits out of total
+func (c cursor) remaining(n int, total int64) bool {
+	return int64(c.Position+n) < total
+}
+
+// cursorValue decodes a sort value of a cursor into a filter value; only
+// numbers and strings can be compared
+func cursorValue(raw json.RawMessage) (interface{}, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case json.Number:
+		if i, err := strconv.ParseInt(val.String(), 10, 64); err == nil {
+			return i, true
+		}
+		f, err := val.Float64()
+		return f, err == nil
+	}
+	return nil, false
+}
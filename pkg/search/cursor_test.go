@@ -0,0 +1,92 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCursorOffset(t *testing.T) {
+	opts := SearchOptions{Filter: Eq("shop_id", 1), Sort: []SortField{Asc("price")}, Offset: 40}
+	opts.Cursor = NewCursor("shoe", &opts)
+	offset, err := CursorOffset("shoe", &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 40 {
+		t.Errorf("offset = %d, want 40", offset)
+	}
+
+	// Cursors are bound to the query, filter and sort they page through
+	others := map[string]func(o *SearchOptions) string{
+		"query":  func(o *SearchOptions) string { return "boot" },
+		"filter": func(o *SearchOptions) string { o.Filter = Eq("shop_id", 2); return "shoe" },
+		"sort":   func(o *SearchOptions) string { o.Sort = nil; return "shoe" },
+	}
+	for name, change := range others {
+		other := opts
+		query := change(&other)
+		if _, err := CursorOffset(query, &other); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("other %s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+
+	for _, bad := range []string{"", "!!!", "bm90LWpzb24"} {
+		other := opts
+		other.Cursor = bad
+		if _, err := CursorOffset("shoe", &other); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: got %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestCursorNext(t *testing.T) {
+	opts := SearchOptions{Sort: []SortField{Desc("price")}}
+	start, err := startCursor("", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !start.remaining(20, 21) || start.remaining(20, 20) {
+		t.Error("remaining miscounts the last page")
+	}
+	if next := start.next(0, true, nil); next != "" {
+		t.Errorf("empty page has next cursor %q", next)
+	}
+	if next := start.next(20, false, nil); next != "" {
+		t.Errorf("last page has next cursor %q", next)
+	}
+
+	// A search_after cursor continues by sort values, not by offset
+	opts.Cursor = start.next(20, true, []json.RawMessage{json.RawMessage(`99.5`), json.RawMessage(`"17"`)})
+	c, err := startCursor("", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Position != 20 || len(c.After) != 2 {
+		t.Errorf("decoded cursor = %+v", c)
+	}
+	if _, err := CursorOffset("", &opts); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("offset of a search_after cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestCursorValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want interface{}
+		ok   bool
+	}{
+		{`12`, int64(12), true},
+		{`12.5`, 12.5, true},
+		{`"abc"`, "abc", true},
+		{`true`, nil, false},
+		{`null`, nil, false},
+		{`{`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := cursorValue(json.RawMessage(tt.raw))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cursorValue(%s) = %v, %v; want %v, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
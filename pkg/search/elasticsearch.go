@@ -4,22 +4,39 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"shop/internal/config"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"go.uber.org/zap"
 )
 
+const (
+	// esFragmentSize and esFragments shape highlighted snippets, in characters
+	esFragmentSize = 150
+	esFragments    = 3
+)
+
 type ESAdapter struct {
-	client *elasticsearch.Client
-	logger *zap.Logger
+	client      *elasticsearch.Client
+	logger      *zap.Logger
+	primaryKeys sync.Map // index name -> primary key, registered by EnsureIndex
+	reindex     reindexTargets
 }
 
+// NewESAdapter connects to Elasticsearch; requests are retried by
+// RetryTransport rather than by the client, whose retries do not back off
 func NewESAdapter(cfg *config.Config, logger *zap.Logger) (Engine, error) {
 	es, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: cfg.Elasticsearch.Addresses,
-		Username:  cfg.Elasticsearch.Username,
-		Password:  cfg.Elasticsearch.Password,
+		Addresses:    cfg.Elasticsearch.Addresses,
+		Username:     cfg.Elasticsearch.Username,
+		Password:     cfg.Elasticsearch.Password,
+		Transport:    &RetryTransport{},
+		DisableRetry: true,
 	})
 	if err != nil {
 		return nil, err
@@ -32,58 +49,382 @@ func (e *ESAdapter) Index(ctx context.Context, indexName string, docID string, d
 	if err != nil {
 		return err
 	}
-	_, err = e.client.Index(indexName, bytes.NewReader(data), e.client.Index.WithDocumentID(docID))
-	return err
+	for _, index := range e.reindex.indexes(indexName) {
+		err := esDo(e.client.Index(index, bytes.NewReader(data),
+			e.client.Index.WithDocumentID(docID), e.client.Index.WithContext(ctx)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (e *ESAdapter) Delete(ctx context.Context, indexName string, docID string) error {
-	_, err := e.client.Delete(indexName, docID)
-	return err
+	for _, index := range e.reindex.indexes(indexName) {
+		res, err := e.client.Delete(index, docID, e.client.Delete.WithContext(ctx))
+		if err == nil && res.StatusCode == http.StatusNotFound {
+			// Already gone
+			res.Body.Close()
+			continue
+		}
+		if err := esDo(res, err); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// Search sorts ties by the primary key so every hit has unique sort values,
+// which cursors continue from with search_after
 func (e *ESAdapter) Search(ctx context.Context, indexName string, query string, options *SearchOptions) (*SearchResult, error) {
-	// Simplified ES search query
-	var buf bytes.Buffer
-	searchQuery := map[string]interface{}{
-		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query": query,
-			},
-		},
-		"from": options.Offset,
-		"size": options.Limit,
+	opts, err := normalize(options)
+	if err != nil {
+		return nil, err
+	}
+	start, err := startCursor(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	searchQuery, err := esSearchBody(query, &opts, start, e.primaryKey(indexName))
+	if err != nil {
+		return nil, err
 	}
+	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
 		return nil, err
 	}
 
 	res, err := e.client.Search(
+		e.client.Search.WithContext(ctx),
 		e.client.Search.WithIndex(indexName),
 		e.client.Search.WithBody(&buf),
 	)
-	if err != nil {
+	var r esSearchResponse
+	if err := ESDecode(res, err, &r); err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+	result := &SearchResult{
+		Hits:  make([]Hit, len(r.Hits.Hits)),
+		Total: r.Hits.Total.Value,
+	}
+	for i, hit := range r.Hits.Hits {
+		result.Hits[i] = Hit{ID: hit.ID, Source: hit.Source, Highlights: highlights(hit.Highlight)}
+		if hit.Score != nil {
+			result.Hits[i].Score = *hit.Score
+		}
+	}
+	if n := len(r.Hits.Hits); n > 0 {
+		// A total of relation gte stopped counting at track_total_hits
+		more := r.Hits.Total.Relation == "gte" || start.remaining(n, r.Hits.Total.Value)
+		result.NextCursor = start.next(n, more, r.Hits.Hits[n-1].Sort)
+	}
+	if len(opts.Facets) > 0 {
+		result.Facets = make(map[string][]FacetValue, len(opts.Facets))
+		for _, f := range opts.Facets {
+			agg := r.Aggregations[f.Field]
+			values := make([]FacetValue, len(agg.Buckets))
+			for i, b := range agg.Buckets {
+				values[i] = FacetValue{Value: b.value(), Count: b.DocCount}
+			}
+			result.Facets[f.Field] = values
+		}
+	}
+	return result, nil
+}
+
+type esSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value    int64  `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Hits []struct {
+			ID        string              `json:"_id"`
+			Score     *float64            `json:"_score"`
+			Source    json.RawMessage     `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+			Sort      []json.RawMessage   `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]struct {
+		Buckets []esBucket `json:"buckets"`
+	} `json:"aggregations"`
+}
+
+type esBucket struct {
+	Key         interface{} `json:"key"`
+	KeyAsString string      `json:"key_as_string"`
+	DocCount    int64       `json:"doc_count"`
+}
+
+// value prints a bucket key the way Meilisearch prints facet values
+func (b esBucket) value() string {
+	if b.KeyAsString != "" {
+		return b.KeyAsString
+	}
+	switch key := b.Key.(type) {
+	case string:
+		return key
+	case float64:
+		return strconv.FormatFloat(key, 'f', -1, 64)
+	}
+	return fmt.Sprint(b.Key)
+}
+
+// esSearchBody builds the request body: the text query scores documents while
+// the filter runs in filter context, so it neither affects scores nor runs
+// when the text query is empty (match_all). The page starts at start,
+// continuing after its sort values when it has them.
+func esSearchBody(query string, options *SearchOptions, start cursor, primaryKey string) (map[string]interface{}, error) {
+	opts, err := normalize(options)
+	if err != nil {
 		return nil, err
 	}
 
-	// Parse hits... this is a simplified example
-	hits := r["hits"].(map[string]interface{})
-	total := hits["total"].(map[string]interface{})["value"].(float64)
-	hitsList := hits["hits"].([]interface{})
+	match := map[string]interface{}{"match_all": map[string]interface{}{}}
+	if strings.TrimSpace(query) != "" {
+		match = map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query": query,
+			},
+		}
+	}
+	boolQuery := map[string]interface{}{"must": match}
+	if opts.Filter != nil {
+		filter, err := esFilter(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		boolQuery["filter"] = filter
+	}
 
-	var results []interface{}
-	for _, hit := range hitsList {
-		source := hit.(map[string]interface{})["_source"]
-		results = append(results, source)
+	body := map[string]interface{}{
+		"query": map[string]interface{}{"bool": boolQuery},
+		"size":  opts.Limit,
+	}
+	if len(start.After) > 0 {
+		body["search_after"] = start.After
+	} else {
+		body["from"] = start.Position
 	}
+	if len(opts.Facets) > 0 {
+		aggs := make(map[string]interface{}, len(opts.Facets))
+		for _, f := range opts.Facets {
+			aggs[f.Field] = esAggregation(f)
+		}
+		body["aggs"] = aggs
+	}
+	if len(opts.Highlight) > 0 {
+		fields := make(map[string]interface{}, len(opts.Highlight))
+		for _, field := range opts.Highlight {
+			fields[field] = map[string]interface{}{}
+		}
+		body["highlight"] = map[string]interface{}{
+			"pre_tags":            []string{highlightPre},
+			"post_tags":           []string{highlightPost},
+			"fragment_size":       esFragmentSize,
+			"number_of_fragments": esFragments,
+			"fields":              fields,
+		}
+	}
+
+	sort := make([]interface{}, 0, len(opts.Sort)+2)
+	for _, s := range opts.Sort {
+		order := "asc"
+		if s.Desc {
+			order = "desc"
+		}
+		sort = append(sort, map[string]interface{}{s.Field: map[string]interface{}{"order": order}})
+	}
+	// Ties keep relevance order, as in Meilisearch, then the primary key
+	// makes the order total; indexes created before it was mapped as a
+	// keyword sort it as missing
+	body["sort"] = append(sort, "_score", map[string]interface{}{
+		primaryKey: map[string]interface{}{"order": "asc", "unmapped_type": "keyword"},
+	})
+	if len(opts.Sort) > 0 {
+		// Hits sorted by a field carry no score unless asked for
+		body["track_scores"] = true
+	}
+	return body, nil
+}
+
+// esAggregation counts a facet: a terms aggregation for values, a range
+// aggregation (from inclusive, to exclusive) for buckets
+func esAggregation(f Facet) map[string]interface{} {
+	if len(f.Ranges) == 0 {
+		size := f.Size
+		if size <= 0 {
+			size = DefaultFacetSize
+		}
+		return map[string]interface{}{"terms": map[string]interface{}{"field": f.Field, "size": size}}
+	}
+	ranges := make([]interface{}, len(f.Ranges))
+	for i, r := range f.Ranges {
+		bucket := map[string]interface{}{"key": r.key()}
+		if r.From != nil {
+			bucket["from"] = *r.From
+		}
+		if r.To != nil {
+			bucket["to"] = *r.To
+		}
+		ranges[i] = bucket
+	}
+	return map[string]interface{}{"range": map[string]interface{}{"field": f.Field, "ranges": ranges}}
+}
+
+// esFilter translates a filter into query DSL clauses
+func esFilter(f Filter) (map[string]interface{}, error) {
+	switch f := f.(type) {
+	case EqFilter:
+		if err := checkField(f.Field); err != nil {
+			return nil, err
+		}
+		value, err := scalar(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"term": map[string]interface{}{f.Field: value}}, nil
+	case InFilter:
+		if err := checkField(f.Field); err != nil {
+			return nil, err
+		}
+		if len(f.Values) == 0 {
+			return nil, fmt.Errorf("%w: in on %q has no values", ErrInvalidFilter, f.Field)
+		}
+		values := make([]interface{}, len(f.Values))
+		for i, v := range f.Values {
+			value, err := scalar(v)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return map[string]interface{}{"terms": map[string]interface{}{f.Field: values}}, nil
+	case RangeFilter:
+		if err := checkField(f.Field); err != nil {
+			return nil, err
+		}
+		bounds, err := rangeBounds(f)
+		if err != nil {
+			return nil, err
+		}
+		clause := map[string]interface{}{}
+		for _, b := range bounds {
+			clause[b.op] = b.value
+		}
+		return map[string]interface{}{"range": map[string]interface{}{f.Field: clause}}, nil
+	case ExistsFilter:
+		if err := checkField(f.Field); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"exists": map[string]interface{}{"field": f.Field}}, nil
+	case AndFilter:
+		clauses, err := esClauses(f.Filters, "and")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"filter": clauses}}, nil
+	case OrFilter:
+		clauses, err := esClauses(f.Filters, "or")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"should": clauses, "minimum_should_match": 1}}, nil
+	case NotFilter:
+		if f.Filter == nil {
+			return nil, fmt.Errorf("%w: not without operand", ErrInvalidFilter)
+		}
+		inner, err := esFilter(f.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": inner}}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported filter %T", ErrInvalidFilter, f)
+}
+
+func esClauses(filters []Filter, op string) ([]interface{}, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("%w: %s without operands", ErrInvalidFilter, op)
+	}
+	clauses := make([]interface{}, len(filters))
+	for i, f := range filters {
+		if f == nil {
+			return nil, fmt.Errorf("%w: nil operand", ErrInvalidFilter)
+		}
+		clause, err := esFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		clauses[i] = clause
+	}
+	return clauses, nil
+}
 
-	return &SearchResult{
-		Hits:  results,
-		Total: int64(total),
-	}, nil
+// Suggest runs a bool_prefix multi_match: the last word matches as a prefix
+// and the others fuzzily. The completion suggester would be faster, but it
+// cannot apply arbitrary filters such as the shop a suggestion belongs to.
+func (e *ESAdapter) Suggest(ctx context.Context, indexName string, prefix string, options *SuggestOptions) ([]Suggestion, error) {
+	opts, err := normalizeSuggest(options)
+	if err != nil {
+		return nil, err
+	}
+	boolQuery := map[string]interface{}{
+		"must": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":     prefix,
+				"type":      "bool_prefix",
+				"fields":    []string{opts.Field},
+				"fuzziness": "AUTO",
+			},
+		},
+	}
+	if opts.Filter != nil {
+		filter, err := esFilter(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		boolQuery["filter"] = filter
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"size":    opts.Limit * 2, // extra hits make up for duplicate texts
+		"_source": []string{opts.Field},
+		"query":   map[string]interface{}{"bool": boolQuery},
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{highlightPre},
+			"post_tags": []string{highlightPost},
+			"fields":    map[string]interface{}{opts.Field: map[string]interface{}{"number_of_fragments": 0}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Hits struct {
+			Hits []struct {
+				ID        string                 `json:"_id"`
+				Source    map[string]interface{} `json:"_source"`
+				Highlight map[string][]string    `json:"highlight"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	res, err := e.client.Search(
+		e.client.Search.WithContext(ctx),
+		e.client.Search.WithIndex(indexName),
+		e.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err := ESDecode(res, err, &r); err != nil {
+		return nil, err
+	}
+	result := suggestions{limit: opts.Limit}
+	for _, hit := range r.Hits.Hits {
+		result.add(hit.ID, sourceText(hit.Source, opts.Field), strings.Join(hit.Highlight[opts.Field], " "))
+		if result.full() {
+			break
+		}
+	}
+	return result.items, nil
 }
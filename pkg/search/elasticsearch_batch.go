@@ -0,0 +1,152 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// esBulkResponse holds the per-item results of a _bulk request, in request
+// order, each keyed by its action
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// IndexBatch writes documents with the _bulk API, up to MaxBatchSize per
+// request; documents ES rejects (a mapping conflict, say) are reported one
+// by one
+func (e *ESAdapter) IndexBatch(ctx context.Context, indexName string, docs []Document, opts *WriteOptions) error {
+	var failed itemErrors
+	sources := make([][]byte, 0, len(docs))
+	ids := make([]string, 0, len(docs))
+	for _, d := range docs {
+		data, err := json.Marshal(d.Doc)
+		if err != nil {
+			failed.add(d.ID, err.Error())
+			continue
+		}
+		sources = append(sources, data)
+		ids = append(ids, d.ID)
+	}
+
+	for _, r := range chunks(len(ids)) {
+		var body bytes.Buffer
+		for _, index := range e.reindex.indexes(indexName) {
+			for i := r[0]; i < r[1]; i++ {
+				if err := esBulkAction(&body, "index", index, ids[i]); err != nil {
+					return err
+				}
+				body.Write(sources[i])
+				body.WriteByte('\n')
+			}
+		}
+		if err := e.bulk(ctx, &body, opts, &failed); err != nil {
+			return err
+		}
+	}
+	return failed.err()
+}
+
+func (e *ESAdapter) DeleteBatch(ctx context.Context, indexName string, docIDs []string, opts *WriteOptions) error {
+	var failed itemErrors
+	for _, r := range chunks(len(docIDs)) {
+		var body bytes.Buffer
+		for _, index := range e.reindex.indexes(indexName) {
+			for _, id := range docIDs[r[0]:r[1]] {
+				if err := esBulkAction(&body, "delete", index, id); err != nil {
+					return err
+				}
+			}
+		}
+		if err := e.bulk(ctx, &body, opts, &failed); err != nil {
+			return err
+		}
+	}
+	return failed.err()
+}
+
+// DeleteByFilter runs _delete_by_query on the index and any rebuild target;
+// documents changed while it runs are left alone rather than failing it
+func (e *ESAdapter) DeleteByFilter(ctx context.Context, indexName string, filter Filter, opts *WriteOptions) error {
+	if filter == nil {
+		return ErrEmptyFilter
+	}
+	clause, err := esFilter(filter)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": clause}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var r struct {
+		Failures []json.RawMessage `json:"failures"`
+	}
+	res, err := e.client.DeleteByQuery(e.reindex.indexes(indexName), bytes.NewReader(body),
+		e.client.DeleteByQuery.WithConflicts("proceed"),
+		e.client.DeleteByQuery.WithRefresh(opts.wait()),
+		e.client.DeleteByQuery.WithContext(ctx),
+	)
+	if err := ESDecode(res, err, &r); err != nil {
+		return err
+	}
+	if len(r.Failures) > 0 {
+		return fmt.Errorf("elasticsearch: delete by query: %d failures, first: %s", len(r.Failures), r.Failures[0])
+	}
+	return nil
+}
+
+// bulk sends one _bulk body and records the failed items. Deleting a
+// missing document is a 404 without an error, so it is not recorded.
+func (e *ESAdapter) bulk(ctx context.Context, body *bytes.Buffer, opts *WriteOptions, failed *itemErrors) error {
+	if body.Len() == 0 {
+		return nil
+	}
+	refresh := "false"
+	if opts.wait() {
+		refresh = "wait_for"
+	}
+	var r esBulkResponse
+	res, err := e.client.Bulk(body,
+		e.client.Bulk.WithRefresh(refresh),
+		e.client.Bulk.WithContext(ctx),
+	)
+	if err := ESDecode(res, err, &r); err != nil {
+		return err
+	}
+	if !r.Errors {
+		return nil
+	}
+	for _, item := range r.Items {
+		for action, result := range item {
+			if result.Error != nil {
+				failed.add(result.ID, fmt.Sprintf("%s: %s: %s", action, result.Error.Type, result.Error.Reason))
+			}
+		}
+	}
+	return nil
+}
+
+func esBulkAction(body *bytes.Buffer, action, index, id string) error {
+	line, err := json.Marshal(map[string]interface{}{
+		action: map[string]string{"_index": index, "_id": id},
+	})
+	if err != nil {
+		return err
+	}
+	body.Write(line)
+	body.WriteByte('\n')
+	return nil
+}
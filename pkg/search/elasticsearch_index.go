@@ -0,0 +1,363 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Analyzers of text fields; synonym_graph only works at search time
+const (
+	esTextAnalyzer   = "shop_text"
+	esSearchAnalyzer = "shop_search"
+)
+
+// EnsureIndex creates a versioned index behind an alias named def.Name. The
+// definition hash is stored in the mapping's _meta, so an unchanged
+// definition costs one request; new fields are added in place, while
+// analysis and type changes return ErrReindexRequired.
+func (e *ESAdapter) EnsureIndex(ctx context.Context, def IndexDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	e.primaryKeys.Store(def.Name, def.primaryKey())
+	indexes, _, err := e.resolve(ctx, def.Name)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		return e.createIndex(ctx, versionedName(def.Name), def, def.Name)
+	}
+
+	for _, index := range indexes {
+		var mapping map[string]struct {
+			Mappings struct {
+				Meta map[string]string `json:"_meta"`
+			} `json:"mappings"`
+		}
+		res, err := e.client.Indices.GetMapping(
+			e.client.Indices.GetMapping.WithIndex(index),
+			e.client.Indices.GetMapping.WithContext(ctx),
+		)
+		if err := ESDecode(res, err, &mapping); err != nil {
+			return err
+		}
+		meta := mapping[index].Mappings.Meta
+		if meta["definition"] == def.Hash() {
+			continue
+		}
+		if meta["analysis"] != def.analysisHash() {
+			return fmt.Errorf("%w: analysis of %s changed", ErrReindexRequired, index)
+		}
+
+		body, err := json.Marshal(esMappings(def))
+		if err != nil {
+			return err
+		}
+		res, err = e.client.Indices.PutMapping([]string{index}, bytes.NewReader(body), e.client.Indices.PutMapping.WithContext(ctx))
+		if err == nil && res.StatusCode == http.StatusBadRequest {
+			// A field changed type
+			defer res.Body.Close()
+			return fmt.Errorf("%w: %v", ErrReindexRequired, esError(res))
+		}
+		if err := esDo(res, err); err != nil {
+			return err
+		}
+		settings, err := json.Marshal(map[string]interface{}{"index": esIndexSettings(def)})
+		if err != nil {
+			return err
+		}
+		err = esDo(e.client.Indices.PutSettings(bytes.NewReader(settings),
+			e.client.Indices.PutSettings.WithIndex(index),
+			e.client.Indices.PutSettings.WithContext(ctx),
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reindex fills a new versioned index, then moves the alias to it and drops
+// the old index in one atomic _aliases call. An index created before aliases
+// were used, with the alias's name, is replaced the same way.
+func (e *ESAdapter) Reindex(ctx context.Context, def IndexDefinition, fill func(ctx context.Context, target string) error) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	e.primaryKeys.Store(def.Name, def.primaryKey())
+	target := versionedName(def.Name)
+	if err := e.createIndex(ctx, target, def, ""); err != nil {
+		return err
+	}
+
+	e.reindex.set(def.Name, target)
+	defer e.reindex.clear(def.Name)
+	if err := fill(ctx, target); err != nil {
+		if cleanupErr := e.deleteIndexes(context.Background(), []string{target}); cleanupErr != nil {
+			return errors.Join(err, cleanupErr)
+		}
+		return err
+	}
+	err := esDo(e.client.Indices.Refresh(
+		e.client.Indices.Refresh.WithIndex(target),
+		e.client.Indices.Refresh.WithContext(ctx),
+	))
+	if err != nil {
+		return err
+	}
+
+	indexes, concrete, err := e.resolve(ctx, def.Name)
+	if err != nil {
+		return err
+	}
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]interface{}{"index": target, "alias": def.Name}},
+	}
+	if concrete {
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": def.Name}})
+	} else {
+		for _, index := range indexes {
+			actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": index, "alias": def.Name}})
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	if err := esDo(e.client.Indices.UpdateAliases(bytes.NewReader(body), e.client.Indices.UpdateAliases.WithContext(ctx))); err != nil {
+		return err
+	}
+	if concrete {
+		return nil
+	}
+	return e.deleteIndexes(ctx, indexes)
+}
+
+// resolve returns the indexes behind the alias name, or name itself when it
+// is a concrete index; neither yields no indexes
+func (e *ESAdapter) resolve(ctx context.Context, name string) ([]string, bool, error) {
+	res, err := e.client.Indices.GetAlias(
+		e.client.Indices.GetAlias.WithName(name),
+		e.client.Indices.GetAlias.WithContext(ctx),
+	)
+	if err == nil && res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		exists, err := e.client.Indices.Exists([]string{name}, e.client.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			return nil, false, unreachable("elasticsearch", err)
+		}
+		defer exists.Body.Close()
+		switch exists.StatusCode {
+		case http.StatusOK:
+			return []string{name}, true, nil
+		case http.StatusNotFound:
+			return nil, false, nil
+		}
+		return nil, false, esError(exists)
+	}
+
+	var aliases map[string]json.RawMessage
+	if err := ESDecode(res, err, &aliases); err != nil {
+		return nil, false, err
+	}
+	indexes := make([]string, 0, len(aliases))
+	for index := range aliases {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	return indexes, false, nil
+}
+
+func (e *ESAdapter) createIndex(ctx context.Context, index string, def IndexDefinition, alias string) error {
+	body := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"index":    esIndexSettings(def),
+			"analysis": esAnalysis(def),
+		},
+		"mappings": esMappings(def),
+	}
+	if alias != "" {
+		body["aliases"] = map[string]interface{}{alias: map[string]interface{}{}}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return esDo(e.client.Indices.Create(index,
+		e.client.Indices.Create.WithBody(bytes.NewReader(data)),
+		e.client.Indices.Create.WithContext(ctx),
+	))
+}
+
+func (e *ESAdapter) deleteIndexes(ctx context.Context, indexes []string) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	return esDo(e.client.Indices.Delete(indexes,
+		e.client.Indices.Delete.WithIgnoreUnavailable(true),
+		e.client.Indices.Delete.WithContext(ctx),
+	))
+}
+
+// versionedName names a physical index; millisecond versions sort in
+// creation order
+func versionedName(name string) string {
+	return name + "_v" + strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+// esIndexSettings holds the dynamic settings: unqualified multi_match
+// queries search the searchable attributes
+func esIndexSettings(def IndexDefinition) map[string]interface{} {
+	fields := def.Searchable
+	if len(fields) == 0 {
+		fields = []string{"*"}
+	}
+	return map[string]interface{}{"query": map[string]interface{}{"default_field": fields}}
+}
+
+func esAnalysis(def IndexDefinition) map[string]interface{} {
+	c := def.canonical()
+	filters := map[string]interface{}{}
+	textFilters := []string{"lowercase", "asciifolding"}
+	if len(c.StopWords) > 0 {
+		filters["shop_stop"] = map[string]interface{}{"type": "stop", "stopwords": c.StopWords}
+		textFilters = append(textFilters, "shop_stop")
+	}
+	searchFilters := append([]string{}, textFilters...)
+	if len(c.Synonyms) > 0 {
+		words := make([]string, 0, len(c.Synonyms))
+		for word := range c.Synonyms {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+		rules := make([]string, len(words))
+		for i, word := range words {
+			// Keep the word itself, like Meilisearch's one-way synonyms
+			rules[i] = word + " => " + strings.Join(append([]string{word}, c.Synonyms[word]...), ", ")
+		}
+		filters["shop_synonyms"] = map[string]interface{}{"type": "synonym_graph", "synonyms": rules}
+		searchFilters = append(searchFilters, "shop_synonyms")
+	}
+	return map[string]interface{}{
+		"filter": filters,
+		"analyzer": map[string]interface{}{
+			esTextAnalyzer:   map[string]interface{}{"type": "custom", "tokenizer": "standard", "filter": textFilters},
+			esSearchAnalyzer: map[string]interface{}{"type": "custom", "tokenizer": "standard", "filter": searchFilters},
+		},
+	}
+}
+
+// esMappings maps declared fields and, through dynamic templates, undeclared
+// filterable or sortable strings (and their nested attributes) as keywords.
+// The primary key attribute is one too: it breaks ties in every sort.
+func esMappings(def IndexDefinition) map[string]interface{} {
+	properties := make(map[string]interface{}, len(def.Fields))
+	for field, typ := range def.Fields {
+		mapping := map[string]interface{}{"type": string(typ)}
+		if typ == FieldText {
+			mapping["analyzer"] = esTextAnalyzer
+			mapping["search_analyzer"] = esSearchAnalyzer
+		}
+		properties[field] = mapping
+	}
+
+	templates := []interface{}{}
+	seen := map[string]bool{}
+	for _, field := range append(append([]string{def.primaryKey()}, def.Filterable...), def.Sortable...) {
+		if seen[field] || def.Fields[field] != "" {
+			continue
+		}
+		seen[field] = true
+		for _, path := range []string{field, field + ".*"} {
+			templates = append(templates, map[string]interface{}{
+				"keyword_" + path: map[string]interface{}{
+					"path_match":         path,
+					"match_mapping_type": "string",
+					"mapping":            map[string]interface{}{"type": "keyword"},
+				},
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"_meta":             map[string]interface{}{"definition": def.Hash(), "analysis": def.analysisHash()},
+		"dynamic_templates": templates,
+		"properties":        properties,
+	}
+}
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// esDo finishes a request whose body is not needed
+func esDo(res *esapi.Response, err error) error {
+	return ESDecode(res, err, nil)
+}
+
+// ESDecode finishes a request of the go-elasticsearch client, decoding its
+// body into v unless v is nil. Error responses and unreachable servers are
+// *EngineError; a cancelled or expired context is returned as is.
+func ESDecode(res *esapi.Response, err error, v interface{}) error {
+	if err != nil {
+		return unreachable("elasticsearch", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError(res)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("elasticsearch: decode response: %w", err)
+	}
+	return nil
+}
+
+// esError decodes an error response, whose error is an object with a type
+// and reason or, from proxies and older versions, a plain string
+func esError(res *esapi.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	var code, message string
+	if json.Unmarshal(data, &body) == nil && len(body.Error) > 0 {
+		var detail struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal(body.Error, &detail) == nil {
+			code, message = detail.Type, detail.Reason
+		} else {
+			json.Unmarshal(body.Error, &message)
+		}
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(data))
+	}
+	if message == "" {
+		message = http.StatusText(res.StatusCode)
+	}
+	return NewEngineError("elasticsearch", res.StatusCode, code, message)
+}
+
+// primaryKey returns the primary key attribute registered for the index by
+// EnsureIndex
+func (e *ESAdapter) primaryKey(indexName string) string {
+	if key, ok := e.primaryKeys.Load(indexName); ok {
+		return key.(string)
+	}
+	return DefaultPrimaryKey
+}
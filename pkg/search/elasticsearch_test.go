@@ -0,0 +1,63 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+func esResponse(status int, body string) *esapi.Response {
+	return &esapi.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestESDecode(t *testing.T) {
+	var v struct {
+		Acknowledged bool `json:"acknowledged"`
+	}
+	if err := ESDecode(esResponse(http.StatusOK, `{"acknowledged":true}`), nil, &v); err != nil || !v.Acknowledged {
+		t.Errorf("decode = %v, %+v", err, v)
+	}
+	if err := ESDecode(esResponse(http.StatusOK, `not json`), nil, nil); err != nil {
+		t.Errorf("nil target read the body: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		res     *esapi.Response
+		err     error
+		kind    error
+		message string
+	}{
+		{"typed error", esResponse(http.StatusNotFound, `{"error":{"type":"index_not_found_exception","reason":"no such index [x]"}}`), nil,
+			ErrIndexNotFound, "elasticsearch: 404 index_not_found_exception: no such index [x]"},
+		{"string error", esResponse(http.StatusBadRequest, `{"error":"bad request"}`), nil,
+			nil, "elasticsearch: 400: bad request"},
+		{"plain body", esResponse(http.StatusServiceUnavailable, `overloaded`), nil,
+			ErrUnavailable, "elasticsearch: 503: overloaded"},
+		{"empty body", esResponse(http.StatusConflict, ``), nil,
+			nil, "elasticsearch: 409: Conflict"},
+		{"no response", nil, errors.New("connection refused"),
+			ErrUnavailable, "elasticsearch: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ESDecode(tt.res, tt.err, nil)
+			var engineErr *EngineError
+			if !errors.As(err, &engineErr) {
+				t.Fatalf("got %v, want an EngineError", err)
+			}
+			if engineErr.Kind != tt.kind || err.Error() != tt.message {
+				t.Errorf("got %q of kind %v, want %q of kind %v", err, engineErr.Kind, tt.message, tt.kind)
+			}
+		})
+	}
+
+	if err := ESDecode(nil, context.Canceled, nil); err != context.Canceled {
+		t.Errorf("cancelled request: got %v", err)
+	}
+}
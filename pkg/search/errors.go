@@ -0,0 +1,162 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Failures every engine reports alike; errors.Is matches them on the
+// *EngineError an adapter returns
+var (
+	ErrIndexNotFound   = errors.New("search index not found")
+	ErrVersionConflict = errors.New("search document version conflict")
+	// ErrUnavailable reports an engine that could not be reached or turned
+	// the request away as overloaded, after retries; trying later may work
+	ErrUnavailable = errors.New("search engine unavailable")
+)
+
+// EngineError is a failed request to a search engine
+type EngineError struct {
+	Engine  string // "elasticsearch", "meilisearch" or "memory"
+	Status  int    // HTTP status, 0 when no response arrived
+	Code    string // the engine's error type, such as index_not_found_exception
+	Message string
+	// Kind is ErrIndexNotFound, ErrVersionConflict, ErrUnavailable or nil
+	Kind error
+	// Err is the client's error, when the client returned one
+	Err error
+}
+
+// NewEngineError classifies an error response of engine
+func NewEngineError(engine string, status int, code, message string) *EngineError {
+	e := &EngineError{Engine: engine, Status: status, Code: code, Message: message}
+	switch {
+	case code == "index_not_found_exception" || code == "index_not_found":
+		e.Kind = ErrIndexNotFound
+	case code == "version_conflict_engine_exception":
+		e.Kind = ErrVersionConflict
+	case retryStatus(status):
+		e.Kind = ErrUnavailable
+	}
+	return e
+}
+
+func (e *EngineError) Error() string {
+	switch {
+	case e.Status == 0:
+		return fmt.Sprintf("%s: %s", e.Engine, e.Message)
+	case e.Code == "":
+		return fmt.Sprintf("%s: %d: %s", e.Engine, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s: %d %s: %s", e.Engine, e.Status, e.Code, e.Message)
+}
+
+func (e *EngineError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func (e *EngineError) Unwrap() error {
+	return e.Err
+}
+
+// unreachable wraps the error of a request that got no response; a
+// cancelled or expired context is the caller's and is returned as is
+func unreachable(engine string, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &EngineError{Engine: engine, Message: err.Error(), Kind: ErrUnavailable, Err: err}
+}
+
+const (
+	maxRetries     = 3
+	minRetryDelay  = 100 * time.Millisecond
+	maxRetryDelay  = 2 * time.Second
+	retryAfterCeil = 10 * time.Second
+)
+
+// RetryTransport retries requests that got no response or were turned away
+// with 429, 502, 503 or 504, up to three times with jittered exponential
+// backoff, or after the delay a Retry-After header asks for. Waits end with
+// the request's context. Bodies are replayed with Request.GetBody, or read
+// into memory first when the request has none.
+type RetryTransport struct {
+	// Base sends the requests; http.DefaultTransport when nil
+	Base http.RoundTripper
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		res, err := base.RoundTrip(req)
+		if err == nil && !retryStatus(res.StatusCode) || attempt == maxRetries {
+			return res, err
+		}
+		if req.Context().Err() != nil {
+			return res, err
+		}
+
+		delay := retryDelay(attempt)
+		if res != nil {
+			if after, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && after >= 0 {
+				delay = min(time.Duration(after)*time.Second, retryAfterCeil)
+			}
+			res.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay is the wait before retry attempt+1: doubling from
+// minRetryDelay, capped at maxRetryDelay, with jitter so that clients
+// rejected together do not retry together
+func retryDelay(attempt int) time.Duration {
+	ceiling := min(minRetryDelay<<attempt, maxRetryDelay)
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+}
+
+// retryStatus reports the statuses of an engine that is overloaded or
+// briefly unavailable
+func retryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// DefaultFacetSize is how many values a terms facet returns when Size is unset
+const DefaultFacetSize = 10
+
+// Facet requests counts over the matching documents. A facet without Ranges
+// counts the most frequent values of Field (colors, sizes, vendors); one with
+// Ranges counts documents per numeric bucket (price bands).
+type Facet struct {
+	Field  string
+	Size   int          // terms facets only
+	Ranges []FacetRange // buckets of a numeric field
+}
+
+// FacetRange is the bucket From <= value < To; a nil bound is open
+type FacetRange struct {
+	Key  string // defaults to "from-to", with "*" for an open bound
+	From *float64
+	To   *float64
+}
+
+// TermsFacet counts the values of field
+func TermsFacet(field string, size int) Facet {
+	return Facet{Field: field, Size: size}
+}
+
+// RangeFacet buckets field at the given ascending boundaries, with open-ended
+// first and last buckets: RangeFacet("price", 100, 500) yields *-100,
+// 100-500 and 500-*
+func RangeFacet(field string, boundaries ...float64) Facet {
+	ranges := make([]FacetRange, 0, len(boundaries)+1)
+	var from *float64
+	for i := range boundaries {
+		to := &boundaries[i]
+		ranges = append(ranges, FacetRange{From: from, To: to})
+		from = to
+	}
+	ranges = append(ranges, FacetRange{From: from})
+	return Facet{Field: field, Ranges: ranges}
+}
+
+// FacetValue is one value or bucket of a facet with its document count
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+func (r FacetRange) key() string {
+	if r.Key != "" {
+		return r.Key
+	}
+	bound := func(v *float64) string {
+		if v == nil {
+			return "*"
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	return bound(r.From) + "-" + bound(r.To)
+}
+
+// filter expresses the bucket with the filter AST so adapters without range
+// aggregations can count it as a filtered query
+func (r FacetRange) filter(field string) Filter {
+	f := RangeFilter{Field: field}
+	if r.From != nil {
+		f.Gte = *r.From
+	}
+	if r.To != nil {
+		f.Lt = *r.To
+	}
+	if f.Gte == nil && f.Lt == nil {
+		return Exists(field)
+	}
+	return f
+}
+
+func checkFacets(facets []Facet) error {
+	seen := make(map[string]bool, len(facets))
+	for _, f := range facets {
+		if err := checkField(f.Field); err != nil {
+			return err
+		}
+		if seen[f.Field] {
+			return fmt.Errorf("%w: duplicate facet %q", ErrInvalidFilter, f.Field)
+		}
+		seen[f.Field] = true
+	}
+	return nil
+}
+
+// topValues orders counts by descending count, then value, and keeps size
+func topValues(counts map[string]int64, size int) []FacetValue {
+	if size <= 0 {
+		size = DefaultFacetSize
+	}
+	values := make([]FacetValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, FacetValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if len(values) > size {
+		values = values[:size]
+	}
+	return values
+}
+
+// MergeFacets adds up the facets of searches over disjoint sets of documents,
+// such as pinned results and the matches shown after them. Terms facets keep
+// their Size most frequent values, range facets their bucket order.
+func MergeFacets(facets []Facet, results ...map[string][]FacetValue) map[string][]FacetValue {
+	if len(facets) == 0 {
+		return nil
+	}
+	merged := make(map[string][]FacetValue, len(facets))
+	for _, f := range facets {
+		counts := map[string]int64{}
+		for _, result := range results {
+			for _, v := range result[f.Field] {
+				counts[v.Value] += v.Count
+			}
+		}
+		if len(f.Ranges) == 0 {
+			merged[f.Field] = topValues(counts, f.Size)
+			continue
+		}
+		values := make([]FacetValue, len(f.Ranges))
+		for i, r := range f.Ranges {
+			values[i] = FacetValue{Value: r.key(), Count: counts[r.key()]}
+		}
+		merged[f.Field] = values
+	}
+	return merged
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRangeFacet(t *testing.T) {
+	f := RangeFacet("price", 100, 500)
+	var keys []string
+	for _, r := range f.Ranges {
+		keys = append(keys, r.key())
+	}
+	if want := []string{"*-100", "100-500", "500-*"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	// Buckets include From and exclude To
+	filters := []Filter{f.Ranges[0].filter("price"), f.Ranges[1].filter("price"), f.Ranges[2].filter("price")}
+	want := []Filter{
+		RangeFilter{Field: "price", Lt: 100.0},
+		RangeFilter{Field: "price", Gte: 100.0, Lt: 500.0},
+		RangeFilter{Field: "price", Gte: 500.0},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("filters = %#v, want %#v", filters, want)
+	}
+	if got := (FacetRange{}).filter("price"); !reflect.DeepEqual(got, Exists("price")) {
+		t.Errorf("open bucket filter = %#v", got)
+	}
+	if got := (FacetRange{Key: "cheap"}).key(); got != "cheap" {
+		t.Errorf("explicit key = %q", got)
+	}
+}
+
+func TestESAggregation(t *testing.T) {
+	tests := []struct {
+		facet Facet
+		want  string
+	}{
+		{TermsFacet("options.color", 0), `{"terms":{"field":"options.color","size":10}}`},
+		{RangeFacet("price", 100), `{"range":{"field":"price","ranges":[{"key":"*-100","to":100},{"from":100,"key":"100-*"}]}}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(esAggregation(tt.facet))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestCheckFacets(t *testing.T) {
+	if err := checkFacets([]Facet{TermsFacet("a", 0), TermsFacet("a", 5)}); err == nil {
+		t.Error("duplicate facet accepted")
+	}
+	if err := checkFacets([]Facet{TermsFacet("a b", 0)}); err == nil {
+		t.Error("invalid field accepted")
+	}
+}
+
+func TestTopValues(t *testing.T) {
+	got := topValues(map[string]int64{"b": 2, "a": 2, "c": 5, "d": 1}, 3)
+	want := []FacetValue{{"c", 5}, {"a", 2}, {"b", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := topValues(map[string]int64{"a": 1}, 0); len(got) != 1 {
+		t.Errorf("default size dropped values: %v", got)
+	}
+}
+
+func TestMergeFacets(t *testing.T) {
+	facets := []Facet{TermsFacet("color", 2), RangeFacet("price", 100)}
+	pinned := map[string][]FacetValue{
+		"color": {{"Red", 1}},
+		"price": {{"*-100", 1}, {"100-*", 0}},
+	}
+	organic := map[string][]FacetValue{
+		"color": {{"Blue", 3}, {"Red", 1}, {"Grey", 1}},
+		"price": {{"*-100", 2}, {"100-*", 3}},
+	}
+	got := MergeFacets(facets, pinned, organic)
+	want := map[string][]FacetValue{
+		"color": {{"Blue", 3}, {"Red", 2}},
+		"price": {{"*-100", 3}, {"100-*", 3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := MergeFacets(nil, organic); got != nil {
+		t.Errorf("no facets requested: got %v", got)
+	}
+}
@@ -0,0 +1,261 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid search filter")
+	ErrInvalidSort   = errors.New("invalid search sort")
+)
+
+// fieldPattern restricts field names to what both engines accept unquoted;
+// dots address nested attributes such as options.color
+var fieldPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// Filter is a node of an engine-independent filter expression. Build one with
+// Eq, In, Gt/Gte/Lt/Lte/Between, Exists, And, Or and Not; every adapter
+// translates it to its native syntax.
+type Filter interface {
+	isFilter()
+}
+
+// EqFilter matches documents whose field equals Value (a string, bool or number)
+type EqFilter struct {
+	Field string
+	Value interface{}
+}
+
+// InFilter matches documents whose field equals any of Values
+type InFilter struct {
+	Field  string
+	Values []interface{}
+}
+
+// RangeFilter bounds a numeric field; nil bounds are open
+type RangeFilter struct {
+	Field string
+	Gt    interface{}
+	Gte   interface{}
+	Lt    interface{}
+	Lte   interface{}
+}
+
+// ExistsFilter matches documents that have the field
+type ExistsFilter struct {
+	Field string
+}
+
+type AndFilter struct {
+	Filters []Filter
+}
+
+type OrFilter struct {
+	Filters []Filter
+}
+
+type NotFilter struct {
+	Filter Filter
+}
+
+func (EqFilter) isFilter()     {}
+func (InFilter) isFilter()     {}
+func (RangeFilter) isFilter()  {}
+func (ExistsFilter) isFilter() {}
+func (AndFilter) isFilter()    {}
+func (OrFilter) isFilter()     {}
+func (NotFilter) isFilter()    {}
+
+func Eq(field string, value interface{}) Filter {
+	return EqFilter{Field: field, Value: value}
+}
+
+func In(field string, values ...interface{}) Filter {
+	return InFilter{Field: field, Values: values}
+}
+
+func Gt(field string, value interface{}) Filter {
+	return RangeFilter{Field: field, Gt: value}
+}
+
+func Gte(field string, value interface{}) Filter {
+	return RangeFilter{Field: field, Gte: value}
+}
+
+func Lt(field string, value interface{}) Filter {
+	return RangeFilter{Field: field, Lt: value}
+}
+
+func Lte(field string, value interface{}) Filter {
+	return RangeFilter{Field: field, Lte: value}
+}
+
+// Between matches min <= field <= max
+func Between(field string, min, max interface{}) Filter {
+	return RangeFilter{Field: field, Gte: min, Lte: max}
+}
+
+func Exists(field string) Filter {
+	return ExistsFilter{Field: field}
+}
+
+// And combines filters, skipping nil ones so optional conditions can be passed
+// directly; it returns nil (no filter) when none remain
+func And(filters ...Filter) Filter {
+	filters = compact(filters)
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return AndFilter{Filters: filters}
+}
+
+// Or is the disjunction of the non-nil filters, or nil when none remain
+func Or(filters ...Filter) Filter {
+	filters = compact(filters)
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return OrFilter{Filters: filters}
+}
+
+func Not(filter Filter) Filter {
+	return NotFilter{Filter: filter}
+}
+
+func compact(filters []Filter) []Filter {
+	out := make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		if f != nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// SortField orders results by one field
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+func Asc(field string) SortField {
+	return SortField{Field: field}
+}
+
+func Desc(field string) SortField {
+	return SortField{Field: field, Desc: true}
+}
+
+// ParseSort reads a comma-separated sort specification such as
+// "price:asc,created_at:desc"; the direction defaults to ascending
+func ParseSort(spec string) ([]SortField, error) {
+	var fields []SortField
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, dir, _ := strings.Cut(part, ":")
+		field := SortField{Field: name}
+		switch strings.ToLower(dir) {
+		case "", "asc":
+		case "desc":
+			field.Desc = true
+		default:
+			return nil, fmt.Errorf("%w: direction %q", ErrInvalidSort, dir)
+		}
+		if err := checkField(name); err != nil {
+			return nil, fmt.Errorf("%w: field %q", ErrInvalidSort, name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func checkSort(sort []SortField) error {
+	for _, s := range sort {
+		if checkField(s.Field) != nil {
+			return fmt.Errorf("%w: field %q", ErrInvalidSort, s.Field)
+		}
+	}
+	return nil
+}
+
+func checkField(field string) error {
+	if !fieldPattern.MatchString(field) {
+		return fmt.Errorf("%w: field %q", ErrInvalidFilter, field)
+	}
+	return nil
+}
+
+// scalar normalizes a comparison value to string, bool, int64, uint64 or
+// float64 so adapters only deal with those
+func scalar(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string, bool:
+		return val, nil
+	case nil:
+		return nil, fmt.Errorf("%w: nil value", ErrInvalidFilter)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported value type %T", ErrInvalidFilter, v)
+}
+
+// number is scalar restricted to numbers, as Meilisearch only ranges over those
+func number(v interface{}) (interface{}, error) {
+	val, err := scalar(v)
+	if err != nil {
+		return nil, err
+	}
+	switch val.(type) {
+	case string, bool:
+		return nil, fmt.Errorf("%w: range bound %v is not a number", ErrInvalidFilter, v)
+	}
+	return val, nil
+}
+
+type bound struct {
+	op    string // gt, gte, lt or lte
+	value interface{}
+}
+
+// rangeBounds returns the normalized non-nil bounds in a fixed order
+func rangeBounds(f RangeFilter) ([]bound, error) {
+	var bounds []bound
+	for _, b := range []bound{{"gt", f.Gt}, {"gte", f.Gte}, {"lt", f.Lt}, {"lte", f.Lte}} {
+		if b.value == nil {
+			continue
+		}
+		n, err := number(b.value)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, bound{op: b.op, value: n})
+	}
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("%w: range on %q has no bounds", ErrInvalidFilter, f.Field)
+	}
+	return bounds, nil
+}
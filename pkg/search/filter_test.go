@@ -0,0 +1,121 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMeiliFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"eq string", Eq("status", "active"), `status = "active"`},
+		{"eq escapes quotes", Eq("title", `say "hi" \o/`), `title = "say \"hi\" \\o/"`},
+		{"eq number", Eq("shop_id", uint(7)), `shop_id = 7`},
+		{"eq bool", Eq("in_stock", true), `in_stock = true`},
+		{"in", In("id", 1, 2.5, "x"), `id IN [1, 2.5, "x"]`},
+		{"between", Between("price", 10, 20), `price >= 10 AND price <= 20`},
+		{"gt", Gt("price", 0.5), `price > 0.5`},
+		{"exists", Exists("options.color"), `options.color EXISTS`},
+		{"and", And(Eq("a", 1), Or(Eq("b", 2), Eq("c", 3))), `(a = 1) AND ((b = 2) OR (c = 3))`},
+		{"not", Not(And(Eq("a", 1), Lt("b", 2))), `NOT ((a = 1) AND (b < 2))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := meiliFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestESFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"eq", Eq("status", "active"), `{"term":{"status":"active"}}`},
+		{"in", In("id", 1, uint(2)), `{"terms":{"id":[1,2]}}`},
+		{"range", Between("price", 10, 20.5), `{"range":{"price":{"gte":10,"lte":20.5}}}`},
+		{"exists", Exists("options.color"), `{"exists":{"field":"options.color"}}`},
+		{"and", And(Eq("a", 1), Eq("b", true)), `{"bool":{"filter":[{"term":{"a":1}},{"term":{"b":true}}]}}`},
+		{"or", Or(Eq("a", 1), Eq("b", 2)), `{"bool":{"minimum_should_match":1,"should":[{"term":{"a":1}},{"term":{"b":2}}]}}`},
+		{"not", Not(Eq("a", 1)), `{"bool":{"must_not":{"term":{"a":1}}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, err := esFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(clause)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{"field with spaces", Eq("price OR 1", 1)},
+		{"nil value", Eq("a", nil)},
+		{"unsupported value", Eq("a", []int{1})},
+		{"empty in", In("a")},
+		{"range without bounds", RangeFilter{Field: "price"}},
+		{"string bound", Gt("price", "10")},
+		{"empty and", AndFilter{}},
+		{"nil operand", OrFilter{Filters: []Filter{Eq("a", 1), nil}}},
+		{"not without operand", NotFilter{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := meiliFilter(tt.filter); !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("meilisearch: got %v, want ErrInvalidFilter", err)
+			}
+			if _, err := esFilter(tt.filter); !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("elasticsearch: got %v, want ErrInvalidFilter", err)
+			}
+		})
+	}
+}
+
+func TestAndOrSkipNil(t *testing.T) {
+	if f := And(nil, nil); f != nil {
+		t.Errorf("And of nils = %#v, want nil", f)
+	}
+	if f := Or(nil, Eq("a", 1)); !reflect.DeepEqual(f, Eq("a", 1)) {
+		t.Errorf("Or with one operand = %#v", f)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	got, err := ParseSort(" price:desc, created_at ,title:ASC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SortField{Desc("price"), Asc("created_at"), Asc("title")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, spec := range []string{"price:up", "price;drop:asc"} {
+		if _, err := ParseSort(spec); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("%q: got %v, want ErrInvalidSort", spec, err)
+		}
+	}
+}
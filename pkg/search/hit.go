@@ -0,0 +1,112 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// snippetWords is about how many words a highlighted snippet keeps
+const snippetWords = 30
+
+// Hit is one matching document
+type Hit struct {
+	ID string `json:"id"`
+	// Score is the engine's relevance score. It orders the hits of one search
+	// and is not comparable across searches or engines.
+	Score  float64         `json:"score"`
+	Source json.RawMessage `json:"source"`
+	// Highlights holds the requested fields that matched, as HTML-escaped
+	// snippets with matches wrapped in HighlightPreTag and HighlightPostTag
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// TypedHit is a Hit with its source decoded into T
+type TypedHit[T any] struct {
+	ID         string              `json:"id"`
+	Score      float64             `json:"score"`
+	Document   T                   `json:"document"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// TypedResult is a SearchResult with its hits decoded into T
+type TypedResult[T any] struct {
+	Hits       []TypedHit[T]           `json:"hits"`
+	Total      int64                   `json:"total"`
+	Facets     map[string][]FacetValue `json:"facets,omitempty"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// SearchInto searches like Engine.Search and decodes the hits into T
+func SearchInto[T any](ctx context.Context, engine Engine, indexName, query string, options *SearchOptions) (*TypedResult[T], error) {
+	result, err := engine.Search(ctx, indexName, query, options)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeResult[T](result)
+}
+
+// DecodeResult decodes the hits of result into T
+func DecodeResult[T any](result *SearchResult) (*TypedResult[T], error) {
+	typed := &TypedResult[T]{
+		Hits:       make([]TypedHit[T], len(result.Hits)),
+		Total:      result.Total,
+		Facets:     result.Facets,
+		NextCursor: result.NextCursor,
+	}
+	for i, hit := range result.Hits {
+		typed.Hits[i] = TypedHit[T]{ID: hit.ID, Score: hit.Score, Highlights: hit.Highlights}
+		if err := json.Unmarshal(hit.Source, &typed.Hits[i].Document); err != nil {
+			return nil, fmt.Errorf("decode hit %s: %w", hit.ID, err)
+		}
+	}
+	return typed, nil
+}
+
+// highlights renders the marked snippets of each field, keeping the fields
+// with at least one match
+func highlights(marked map[string][]string) map[string][]string {
+	var out map[string][]string
+	for field, snippets := range marked {
+		for _, snippet := range snippets {
+			if !containsMarker(snippet) {
+				continue
+			}
+			if out == nil {
+				out = map[string][]string{}
+			}
+			out[field] = append(out[field], renderHighlight(snippet))
+		}
+	}
+	return out
+}
+
+func containsMarker(s string) bool {
+	return strings.Contains(s, highlightPre)
+}
+
+// cropSnippet keeps about snippetWords words of marked text, starting a few
+// words before the first match, for engines that do not crop themselves
+func cropSnippet(marked string) string {
+	words := strings.Fields(marked)
+	if len(words) <= snippetWords {
+		return marked
+	}
+	start := 0
+	for i, w := range words {
+		if containsMarker(w) {
+			start = max(i-snippetWords/4, 0)
+			break
+		}
+	}
+	end := min(start+snippetWords, len(words))
+	snippet := strings.Join(words[start:end], " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
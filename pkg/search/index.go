@@ -0,0 +1,171 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultPrimaryKey names the document ID attribute when a definition has none
+const DefaultPrimaryKey = "id"
+
+var (
+	ErrInvalidDefinition = errors.New("invalid index definition")
+	// ErrReindexRequired reports a definition change that cannot be applied to
+	// the live index in place (a primary key, field type or analysis change)
+	ErrReindexRequired = errors.New("index definition changed, reindex required")
+)
+
+// indexNamePattern is valid for both engines and leaves room for the
+// suffixes of rebuilt indexes
+var indexNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,199}$`)
+
+// FieldType is how a document attribute is stored and matched
+type FieldType string
+
+const (
+	FieldText    FieldType = "text"    // analyzed full text
+	FieldKeyword FieldType = "keyword" // exact values: statuses, SKUs, option values
+	FieldLong    FieldType = "long"
+	FieldDouble  FieldType = "double"
+	FieldBoolean FieldType = "boolean"
+	FieldDate    FieldType = "date"
+)
+
+// IndexDefinition declares an index in Go, next to the document type stored
+// in it. Adapters apply it with Engine.EnsureIndex, which is idempotent.
+type IndexDefinition struct {
+	Name       string
+	PrimaryKey string               // defaults to DefaultPrimaryKey
+	Fields     map[string]FieldType // explicit types; others are inferred by the engine
+	Searchable []string             // in decreasing order of importance
+	Filterable []string             // also required for facets; a field covers its nested attributes
+	Sortable   []string
+	Synonyms   map[string][]string // one-way: searching the key also matches its synonyms
+	StopWords  []string
+}
+
+func (d IndexDefinition) primaryKey() string {
+	if d.PrimaryKey == "" {
+		return DefaultPrimaryKey
+	}
+	return d.PrimaryKey
+}
+
+// Validate checks attribute names and that exact-match attributes are not
+// declared as analyzed text
+func (d IndexDefinition) Validate() error {
+	if !indexNamePattern.MatchString(d.Name) {
+		return fmt.Errorf("%w: index name %q", ErrInvalidDefinition, d.Name)
+	}
+	fields := append([]string{d.primaryKey()}, d.Searchable...)
+	for field := range d.Fields {
+		fields = append(fields, field)
+	}
+	for _, field := range append(append(fields, d.Filterable...), d.Sortable...) {
+		if !fieldPattern.MatchString(field) {
+			return fmt.Errorf("%w: field %q", ErrInvalidDefinition, field)
+		}
+	}
+	for word, synonyms := range d.Synonyms {
+		for _, term := range append([]string{word}, synonyms...) {
+			if strings.TrimSpace(term) == "" || strings.ContainsAny(term, ",\n") || strings.Contains(term, "=>") {
+				return fmt.Errorf("%w: synonym %q", ErrInvalidDefinition, term)
+			}
+		}
+	}
+	for _, field := range append(append([]string{}, d.Filterable...), d.Sortable...) {
+		if d.Fields[field] == FieldText {
+			return fmt.Errorf("%w: %q is text and cannot be filtered or sorted, declare it as keyword", ErrInvalidDefinition, field)
+		}
+	}
+	return nil
+}
+
+// Hash identifies the definition; adapters store it with the index to skip
+// unchanged definitions
+func (d IndexDefinition) Hash() string {
+	return hashJSON(d.canonical())
+}
+
+// analysisHash covers the settings that need a rebuilt index on engines
+// with index-time analysis
+func (d IndexDefinition) analysisHash() string {
+	c := d.canonical()
+	return hashJSON(struct {
+		PrimaryKey string
+		Synonyms   map[string][]string
+		StopWords  []string
+	}{c.PrimaryKey, c.Synonyms, c.StopWords})
+}
+
+// canonical sorts the order-insensitive lists so equal definitions hash equal
+func (d IndexDefinition) canonical() IndexDefinition {
+	c := d
+	c.PrimaryKey = d.primaryKey()
+	c.Filterable = sortedCopy(d.Filterable)
+	c.Sortable = sortedCopy(d.Sortable)
+	c.StopWords = sortedCopy(d.StopWords)
+	if len(d.Synonyms) > 0 {
+		c.Synonyms = make(map[string][]string, len(d.Synonyms))
+		for word, synonyms := range d.Synonyms {
+			c.Synonyms[word] = sortedCopy(synonyms)
+		}
+	}
+	return c
+}
+
+func sortedCopy(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := append([]string{}, values...)
+	sort.Strings(out)
+	return out
+}
+
+func hashJSON(v interface{}) string {
+	// encoding/json sorts map keys, so the encoding is stable
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// reindexTargets remembers the index being rebuilt for each live index so
+// writes made while Reindex fills it reach both. It only covers writes
+// through the same Engine instance.
+type reindexTargets struct {
+	mu      sync.RWMutex
+	targets map[string]string
+}
+
+func (r *reindexTargets) set(name, target string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.targets == nil {
+		r.targets = map[string]string{}
+	}
+	r.targets[name] = target
+}
+
+func (r *reindexTargets) clear(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.targets, name)
+}
+
+// indexes returns name plus the index being rebuilt for it, if any
+func (r *reindexTargets) indexes(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if target, ok := r.targets[name]; ok {
+		return []string{name, target}
+	}
+	return []string{name}
+}
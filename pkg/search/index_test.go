@@ -0,0 +1,66 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIndexDefinitionValidate(t *testing.T) {
+	valid := IndexDefinition{
+		Name:       "products",
+		Fields:     map[string]FieldType{"title": FieldText, "status": FieldKeyword},
+		Searchable: []string{"title"},
+		Filterable: []string{"status", "options.color"},
+		Sortable:   []string{"created_at"},
+		Synonyms:   map[string][]string{"tee": {"t-shirt"}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid definition: %v", err)
+	}
+
+	invalid := []func(d *IndexDefinition){
+		func(d *IndexDefinition) { d.Name = "Products" },
+		func(d *IndexDefinition) { d.Name = "" },
+		func(d *IndexDefinition) { d.Searchable = []string{"title; drop"} },
+		func(d *IndexDefinition) { d.Sortable = []string{"title"} },
+		func(d *IndexDefinition) { d.Synonyms = map[string][]string{"tee": {"a,b"}} },
+		func(d *IndexDefinition) { d.Synonyms = map[string][]string{"tee": {"a => b"}} },
+	}
+	for i, edit := range invalid {
+		d := valid
+		edit(&d)
+		if err := d.Validate(); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("invalid definition %d: got %v, want ErrInvalidDefinition", i, err)
+		}
+	}
+}
+
+func TestIndexDefinitionHash(t *testing.T) {
+	a := IndexDefinition{
+		Name:       "products",
+		Filterable: []string{"status", "shop_id"},
+		Synonyms:   map[string][]string{"tee": {"t-shirt", "shirt"}},
+	}
+	b := IndexDefinition{
+		Name:       "products",
+		PrimaryKey: DefaultPrimaryKey,
+		Filterable: []string{"shop_id", "status"},
+		Synonyms:   map[string][]string{"tee": {"shirt", "t-shirt"}},
+	}
+	if a.Hash() != b.Hash() || a.analysisHash() != b.analysisHash() {
+		t.Error("definitions differing only in list order hash differently")
+	}
+
+	c := b
+	c.Sortable = []string{"created_at"}
+	if c.Hash() == a.Hash() {
+		t.Error("a sortable change kept the hash")
+	}
+	if c.analysisHash() != a.analysisHash() {
+		t.Error("a sortable change altered the analysis hash")
+	}
+	c.StopWords = []string{"the"}
+	if c.analysisHash() == a.analysisHash() {
+		t.Error("a stop word change kept the analysis hash")
+	}
+}
@@ -10,18 +10,85 @@ type Engine interface {
 	// Delete removes a document from the specified index
 	Delete(ctx context.Context, indexName string, docID string) error
 
+	// IndexBatch adds or updates documents in as few requests as possible.
+	// Documents that fail are reported in a *BatchError; the others are
+	// written. Any other error means the batch may be partly written.
+	IndexBatch(ctx context.Context, indexName string, docs []Document, opts *WriteOptions) error
+
+	// DeleteBatch removes documents by ID; missing documents are not errors
+	DeleteBatch(ctx context.Context, indexName string, docIDs []string, opts *WriteOptions) error
+
+	// DeleteByFilter removes every document matching filter, which must be
+	// filterable on the index and cannot be nil
+	DeleteByFilter(ctx context.Context, indexName string, filter Filter, opts *WriteOptions) error
+
 	// Search performs a search query
 	// This is a simplified search interface. Real-world cases might need more complex query builders.
 	Search(ctx context.Context, indexName string, query string, options *SearchOptions) (*SearchResult, error)
+
+	// Suggest completes what a user is typing from one text field of the
+	// matching documents: the last word matches as a prefix and the others
+	// tolerate typos. Suggestions with the same text are returned once.
+	Suggest(ctx context.Context, indexName string, prefix string, options *SuggestOptions) ([]Suggestion, error)
+
+	// EnsureIndex creates the index of def when missing and applies its
+	// settings. It is idempotent and meant to run at startup; changes that
+	// cannot be applied in place return ErrReindexRequired.
+	EnsureIndex(ctx context.Context, def IndexDefinition) error
+
+	// Reindex rebuilds the index of def without downtime: fill writes every
+	// document to target, a fresh index, which then atomically replaces the
+	// live one. Searches keep hitting the old index until the swap.
+	Reindex(ctx context.Context, def IndexDefinition, fill func(ctx context.Context, target string) error) error
 }
 
 type SearchOptions struct {
 	Limit  int
 	Offset int
-	Filter interface{}
+	Filter Filter      // optional; see Eq, In, Between, And, ...
+	Sort   []SortField // optional; relevance order when empty
+	Facets []Facet     // optional; counted over all matches, not just the page
+	// Highlight lists the text fields whose matches are marked in
+	// Hit.Highlights, cropped to snippets around them
+	Highlight []string
+	// Cursor continues from the page that returned it as NextCursor, for
+	// deep pagination; Offset is ignored. It is only valid with the same
+	// query, filter and sort.
+	Cursor string
+}
+
+// DefaultLimit applies when SearchOptions is nil or its Limit is not positive
+const DefaultLimit = 20
+
+// normalize returns a copy of options with defaults applied, validating the
+// sort, highlight and facets
+func normalize(options *SearchOptions) (SearchOptions, error) {
+	var opts SearchOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+	if err := checkSort(opts.Sort); err != nil {
+		return opts, err
+	}
+	for _, field := range opts.Highlight {
+		if err := checkField(field); err != nil {
+			return opts, err
+		}
+	}
+	return opts, checkFacets(opts.Facets)
 }
 
 type SearchResult struct {
-	Hits  []interface{} `json:"hits"`
-	Total int64         `json:"total"`
+	Hits   []Hit                   `json:"hits"`
+	Total  int64                   `json:"total"`
+	Facets map[string][]FacetValue `json:"facets,omitempty"` // keyed by field
+	// NextCursor fetches the following page through SearchOptions.Cursor;
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
@@ -1,58 +1,523 @@
 package search
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"shop/internal/config"
+	"strconv"
+	"strings"
+	"sync"
 
 	meilisearchgo "github.com/meilisearch/meilisearch-go"
 	"go.uber.org/zap"
 )
 
 type MeiliAdapter struct {
-	client meilisearchgo.ServiceManager
-	logger *zap.Logger
+	client      meilisearchgo.ServiceManager
+	logger      *zap.Logger
+	primaryKeys sync.Map // index name -> primary key, registered by EnsureIndex
+	reindex     reindexTargets
 }
 
+// NewMeiliAdapter connects to Meilisearch; requests are retried by
+// RetryTransport rather than by the client, which cannot replay bodies
 func NewMeiliAdapter(cfg *config.Config, logger *zap.Logger) (Engine, error) {
 	client := meilisearchgo.New(
 		cfg.Meilisearch.Host,
 		meilisearchgo.WithAPIKey(cfg.Meilisearch.APIKey),
+		meilisearchgo.WithCustomClient(&http.Client{Transport: &RetryTransport{}}),
+		meilisearchgo.DisableRetries(),
 	)
 
 	return &MeiliAdapter{client: client, logger: logger}, nil
 }
 
+// Index stores doc under docID, setting the primary key attribute when doc
+// lacks it rather than letting Meilisearch infer one
 func (m *MeiliAdapter) Index(ctx context.Context, indexName string, docID string, doc interface{}) error {
-	_, err := m.client.Index(indexName).AddDocuments([]interface{}{doc}, nil)
-	return err
+	primaryKey := m.primaryKey(indexName)
+	document, err := withPrimaryKey(doc, primaryKey, docID)
+	if err != nil {
+		return err
+	}
+	for _, index := range m.reindex.indexes(indexName) {
+		_, err := m.client.Index(index).AddDocumentsWithContext(ctx, []map[string]json.RawMessage{document},
+			&meilisearchgo.DocumentOptions{PrimaryKey: &primaryKey})
+		if err != nil {
+			return meiliError(err)
+		}
+	}
+	return nil
 }
 
 func (m *MeiliAdapter) Delete(ctx context.Context, indexName string, docID string) error {
-	_, err := m.client.Index(indexName).DeleteDocument(docID, nil)
-	return err
+	for _, index := range m.reindex.indexes(indexName) {
+		if _, err := m.client.Index(index).DeleteDocumentWithContext(ctx, docID, nil); err != nil {
+			return meiliError(err)
+		}
+	}
+	return nil
 }
 
+// Search pages sorted searches by filter: a cursor holds the sort values of
+// the last hit and the next page keeps the documents after them, so cursors
+// reach past the index's maxTotalHits. Relevance order cannot be expressed
+// as a filter and is paged by offset, within maxTotalHits.
 func (m *MeiliAdapter) Search(ctx context.Context, indexName string, query string, options *SearchOptions) (*SearchResult, error) {
+	opts, err := normalize(options)
+	if err != nil {
+		return nil, err
+	}
+	start, err := startCursor(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	primaryKey := m.primaryKey(indexName)
+	var sort []SortField
+	if len(opts.Sort) > 0 {
+		// The primary key makes the order total, as keyset pages need
+		sort = append(append(sort, opts.Sort...), Asc(primaryKey))
+	}
+	keyset := len(sort) > 0 && len(start.After) > 0
+
 	req := &meilisearchgo.SearchRequest{
-		Limit:  int64(options.Limit),
-		Offset: int64(options.Offset),
+		Limit:            int64(opts.Limit),
+		Offset:           int64(start.Position),
+		Sort:             meiliSort(sort),
+		ShowRankingScore: true,
+	}
+	filter := opts.Filter
+	if keyset {
+		after, err := meiliAfter(sort, start.After)
+		if err != nil {
+			return nil, err
+		}
+		filter = And(filter, after)
+		req.Offset = 0
+	}
+	if filter != nil {
+		if req.Filter, err = meiliFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+	var facets []string
+	for _, f := range opts.Facets {
+		if len(f.Ranges) == 0 {
+			facets = append(facets, f.Field)
+		}
+	}
+	if !keyset {
+		req.Facets = facets
+	}
+	if len(opts.Highlight) > 0 {
+		req.AttributesToHighlight = opts.Highlight
+		req.AttributesToCrop = opts.Highlight
+		req.CropLength = snippetWords
+		req.CropMarker = "…"
+		req.HighlightPreTag = highlightPre
+		req.HighlightPostTag = highlightPost
+	}
+
+	resp, err := m.client.Index(indexName).SearchWithContext(ctx, query, req)
+	if err != nil {
+		return nil, meiliError(err)
+	}
+	result := &SearchResult{
+		Hits:  make([]Hit, len(resp.Hits)),
+		Total: resp.EstimatedTotalHits,
+	}
+	for i, raw := range resp.Hits {
+		if result.Hits[i], err = meiliHit(raw, primaryKey, opts.Highlight); err != nil {
+			return nil, err
+		}
 	}
-	// Note: Filter handling in Meilisearch might require string parsing/building
 
-	resp, err := m.client.Index(indexName).Search(query, req)
+	n := len(resp.Hits)
+	more := start.remaining(n, resp.EstimatedTotalHits)
+	distribution := resp.FacetDistribution
+	if keyset {
+		// The page only sees the documents after the cursor; the total and
+		// facets count every match
+		more = resp.EstimatedTotalHits > int64(n)
+		count := &meilisearchgo.SearchRequest{
+			Limit:                1,
+			Facets:               facets,
+			AttributesToRetrieve: []string{primaryKey},
+		}
+		if opts.Filter != nil {
+			if count.Filter, err = meiliFilter(opts.Filter); err != nil {
+				return nil, err
+			}
+		}
+		all, err := m.client.Index(indexName).SearchWithContext(ctx, query, count)
+		if err != nil {
+			return nil, meiliError(err)
+		}
+		result.Total = all.EstimatedTotalHits
+		distribution = all.FacetDistribution
+	}
+	if n > 0 {
+		var after []json.RawMessage
+		if len(sort) > 0 {
+			// Sort values other than single numbers fall back to offsets
+			after = meiliSortValues(result.Hits[n-1].Source, sort)
+		}
+		result.NextCursor = start.next(n, more, after)
+	}
+	if len(opts.Facets) > 0 {
+		if result.Facets, err = m.facets(ctx, indexName, query, opts, distribution); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// meiliHit splits a hit into its attributes and the _rankingScore and
+// _formatted Meilisearch adds
+func meiliHit(raw meilisearchgo.Hit, primaryKey string, highlight []string) (Hit, error) {
+	attributes := make(map[string]json.RawMessage, len(raw))
+	for name, value := range raw {
+		if !strings.HasPrefix(name, "_") {
+			attributes[name] = value
+		}
+	}
+	source, err := json.Marshal(attributes)
+	if err != nil {
+		return Hit{}, err
+	}
+	hit := Hit{Source: source}
+	var id interface{}
+	if err := json.Unmarshal(raw[primaryKey], &id); err == nil {
+		hit.ID, _ = meiliID(id)
+	}
+	if score, ok := raw["_rankingScore"]; ok {
+		if err := json.Unmarshal(score, &hit.Score); err != nil {
+			return Hit{}, err
+		}
+	}
+	if formattedRaw, ok := raw["_formatted"]; ok && len(highlight) > 0 {
+		var formatted map[string]interface{}
+		if err := json.Unmarshal(formattedRaw, &formatted); err != nil {
+			return Hit{}, err
+		}
+		marked := make(map[string][]string, len(highlight))
+		for _, field := range highlight {
+			marked[field] = fieldStrings(fieldValues(formatted, field))
+		}
+		hit.Highlights = highlights(marked)
+	}
+	return hit, nil
+}
+
+// meiliSortValues reads the values of the sort fields from a hit's source;
+// nil unless each is a single number, the only values Meilisearch compares
+func meiliSortValues(source json.RawMessage, sort []SortField) []json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(source))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+	values := make([]json.RawMessage, len(sort))
+	for i, s := range sort {
+		found := fieldValues(doc, s.Field)
+		if len(found) != 1 {
+			return nil
+		}
+		number, ok := found[0].(json.Number)
+		if !ok {
+			return nil
+		}
+		values[i] = json.RawMessage(number.String())
+	}
+	return values
+}
+
+// meiliAfter keeps the documents that sort after the values of a cursor:
+// those past the first field's value, or equal on it and past the second's,
+// and so on
+func meiliAfter(sort []SortField, after []json.RawMessage) (Filter, error) {
+	if len(after) != len(sort) {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]interface{}, len(after))
+	for i, raw := range after {
+		value, ok := cursorValue(raw)
+		if _, isString := value.(string); !ok || isString {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value
+	}
+	alternatives := make([]Filter, len(sort))
+	for i, s := range sort {
+		equal := make([]Filter, 0, i+1)
+		for j := 0; j < i; j++ {
+			equal = append(equal, Eq(sort[j].Field, values[j]))
+		}
+		past := Gt(s.Field, values[i])
+		if s.Desc {
+			past = Lt(s.Field, values[i])
+		}
+		alternatives[i] = And(append(equal, past)...)
+	}
+	return Or(alternatives...), nil
+}
+
+// facets reads terms facets from the facet distribution. Meilisearch has no
+// range aggregation, so every range bucket is counted exactly by a filtered
+// query, all of them sent in one multi-search.
+func (m *MeiliAdapter) facets(ctx context.Context, indexName, query string, opts SearchOptions, distribution json.RawMessage) (map[string][]FacetValue, error) {
+	var counts map[string]map[string]int64
+	if len(distribution) > 0 {
+		if err := json.Unmarshal(distribution, &counts); err != nil {
+			return nil, err
+		}
+	}
+
+	facets := make(map[string][]FacetValue, len(opts.Facets))
+	var buckets []*meilisearchgo.SearchRequest
+	for _, f := range opts.Facets {
+		if len(f.Ranges) == 0 {
+			facets[f.Field] = topValues(counts[f.Field], f.Size)
+			continue
+		}
+		for _, r := range f.Ranges {
+			filter, err := meiliFilter(And(opts.Filter, r.filter(f.Field)))
+			if err != nil {
+				return nil, err
+			}
+			// page-based pagination makes totalHits exact
+			buckets = append(buckets, &meilisearchgo.SearchRequest{
+				IndexUID:             indexName,
+				Query:                query,
+				Filter:               filter,
+				Page:                 1,
+				HitsPerPage:          1,
+				AttributesToRetrieve: []string{f.Field},
+			})
+		}
+	}
+	if len(buckets) == 0 {
+		return facets, nil
+	}
+
+	resp, err := m.client.MultiSearchWithContext(ctx, &meilisearchgo.MultiSearchRequest{Queries: buckets})
+	if err != nil {
+		return nil, meiliError(err)
+	}
+	if len(resp.Results) != len(buckets) {
+		return nil, fmt.Errorf("meilisearch: %d results for %d facet queries", len(resp.Results), len(buckets))
+	}
+	i := 0
+	for _, f := range opts.Facets {
+		if len(f.Ranges) == 0 {
+			continue
+		}
+		values := make([]FacetValue, len(f.Ranges))
+		for j, r := range f.Ranges {
+			values[j] = FacetValue{Value: r.key(), Count: resp.Results[i].TotalHits}
+			i++
+		}
+		facets[f.Field] = values
+	}
+	return facets, nil
+}
+
+// meiliFilter renders a filter in Meilisearch's filter expression syntax.
+// Every compound operand is parenthesized so precedence never depends on
+// Meilisearch's NOT > AND > OR rules.
+func meiliFilter(f Filter) (string, error) {
+	switch f := f.(type) {
+	case EqFilter:
+		if err := checkField(f.Field); err != nil {
+			return "", err
+		}
+		value, err := meiliValue(f.Value)
+		if err != nil {
+			return "", err
+		}
+		return f.Field + " = " + value, nil
+	case InFilter:
+		if err := checkField(f.Field); err != nil {
+			return "", err
+		}
+		if len(f.Values) == 0 {
+			return "", fmt.Errorf("%w: in on %q has no values", ErrInvalidFilter, f.Field)
+		}
+		values := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			value, err := meiliValue(v)
+			if err != nil {
+				return "", err
+			}
+			values[i] = value
+		}
+		return f.Field + " IN [" + strings.Join(values, ", ") + "]", nil
+	case RangeFilter:
+		if err := checkField(f.Field); err != nil {
+			return "", err
+		}
+		bounds, err := rangeBounds(f)
+		if err != nil {
+			return "", err
+		}
+		operators := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+		parts := make([]string, len(bounds))
+		for i, b := range bounds {
+			value, _ := meiliValue(b.value)
+			parts[i] = f.Field + " " + operators[b.op] + " " + value
+		}
+		return strings.Join(parts, " AND "), nil
+	case ExistsFilter:
+		if err := checkField(f.Field); err != nil {
+			return "", err
+		}
+		return f.Field + " EXISTS", nil
+	case AndFilter:
+		return meiliJoin(f.Filters, " AND ")
+	case OrFilter:
+		return meiliJoin(f.Filters, " OR ")
+	case NotFilter:
+		if f.Filter == nil {
+			return "", fmt.Errorf("%w: not without operand", ErrInvalidFilter)
+		}
+		inner, err := meiliFilter(f.Filter)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + inner + ")", nil
+	}
+	return "", fmt.Errorf("%w: unsupported filter %T", ErrInvalidFilter, f)
+}
+
+func meiliJoin(filters []Filter, op string) (string, error) {
+	if len(filters) == 0 {
+		return "", fmt.Errorf("%w: %s without operands", ErrInvalidFilter, strings.TrimSpace(op))
+	}
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		if f == nil {
+			return "", fmt.Errorf("%w: nil operand", ErrInvalidFilter)
+		}
+		part, err := meiliFilter(f)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = "(" + part + ")"
+	}
+	return strings.Join(parts, op), nil
+}
+
+// meiliValue quotes strings (escaping quotes and backslashes) and prints
+// numbers and booleans bare
+func meiliValue(v interface{}) (string, error) {
+	val, err := scalar(v)
+	if err != nil {
+		return "", err
+	}
+	switch val := val.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(val) + `"`, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("%w: unsupported value type %T", ErrInvalidFilter, v)
+}
+
+func meiliSort(sort []SortField) []string {
+	if len(sort) == 0 {
+		return nil
+	}
+	out := make([]string, len(sort))
+	for i, s := range sort {
+		if s.Desc {
+			out[i] = s.Field + ":desc"
+		} else {
+			out[i] = s.Field + ":asc"
+		}
+	}
+	return out
+}
+
+// Suggest runs a prefix search, which Meilisearch makes typo tolerant, and
+// highlights the field. Extra hits make up for duplicate texts.
+func (m *MeiliAdapter) Suggest(ctx context.Context, indexName string, prefix string, options *SuggestOptions) ([]Suggestion, error) {
+	opts, err := normalizeSuggest(options)
 	if err != nil {
 		return nil, err
 	}
+	primaryKey := m.primaryKey(indexName)
+	req := &meilisearchgo.SearchRequest{
+		Limit:                 int64(opts.Limit * 2),
+		AttributesToRetrieve:  []string{primaryKey, opts.Field},
+		AttributesToHighlight: []string{opts.Field},
+		HighlightPreTag:       highlightPre,
+		HighlightPostTag:      highlightPost,
+	}
+	if opts.Filter != nil {
+		if req.Filter, err = meiliFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+	}
 
-	// Convert Hits (which is []interface{} in latest SDK or custom type) to []interface{}
-	// The SDK defines Hits as []interface{} usually, but let's be safe
-	var hits []interface{}
+	resp, err := m.client.Index(indexName).SearchWithContext(ctx, prefix, req)
+	if err != nil {
+		return nil, meiliError(err)
+	}
+	result := suggestions{limit: opts.Limit}
 	for _, hit := range resp.Hits {
-		hits = append(hits, hit)
+		source, err := decodeMeiliHit(hit)
+		if err != nil {
+			return nil, err
+		}
+		var formatted map[string]interface{}
+		if raw, ok := hit["_formatted"]; ok {
+			if err := json.Unmarshal(raw, &formatted); err != nil {
+				return nil, err
+			}
+		}
+		id, _ := meiliID(source[primaryKey])
+		result.add(id, sourceText(source, opts.Field), sourceText(formatted, opts.Field))
+		if result.full() {
+			break
+		}
+	}
+	return result.items, nil
+}
+
+// decodeMeiliHit decodes the attributes of a hit, leaving out _formatted
+func decodeMeiliHit(hit map[string]json.RawMessage) (map[string]interface{}, error) {
+	source := make(map[string]interface{}, len(hit))
+	for name, raw := range hit {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		source[name] = value
 	}
+	return source, nil
+}
 
-	return &SearchResult{
-		Hits:  hits,
-		Total: resp.EstimatedTotalHits,
-	}, nil
+// meiliID prints a primary key value, which Meilisearch allows to be a
+// string or an integer
+func meiliID(v interface{}) (string, bool) {
+	switch id := v.(type) {
+	case string:
+		return id, true
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64), true
+	}
+	return "", false
 }
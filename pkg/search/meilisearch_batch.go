@@ -0,0 +1,120 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+
+	meilisearchgo "github.com/meilisearch/meilisearch-go"
+)
+
+// meiliTask is an enqueued write and the documents it carries, so a failed
+// task can be reported per document
+type meiliTask struct {
+	uid int64
+	ids []string
+}
+
+// IndexBatch sends up to MaxBatchSize documents per task. Meilisearch
+// validates documents when it processes the task and fails the whole task,
+// so without Wait only encoding errors are reported.
+func (m *MeiliAdapter) IndexBatch(ctx context.Context, indexName string, docs []Document, opts *WriteOptions) error {
+	var failed itemErrors
+	primaryKey := m.primaryKey(indexName)
+	documents := make([]map[string]json.RawMessage, 0, len(docs))
+	ids := make([]string, 0, len(docs))
+	for _, d := range docs {
+		document, err := withPrimaryKey(d.Doc, primaryKey, d.ID)
+		if err != nil {
+			failed.add(d.ID, err.Error())
+			continue
+		}
+		documents = append(documents, document)
+		ids = append(ids, d.ID)
+	}
+
+	var tasks []meiliTask
+	for _, index := range m.reindex.indexes(indexName) {
+		for _, r := range chunks(len(documents)) {
+			task, err := m.client.Index(index).AddDocumentsWithContext(ctx, documents[r[0]:r[1]],
+				&meilisearchgo.DocumentOptions{PrimaryKey: &primaryKey})
+			if err != nil {
+				return meiliError(err)
+			}
+			tasks = append(tasks, meiliTask{uid: task.TaskUID, ids: ids[r[0]:r[1]]})
+		}
+	}
+	if opts.wait() {
+		if err := m.waitItems(ctx, tasks, &failed); err != nil {
+			return err
+		}
+	}
+	return failed.err()
+}
+
+func (m *MeiliAdapter) DeleteBatch(ctx context.Context, indexName string, docIDs []string, opts *WriteOptions) error {
+	var failed itemErrors
+	var tasks []meiliTask
+	for _, index := range m.reindex.indexes(indexName) {
+		for _, r := range chunks(len(docIDs)) {
+			task, err := m.client.Index(index).DeleteDocumentsWithContext(ctx, docIDs[r[0]:r[1]], nil)
+			if err != nil {
+				return meiliError(err)
+			}
+			tasks = append(tasks, meiliTask{uid: task.TaskUID, ids: docIDs[r[0]:r[1]]})
+		}
+	}
+	if opts.wait() {
+		if err := m.waitItems(ctx, tasks, &failed); err != nil {
+			return err
+		}
+	}
+	return failed.err()
+}
+
+func (m *MeiliAdapter) DeleteByFilter(ctx context.Context, indexName string, filter Filter, opts *WriteOptions) error {
+	if filter == nil {
+		return ErrEmptyFilter
+	}
+	expr, err := meiliFilter(filter)
+	if err != nil {
+		return err
+	}
+	var tasks []int64
+	for _, index := range m.reindex.indexes(indexName) {
+		task, err := m.client.Index(index).DeleteDocumentsByFilterWithContext(ctx, expr, nil)
+		if err != nil {
+			return meiliError(err)
+		}
+		tasks = append(tasks, task.TaskUID)
+	}
+	if !opts.wait() {
+		return nil
+	}
+	for _, uid := range tasks {
+		if err := m.waitTask(ctx, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitItems waits for every task and records the documents of failed ones
+func (m *MeiliAdapter) waitItems(ctx context.Context, tasks []meiliTask, failed *itemErrors) error {
+	for _, t := range tasks {
+		task, err := m.client.WaitForTaskWithContext(ctx, t.uid, meiliTaskInterval)
+		if err != nil {
+			return meiliError(err)
+		}
+		if task.Status == meilisearchgo.TaskStatusSucceeded {
+			continue
+		}
+		reason := task.Error.Message
+		if reason == "" {
+			reason = string(task.Status)
+		}
+		for _, id := range t.ids {
+			failed.add(id, reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	meilisearchgo "github.com/meilisearch/meilisearch-go"
+)
+
+// meiliTaskInterval is how often task status is polled
+const meiliTaskInterval = 100 * time.Millisecond
+
+// EnsureIndex creates the index with its primary key and updates settings that
+// differ. Meilisearch applies every setting in place, rebuilding its internal
+// structures in the background while the index keeps serving searches.
+func (m *MeiliAdapter) EnsureIndex(ctx context.Context, def IndexDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	if err := m.applyDefinition(ctx, def.Name, def, false); err != nil {
+		return err
+	}
+	m.primaryKeys.Store(def.Name, def.primaryKey())
+	return nil
+}
+
+// Reindex fills a staging index and swaps it with the live one, which
+// Meilisearch does atomically; the staging index then holds the old
+// documents and is deleted.
+func (m *MeiliAdapter) Reindex(ctx context.Context, def IndexDefinition, fill func(ctx context.Context, target string) error) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	// The live index must exist to be swapped; a primary key change is what
+	// the rebuild is for
+	if err := m.applyDefinition(ctx, def.Name, def, true); err != nil && !errors.Is(err, ErrReindexRequired) {
+		return err
+	}
+
+	target := def.Name + "_reindex"
+	// Left over from an interrupted rebuild
+	if err := m.deleteIndex(ctx, target); err != nil {
+		return err
+	}
+	if err := m.applyDefinition(ctx, target, def, true); err != nil {
+		return err
+	}
+	m.primaryKeys.Store(target, def.primaryKey())
+	defer m.primaryKeys.Delete(target)
+
+	// Task history outlives deleted indexes: only writes enqueued after the
+	// staging index was set up count, by the server's clock
+	setup, err := m.client.GetTasksWithContext(ctx, &meilisearchgo.TasksQuery{IndexUIDS: []string{target}, Limit: 1})
+	if err != nil {
+		return meiliError(err)
+	}
+	var started time.Time
+	if len(setup.Results) > 0 {
+		started = setup.Results[0].EnqueuedAt
+	}
+
+	m.reindex.set(def.Name, target)
+	defer m.reindex.clear(def.Name)
+	if err := fill(ctx, target); err != nil {
+		if cleanupErr := m.deleteIndex(context.Background(), target); cleanupErr != nil {
+			return errors.Join(err, cleanupErr)
+		}
+		return err
+	}
+	if err := m.waitIdle(ctx, target, started); err != nil {
+		return err
+	}
+
+	task, err := m.client.SwapIndexesWithContext(ctx, []*meilisearchgo.SwapIndexesParams{{Indexes: []string{def.Name, target}}})
+	if err != nil {
+		return meiliError(err)
+	}
+	if err := m.waitTask(ctx, task.TaskUID); err != nil {
+		return err
+	}
+	m.primaryKeys.Store(def.Name, def.primaryKey())
+	return m.deleteIndex(ctx, target)
+}
+
+// applyDefinition creates uid if missing and brings its settings in line
+// with def, optionally waiting until Meilisearch has applied them
+func (m *MeiliAdapter) applyDefinition(ctx context.Context, uid string, def IndexDefinition, wait bool) error {
+	primaryKey := def.primaryKey()
+	var tasks []int64
+
+	info, err := m.client.GetIndexWithContext(ctx, uid)
+	switch {
+	case meiliNotFound(err):
+		task, err := m.client.CreateIndexWithContext(ctx, &meilisearchgo.IndexConfig{Uid: uid, PrimaryKey: primaryKey})
+		if err != nil {
+			return meiliError(err)
+		}
+		tasks = append(tasks, task.TaskUID)
+	case err != nil:
+		return meiliError(err)
+	case info.PrimaryKey != "" && info.PrimaryKey != primaryKey:
+		return fmt.Errorf("%w: %s has primary key %q, want %q", ErrReindexRequired, uid, info.PrimaryKey, primaryKey)
+	}
+
+	index := m.client.Index(uid)
+	desired := meiliSettings(def)
+	if len(tasks) == 0 {
+		current, err := index.GetSettingsWithContext(ctx)
+		if err != nil {
+			return meiliError(err)
+		}
+		if meiliSettingsEqual(current, desired) {
+			return nil
+		}
+	}
+
+	task, err := index.UpdateSettingsWithContext(ctx, desired)
+	if err != nil {
+		return meiliError(err)
+	}
+	tasks = append(tasks, task.TaskUID)
+	// Empty lists are omitted from the update and must be reset explicitly
+	resets := []struct {
+		empty bool
+		reset func(context.Context) (*meilisearchgo.TaskInfo, error)
+	}{
+		{len(desired.FilterableAttributes) == 0, index.ResetFilterableAttributesWithContext},
+		{len(desired.SortableAttributes) == 0, index.ResetSortableAttributesWithContext},
+		{len(desired.Synonyms) == 0, index.ResetSynonymsWithContext},
+		{len(desired.StopWords) == 0, index.ResetStopWordsWithContext},
+	}
+	for _, r := range resets {
+		if !r.empty {
+			continue
+		}
+		task, err := r.reset(ctx)
+		if err != nil {
+			return meiliError(err)
+		}
+		tasks = append(tasks, task.TaskUID)
+	}
+
+	if !wait {
+		return nil
+	}
+	for _, uid := range tasks {
+		if err := m.waitTask(ctx, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func meiliSettings(def IndexDefinition) *meilisearchgo.Settings {
+	c := def.canonical()
+	searchable := c.Searchable
+	if len(searchable) == 0 {
+		searchable = []string{"*"}
+	}
+	// Sorted searches break ties on the primary key, so it is always sortable
+	sortable := c.Sortable
+	if !slices.Contains(sortable, def.primaryKey()) {
+		sortable = sortedCopy(append(sortable, def.primaryKey()))
+	}
+	return &meilisearchgo.Settings{
+		SearchableAttributes: searchable,
+		FilterableAttributes: c.Filterable,
+		SortableAttributes:   sortable,
+		Synonyms:             c.Synonyms,
+		StopWords:            c.StopWords,
+	}
+}
+
+// meiliSettingsEqual compares the settings EnsureIndex manages; searchable
+// attributes are ordered by importance, the other lists are sets
+func meiliSettingsEqual(current, desired *meilisearchgo.Settings) bool {
+	synonyms := make(map[string][]string, len(current.Synonyms))
+	for word, values := range current.Synonyms {
+		synonyms[word] = sortedCopy(values)
+	}
+	return reflect.DeepEqual(current.SearchableAttributes, desired.SearchableAttributes) &&
+		reflect.DeepEqual(sortedCopy(current.FilterableAttributes), desired.FilterableAttributes) &&
+		reflect.DeepEqual(sortedCopy(current.SortableAttributes), desired.SortableAttributes) &&
+		reflect.DeepEqual(sortedCopy(current.StopWords), desired.StopWords) &&
+		(len(synonyms) == 0 && len(desired.Synonyms) == 0 || reflect.DeepEqual(synonyms, desired.Synonyms))
+}
+
+// waitTask blocks until a task is processed and reports its failure
+func (m *MeiliAdapter) waitTask(ctx context.Context, taskUID int64) error {
+	task, err := m.client.WaitForTaskWithContext(ctx, taskUID, meiliTaskInterval)
+	if err != nil {
+		return meiliError(err)
+	}
+	if task.Status != meilisearchgo.TaskStatusSucceeded {
+		return fmt.Errorf("meilisearch task %d %s: %s (%s)", taskUID, task.Status, task.Error.Message, task.Error.Code)
+	}
+	return nil
+}
+
+// waitIdle waits until every write queued on uid is processed and fails if
+// any task enqueued after since failed, so an incomplete index is never
+// swapped in
+func (m *MeiliAdapter) waitIdle(ctx context.Context, uid string, since time.Time) error {
+	for {
+		pending, err := m.client.GetTasksWithContext(ctx, &meilisearchgo.TasksQuery{
+			IndexUIDS: []string{uid},
+			Statuses:  []meilisearchgo.TaskStatus{meilisearchgo.TaskStatusEnqueued, meilisearchgo.TaskStatusProcessing},
+			Limit:     1,
+		})
+		if err != nil {
+			return meiliError(err)
+		}
+		if len(pending.Results) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(meiliTaskInterval):
+		}
+	}
+
+	failed, err := m.client.GetTasksWithContext(ctx, &meilisearchgo.TasksQuery{
+		IndexUIDS:       []string{uid},
+		Statuses:        []meilisearchgo.TaskStatus{meilisearchgo.TaskStatusFailed},
+		AfterEnqueuedAt: since,
+		Limit:           1,
+	})
+	if err != nil {
+		return meiliError(err)
+	}
+	if len(failed.Results) > 0 {
+		task := failed.Results[0]
+		return fmt.Errorf("meilisearch: write to %s failed: %s (%s)", uid, task.Error.Message, task.Error.Code)
+	}
+	return nil
+}
+
+// deleteIndex removes uid, treating a missing index as deleted
+func (m *MeiliAdapter) deleteIndex(ctx context.Context, uid string) error {
+	task, err := m.client.DeleteIndexWithContext(ctx, uid)
+	if meiliNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return meiliError(err)
+	}
+	done, err := m.client.WaitForTaskWithContext(ctx, task.TaskUID, meiliTaskInterval)
+	if err != nil {
+		return meiliError(err)
+	}
+	if done.Status != meilisearchgo.TaskStatusSucceeded && done.Error.Code != "index_not_found" {
+		return fmt.Errorf("meilisearch: deleting %s: %s", uid, done.Error.Message)
+	}
+	return nil
+}
+
+func (m *MeiliAdapter) primaryKey(indexName string) string {
+	if key, ok := m.primaryKeys.Load(indexName); ok {
+		return key.(string)
+	}
+	return DefaultPrimaryKey
+}
+
+func meiliNotFound(err error) bool {
+	var apiErr *meilisearchgo.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// meiliError turns the client's errors for responses and unreachable
+// servers into *EngineError, keeping the client's error to unwrap
+func meiliError(err error) error {
+	var apiErr *meilisearchgo.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrCode {
+	case meilisearchgo.MeilisearchApiError, meilisearchgo.MeilisearchApiErrorWithoutMessage:
+		message := apiErr.MeilisearchApiError.Message
+		if message == "" {
+			message = http.StatusText(apiErr.StatusCode)
+		}
+		e := NewEngineError("meilisearch", apiErr.StatusCode, apiErr.MeilisearchApiError.Code, message)
+		e.Err = err
+		return e
+	case meilisearchgo.MeilisearchTimeoutError:
+		// The context ended
+		return apiErr.OriginError
+	case meilisearchgo.MeilisearchCommunicationError:
+		return unreachable("meilisearch", apiErr.OriginError)
+	}
+	return err
+}
+
+// withPrimaryKey encodes doc as an object carrying docID in primaryKey. A
+// document that already has the attribute must agree with docID.
+func withPrimaryKey(doc interface{}, primaryKey, docID string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("search document must be a JSON object: %w", err)
+	}
+	if document == nil {
+		return nil, errors.New("search document must be a JSON object")
+	}
+
+	if raw, ok := document[primaryKey]; ok {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		var id string
+		switch v := value.(type) {
+		case string:
+			id = v
+		case float64:
+			id = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if id != docID {
+			return nil, fmt.Errorf("search document %s %q does not match id %q", primaryKey, id, docID)
+		}
+		return document, nil
+	}
+	encoded, err := json.Marshal(docID)
+	if err != nil {
+		return nil, err
+	}
+	document[primaryKey] = encoded
+	return document, nil
+}
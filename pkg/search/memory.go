@@ -0,0 +1,817 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MemoryEngine is an in-process Engine for local development, small
+// deployments and unit tests. Documents live in memory only, so the index is
+// empty after a restart until it is rebuilt.
+//
+// It follows the remote engines where they agree: every query term must
+// match (the last as a prefix, as typed), earlier searchable fields rank
+// higher, and filters, sorts and facets must use the fields an
+// IndexDefinition declares once EnsureIndex has run.
+type MemoryEngine struct {
+	mu      sync.RWMutex
+	indexes map[string]*memoryIndex
+	reindex reindexTargets
+}
+
+type memoryIndex struct {
+	def  *IndexDefinition // nil until EnsureIndex
+	docs map[string]*memoryDocument
+}
+
+type memoryDocument struct {
+	id     string
+	source map[string]interface{}
+	text   [][]string // tokens of each searchable field, most important first
+}
+
+func NewMemoryEngine() *MemoryEngine {
+	return &MemoryEngine{indexes: map[string]*memoryIndex{}}
+}
+
+func (m *MemoryEngine) Index(ctx context.Context, indexName string, docID string, doc interface{}) error {
+	return m.IndexBatch(ctx, indexName, []Document{{ID: docID, Doc: doc}}, nil)
+}
+
+func (m *MemoryEngine) Delete(ctx context.Context, indexName string, docID string) error {
+	return m.DeleteBatch(ctx, indexName, []string{docID}, nil)
+}
+
+// IndexBatch writes synchronously, so documents are searchable on return
+// whether or not opts asks to wait
+func (m *MemoryEngine) IndexBatch(ctx context.Context, indexName string, docs []Document, opts *WriteOptions) error {
+	var failed itemErrors
+	sources := make([]map[string]interface{}, len(docs))
+	for i, d := range docs {
+		source, err := memorySource(d.Doc)
+		if err != nil {
+			failed.add(d.ID, err.Error())
+			continue
+		}
+		sources[i] = source
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.reindex.indexes(indexName) {
+		index := m.index(name)
+		for i, d := range docs {
+			if sources[i] != nil {
+				index.put(d.ID, sources[i])
+			}
+		}
+	}
+	return failed.err()
+}
+
+func (m *MemoryEngine) DeleteBatch(ctx context.Context, indexName string, docIDs []string, opts *WriteOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.reindex.indexes(indexName) {
+		if index, ok := m.indexes[name]; ok {
+			for _, id := range docIDs {
+				delete(index.docs, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryEngine) DeleteByFilter(ctx context.Context, indexName string, filter Filter, opts *WriteOptions) error {
+	if filter == nil {
+		return ErrEmptyFilter
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.reindex.indexes(indexName) {
+		index, ok := m.indexes[name]
+		if !ok {
+			continue
+		}
+		if err := index.checkFilter(filter); err != nil {
+			return err
+		}
+		for id, doc := range index.docs {
+			matched, err := memoryMatch(filter, doc.source)
+			if err != nil {
+				return err
+			}
+			if matched {
+				delete(index.docs, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Search pages by position under cursors; scores are the memory engine's
+// own term weights
+func (m *MemoryEngine) Search(ctx context.Context, indexName string, query string, options *SearchOptions) (*SearchResult, error) {
+	opts, err := normalize(options)
+	if err != nil {
+		return nil, err
+	}
+	start, err := startCursor(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	index, ok := m.indexes[indexName]
+	if !ok {
+		return nil, memoryIndexNotFound(indexName)
+	}
+	if opts.Filter != nil {
+		if err := index.checkFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+	}
+	if err := index.checkSort(opts.Sort); err != nil {
+		return nil, err
+	}
+	for _, f := range opts.Facets {
+		if !index.filterable(f.Field) {
+			return nil, fmt.Errorf("%w: %q is not filterable", ErrInvalidFilter, f.Field)
+		}
+	}
+
+	terms := index.queryTerms(query)
+	type match struct {
+		doc   *memoryDocument
+		score int
+	}
+	var matches []match
+	for _, doc := range index.docs {
+		score, ok := memoryScore(doc, terms)
+		if !ok {
+			continue
+		}
+		if opts.Filter != nil {
+			matched, err := memoryMatch(opts.Filter, doc.source)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		matches = append(matches, match{doc: doc, score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		for _, s := range opts.Sort {
+			if c := memoryCompare(fieldValues(a.doc.source, s.Field), fieldValues(b.doc.source, s.Field), s.Desc); c != 0 {
+				return c < 0
+			}
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.doc.id < b.doc.id
+	})
+
+	result := &SearchResult{Hits: []Hit{}, Total: int64(len(matches))}
+	for i := start.Position; i < len(matches) && i < start.Position+opts.Limit; i++ {
+		doc := matches[i].doc
+		source, err := json.Marshal(doc.source)
+		if err != nil {
+			return nil, err
+		}
+		hit := Hit{ID: doc.id, Score: float64(matches[i].score), Source: source}
+		if len(terms) > 0 && len(opts.Highlight) > 0 {
+			marked := make(map[string][]string, len(opts.Highlight))
+			for _, field := range opts.Highlight {
+				for _, text := range fieldStrings(fieldValues(doc.source, field)) {
+					marked[field] = append(marked[field], cropSnippet(memoryHighlight(text, terms)))
+				}
+			}
+			hit.Highlights = highlights(marked)
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	result.NextCursor = start.next(len(result.Hits), start.remaining(len(result.Hits), result.Total), nil)
+
+	if len(opts.Facets) > 0 {
+		result.Facets = make(map[string][]FacetValue, len(opts.Facets))
+		for _, f := range opts.Facets {
+			if len(f.Ranges) == 0 {
+				counts := map[string]int64{}
+				for _, m := range matches {
+					seen := map[string]bool{}
+					for _, v := range fieldValues(m.doc.source, f.Field) {
+						if value, ok := memoryFacetValue(v); ok && !seen[value] {
+							seen[value] = true
+							counts[value]++
+						}
+					}
+				}
+				result.Facets[f.Field] = topValues(counts, f.Size)
+				continue
+			}
+			values := make([]FacetValue, len(f.Ranges))
+			for i, r := range f.Ranges {
+				values[i] = FacetValue{Value: r.key()}
+				for _, m := range matches {
+					matched, err := memoryMatch(r.filter(f.Field), m.doc.source)
+					if err != nil {
+						return nil, err
+					}
+					if matched {
+						values[i].Count++
+					}
+				}
+			}
+			result.Facets[f.Field] = values
+		}
+	}
+	return result, nil
+}
+
+// Suggest matches the words of the field like Search, and also accepts
+// typos within Meilisearch's budget, including in the prefix being typed
+func (m *MemoryEngine) Suggest(ctx context.Context, indexName string, prefix string, options *SuggestOptions) ([]Suggestion, error) {
+	opts, err := normalizeSuggest(options)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	index, ok := m.indexes[indexName]
+	if !ok {
+		return nil, memoryIndexNotFound(indexName)
+	}
+	if opts.Filter != nil {
+		if err := index.checkFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+	}
+	terms := index.queryTerms(prefix)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		doc   *memoryDocument
+		text  string
+		score int
+	}
+	var matches []match
+	for _, doc := range index.docs {
+		text := sourceText(doc.source, opts.Field)
+		score, ok := memorySuggestScore(memoryTokens(text), terms)
+		if !ok {
+			continue
+		}
+		if opts.Filter != nil {
+			matched, err := memoryMatch(opts.Filter, doc.source)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		matches = append(matches, match{doc: doc, text: text, score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].doc.id < matches[j].doc.id
+	})
+
+	result := suggestions{limit: opts.Limit}
+	for _, m := range matches {
+		result.add(m.doc.id, m.text, memoryHighlight(m.text, terms))
+		if result.full() {
+			break
+		}
+	}
+	return result.items, nil
+}
+
+// EnsureIndex creates the index and applies def to its documents; being in
+// memory, every change applies in place
+func (m *MemoryEngine) EnsureIndex(ctx context.Context, def IndexDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index(def.Name).define(def)
+	return nil
+}
+
+// Reindex fills a fresh index and replaces the live one with it
+func (m *MemoryEngine) Reindex(ctx context.Context, def IndexDefinition, fill func(ctx context.Context, target string) error) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	target := def.Name + "_reindex"
+	m.mu.Lock()
+	staging := &memoryIndex{docs: map[string]*memoryDocument{}}
+	staging.define(def)
+	m.indexes[target] = staging
+	m.reindex.set(def.Name, target)
+	m.mu.Unlock()
+
+	err := fill(ctx, target)
+
+	// Writes look up their targets under m.mu, so none can land between the
+	// swap and the end of dual writes
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reindex.clear(def.Name)
+	delete(m.indexes, target)
+	if err != nil {
+		return err
+	}
+	m.indexes[def.Name] = staging
+	return nil
+}
+
+// memoryIndexNotFound is the error the remote engines return for a missing
+// index, so callers handle ErrIndexNotFound alike
+func memoryIndexNotFound(name string) error {
+	return NewEngineError("memory", 0, "index_not_found", fmt.Sprintf("index %q not found", name))
+}
+
+// index returns the named index, creating it like the remote engines do on
+// the first write; m.mu must be held for writing
+func (m *MemoryEngine) index(name string) *memoryIndex {
+	index, ok := m.indexes[name]
+	if !ok {
+		index = &memoryIndex{docs: map[string]*memoryDocument{}}
+		m.indexes[name] = index
+	}
+	return index
+}
+
+func (x *memoryIndex) define(def IndexDefinition) {
+	c := def.canonical()
+	x.def = &c
+	for id, doc := range x.docs {
+		x.put(id, doc.source)
+	}
+}
+
+func (x *memoryIndex) put(id string, source map[string]interface{}) {
+	doc := &memoryDocument{id: id, source: source}
+	if x.def != nil && len(x.def.Searchable) > 0 {
+		for _, field := range x.def.Searchable {
+			doc.text = append(doc.text, memoryTokens(strings.Join(fieldStrings(fieldValues(source, field)), " ")))
+		}
+	} else {
+		doc.text = [][]string{memoryTokens(strings.Join(fieldStrings([]interface{}{source}), " "))}
+	}
+	x.docs[id] = doc
+}
+
+// queryTerms tokenizes the query, dropping stop words and expanding each
+// term with its synonyms
+func (x *memoryIndex) queryTerms(query string) [][]string {
+	var terms [][]string
+	for _, token := range memoryTokens(query) {
+		if x.def != nil && memoryContainsFold(x.def.StopWords, token) {
+			continue
+		}
+		alternatives := []string{token}
+		if x.def != nil {
+			for word, synonyms := range x.def.Synonyms {
+				if strings.ToLower(word) == token {
+					for _, s := range synonyms {
+						alternatives = append(alternatives, memoryTokens(s)...)
+					}
+				}
+			}
+		}
+		terms = append(terms, alternatives)
+	}
+	return terms
+}
+
+func (x *memoryIndex) filterable(field string) bool {
+	return x.def == nil || memoryCovers(x.def.Filterable, field)
+}
+
+func (x *memoryIndex) checkFilter(f Filter) error {
+	switch f := f.(type) {
+	case EqFilter:
+		return x.checkFilterable(f.Field)
+	case InFilter:
+		return x.checkFilterable(f.Field)
+	case RangeFilter:
+		return x.checkFilterable(f.Field)
+	case ExistsFilter:
+		return x.checkFilterable(f.Field)
+	case AndFilter:
+		return x.checkFilters(f.Filters)
+	case OrFilter:
+		return x.checkFilters(f.Filters)
+	case NotFilter:
+		if f.Filter == nil {
+			return fmt.Errorf("%w: not without operand", ErrInvalidFilter)
+		}
+		return x.checkFilter(f.Filter)
+	}
+	return fmt.Errorf("%w: unsupported filter %T", ErrInvalidFilter, f)
+}
+
+func (x *memoryIndex) checkFilters(filters []Filter) error {
+	if len(filters) == 0 {
+		return fmt.Errorf("%w: empty compound filter", ErrInvalidFilter)
+	}
+	for _, f := range filters {
+		if err := x.checkFilter(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *memoryIndex) checkFilterable(field string) error {
+	if err := checkField(field); err != nil {
+		return err
+	}
+	if !x.filterable(field) {
+		return fmt.Errorf("%w: %q is not filterable", ErrInvalidFilter, field)
+	}
+	return nil
+}
+
+func (x *memoryIndex) checkSort(sort []SortField) error {
+	for _, s := range sort {
+		if x.def != nil && !memoryCovers(x.def.Sortable, s.Field) {
+			return fmt.Errorf("%w: %q is not sortable", ErrInvalidSort, s.Field)
+		}
+	}
+	return nil
+}
+
+// memorySource stores a document as its JSON object, so filters see the
+// same attribute names and values as the remote engines
+func memorySource(doc interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var source map[string]interface{}
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, fmt.Errorf("search document must be a JSON object: %w", err)
+	}
+	if source == nil {
+		return nil, errors.New("search document must be a JSON object")
+	}
+	return source, nil
+}
+
+// memoryScore requires every term to match a token, the last one also as a
+// prefix; earlier fields and exact matches score higher
+func memoryScore(doc *memoryDocument, terms [][]string) (int, bool) {
+	score := 0
+	for i, alternatives := range terms {
+		prefix := i == len(terms)-1
+		best := 0
+		for f, tokens := range doc.text {
+			weight := len(doc.text) - f
+			for _, token := range tokens {
+				for _, term := range alternatives {
+					switch {
+					case token == term:
+						best = max(best, 2*weight)
+					case prefix && strings.HasPrefix(token, term):
+						best = max(best, weight)
+					}
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score, true
+}
+
+// memorySuggestScore requires every term to match a token, tolerating typos
+func memorySuggestScore(tokens []string, terms [][]string) (int, bool) {
+	score := 0
+	for i, alternatives := range terms {
+		best := 0
+		for _, token := range tokens {
+			for _, term := range alternatives {
+				best = max(best, memoryTermScore(token, term, i == len(terms)-1))
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score, true
+}
+
+// memoryTermScore rates how token matches term: exactly, as a prefix of the
+// last term, or within the typo budget of term
+func memoryTermScore(token, term string, prefix bool) int {
+	switch {
+	case token == term:
+		return 3
+	case prefix && strings.HasPrefix(token, term):
+		return 2
+	}
+	budget := typoBudget(term)
+	if budget == 0 {
+		return 0
+	}
+	if levenshtein(token, term) <= budget {
+		return 1
+	}
+	if runes := []rune(token); prefix && len(runes) > len([]rune(term)) &&
+		levenshtein(string(runes[:len([]rune(term))]), term) <= budget {
+		return 1
+	}
+	return 0
+}
+
+// memoryHighlight marks the words of text that match a term, splitting words
+// the way memoryTokens does
+func memoryHighlight(text string, terms [][]string) string {
+	var out strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		start = -1
+		token := strings.ToLower(word)
+		for i, alternatives := range terms {
+			for _, term := range alternatives {
+				if memoryTermScore(token, term, i == len(terms)-1) > 0 {
+					out.WriteString(highlightPre + word + highlightPost)
+					return
+				}
+			}
+		}
+		out.WriteString(word)
+	}
+	for i, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush(i)
+			start = i
+			flush(i + utf8.RuneLen(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+			out.WriteRune(r)
+		}
+	}
+	flush(len(text))
+	return out.String()
+}
+
+// levenshtein counts the rune edits between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// memoryTokens lowercases text and splits it into words; every Han character
+// is a word of its own, as unsegmented Chinese has no separators
+func memoryTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// memoryMatch evaluates f against a document; a multi-valued field matches
+// when any of its values does
+func memoryMatch(f Filter, source map[string]interface{}) (bool, error) {
+	switch f := f.(type) {
+	case EqFilter:
+		return memoryAny(source, f.Field, []interface{}{f.Value})
+	case InFilter:
+		if len(f.Values) == 0 {
+			return false, fmt.Errorf("%w: in on %q has no values", ErrInvalidFilter, f.Field)
+		}
+		return memoryAny(source, f.Field, f.Values)
+	case RangeFilter:
+		bounds, err := rangeBounds(f)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range fieldValues(source, f.Field) {
+			n, ok := memoryNumber(v)
+			if !ok {
+				continue
+			}
+			in := true
+			for _, b := range bounds {
+				limit, _ := memoryNumber(b.value)
+				switch b.op {
+				case "gt":
+					in = in && n > limit
+				case "gte":
+					in = in && n >= limit
+				case "lt":
+					in = in && n < limit
+				case "lte":
+					in = in && n <= limit
+				}
+			}
+			if in {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ExistsFilter:
+		return len(fieldValues(source, f.Field)) > 0, nil
+	case AndFilter:
+		for _, sub := range f.Filters {
+			matched, err := memoryMatch(sub, source)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case OrFilter:
+		for _, sub := range f.Filters {
+			matched, err := memoryMatch(sub, source)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	case NotFilter:
+		matched, err := memoryMatch(f.Filter, source)
+		return !matched, err
+	}
+	return false, fmt.Errorf("%w: unsupported filter %T", ErrInvalidFilter, f)
+}
+
+func memoryAny(source map[string]interface{}, field string, wanted []interface{}) (bool, error) {
+	values := fieldValues(source, field)
+	for _, w := range wanted {
+		want, err := scalar(w)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if memoryEqual(v, want) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func memoryEqual(v, want interface{}) bool {
+	switch want := want.(type) {
+	case string:
+		s, ok := v.(string)
+		return ok && s == want
+	case bool:
+		b, ok := v.(bool)
+		return ok && b == want
+	}
+	n, ok := memoryNumber(v)
+	w, _ := memoryNumber(want)
+	return ok && n == w
+}
+
+func memoryNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// memoryCompare orders by the first value of a field, numbers before
+// strings; documents without the field sort last in both directions
+func memoryCompare(a, b []interface{}, desc bool) int {
+	if len(a) == 0 || len(b) == 0 {
+		return len(b) - len(a)
+	}
+	c := 0
+	an, aNum := memoryNumber(a[0])
+	bn, bNum := memoryNumber(b[0])
+	as, _ := a[0].(string)
+	bs, _ := b[0].(string)
+	switch {
+	case aNum && bNum:
+		c = compareOrdered(an, bn)
+	case aNum != bNum:
+		if aNum {
+			return -1
+		}
+		return 1
+	default:
+		c = strings.Compare(as, bs)
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// memoryFacetValue prints a facet value the way Meilisearch does
+func memoryFacetValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// memoryCovers reports whether field or one of its parents is in fields
+func memoryCovers(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field || strings.HasPrefix(field, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func memoryContainsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testProduct struct {
+	ID      uint                `json:"id"`
+	ShopID  uint                `json:"shop_id"`
+	Title   string              `json:"title"`
+	Body    string              `json:"body"`
+	Price   float64             `json:"price"`
+	Status  string              `json:"status"`
+	Options map[string][]string `json:"options"`
+}
+
+var testProducts = IndexDefinition{
+	Name:       "products",
+	Fields:     map[string]FieldType{"title": FieldText, "body": FieldText, "status": FieldKeyword},
+	Searchable: []string{"title", "body"},
+	Filterable: []string{"shop_id", "status", "price", "options"},
+	Sortable:   []string{"price", "id"},
+	Synonyms:   map[string][]string{"sneaker": {"trainer"}},
+	StopWords:  []string{"the"},
+}
+
+func newTestEngine(t *testing.T) *MemoryEngine {
+	t.Helper()
+	ctx := context.Background()
+	engine := NewMemoryEngine()
+	if err := engine.EnsureIndex(ctx, testProducts); err != nil {
+		t.Fatal(err)
+	}
+	docs := []Document{
+		{ID: "1", Doc: testProduct{ID: 1, ShopID: 1, Title: "Red running shoe", Body: "Light trainer", Price: 80, Status: "active",
+			Options: map[string][]string{"color": {"Red"}, "size": {"40", "41"}}}},
+		{ID: "2", Doc: testProduct{ID: 2, ShopID: 1, Title: "Blue running shoe", Body: "Cushioned", Price: 120, Status: "active",
+			Options: map[string][]string{"color": {"Blue"}, "size": {"41"}}}},
+		{ID: "3", Doc: testProduct{ID: 3, ShopID: 1, Title: "Wool socks", Body: "Warm socks for running", Price: 15, Status: "active",
+			Options: map[string][]string{"color": {"Red", "Grey"}}}},
+		{ID: "4", Doc: testProduct{ID: 4, ShopID: 1, Title: "Old shoe", Price: 60, Status: "archived"}},
+		{ID: "5", Doc: testProduct{ID: 5, ShopID: 2, Title: "Red running shoe", Price: 90, Status: "active"}},
+	}
+	if err := engine.IndexBatch(ctx, testProducts.Name, docs, nil); err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func hitIDs(result *SearchResult) []string {
+	ids := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+func TestMemorySearch(t *testing.T) {
+	engine := newTestEngine(t)
+	shop := And(Eq("shop_id", 1), Eq("status", "active"))
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  []string
+		total int64
+	}{
+		{"title ranks above body", "running", SearchOptions{Filter: shop}, []string{"1", "2", "3"}, 3},
+		{"every term must match", "red shoe", SearchOptions{Filter: shop}, []string{"1"}, 1},
+		{"last term matches as prefix", "running sho", SearchOptions{Filter: shop}, []string{"1", "2"}, 2},
+		{"synonyms", "sneaker", SearchOptions{Filter: shop}, []string{"1"}, 1},
+		{"stop words are dropped", "the socks", SearchOptions{Filter: shop}, []string{"3"}, 1},
+		{"empty query matches all", "", SearchOptions{Filter: shop, Sort: []SortField{Asc("price")}}, []string{"3", "1", "2"}, 3},
+		{"sort descending", "", SearchOptions{Filter: shop, Sort: []SortField{Desc("price")}}, []string{"2", "1", "3"}, 3},
+		{"range", "", SearchOptions{Filter: And(shop, Between("price", 50, 100))}, []string{"1"}, 1},
+		{"in", "shoe", SearchOptions{Filter: And(In("shop_id", 1, 2), Eq("status", "active")), Sort: []SortField{Desc("price")}}, []string{"2", "5", "1"}, 3},
+		{"nested option", "", SearchOptions{Filter: And(shop, Eq("options.color", "Red")), Sort: []SortField{Asc("price")}}, []string{"3", "1"}, 2},
+		{"not", "", SearchOptions{Filter: And(shop, Not(Eq("options.color", "Red")))}, []string{"2"}, 1},
+		{"or", "", SearchOptions{Filter: And(Eq("shop_id", 1), Or(Eq("status", "archived"), Lt("price", 20))), Sort: []SortField{Asc("id")}}, []string{"3", "4"}, 2},
+		{"exists", "", SearchOptions{Filter: And(shop, Exists("options.size")), Sort: []SortField{Asc("id")}}, []string{"1", "2"}, 2},
+		{"limit and offset", "", SearchOptions{Filter: shop, Sort: []SortField{Asc("price")}, Limit: 1, Offset: 1}, []string{"1"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Search(context.Background(), testProducts.Name, tt.query, &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hitIDs(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hits = %v, want %v", got, tt.want)
+			}
+			if result.Total != tt.total {
+				t.Errorf("total = %d, want %d", result.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestMemorySearchRejectsUndeclaredFields(t *testing.T) {
+	engine := newTestEngine(t)
+	ctx := context.Background()
+	if _, err := engine.Search(ctx, testProducts.Name, "", &SearchOptions{Filter: Eq("title", "x")}); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("filter on title: got %v, want ErrInvalidFilter", err)
+	}
+	if _, err := engine.Search(ctx, testProducts.Name, "", &SearchOptions{Sort: []SortField{Asc("status")}}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("sort on status: got %v, want ErrInvalidSort", err)
+	}
+	if _, err := engine.Search(ctx, testProducts.Name, "", &SearchOptions{Facets: []Facet{TermsFacet("title", 0)}}); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("facet on title: got %v, want ErrInvalidFilter", err)
+	}
+	if _, err := engine.Search(ctx, "missing", "", nil); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("missing index: got %v, want ErrIndexNotFound", err)
+	}
+	var engineErr *EngineError
+	if _, err := engine.Suggest(ctx, "missing", "sh", &SuggestOptions{Field: "title"}); !errors.As(err, &engineErr) || engineErr.Kind != ErrIndexNotFound {
+		t.Errorf("suggest on a missing index: got %v, want an EngineError of ErrIndexNotFound", err)
+	}
+}
+
+func TestMemoryFacets(t *testing.T) {
+	engine := newTestEngine(t)
+	result, err := engine.Search(context.Background(), testProducts.Name, "", &SearchOptions{
+		Filter: And(Eq("shop_id", 1), Eq("status", "active")),
+		Limit:  1,
+		Facets: []Facet{TermsFacet("options.color", 2), RangeFacet("price", 50, 100)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]FacetValue{
+		// Counted over every match, not the page; Grey is cut by the size
+		"options.color": {{Value: "Red", Count: 2}, {Value: "Blue", Count: 1}},
+		"price":         {{Value: "*-50", Count: 1}, {Value: "50-100", Count: 1}, {Value: "100-*", Count: 1}},
+	}
+	if !reflect.DeepEqual(result.Facets, want) {
+		t.Errorf("facets = %v, want %v", result.Facets, want)
+	}
+}
+
+func TestMemoryCursor(t *testing.T) {
+	engine := newTestEngine(t)
+	opts := SearchOptions{Filter: Eq("status", "active"), Sort: []SortField{Asc("price")}, Limit: 2}
+	var got []string
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatal("cursor does not end")
+		}
+		result, err := engine.Search(context.Background(), testProducts.Name, "", &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, hitIDs(result)...)
+		if result.NextCursor == "" {
+			break
+		}
+		opts.Cursor = result.NextCursor
+	}
+	if want := []string{"3", "1", "5", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+
+	// A cursor only continues the search it came from
+	first, err := engine.Search(context.Background(), testProducts.Name, "", &SearchOptions{Sort: []SortField{Asc("price")}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = engine.Search(context.Background(), testProducts.Name, "", &SearchOptions{Sort: []SortField{Desc("price")}, Cursor: first.NextCursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor of another sort: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestMemoryDelete(t *testing.T) {
+	engine := newTestEngine(t)
+	ctx := context.Background()
+	if err := engine.DeleteByFilter(ctx, testProducts.Name, nil, nil); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("delete without filter: got %v, want ErrEmptyFilter", err)
+	}
+	if err := engine.DeleteByFilter(ctx, testProducts.Name, Eq("shop_id", 2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Delete(ctx, testProducts.Name, "4"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Search(ctx, testProducts.Name, "", &SearchOptions{Sort: []SortField{Asc("id")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hitIDs(result), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hits = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryReindex(t *testing.T) {
+	engine := newTestEngine(t)
+	ctx := context.Background()
+	err := engine.Reindex(ctx, testProducts, func(ctx context.Context, target string) error {
+		if err := engine.Index(ctx, target, "10", testProduct{ID: 10, ShopID: 1, Title: "Rebuilt shoe", Status: "active"}); err != nil {
+			return err
+		}
+		// Writes to the live index during the rebuild reach the new one too
+		if err := engine.Index(ctx, testProducts.Name, "11", testProduct{ID: 11, ShopID: 1, Title: "Live shoe", Status: "active"}); err != nil {
+			return err
+		}
+		// Searches keep using the old index until the swap
+		result, err := engine.Search(ctx, testProducts.Name, "rebuilt", nil)
+		if err != nil {
+			return err
+		}
+		if result.Total != 0 {
+			t.Errorf("old index found %v during the rebuild", hitIDs(result))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.Search(ctx, testProducts.Name, "", &SearchOptions{Sort: []SortField{Asc("id")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hitIDs(result), []string{"10", "11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hits = %v, want %v", got, want)
+	}
+
+	failed := errors.New("fill failed")
+	if err := engine.Reindex(ctx, testProducts, func(ctx context.Context, target string) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("got %v, want the fill error", err)
+	}
+	if result, err = engine.Search(ctx, testProducts.Name, "", nil); err != nil || result.Total != 2 {
+		t.Errorf("failed rebuild replaced the index: %v, %v", result, err)
+	}
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSuggestLimit applies when SuggestOptions.Limit is not positive
+const DefaultSuggestLimit = 5
+
+// Highlighted text marks matches with these tags; everything else is escaped
+const (
+	HighlightPreTag  = "<em>"
+	HighlightPostTag = "</em>"
+)
+
+// Adapters ask the engines for these private-use characters, which never
+// occur in text, and turn them into tags after escaping the text
+const (
+	highlightPre  = "\uE000"
+	highlightPost = "\uE001"
+)
+
+// SuggestOptions selects what Suggest completes
+type SuggestOptions struct {
+	Field  string // the text attribute to complete, such as a title
+	Limit  int
+	Filter Filter // optional; see Eq, In, And, ...
+}
+
+// Suggestion is one completion of the typed prefix, taken from a document
+type Suggestion struct {
+	ID          string `json:"id"`          // the document the text comes from
+	Text        string `json:"text"`        // the field's plain value
+	Highlighted string `json:"highlighted"` // HTML-escaped, matches wrapped in HighlightPreTag/HighlightPostTag
+}
+
+func normalizeSuggest(options *SuggestOptions) (SuggestOptions, error) {
+	var opts SuggestOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultSuggestLimit
+	}
+	return opts, checkField(opts.Field)
+}
+
+// renderHighlight escapes text marked with the private markers and turns the
+// markers into highlight tags
+func renderHighlight(marked string) string {
+	return strings.NewReplacer(highlightPre, HighlightPreTag, highlightPost, HighlightPostTag).
+		Replace(html.EscapeString(marked))
+}
+
+// suggestions keeps the first suggestion of each text, as many documents
+// (variants of one product, say) often share a title
+type suggestions struct {
+	limit int
+	items []Suggestion
+	seen  map[string]bool
+}
+
+func (s *suggestions) add(id, text, marked string) {
+	key := strings.ToLower(strings.TrimSpace(text))
+	if key == "" || len(s.items) >= s.limit || s.seen[key] {
+		return
+	}
+	if s.seen == nil {
+		s.seen = map[string]bool{}
+	}
+	s.seen[key] = true
+	if marked == "" {
+		marked = text
+	}
+	s.items = append(s.items, Suggestion{ID: id, Text: text, Highlighted: renderHighlight(marked)})
+}
+
+func (s *suggestions) full() bool {
+	return len(s.items) >= s.limit
+}
+
+// sourceText is the text of field in a decoded document
+func sourceText(source map[string]interface{}, field string) string {
+	return strings.Join(fieldStrings(fieldValues(source, field)), " ")
+}
+
+// typoBudget is how many typos a term of that length tolerates, following
+// Meilisearch's defaults
+func typoBudget(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n >= 9:
+		return 2
+	case n >= 5:
+		return 1
+	}
+	return 0
+}
+
+// fieldValues returns the leaf values at a dotted path, flattening arrays
+// on the way like both engines do for filters
+func fieldValues(v interface{}, path string) []interface{} {
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, ".")
+	}
+	var out []interface{}
+	var walk func(v interface{}, parts []string)
+	walk = func(v interface{}, parts []string) {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			for _, e := range v {
+				walk(e, parts)
+			}
+		case map[string]interface{}:
+			if len(parts) == 0 {
+				out = append(out, v)
+				return
+			}
+			walk(v[parts[0]], parts[1:])
+		default:
+			if len(parts) == 0 {
+				out = append(out, v)
+			}
+		}
+	}
+	walk(v, parts)
+	return out
+}
+
+// fieldStrings collects every string in values, including nested ones
+func fieldStrings(values []interface{}) []string {
+	var out []string
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			out = append(out, v)
+		case map[string]interface{}:
+			for _, e := range v {
+				out = append(out, fieldStrings([]interface{}{e})...)
+			}
+		case []interface{}:
+			out = append(out, fieldStrings(v)...)
+		}
+	}
+	return out
+}
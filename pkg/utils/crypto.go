@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,3 +19,15 @@ func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// HMACSign returns the hex encoded HMAC-SHA256 of payload
+func HMACSign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACVerify checks signature against payload in constant time
+func HMACVerify(secret, payload, signature string) bool {
+	return hmac.Equal([]byte(HMACSign(secret, payload)), []byte(signature))
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token scopes: who the subject is and what the token grants
+const (
+	// ScopeCustomer tokens identify a buyer of ShopID. Tokens issued before
+	// scopes existed have none and are customer tokens.
+	ScopeCustomer = "customer"
+	// ScopeStaff tokens identify a platform user working on ShopID
+	ScopeStaff = "staff"
+	// ScopePlatform tokens identify a platform administrator; ShopID is 0
+	ScopePlatform = "platform"
+)
+
+// Claims is the JWT payload issued to shop customers, shop staff and
+// platform administrators
+type Claims struct {
+	ShopID uint   `json:"shop_id"`
+	Scope  string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken signs an HS256 token of scope for subject within shopID
+func GenerateToken(secret, scope string, shopID, subject uint, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		ShopID: shopID,
+		Scope:  scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(subject), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// ParseToken validates the signature and expiry of a token and returns its claims
+func ParseToken(secret string, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// HasScope reports whether the claims were issued for scope
+func (c *Claims) HasScope(scope string) bool {
+	return c.Scope == scope || c.Scope == "" && scope == ScopeCustomer
+}
+
+// SubjectID returns the numeric subject of the claims
+func (c *Claims) SubjectID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id), err
+}